@@ -0,0 +1,99 @@
+// Package audit emits machine-parseable records of session lifecycle events.
+//
+// Records are defined as the AuditRecord protobuf message (see audit.proto)
+// and delivered to a Sink. They identify sessions by subject and token id
+// only: credentials never appear in a record.
+package audit
+
+import (
+	"bufio"
+	"os"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Sink receives audit records.
+type Sink interface {
+	Emit(r *AuditRecord) error
+}
+
+// FileSink appends audit records to a file, one JSON document per line
+// following the proto3 JSON mapping.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+	m  jsonpb.Marshaler
+}
+
+// NewFileSink opens, creating it if needed, the file at path for appending
+// audit records.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{
+		f: f,
+		w: bufio.NewWriter(f),
+		m: jsonpb.Marshaler{OrigName: true},
+	}, nil
+}
+
+// Emit writes the given record to the file. Records are flushed right away so
+// none is lost if the process dies.
+func (fs *FileSink) Emit(r *AuditRecord) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.m.Marshal(fs.w, r); err != nil {
+		return err
+	}
+	if err := fs.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return fs.w.Flush()
+}
+
+// Close flushes pending records to disk and closes the file.
+func (fs *FileSink) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.w.Flush(); err != nil {
+		fs.f.Close()
+		return err
+	}
+	if err := fs.f.Sync(); err != nil {
+		fs.f.Close()
+		return err
+	}
+	return fs.f.Close()
+}
+
+// MemorySink keeps audit records in memory. It is meant to be used as a test
+// double.
+type MemorySink struct {
+	mu      sync.Mutex
+	records []*AuditRecord
+}
+
+// Emit stores a copy of the given record.
+func (ms *MemorySink) Emit(r *AuditRecord) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.records = append(ms.records, proto.Clone(r).(*AuditRecord))
+	return nil
+}
+
+// Records returns the records emitted so far.
+func (ms *MemorySink) Records() []*AuditRecord {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return append([]*AuditRecord(nil), ms.records...)
+}
@@ -0,0 +1,97 @@
+package audit_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-toschool/palermo/audit"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+var records = []*audit.AuditRecord{
+	{Event: audit.AuditRecord_CREATED, Subject: "42", Jti: "t1", Timestamp: 1546300800, Actor: "ip:203.0.113.7"},
+	{Event: audit.AuditRecord_VALIDATED, Outcome: audit.AuditRecord_FAILURE, Timestamp: 1546300801, Error: "token is expired"},
+	{Event: audit.AuditRecord_REVOKED, Subject: "42", Jti: "t1", Timestamp: 1546300802, Client: "spiffe://example.com/gateway"},
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	// Records are appended across reopenings.
+	for _, batch := range [][]*audit.AuditRecord{records[:1], records[1:]} {
+		fs, err := audit.NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range batch {
+			if err := fs.Emit(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := fs.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("file mode %v, %v", fi.Mode(), err)
+	}
+
+	var got []*audit.AuditRecord
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		r := new(audit.AuditRecord)
+		if err := jsonpb.UnmarshalString(s.Text(), r); err != nil {
+			t.Fatalf("line %q: %v", s.Text(), err)
+		}
+		if !strings.Contains(s.Text(), `"event":`) {
+			t.Errorf("line %q does not use the original field names", s.Text())
+		}
+		got = append(got, r)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("read %d records, want %d", len(got), len(records))
+	}
+	for i := range records {
+		if !proto.Equal(got[i], records[i]) {
+			t.Errorf("record %d = %v, want %v", i, got[i], records[i])
+		}
+	}
+}
+
+func TestMemorySink(t *testing.T) {
+	ms := &audit.MemorySink{}
+	for _, r := range records {
+		r := proto.Clone(r).(*audit.AuditRecord)
+		if err := ms.Emit(r); err != nil {
+			t.Fatal(err)
+		}
+		// Records are stored as emitted.
+		r.Subject = "changed"
+	}
+
+	got := ms.Records()
+	if len(got) != len(records) {
+		t.Fatalf("got %d records, want %d", len(got), len(records))
+	}
+	for i := range records {
+		if !proto.Equal(got[i], records[i]) {
+			t.Errorf("record %d = %v, want %v", i, got[i], records[i])
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Package breaker implements a palermo.SessionService decorator that stops
+// hitting a failing backend.
+//
+// The breaker starts closed and lets every read through. After Threshold
+// consecutive failures it opens and fails fast for Cooldown, after which a
+// single probe is let through (half-open): a successful probe closes the
+// breaker again, a failed one re-opens it. Calls abandoned by their caller,
+// cancelled or past the caller's deadline, tell nothing of the backend and are
+// not counted, and a probe abandoned so is retried by the next call. Calls
+// panicking count as failures.
+package breaker
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultThreshold is the number of consecutive failures opening the breaker
+// when no Threshold is set.
+const DefaultThreshold = 5
+
+// ErrOpen is returned by reads while the breaker is open and no fallback is
+// configured.
+var ErrOpen = errors.New("breaker: circuit open")
+
+// State represents the state of the circuit breaker.
+type State int
+
+// Circuit breaker states.
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// SessionService decorates a palermo.SessionService with a circuit breaker
+// around the backend reads (Session and RefreshSession). Writes are passed
+// through untouched.
+type SessionService struct {
+	palermo.SessionService
+
+	// Threshold is the number of consecutive failures that opens the
+	// breaker. Defaults to DefaultThreshold.
+	Threshold int
+
+	// Cooldown is how long the breaker stays open before probing the
+	// backend again.
+	Cooldown time.Duration
+
+	// Fallback serves reads while the breaker is open (fail-open). When nil,
+	// reads fail fast with ErrOpen (fail-closed).
+	Fallback palermo.SessionService
+
+	// IsFailure reports whether an error returned by the backend counts as a
+	// failure. Defaults to IsBackendFailure, so that invalid credentials
+	// never open the breaker. Calls abandoned by their caller are never
+	// failures.
+	IsFailure func(error) bool
+
+	// OnStateChange, when set, is called on every state transition, e.g. to
+	// export the breaker state as a metric. It is called with the breaker
+	// locked and must not call back into it.
+	OnStateChange func(from, to State)
+
+	// Metrics records the state of the breaker in the palermo_breaker_state
+	// gauge (0 closed, 1 open, 2 half-open) and counts its transitions.
+	// Defaults to palermo.NopMetrics.
+	Metrics palermo.Metrics
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// State returns the current state of the breaker.
+func (s *SessionService) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Session validates the given credentials through the backend unless the
+// breaker is open.
+func (s *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	probe, ok := s.allow()
+	if !ok {
+		if s.Fallback != nil {
+			return s.Fallback.Session(ctx, c)
+		}
+		return nil, ErrOpen
+	}
+
+	return s.call(ctx, probe, func() (*palermo.Session, error) {
+		return s.SessionService.Session(ctx, c)
+	})
+}
+
+// RefreshSession refreshes the given credentials through the backend unless
+// the breaker is open.
+func (s *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	probe, ok := s.allow()
+	if !ok {
+		if s.Fallback != nil {
+			return s.Fallback.RefreshSession(ctx, c)
+		}
+		return nil, ErrOpen
+	}
+
+	return s.call(ctx, probe, func() (*palermo.Session, error) {
+		return s.SessionService.RefreshSession(ctx, c)
+	})
+}
+
+// call runs fn, a backend call let through by allow, and records its outcome
+// even when fn panics.
+func (s *SessionService) call(ctx context.Context, probe bool, fn func() (*palermo.Session, error)) (us *palermo.Session, err error) {
+	panicked := true
+	defer func() {
+		switch {
+		case panicked:
+			s.record(failure, probe)
+		case err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled)):
+			s.record(abandoned, probe)
+		case err != nil && s.isFailure(err):
+			s.record(failure, probe)
+		default:
+			s.record(success, probe)
+		}
+	}()
+
+	us, err = fn()
+	panicked = false
+	return us, err
+}
+
+// outcome is the outcome of a backend call.
+type outcome int
+
+const (
+	success outcome = iota
+	failure
+	// abandoned calls were cancelled or timed out by their caller, before
+	// the backend could tell whether it is healthy.
+	abandoned
+)
+
+// allow reports whether a call may reach the backend, and whether it is the
+// probe of the half-open breaker.
+func (s *SessionService) allow() (probe, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case Open:
+		if s.now().Sub(s.openedAt) < s.Cooldown {
+			return false, false
+		}
+		s.setState(HalfOpen)
+		s.probing = true
+		return true, true
+	case HalfOpen:
+		// Only a single probe is in flight while half-open.
+		if s.probing {
+			return false, false
+		}
+		s.probing = true
+		return true, true
+	}
+	return false, true
+}
+
+// record records the outcome of a call. Only the probe closes or re-opens
+// the breaker once it opened: calls started before are ignored. An abandoned
+// probe leaves the breaker half-open, for the next call to probe.
+func (s *SessionService) record(o outcome, probe bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if probe {
+		s.probing = false
+		switch o {
+		case failure:
+			s.openedAt = s.now()
+			s.setState(Open)
+		case success:
+			s.failures = 0
+			s.setState(Closed)
+		}
+		return
+	}
+	if s.state != Closed || o == abandoned {
+		return
+	}
+
+	if o == success {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.failures >= s.threshold() {
+		s.openedAt = s.now()
+		s.setState(Open)
+	}
+}
+
+func (s *SessionService) setState(to State) {
+	from := s.state
+	if from == to {
+		return
+	}
+	s.state = to
+
+	s.metrics().SetGauge("palermo_breaker_state", float64(to), nil)
+	s.metrics().IncCounter("palermo_breaker_transitions_total", map[string]string{
+		"from": from.String(),
+		"to":   to.String(),
+	})
+	if s.OnStateChange != nil {
+		s.OnStateChange(from, to)
+	}
+}
+
+func (s *SessionService) isFailure(err error) bool {
+	if s.IsFailure == nil {
+		return IsBackendFailure(err)
+	}
+	return s.IsFailure(err)
+}
+
+// IsBackendFailure reports whether err was caused by the backend or the
+// transport to it rather than by the credentials: network errors, timeouts,
+// broken database connections and unavailable gRPC services. Errors
+// rejecting the credentials, e.g. malformed, expired or unknown ones, are
+// not failures. The SessionService only consults it for calls whose caller
+// is still waiting, so a context.DeadlineExceeded is the backend's own.
+func IsBackendFailure(err error) bool {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &netErr):
+		return true
+	}
+
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SessionService) threshold() int {
+	if s.Threshold <= 0 {
+		return DefaultThreshold
+	}
+	return s.Threshold
+}
+
+func (s *SessionService) metrics() palermo.Metrics {
+	if s.Metrics == nil {
+		return palermo.NopMetrics{}
+	}
+	return s.Metrics
+}
+
+func (s *SessionService) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
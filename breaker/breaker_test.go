@@ -0,0 +1,333 @@
+package breaker_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/breaker"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/palermotest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errBackend = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func TestSessionServiceTransitions(t *testing.T) {
+	type step struct {
+		after     time.Duration // clock advance before the call
+		fail      bool          // backend result
+		wantErr   error
+		wantState breaker.State
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{"stays closed below threshold", 3, []step{
+			{0, true, errBackend, breaker.Closed},
+			{0, true, errBackend, breaker.Closed},
+			{0, false, nil, breaker.Closed},
+			{0, true, errBackend, breaker.Closed},
+		}},
+		{"opens at threshold", 2, []step{
+			{0, true, errBackend, breaker.Closed},
+			{0, true, errBackend, breaker.Open},
+			{0, false, breaker.ErrOpen, breaker.Open},
+			{30 * time.Second, false, breaker.ErrOpen, breaker.Open},
+		}},
+		{"closes on successful probe", 1, []step{
+			{0, true, errBackend, breaker.Open},
+			{time.Minute, false, nil, breaker.Closed},
+			{0, false, nil, breaker.Closed},
+		}},
+		{"re-opens on failed probe", 1, []step{
+			{0, true, errBackend, breaker.Open},
+			{time.Minute, true, errBackend, breaker.Open},
+			{30 * time.Second, false, breaker.ErrOpen, breaker.Open},
+			{30 * time.Second, false, nil, breaker.Closed},
+		}},
+		{"zero threshold defaults", 0, []step{
+			{0, true, errBackend, breaker.Closed},
+			{0, true, errBackend, breaker.Closed},
+			{0, true, errBackend, breaker.Closed},
+			{0, true, errBackend, breaker.Closed},
+			{0, true, errBackend, breaker.Open},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			fail := false
+			metrics := &palermotest.Metrics{}
+			bs := &breaker.SessionService{
+				SessionService: &palermotest.SessionService{
+					SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+						if fail {
+							return nil, errBackend
+						}
+						return &palermo.Session{UserID: "u1"}, nil
+					},
+				},
+				Threshold: tt.threshold,
+				Cooldown:  time.Minute,
+				Metrics:   metrics,
+				Now:       func() time.Time { return now },
+			}
+
+			for i, st := range tt.steps {
+				now = now.Add(st.after)
+				fail = st.fail
+				if _, err := bs.Session(context.Background(), &palermo.SessionCredentials{}); err != st.wantErr {
+					t.Fatalf("step %d: Session() = %v, want %v", i, err, st.wantErr)
+				}
+				if got := bs.State(); got != st.wantState {
+					t.Fatalf("step %d: state %v, want %v", i, got, st.wantState)
+				}
+			}
+
+			gauge := float64(breaker.Closed)
+			if m, ok := metrics.Last("palermo_breaker_state"); ok {
+				gauge = m.Value
+			}
+			if gauge != float64(bs.State()) {
+				t.Errorf("state gauge = %v, want %v", gauge, float64(bs.State()))
+			}
+		})
+	}
+}
+
+func TestSessionServiceAbandonedCalls(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	live := context.Background()
+
+	type step struct {
+		after     time.Duration // clock advance before the call
+		ctx       context.Context
+		backend   string // ok, fail, ctx (the context error), deadline or panic
+		wantState breaker.State
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"caller deadline", []step{
+			{0, expired, "ctx", breaker.Closed},
+			{0, expired, "ctx", breaker.Closed},
+		}},
+		{"backend deadline", []step{
+			{0, live, "deadline", breaker.Open},
+		}},
+		{"cancelled", []step{
+			{0, cancelled, "ctx", breaker.Closed},
+			{0, cancelled, "ctx", breaker.Closed},
+		}},
+		{"cancelled probe", []step{
+			{0, live, "fail", breaker.Open},
+			{time.Minute, cancelled, "ctx", breaker.HalfOpen},
+			{0, expired, "ctx", breaker.HalfOpen},
+			{0, live, "ok", breaker.Closed},
+		}},
+		{"cancelled probe then failing", []step{
+			{0, live, "fail", breaker.Open},
+			{time.Minute, cancelled, "ctx", breaker.HalfOpen},
+			{0, live, "fail", breaker.Open},
+		}},
+		{"panic", []step{
+			{0, live, "panic", breaker.Open},
+		}},
+		{"panicking probe", []step{
+			{0, live, "fail", breaker.Open},
+			{time.Minute, live, "panic", breaker.Open},
+			{time.Minute, live, "ok", breaker.Closed},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			backend := ""
+			bs := &breaker.SessionService{
+				SessionService: &palermotest.SessionService{
+					SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+						switch backend {
+						case "fail":
+							return nil, errBackend
+						case "ctx":
+							return nil, ctx.Err()
+						case "deadline":
+							return nil, context.DeadlineExceeded
+						case "panic":
+							panic("backend bug")
+						}
+						return &palermo.Session{UserID: "u1"}, nil
+					},
+				},
+				Threshold: 1,
+				Cooldown:  time.Minute,
+				Now:       func() time.Time { return now },
+			}
+
+			for i, st := range tt.steps {
+				now = now.Add(st.after)
+				backend = st.backend
+				func() {
+					defer func() {
+						if r := recover(); r != nil && st.backend != "panic" {
+							t.Fatalf("step %d: Session() panicked: %v", i, r)
+						}
+					}()
+					bs.Session(st.ctx, &palermo.SessionCredentials{})
+				}()
+				if got := bs.State(); got != st.wantState {
+					t.Fatalf("step %d: state %v, want %v", i, got, st.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionServiceFallback(t *testing.T) {
+	bs := &breaker.SessionService{
+		SessionService: &palermotest.SessionService{
+			SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+				return nil, errBackend
+			},
+		},
+		Threshold: 1,
+		Cooldown:  time.Minute,
+		Fallback: &palermotest.SessionService{
+			SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+				return &palermo.Session{UserID: "cached"}, nil
+			},
+		},
+	}
+
+	bs.Session(context.Background(), &palermo.SessionCredentials{})
+	us, err := bs.Session(context.Background(), &palermo.SessionCredentials{})
+	if err != nil || us.UserID != "cached" {
+		t.Errorf("Session() = %v, %v, want the fallback session", us, err)
+	}
+}
+
+func TestIsBackendFailure(t *testing.T) {
+	js := &jwt.SessionService{SecretKey: []byte("0123456789abcdef0123456789abcdef"), MaxAge: time.Minute}
+	_, errParse := js.Session(context.Background(), &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"})
+	if errParse == nil {
+		t.Fatal("Session() accepted malformed tokens")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network", errBackend, true},
+		{"wrapped network", fmt.Errorf("redis: %w", errBackend), true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"bad connection", driver.ErrBadConn, true},
+		{"unavailable", status.Error(codes.Unavailable, "down"), true},
+		{"jwt parse", errParse, false},
+		{"jwt audience", jwt.ErrInvalidAudience, false},
+		{"unauthenticated", status.Error(codes.Unauthenticated, "invalid credentials"), false},
+		{"other", errors.New("session not found"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := breaker.IsBackendFailure(tt.err); got != tt.want {
+				t.Errorf("IsBackendFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionServiceInvalidCredentials(t *testing.T) {
+	bs := &breaker.SessionService{
+		SessionService: &jwt.SessionService{SecretKey: []byte("0123456789abcdef0123456789abcdef"), MaxAge: time.Minute},
+		Threshold:      1,
+		Cooldown:       time.Minute,
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := bs.Session(context.Background(), &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"}); err == nil || err == breaker.ErrOpen {
+			t.Fatalf("Session() = %v, want the backend error", err)
+		}
+	}
+	if got := bs.State(); got != breaker.Closed {
+		t.Errorf("state %v after invalid credentials, want %v", got, breaker.Closed)
+	}
+}
+
+func TestSessionServiceLateCompletion(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Each call reports it reached the backend, then blocks until its
+	// result is sent on its channel.
+	results := map[string]chan error{"late": make(chan error), "failing": make(chan error), "probe": make(chan error)}
+	started := make(chan struct{})
+	bs := &breaker.SessionService{
+		SessionService: &palermotest.SessionService{
+			SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+				started <- struct{}{}
+				if err := <-results[c.AuthToken]; err != nil {
+					return nil, err
+				}
+				return &palermo.Session{UserID: "u1"}, nil
+			},
+		},
+		Threshold: 1,
+		Cooldown:  time.Minute,
+		Now: func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		},
+	}
+	call := func(name string) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := bs.Session(context.Background(), &palermo.SessionCredentials{AuthToken: name})
+			done <- err
+		}()
+		<-started
+		return done
+	}
+
+	late := call("late")
+	failing := call("failing")
+	results["failing"] <- errBackend
+	<-failing
+	if got := bs.State(); got != breaker.Open {
+		t.Fatalf("state %v, want %v", got, breaker.Open)
+	}
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	probe := call("probe")
+
+	// A call started before the breaker opened completes during the probe.
+	results["late"] <- nil
+	<-late
+	if got := bs.State(); got != breaker.HalfOpen {
+		t.Errorf("state %v after a late success, want %v", got, breaker.HalfOpen)
+	}
+	if _, err := bs.Session(context.Background(), &palermo.SessionCredentials{AuthToken: "other"}); err != breaker.ErrOpen {
+		t.Errorf("Session() during the probe = %v, want %v", err, breaker.ErrOpen)
+	}
+
+	results["probe"] <- nil
+	<-probe
+	if got := bs.State(); got != breaker.Closed {
+		t.Errorf("state %v after the probe succeeded, want %v", got, breaker.Closed)
+	}
+}
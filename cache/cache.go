@@ -0,0 +1,279 @@
+// Package cache implements a palermo.SessionService decorator caching
+// validated sessions in memory.
+//
+// Cached validations are served without hitting the backend for up to TTL,
+// and never past the expiry of their credentials. Revocations through the
+// decorator drop the affected validations at once, but other instances may
+// keep serving theirs for up to TTL. TTL should therefore be kept short.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+)
+
+// ErrNoAdmin is returned by the palermo.SessionAdmin methods when the
+// decorated backend does not implement it.
+var ErrNoAdmin = errors.New("cache: backend does not implement palermo.SessionAdmin")
+
+// SessionService decorates a palermo.SessionService with a bounded LRU
+// validation cache.
+type SessionService struct {
+	palermo.SessionService
+
+	// Size is the maximum number of cached sessions.
+	Size int
+
+	// TTL is how long a validation is cached.
+	TTL time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+
+	// gen counts the revocations through the decorator. Validations served
+	// by the backend are only cached when no revocation started meanwhile,
+	// as they may predate it.
+	gen uint64
+}
+
+type entry struct {
+	key     string
+	session *palermo.Session
+	expires time.Time
+}
+
+// Session returns the cached session associated with the given credentials,
+// validating them through the backend on a cache miss.
+func (s *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	k := cacheKey(c)
+	us, gen, ok := s.get(k)
+	if ok {
+		return us, nil
+	}
+
+	us, err := s.SessionService.Session(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.set(k, us, gen)
+	return us, nil
+}
+
+// RefreshSession refreshes the given credentials through the backend and
+// drops their cached validation.
+func (s *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	s.mu.Lock()
+	s.remove(cacheKey(c))
+	s.mu.Unlock()
+
+	return s.SessionService.RefreshSession(ctx, c)
+}
+
+// RevokeSession revokes the given credentials through the backend and drops
+// their cached validation. Other instances may keep serving their cached
+// validation for up to TTL.
+func (s *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	k := cacheKey(c)
+	s.invalidate(func() { s.remove(k) })
+	err := s.SessionService.RevokeSession(ctx, c)
+	s.invalidate(func() { s.remove(k) })
+	return err
+}
+
+// UserSessions returns the live sessions of the given user from the backend.
+func (s *SessionService) UserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	admin, ok := s.SessionService.(palermo.SessionAdmin)
+	if !ok {
+		return nil, ErrNoAdmin
+	}
+	return admin.UserSessions(ctx, userID)
+}
+
+// RevokeSessionByTokenID revokes the given session through the backend and
+// drops its cached validations.
+func (s *SessionService) RevokeSessionByTokenID(ctx context.Context, tokenID string) (*palermo.Session, error) {
+	admin, ok := s.SessionService.(palermo.SessionAdmin)
+	if !ok {
+		return nil, ErrNoAdmin
+	}
+
+	revoked := func(cs *palermo.Session) bool { return cs.TokenID == tokenID }
+	s.invalidate(func() { s.removeMatching(revoked) })
+	us, err := admin.RevokeSessionByTokenID(ctx, tokenID)
+	s.invalidate(func() { s.removeMatching(revoked) })
+	return us, err
+}
+
+// RevokeUserSessions revokes every session of the given user through the
+// backend and drops their cached validations.
+func (s *SessionService) RevokeUserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	admin, ok := s.SessionService.(palermo.SessionAdmin)
+	if !ok {
+		return nil, ErrNoAdmin
+	}
+
+	revoked := func(cs *palermo.Session) bool { return cs.UserID == userID }
+	s.invalidate(func() { s.removeMatching(revoked) })
+	sessions, err := admin.RevokeUserSessions(ctx, userID)
+	s.invalidate(func() { s.removeMatching(revoked) })
+	return sessions, err
+}
+
+// Warm pre-loads the cache by validating the given credentials through the
+// backend, so a freshly started instance does not send its whole traffic to
+// the store at once. Credentials should be ordered from the most to the least
+// likely to be validated soon; at most Size of them are loaded. Invalid
+// credentials are skipped. Warm returns the number of sessions it cached.
+func (s *SessionService) Warm(ctx context.Context, creds []*palermo.SessionCredentials) int {
+	if s.Size <= 0 {
+		return 0
+	}
+
+	n := 0
+	for _, c := range creds {
+		if n >= s.Size {
+			break
+		}
+
+		gen := s.generation()
+		us, err := s.SessionService.Session(ctx, c)
+		if err != nil {
+			continue
+		}
+		if s.set(cacheKey(c), us, gen) {
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of cached sessions.
+func (s *SessionService) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// get returns the cached session of the given key, or the revocation
+// generation to cache it with on a miss.
+func (s *SessionService) get(k string) (*palermo.Session, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[k]
+	if !ok {
+		return nil, s.gen, false
+	}
+
+	e := el.Value.(*entry)
+	if !s.now().Before(e.expires) {
+		s.remove(k)
+		return nil, s.gen, false
+	}
+
+	s.lru.MoveToFront(el)
+	return e.session.Clone(), s.gen, true
+}
+
+func (s *SessionService) generation() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gen
+}
+
+// set caches the given session validated at the revocation generation gen,
+// and reports whether it added an entry. Sessions are dropped when a
+// revocation started since.
+func (s *SessionService) set(k string, us *palermo.Session, gen uint64) bool {
+	if s.Size <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if gen != s.gen {
+		return false
+	}
+
+	if s.entries == nil {
+		s.entries = make(map[string]*list.Element)
+		s.lru = list.New()
+	}
+
+	now := s.now()
+	expires := now.Add(s.TTL)
+	if !us.ExpiresAt.IsZero() && us.ExpiresAt.Before(expires) {
+		expires = us.ExpiresAt
+	}
+	if !now.Before(expires) {
+		return false
+	}
+
+	e := &entry{key: k, session: us.Clone(), expires: expires}
+	if el, ok := s.entries[k]; ok {
+		el.Value = e
+		s.lru.MoveToFront(el)
+		return false
+	}
+
+	s.entries[k] = s.lru.PushFront(e)
+	for len(s.entries) > s.Size {
+		s.remove(s.lru.Back().Value.(*entry).key)
+	}
+	return true
+}
+
+func (s *SessionService) remove(k string) {
+	if el, ok := s.entries[k]; ok {
+		s.lru.Remove(el)
+		delete(s.entries, k)
+	}
+}
+
+// invalidate runs remove, which drops revoked validations, and discards the
+// validations in flight. Revocations call it both before and after revoking
+// through the backend, as validations may be served until it is done.
+func (s *SessionService) invalidate(remove func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	remove()
+	s.gen++
+}
+
+// removeMatching drops the cached validations of the sessions matching fn.
+// Revocations are rare enough to afford walking the whole cache.
+func (s *SessionService) removeMatching(fn func(*palermo.Session) bool) {
+	if s.lru == nil {
+		return
+	}
+	for el := s.lru.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*entry); fn(e.session) {
+			s.remove(e.key)
+		}
+		el = next
+	}
+}
+
+func (s *SessionService) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func cacheKey(c *palermo.SessionCredentials) string {
+	return c.AuthToken + "\x00" + c.ValidationToken
+}
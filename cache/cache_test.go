@@ -0,0 +1,289 @@
+package cache_test
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/cache"
+	"github.com/go-toschool/palermo/memory"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+type fixture struct {
+	now     time.Time
+	backend *memory.SessionService
+	cache   *cache.SessionService
+	creds   *palermo.SessionCredentials
+}
+
+func newFixture(t *testing.T, maxAge, ttl time.Duration) *fixture {
+	f := &fixture{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	clock := func() time.Time { return f.now }
+	f.backend = &memory.SessionService{MaxAge: maxAge, Now: clock}
+	f.cache = &cache.SessionService{SessionService: f.backend, Size: 10, TTL: ttl, Now: clock}
+
+	creds, err := f.backend.CreateSession(context.Background(), &palermo.Session{
+		UserID:         "u1",
+		Email:          "u1@example.com",
+		Scopes:         []string{"read"},
+		AllowedMethods: []string{"/auth.AuthService/Get"},
+		Metadata:       map[string]string{"plan": "free"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.creds = creds
+	return f
+}
+
+// backend decorates the memory backend, counting validations and, when hold
+// is set, holding them once validated until hold is closed.
+type backend struct {
+	*memory.SessionService
+	calls int32
+	held  chan struct{}
+	hold  chan struct{}
+}
+
+func (b *backend) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	atomic.AddInt32(&b.calls, 1)
+	us, err := b.SessionService.Session(ctx, c)
+	if b.hold != nil {
+		b.held <- struct{}{}
+		<-b.hold
+	}
+	return us, err
+}
+
+func TestSessionServiceIsolation(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*palermo.Session)
+	}{
+		{"scopes", func(s *palermo.Session) { s.Scopes[0] = "admin" }},
+		{"appended scopes", func(s *palermo.Session) { s.Scopes = append(s.Scopes, "admin") }},
+		{"allowed methods", func(s *palermo.Session) { s.AllowedMethods[0] = "/auth.AdminService/Export" }},
+		{"metadata", func(s *palermo.Session) { s.Metadata["plan"] = "enterprise" }},
+		{"fields", func(s *palermo.Session) { s.UserID = "u2" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, time.Hour, time.Minute)
+			ctx := context.Background()
+
+			// The first validation fills the cache, the next ones hit it.
+			want, err := f.cache.Session(ctx, f.creds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = want.Clone()
+			for i := 0; i < 2; i++ {
+				us, err := f.cache.Session(ctx, f.creds)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(us, want) {
+					t.Fatalf("got session %+v, want %+v", us, want)
+				}
+				tt.mutate(us)
+			}
+		})
+	}
+}
+
+func TestSessionServiceExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxAge  time.Duration
+		ttl     time.Duration
+		elapsed time.Duration
+		revoke  bool // revoke through the backend, behind the cache
+		wantErr bool
+	}{
+		{"within ttl", time.Hour, time.Minute, 30 * time.Second, false, false},
+		{"past ttl", time.Hour, time.Minute, 2 * time.Minute, false, false},
+		{"revoked within ttl", time.Hour, time.Minute, 30 * time.Second, true, false},
+		{"revoked at ttl", time.Hour, time.Minute, time.Minute, true, true},
+		{"within session", 10 * time.Minute, time.Hour, 5 * time.Minute, false, false},
+		{"at session expiry", 10 * time.Minute, time.Hour, 10 * time.Minute, false, true},
+		{"past session", 10 * time.Minute, time.Hour, 11 * time.Minute, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, tt.maxAge, tt.ttl)
+			ctx := context.Background()
+			if _, err := f.cache.Session(ctx, f.creds); err != nil {
+				t.Fatal(err)
+			}
+			if tt.revoke {
+				if err := f.backend.RevokeSession(ctx, f.creds); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f.now = f.now.Add(tt.elapsed)
+			_, err := f.cache.Session(ctx, f.creds)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Session() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionServiceRevocations(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(*fixture, *palermo.Session) error
+	}{
+		{"credentials", func(f *fixture, us *palermo.Session) error {
+			return f.cache.RevokeSession(context.Background(), f.creds)
+		}},
+		{"token id", func(f *fixture, us *palermo.Session) error {
+			_, err := f.cache.RevokeSessionByTokenID(context.Background(), us.TokenID)
+			return err
+		}},
+		{"user", func(f *fixture, us *palermo.Session) error {
+			_, err := f.cache.RevokeUserSessions(context.Background(), us.UserID)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, time.Hour, time.Hour)
+			ctx := context.Background()
+			us, err := f.cache.Session(ctx, f.creds)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.revoke(f, us); err != nil {
+				t.Fatal(err)
+			}
+			if f.cache.Len() != 0 {
+				t.Errorf("%d validations cached after revocation", f.cache.Len())
+			}
+			if _, err := f.cache.Session(ctx, f.creds); err == nil {
+				t.Error("revoked session still validated")
+			}
+		})
+	}
+}
+
+func TestSessionServiceRevocationsInFlight(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(*fixture, *palermo.Session) error
+	}{
+		{"credentials", func(f *fixture, us *palermo.Session) error {
+			return f.cache.RevokeSession(context.Background(), f.creds)
+		}},
+		{"token id", func(f *fixture, us *palermo.Session) error {
+			_, err := f.cache.RevokeSessionByTokenID(context.Background(), us.TokenID)
+			return err
+		}},
+		{"user", func(f *fixture, us *palermo.Session) error {
+			_, err := f.cache.RevokeUserSessions(context.Background(), us.UserID)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, time.Hour, time.Hour)
+			ctx := context.Background()
+			us, err := f.backend.Session(ctx, f.creds)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The backend validates the credentials, then the revocation runs
+			// before the validation returns to the cache.
+			b := &backend{SessionService: f.backend, held: make(chan struct{}), hold: make(chan struct{})}
+			f.cache.SessionService = b
+			done := make(chan error)
+			go func() {
+				_, err := f.cache.Session(ctx, f.creds)
+				done <- err
+			}()
+			<-b.held
+			if err := tt.revoke(f, us); err != nil {
+				t.Fatal(err)
+			}
+			close(b.hold)
+			if err := <-done; err != nil {
+				t.Fatalf("Session() = %v", err)
+			}
+
+			if f.cache.Len() != 0 {
+				t.Errorf("%d validations cached after revocation", f.cache.Len())
+			}
+			b.hold = nil
+			if _, err := f.cache.Session(ctx, f.creds); err == nil {
+				t.Error("revoked session still validated")
+			}
+		})
+	}
+}
+
+func TestSessionServiceWarm(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		creds     func(*fixture) []*palermo.SessionCredentials
+		want      int
+		wantCalls int32
+	}{
+		{"disabled", 0, func(f *fixture) []*palermo.SessionCredentials {
+			return []*palermo.SessionCredentials{f.creds}
+		}, 0, 0},
+		{"bounded by size", 2, func(f *fixture) []*palermo.SessionCredentials {
+			return []*palermo.SessionCredentials{f.creds, newCreds(t, f), newCreds(t, f)}
+		}, 2, 2},
+		{"invalid credentials", 2, func(f *fixture) []*palermo.SessionCredentials {
+			return []*palermo.SessionCredentials{{AuthToken: "a", ValidationToken: "v"}, f.creds}
+		}, 1, 2},
+		{"duplicate credentials", 2, func(f *fixture) []*palermo.SessionCredentials {
+			return []*palermo.SessionCredentials{f.creds, f.creds}
+		}, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, time.Hour, time.Minute)
+			b := &backend{SessionService: f.backend}
+			f.cache.SessionService = b
+			f.cache.Size = tt.size
+
+			if got := f.cache.Warm(context.Background(), tt.creds(f)); got != tt.want {
+				t.Errorf("Warm() = %d, want %d", got, tt.want)
+			}
+			if got := f.cache.Len(); got != tt.want {
+				t.Errorf("Len() = %d, want %d", got, tt.want)
+			}
+			if b.calls != tt.wantCalls {
+				t.Errorf("backend called %d times, want %d", b.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// newCreds returns the credentials of another session of the fixture
+// backend.
+func newCreds(t *testing.T, f *fixture) *palermo.SessionCredentials {
+	c, err := f.backend.CreateSession(context.Background(), &palermo.Session{UserID: "u2", Email: "u2@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSessionServiceWithoutAdmin(t *testing.T) {
+	// Only the palermo.SessionService methods of the backend are exposed.
+	backend := struct{ palermo.SessionService }{&palermotest.SessionService{}}
+	cs := &cache.SessionService{SessionService: backend, Size: 10, TTL: time.Minute}
+	if _, err := cs.RevokeUserSessions(context.Background(), "u1"); err != cache.ErrNoAdmin {
+		t.Errorf("RevokeUserSessions() = %v, want %v", err, cache.ErrNoAdmin)
+	}
+}
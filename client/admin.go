@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// AdminClient calls the AdminService of a palermo server, authenticating with
+// its admin token. It is meant for operators and provisioning jobs, never
+// for the services validating sessions.
+type AdminClient struct {
+	admin auth.AdminServiceClient
+	token string
+}
+
+// NewAdmin returns an admin client calling the server of conn with the given
+// admin token.
+func NewAdmin(conn *grpc.ClientConn, token string) *AdminClient {
+	return &AdminClient{admin: auth.NewAdminServiceClient(conn), token: token}
+}
+
+// Admin returns an admin client sharing the connection opened by Dial. Use
+// NewAdmin for clients of a connection of the caller.
+func (c *Client) Admin(token string) *AdminClient {
+	return NewAdmin(c.conn, token)
+}
+
+// CreateServiceAccount creates long-lived credentials for the service account
+// named by the user id of s. They carry no refresh token: new credentials
+// must be created before they expire.
+func (ac *AdminClient) CreateServiceAccount(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error) {
+	resp, err := ac.admin.CreateServiceAccount(ac.withToken(ctx), &auth.CreateServiceAccountRequest{
+		Data: sessionToProto(s),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return credentialsFromProto(resp.Data), nil
+}
+
+func (ac *AdminClient) withToken(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+ac.token)
+}
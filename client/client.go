@@ -0,0 +1,374 @@
+// Package client calls a palermo AuthService over gRPC.
+//
+// It wraps the generated stubs with palermo types, so that consumers do not
+// convert sessions and credentials to protocol buffers themselves. A Client
+// implements palermo.SessionService, so services can validate sessions
+// remotely wherever a local SessionService is expected, e.g. by the grpcauth
+// interceptors:
+//
+//	c, err := client.Dial("palermo:8003", &client.Options{TLS: tlsConf})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	s, err := c.Session(ctx, creds)
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ErrUnsupported is returned by the SessionService methods the AuthService
+// does not expose.
+var ErrUnsupported = errors.New("client: operation not supported by the AuthService")
+
+// Options configures the connection of a Client.
+type Options struct {
+	// TLS enables TLS with the given configuration, e.g. holding a client
+	// certificate for mutual TLS as built by TLSFiles. Connections are
+	// plaintext when nil, which only fits local deployments.
+	TLS *tls.Config
+
+	// DialOptions are given to grpc.Dial after the ones derived from the
+	// other fields.
+	DialOptions []grpc.DialOption
+}
+
+// Verifier validates credentials locally, e.g. a jwt.SessionService holding
+// the secret or the public key of the server, or fetching its JWKS with
+// RemoteKeys:
+//
+//	c.Verifier = &jwt.SessionService{
+//		SigningMethod: jwt.SigningMethodES256,
+//		RemoteKeys:    &jwt.RemoteKeySet{URL: "https://palermo/.well-known/jwks.json"},
+//		MaxAge:        25 * time.Minute,
+//	}
+//
+// Its MaxAge, Issuer and Audience must match the ones of the server.
+// Credentials revoked on the server stay valid until they expire, unless the
+// verifier shares the RevocationStore of the server.
+type Verifier interface {
+	Session(ctx context.Context, creds *palermo.SessionCredentials) (*palermo.Session, error)
+}
+
+// Client calls the AuthService of a palermo server. Its fields must be set
+// before its first call.
+type Client struct {
+	// Timeout bounds each call, retries included, whose context has no
+	// deadline. Defaults to DefaultTimeout, none when negative.
+	Timeout time.Duration
+
+	// RetryPolicy retries the idempotent calls failing with a transient
+	// error. Defaults to DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+
+	// Verifier, when set, validates the credentials of Session and Validate
+	// locally instead of calling the server, saving a round trip per
+	// authenticated request. Other calls still reach the server.
+	Verifier Verifier
+
+	auth auth.AuthServiceClient
+
+	// conn is the connection opened by Dial, closed by Close.
+	conn *grpc.ClientConn
+}
+
+// Dial connects to the palermo server at target. Options may be nil. The
+// connection is established in the background, and the client must be
+// closed once done.
+func Dial(target string, o *Options) (*Client, error) {
+	if o == nil {
+		o = &Options{}
+	}
+
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if o.TLS != nil {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(o.TLS))}
+	}
+	conn, err := grpc.Dial(target, append(opts, o.DialOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := New(conn)
+	c.conn = conn
+	return c, nil
+}
+
+// New returns a client calling the server of conn, e.g. a connection shared
+// with other services. The connection stays owned by the caller.
+func New(conn *grpc.ClientConn) *Client {
+	return NewFromStub(auth.NewAuthServiceClient(conn))
+}
+
+// NewFromStub returns a client calling the given AuthService stub, e.g. the
+// in-memory fake of package palermotest.
+func NewFromStub(stub auth.AuthServiceClient) *Client {
+	return &Client{auth: stub}
+}
+
+// Close closes the connection opened by Dial.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Session validates the given credentials and returns their session.
+func (c *Client) Session(ctx context.Context, creds *palermo.SessionCredentials) (*palermo.Session, error) {
+	if c.Verifier != nil {
+		return c.Verifier.Session(ctx, creds)
+	}
+
+	var resp *auth.GetResponse
+	err := c.call(ctx, true, func(ctx context.Context) (err error) {
+		resp, err = c.auth.Get(ctx, &auth.GetRequest{Data: credentialsToProto(creds)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessionFromProto(resp.Data), nil
+}
+
+// RefreshSession refreshes the given credentials and returns their session.
+// Use Refresh to get the credentials replacing refresh tokens.
+func (c *Client) RefreshSession(ctx context.Context, creds *palermo.SessionCredentials) (*palermo.Session, error) {
+	s, _, err := c.Refresh(ctx, creds)
+	return s, err
+}
+
+// Refresh refreshes the given credentials and returns their session, along
+// with the credentials replacing them when refreshed with a single-use
+// refresh token, nil otherwise.
+func (c *Client) Refresh(ctx context.Context, creds *palermo.SessionCredentials) (*palermo.Session, *palermo.SessionCredentials, error) {
+	var resp *auth.UpdateResponse
+	err := c.call(ctx, false, func(ctx context.Context) (err error) {
+		resp, err = c.auth.Update(ctx, &auth.UpdateRequest{Data: credentialsToProto(creds)})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return sessionFromProto(resp.Data), credentialsFromProto(resp.Credentials), nil
+}
+
+// GetOrRefresh validates the given credentials and returns their session,
+// along with the credentials replacing them once their refresh window is
+// open, nil otherwise.
+func (c *Client) GetOrRefresh(ctx context.Context, creds *palermo.SessionCredentials) (*palermo.Session, *palermo.SessionCredentials, error) {
+	var resp *auth.GetOrRefreshResponse
+	err := c.call(ctx, false, func(ctx context.Context) (err error) {
+		resp, err = c.auth.GetOrRefresh(ctx, &auth.GetOrRefreshRequest{Data: credentialsToProto(creds)})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return sessionFromProto(resp.Data), credentialsFromProto(resp.Credentials), nil
+}
+
+// CreateSession creates credentials for the given session.
+func (c *Client) CreateSession(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error) {
+	var resp *auth.CreateResponse
+	err := c.call(ctx, false, func(ctx context.Context) (err error) {
+		resp, err = c.auth.Create(ctx, &auth.CreateRequest{Data: sessionToProto(s)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return credentialsFromProto(resp.Data), nil
+}
+
+// CreateSessionFromIDToken exchanges the given ID token of the OpenID
+// Connect provider trusted by the server for credentials. The session is
+// created for the user the token was issued to, with the other fields of s,
+// which may be nil.
+func (c *Client) CreateSessionFromIDToken(ctx context.Context, idToken string, s *palermo.Session) (*palermo.SessionCredentials, error) {
+	return c.CreateSessionFromTokens(ctx, idToken, "", s)
+}
+
+// CreateSessionFromTokens exchanges the given ID token as
+// CreateSessionFromIDToken does, along with the access token issued with it,
+// which the server checks against the at_hash claim of the ID token.
+func (c *Client) CreateSessionFromTokens(ctx context.Context, idToken, accessToken string, s *palermo.Session) (*palermo.SessionCredentials, error) {
+	var resp *auth.CreateResponse
+	err := c.call(ctx, false, func(ctx context.Context) (err error) {
+		resp, err = c.auth.Create(ctx, &auth.CreateRequest{
+			Data:        sessionToProto(s),
+			IdToken:     idToken,
+			AccessToken: accessToken,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return credentialsFromProto(resp.Data), nil
+}
+
+// UpdateSession returns ErrUnsupported: sessions cannot be updated remotely.
+func (c *Client) UpdateSession(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error) {
+	return nil, ErrUnsupported
+}
+
+// RevokeSession revokes the given credentials. It reads their session first,
+// as the AuthService only revokes the credentials of a given user.
+func (c *Client) RevokeSession(ctx context.Context, creds *palermo.SessionCredentials) error {
+	s, err := c.Session(ctx, creds)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, false, func(ctx context.Context) error {
+		_, err := c.auth.Delete(ctx, &auth.DeleteRequest{
+			UserId:      s.UserID,
+			Credentials: credentialsToProto(creds),
+		})
+		return err
+	})
+}
+
+// RevokeAllSessions revokes every session of the user of the given
+// credentials, e.g. to log out all devices after a password change, and
+// returns how many were revoked. It reads their session first, as the
+// AuthService only revokes the sessions of a given user.
+func (c *Client) RevokeAllSessions(ctx context.Context, creds *palermo.SessionCredentials) (int, error) {
+	s, err := c.Session(ctx, creds)
+	if err != nil {
+		return 0, err
+	}
+
+	var resp *auth.DeleteAllResponse
+	err = c.call(ctx, false, func(ctx context.Context) (err error) {
+		resp, err = c.auth.DeleteAll(ctx, &auth.DeleteAllRequest{
+			UserId:      s.UserID,
+			Credentials: credentialsToProto(creds),
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Revoked), nil
+}
+
+// Validate reports whether the given credentials are valid, without
+// returning their session. Invalid credentials are not an error.
+func (c *Client) Validate(ctx context.Context, creds *palermo.SessionCredentials) (bool, error) {
+	if c.Verifier != nil {
+		_, err := c.Verifier.Session(ctx, creds)
+		switch err {
+		case nil:
+			return true, nil
+		case jwt.ErrRemoteKeysUnavailable, context.Canceled, context.DeadlineExceeded:
+			return false, err
+		}
+		return false, nil
+	}
+
+	var resp *auth.ValidateResponse
+	err := c.call(ctx, true, func(ctx context.Context) (err error) {
+		resp, err = c.auth.Validate(ctx, &auth.ValidateRequest{Credentials: credentialsToProto(creds)})
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Valid, nil
+}
+
+func credentialsToProto(c *palermo.SessionCredentials) *auth.SessionCredentials {
+	if c == nil {
+		return nil
+	}
+	return &auth.SessionCredentials{
+		ValidationToken: c.ValidationToken,
+		AuthToken:       c.AuthToken,
+		RefreshToken:    c.RefreshToken,
+	}
+}
+
+func credentialsFromProto(c *auth.SessionCredentials) *palermo.SessionCredentials {
+	if c == nil {
+		return nil
+	}
+	return &palermo.SessionCredentials{
+		ValidationToken: c.ValidationToken,
+		AuthToken:       c.AuthToken,
+		RefreshToken:    c.RefreshToken,
+	}
+}
+
+func sessionToProto(s *palermo.Session) *auth.Session {
+	if s == nil {
+		return nil
+	}
+	return &auth.Session{
+		Id:             s.ID,
+		UserId:         s.UserID,
+		Email:          s.Email,
+		Token:          s.Token,
+		Anonymous:      s.Anonymous,
+		ServiceAccount: s.ServiceAccount,
+		Source:         s.Source,
+		Scopes:         s.Scopes,
+		ApiVersion:     s.APIVersion,
+		AllowedMethods: s.AllowedMethods,
+		Metadata:       s.Metadata,
+		NotBefore:      unixTime(s.NotBefore),
+	}
+}
+
+func sessionFromProto(s *auth.Session) *palermo.Session {
+	if s == nil {
+		return nil
+	}
+	return &palermo.Session{
+		ID:             s.Id,
+		UserID:         s.UserId,
+		Email:          s.Email,
+		Token:          s.Token,
+		Anonymous:      s.Anonymous,
+		ServiceAccount: s.ServiceAccount,
+		Source:         s.Source,
+		Scopes:         s.Scopes,
+		APIVersion:     s.ApiVersion,
+		AllowedMethods: s.AllowedMethods,
+		Metadata:       s.Metadata,
+		CreatedAt:      fromUnix(s.CreatedAt),
+		UpdatedAt:      fromUnix(s.UpdatedAt),
+		NotBefore:      fromUnix(s.NotBefore),
+		TokenID:        s.TokenId,
+		ExpiresAt:      fromUnix(s.ExpiresAt),
+		RefreshableAt:  fromUnix(s.RefreshableAt),
+	}
+}
+
+// unixTime returns t in Unix seconds, or 0 when t is the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// fromUnix returns the time of the given Unix seconds, or the zero time for
+// 0, i.e. an unset field.
+func fromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
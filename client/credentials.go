@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/grpcauth"
+)
+
+// PerRPCCredentials attaches session credentials to the outgoing RPCs of a
+// service, in the metadata expected by grpcauth, so that a service can call
+// another one as its own session. The credentials are refreshed through
+// Client once their refresh window opens. It implements
+// credentials.PerRPCCredentials:
+//
+//	conn, err := grpc.Dial(target, grpc.WithPerRPCCredentials(client.NewPerRPCCredentials(c, creds)))
+//
+// Client must not itself send these credentials, as refreshing them would
+// recurse.
+type PerRPCCredentials struct {
+	// Client refreshes the credentials.
+	Client *Client
+
+	// AllowInsecure allows sending the credentials over plaintext
+	// connections, e.g. to local services.
+	AllowInsecure bool
+
+	mu    sync.Mutex
+	creds *palermo.SessionCredentials
+	// checkAt is when the credentials must next be checked for a refresh,
+	// zero when unknown.
+	checkAt time.Time
+}
+
+// NewPerRPCCredentials returns the per-RPC credentials sending creds,
+// refreshed through c.
+func NewPerRPCCredentials(c *Client, creds *palermo.SessionCredentials) *PerRPCCredentials {
+	return &PerRPCCredentials{Client: c, creds: creds}
+}
+
+// GetRequestMetadata returns the metadata carrying the credentials,
+// refreshing them first when their refresh window is open.
+func (pc *PerRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.checkAt.IsZero() || !time.Now().Before(pc.checkAt) {
+		if err := pc.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]string{
+		grpcauth.AuthorizationHeader:   "Bearer " + pc.creds.AuthToken,
+		grpcauth.ValidationTokenHeader: pc.creds.ValidationToken,
+	}, nil
+}
+
+// refresh checks the credentials, replacing them when refreshed, and
+// schedules the next check at the opening of their refresh window.
+// pc.mu must be held.
+func (pc *PerRPCCredentials) refresh(ctx context.Context) error {
+	s, nc, err := pc.Client.GetOrRefresh(ctx, pc.creds)
+	if err != nil {
+		return err
+	}
+	if nc != nil {
+		pc.creds = nc
+	}
+
+	pc.checkAt = s.RefreshableAt
+	if pc.checkAt.IsZero() {
+		pc.checkAt = s.ExpiresAt
+	}
+	if nc != nil || !time.Now().Before(pc.checkAt) {
+		// The times are the ones of the refreshed credentials: learn the
+		// ones of the new credentials on next use.
+		pc.checkAt = time.Time{}
+	}
+	return nil
+}
+
+// Credentials returns the credentials currently sent.
+func (pc *PerRPCCredentials) Credentials() *palermo.SessionCredentials {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.creds
+}
+
+// RequireTransportSecurity reports whether the credentials may only be sent
+// over TLS.
+func (pc *PerRPCCredentials) RequireTransportSecurity() bool {
+	return !pc.AllowInsecure
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultTimeout bounds the calls of a Client without Timeout.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultRetryPolicy retries idempotent calls of a Client without
+// RetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+}
+
+// RetryPolicy retries the idempotent calls (Session, Validate) failing with
+// a transient error, so that server restarts and overloads do not surface
+// as invalid sessions. Other calls are never retried, as they may have
+// taken effect. Zero fields take the values of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts of a call, the first one included.
+	// 1 disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry, multiplied by
+	// Multiplier before each next one up to MaxBackoff. Each wait is
+	// randomized between half and all of it, so that clients do not retry
+	// in lockstep.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+func (rp RetryPolicy) withDefaults() RetryPolicy {
+	if rp.MaxAttempts <= 0 {
+		rp.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if rp.InitialBackoff <= 0 {
+		rp.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if rp.MaxBackoff <= 0 {
+		rp.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if rp.Multiplier < 1 {
+		rp.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	return rp
+}
+
+// call runs f within the timeout of the client, retrying transient
+// failures of idempotent calls until the policy or the deadline runs out.
+func (c *Client) call(ctx context.Context, idempotent bool, f func(ctx context.Context) error) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	rp := c.RetryPolicy.withDefaults()
+	attempts := 1
+	if idempotent {
+		attempts = rp.MaxAttempts
+	}
+
+	backoff := rp.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		if err == nil || attempt >= attempts || !retryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(jitter(backoff))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+
+		backoff = time.Duration(float64(backoff) * rp.Multiplier)
+		if backoff > rp.MaxBackoff {
+			backoff = rp.MaxBackoff
+		}
+	}
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if _, ok := ctx.Deadline(); ok || timeout < 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// retryable reports whether err is transient: the server is unreachable or
+// shedding load.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// jitter returns a random duration between half of d and d.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSFiles describes the transport security of a connection to a palermo
+// server with PEM files, as mounted from secrets:
+//
+//	conf, err := (&client.TLSFiles{
+//		CAFile:   "/etc/palermo/ca.pem",
+//		CertFile: "/etc/palermo/client.pem",
+//		KeyFile:  "/etc/palermo/client-key.pem",
+//	}).Config()
+//	if err != nil {
+//		return err
+//	}
+//	c, err := client.Dial("palermo:8003", &client.Options{TLS: conf})
+type TLSFiles struct {
+	// CAFile holds the certificates of the CAs trusted to issue the server
+	// certificate. The system roots are trusted when empty.
+	CAFile string
+
+	// CertFile and KeyFile hold the client certificate and its key, presented
+	// to servers requiring mutual TLS. Both or none must be set.
+	CertFile string
+	KeyFile  string
+
+	// ServerName is the name checked against the server certificate.
+	// Defaults to the host of the dialed target.
+	ServerName string
+}
+
+// Config loads the files and returns the TLS configuration they describe,
+// e.g. for Options.TLS.
+func (f *TLSFiles) Config() (*tls.Config, error) {
+	if (f.CertFile == "") != (f.KeyFile == "") {
+		return nil, errors.New("client: TLS client authentication requires both a certificate and a key")
+	}
+
+	conf := &tls.Config{
+		ServerName: f.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if f.CAFile != "" {
+		b, err := ioutil.ReadFile(f.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("client: no certificate found in %s", f.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if f.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// DialOption loads the files and returns the grpc.DialOption securing a
+// connection with them, for connections given to New. Dial takes the
+// configuration returned by Config instead.
+func (f *TLSFiles) DialOption() (grpc.DialOption, error) {
+	conf, err := f.Config()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(conf)), nil
+}
+
+// WithSystemRoots returns the grpc.DialOption securing a connection with
+// TLS, trusting the system roots to issue the server certificate.
+func WithSystemRoots() grpc.DialOption {
+	return grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12}))
+}
@@ -0,0 +1,222 @@
+// Command palermoctl calls a running palermo server, e.g. to debug
+// authentication issues:
+//
+//	palermoctl create -user-id 42 -email jane@example.com
+//	palermoctl get -auth-token ... -validation-token ...
+//	palermoctl refresh -auth-token ... -validation-token ...
+//	palermoctl revoke -auth-token ... -validation-token ...
+//	palermoctl revoke-all -auth-token ... -validation-token ...
+//	palermoctl -admin-token ... create -service-account -user-id billing
+//
+// Tokens may also be given by the PALERMO_AUTH_TOKEN,
+// PALERMO_VALIDATION_TOKEN and PALERMO_REFRESH_TOKEN variables, so that
+// they do not end up in the shell history, as may the admin token by
+// PALERMO_ADMIN_TOKEN. Results are printed as JSON.
+//
+// Connections are plaintext unless -tls is given or a certificate file is:
+//
+//	palermoctl -tls -ca-file ca.pem -cert-file client.pem -key-file client-key.pem get ...
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/client"
+)
+
+// command runs a subcommand with the arguments following its name.
+type command struct {
+	usage string
+	run   func(ctx context.Context, c *client.Client, args []string) (interface{}, error)
+}
+
+// adminToken authenticates the commands calling the AdminService.
+var adminToken string
+
+var commands = map[string]command{
+	"create":     {"create -user-id ID -email EMAIL [-scopes A,B] [-anonymous | -service-account]", create},
+	"get":        {"get [credentials]", get},
+	"refresh":    {"refresh [credentials]", refresh},
+	"revoke":     {"revoke [credentials]", revoke},
+	"revoke-all": {"revoke-all [credentials]", revokeAll},
+}
+
+// credentialsJSON prints credentials, which carry no JSON tags.
+type credentialsJSON struct {
+	ValidationToken string `json:"validation_token"`
+	AuthToken       string `json:"auth_token"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8003", "address of the palermo server")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of the command")
+	useTLS := flag.Bool("tls", false, "connect with TLS, trusting the system roots unless -ca-file is given")
+	files := &client.TLSFiles{}
+	flag.StringVar(&files.CAFile, "ca-file", "", "PEM file of the CAs trusted to issue the server certificate")
+	flag.StringVar(&files.CertFile, "cert-file", "", "PEM file of the client certificate, for mutual TLS")
+	flag.StringVar(&files.KeyFile, "key-file", "", "PEM file of the key of the client certificate")
+	flag.StringVar(&files.ServerName, "server-name", "", "name checked against the server certificate, defaults to the host of -addr")
+	flag.StringVar(&adminToken, "admin-token", os.Getenv("PALERMO_ADMIN_TOKEN"), "bearer token of the AdminService, defaults to $PALERMO_ADMIN_TOKEN")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	opts := &client.Options{}
+	if *useTLS || *files != (client.TLSFiles{}) {
+		conf, err := files.Config()
+		if err != nil {
+			fatal(err)
+		}
+		opts.TLS = conf
+	}
+
+	c, err := client.Dial(*addr, opts)
+	if err != nil {
+		fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	out, err := cmd.run(ctx, c, flag.Args()[1:])
+	if err != nil {
+		fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] command [command flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range []string{"create", "get", "refresh", "revoke", "revoke-all"} {
+		fmt.Fprintf(out, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "palermoctl: %v\n", err)
+	os.Exit(1)
+}
+
+func create(ctx context.Context, c *client.Client, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	s := &palermo.Session{}
+	fs.StringVar(&s.UserID, "user-id", "", "user id of the session")
+	fs.StringVar(&s.Email, "email", "", "email of the user")
+	fs.BoolVar(&s.Anonymous, "anonymous", false, "create a guest session")
+	fs.BoolVar(&s.ServiceAccount, "service-account", false, "create long-lived credentials of a service through the AdminService, no email required")
+	scopes := fs.String("scopes", "", "comma separated scopes granted to the session")
+	fs.Parse(args)
+
+	if *scopes != "" {
+		s.Scopes = strings.Split(*scopes, ",")
+	}
+	create := c.CreateSession
+	if s.ServiceAccount {
+		if adminToken == "" {
+			return nil, errors.New("service accounts require -admin-token")
+		}
+		create = c.Admin(adminToken).CreateServiceAccount
+	}
+	creds, err := create(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	return toJSON(creds), nil
+}
+
+func get(ctx context.Context, c *client.Client, args []string) (interface{}, error) {
+	creds, err := parseCredentials("get", args)
+	if err != nil {
+		return nil, err
+	}
+	return c.Session(ctx, creds)
+}
+
+func refresh(ctx context.Context, c *client.Client, args []string) (interface{}, error) {
+	creds, err := parseCredentials("refresh", args)
+	if err != nil {
+		return nil, err
+	}
+	s, nc, err := c.Refresh(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Session     *palermo.Session `json:"session"`
+		Credentials *credentialsJSON `json:"credentials,omitempty"`
+	}{s, toJSON(nc)}, nil
+}
+
+func revoke(ctx context.Context, c *client.Client, args []string) (interface{}, error) {
+	creds, err := parseCredentials("revoke", args)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.RevokeSession(ctx, creds); err != nil {
+		return nil, err
+	}
+	return struct {
+		Revoked bool `json:"revoked"`
+	}{true}, nil
+}
+
+func revokeAll(ctx context.Context, c *client.Client, args []string) (interface{}, error) {
+	creds, err := parseCredentials("revoke-all", args)
+	if err != nil {
+		return nil, err
+	}
+	n, err := c.RevokeAllSessions(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Revoked int `json:"revoked"`
+	}{n}, nil
+}
+
+// parseCredentials reads the credentials of a command from its flags, else
+// from the environment.
+func parseCredentials(name string, args []string) (*palermo.SessionCredentials, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	c := &palermo.SessionCredentials{}
+	fs.StringVar(&c.AuthToken, "auth-token", os.Getenv("PALERMO_AUTH_TOKEN"), "authentication token, defaults to $PALERMO_AUTH_TOKEN")
+	fs.StringVar(&c.ValidationToken, "validation-token", os.Getenv("PALERMO_VALIDATION_TOKEN"), "validation token, defaults to $PALERMO_VALIDATION_TOKEN")
+	fs.StringVar(&c.RefreshToken, "refresh-token", os.Getenv("PALERMO_REFRESH_TOKEN"), "refresh token, defaults to $PALERMO_REFRESH_TOKEN")
+	fs.Parse(args)
+
+	if c.AuthToken == "" && c.RefreshToken == "" {
+		return nil, errors.New("missing credentials")
+	}
+	return c, nil
+}
+
+func toJSON(c *palermo.SessionCredentials) *credentialsJSON {
+	if c == nil {
+		return nil
+	}
+	return &credentialsJSON{
+		ValidationToken: c.ValidationToken,
+		AuthToken:       c.AuthToken,
+		RefreshToken:    c.RefreshToken,
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/audit"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// errNoAdmin is returned by the AdminService methods the session backend does
+// not support.
+var errNoAdmin = status.Error(codes.Unimplemented, "session backend does not support session administration")
+
+// AdminService lets operators list, revoke and export the sessions of
+// store-backed backends. Callers must present Token as a bearer token in the
+// authorization metadata, separately from any session credentials.
+type AdminService struct {
+	// Admin lists and revokes the sessions of users. The methods doing so
+	// are unimplemented when nil.
+	Admin palermo.SessionAdmin
+	Token string
+
+	// Exporter streams the sessions of the backend on Export. Export is
+	// unimplemented when nil.
+	Exporter palermo.SessionExporter
+
+	// Auth audits the revocations and publishes them to the watchers.
+	Auth *AuthService
+
+	// HealthReporter details the health of the components on Health.
+	// Health is unimplemented when nil.
+	HealthReporter *healthReporter
+}
+
+// ListUserSessions returns the live sessions of a user.
+func (ads *AdminService) ListUserSessions(ctx context.Context, lr *auth.ListUserSessionsRequest) (*auth.ListUserSessionsResponse, error) {
+	logEntry(ctx).Info("AdminService: Method ListUserSessions", nil)
+	if err := ads.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if ads.Admin == nil {
+		return nil, errNoAdmin
+	}
+	if lr.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing user id")
+	}
+
+	sessions, err := ads.Admin.UserSessions(ctx, lr.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.ListUserSessionsResponse{Data: adminSessionsToProto(sessions)}, nil
+}
+
+// RevokeSession revokes the session identified by its token id.
+func (ads *AdminService) RevokeSession(ctx context.Context, rr *auth.RevokeSessionRequest) (*auth.RevokeSessionResponse, error) {
+	logEntry(ctx).Info("AdminService: Method RevokeSession", nil)
+	if err := ads.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if ads.Admin == nil {
+		return nil, errNoAdmin
+	}
+	if rr.TokenId == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing token id")
+	}
+
+	s, err := ads.Admin.RevokeSessionByTokenID(ctx, rr.TokenId)
+	ads.Auth.emitAudit(ctx, audit.AuditRecord_REVOKED, s, err)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.RevokeSessionResponse{Data: adminSessionToProto(s)}, nil
+}
+
+// RevokeUserSessions revokes every session of a user, e.g. when their
+// account is compromised.
+func (ads *AdminService) RevokeUserSessions(ctx context.Context, rr *auth.RevokeUserSessionsRequest) (*auth.RevokeUserSessionsResponse, error) {
+	logEntry(ctx).Info("AdminService: Method RevokeUserSessions", nil)
+	if err := ads.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if ads.Admin == nil {
+		return nil, errNoAdmin
+	}
+	if rr.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing user id")
+	}
+
+	sessions, err := ads.Admin.RevokeUserSessions(ctx, rr.UserId)
+	if err != nil {
+		ads.Auth.emitAudit(ctx, audit.AuditRecord_REVOKED, nil, err)
+		return nil, err
+	}
+	for _, s := range sessions {
+		ads.Auth.emitAudit(ctx, audit.AuditRecord_REVOKED, s, nil)
+	}
+	return &auth.RevokeUserSessionsResponse{Data: adminSessionsToProto(sessions)}, nil
+}
+
+// CreateServiceAccount creates long-lived credentials of the service account
+// named by the user id of the given session. The AuthService never issues
+// them, as its callers are not trusted to act on behalf of services.
+func (ads *AdminService) CreateServiceAccount(ctx context.Context, cr *auth.CreateServiceAccountRequest) (*auth.CreateResponse, error) {
+	logEntry(ctx).Info("AdminService: Method CreateServiceAccount", nil)
+	if err := ads.authorize(ctx); err != nil {
+		return nil, err
+	}
+	data := cr.Data
+	if data == nil || data.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing user id")
+	}
+
+	now := time.Now()
+	s := &palermo.Session{
+		ID:             data.Id,
+		UserID:         data.UserId,
+		Email:          data.Email,
+		ServiceAccount: true,
+		Source:         sourceFromContext(ctx),
+		Scopes:         data.Scopes,
+		APIVersion:     data.ApiVersion,
+		AllowedMethods: data.AllowedMethods,
+		Metadata:       data.Metadata,
+		NotBefore:      timeFromUnix(data.NotBefore),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	c, err := ads.Auth.SessionService.CreateSession(ctx, s)
+	if err != nil {
+		ads.Auth.emitAudit(ctx, audit.AuditRecord_CREATED, s, err)
+		if err == jwt.ErrServiceAccountsDisabled {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, err
+	}
+
+	ads.Auth.emitAudit(ctx, audit.AuditRecord_CREATED, mintedSession(s, c), nil)
+	return &auth.CreateResponse{
+		Data: &auth.SessionCredentials{
+			ValidationToken: c.ValidationToken,
+			AuthToken:       c.AuthToken,
+		},
+	}, nil
+}
+
+// Export streams every session stored by the backend. Their upstream token
+// is left out: the export must not hand out credentials of other services.
+func (ads *AdminService) Export(er *auth.ExportRequest, stream auth.AdminService_ExportServer) error {
+	ctx := stream.Context()
+	logEntry(ctx).Info("AdminService: Method Export", nil)
+	if err := ads.authorize(ctx); err != nil {
+		return err
+	}
+	if ads.Exporter == nil {
+		return status.Error(codes.Unimplemented, "session backend does not support export")
+	}
+
+	return ads.Exporter.ExportSessions(ctx, func(s *palermo.Session) error {
+		select {
+		case <-ads.Auth.drain.Done():
+			return errDraining
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		err := stream.Send(adminSessionToProto(s))
+		ads.Auth.emitAudit(ctx, audit.AuditRecord_EXPORTED, s, err)
+		return err
+	})
+}
+
+// Health details the health of each component of the server, down to the
+// failures degrading it while it keeps serving.
+func (ads *AdminService) Health(ctx context.Context, hr *auth.HealthRequest) (*auth.HealthResponse, error) {
+	logEntry(ctx).Info("AdminService: Method Health", nil)
+	if err := ads.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if ads.HealthReporter == nil {
+		return nil, status.Error(codes.Unimplemented, "health reporting is disabled")
+	}
+	return ads.HealthReporter.Detail(ctx), nil
+}
+
+// authorize checks the admin token sent in the authorization metadata.
+func (ads *AdminService) authorize(ctx context.Context) error {
+	return checkAdminToken(ctx, ads.Token)
+}
+
+// checkAdminToken checks that the caller sent token as its bearer token. It
+// always fails when token is empty.
+func checkAdminToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if token != "" && len(v) > 7 && strings.EqualFold(v[:7], "bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(v[7:])), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid admin token")
+}
+
+// adminSessionToProto converts s for an admin response, without the upstream
+// token of the user: it is a credential of the user that admins must not
+// see.
+func adminSessionToProto(s *palermo.Session) *auth.Session {
+	ps := sessionToProto(s)
+	ps.Token = ""
+	return ps
+}
+
+func adminSessionsToProto(sessions []*palermo.Session) []*auth.Session {
+	ps := make([]*auth.Session, len(sessions))
+	for i, s := range sessions {
+		ps[i] = adminSessionToProto(s)
+	}
+	return ps
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/health"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testAdminToken = "s3cret-admin-token"
+
+// adminContext returns a context carrying token as an admin bearer token.
+func adminContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+// exportStream is an auth.AdminService_ExportServer counting and keeping the
+// sessions sent.
+type exportStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*auth.Session
+}
+
+func (es *exportStream) Context() context.Context { return es.ctx }
+
+func (es *exportStream) Send(s *auth.Session) error {
+	es.sent = append(es.sent, s)
+	return nil
+}
+
+func newTestAdminService(t *testing.T, sessions int) *AdminService {
+	ms := &memory.SessionService{MaxAge: time.Hour}
+	for i := 0; i < sessions; i++ {
+		_, err := ms.CreateSession(context.Background(), &palermo.Session{
+			UserID: fmt.Sprint(i),
+			Email:  fmt.Sprintf("user%d@example.com", i),
+			Token:  "upstream-token",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &AdminService{
+		Admin:    ms,
+		Exporter: ms,
+		Token:    testAdminToken,
+		Auth:     &AuthService{SessionService: ms, drain: newDrainer()},
+	}
+}
+
+func TestAdminServiceExport(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+		wantSent int
+	}{
+		{"admin", adminContext(testAdminToken), codes.OK, 2500},
+		{"wrong token", adminContext("guess"), codes.Unauthenticated, 0},
+		{"no token", context.Background(), codes.Unauthenticated, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ads := newTestAdminService(t, 2500)
+			stream := &exportStream{ctx: tt.ctx}
+			err := ads.Export(&auth.ExportRequest{}, stream)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Export() = %v, want %v", err, tt.wantCode)
+			}
+			if len(stream.sent) != tt.wantSent {
+				t.Fatalf("exported %d sessions, want %d", len(stream.sent), tt.wantSent)
+			}
+
+			users := make(map[string]bool)
+			for _, s := range stream.sent {
+				if s.Token != "" {
+					t.Fatalf("session of %s exported with its upstream token", s.UserId)
+				}
+				users[s.UserId] = true
+			}
+			if len(users) != tt.wantSent {
+				t.Errorf("exported %d distinct users, want %d", len(users), tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestAdminServiceOmitsUpstreamToken(t *testing.T) {
+	ctx := adminContext(testAdminToken)
+	ads := newTestAdminService(t, 1)
+	// A second session of user 0.
+	if _, err := ads.Admin.(*memory.SessionService).CreateSession(context.Background(), &palermo.Session{UserID: "0", Email: "user0@example.com", Token: "upstream-token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := ads.ListUserSessions(ctx, &auth.ListUserSessionsRequest{UserId: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 2 {
+		t.Fatalf("listed %d sessions, want 2", len(list.Data))
+	}
+	revoked, err := ads.RevokeSession(ctx, &auth.RevokeSessionRequest{TokenId: list.Data[0].TokenId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedAll, err := ads.RevokeUserSessions(ctx, &auth.RevokeUserSessionsRequest{UserId: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[string][]*auth.Session{
+		"ListUserSessions":   list.Data,
+		"RevokeSession":      {revoked.Data},
+		"RevokeUserSessions": revokedAll.Data,
+	}
+	for method, sessions := range responses {
+		if len(sessions) == 0 {
+			t.Errorf("%s returned no session", method)
+		}
+		for _, s := range sessions {
+			if s.Token != "" {
+				t.Errorf("%s returned the upstream token of %s", method, s.UserId)
+			}
+		}
+	}
+}
+
+func TestAdminServiceHealth(t *testing.T) {
+	hr := newHealthReporter(nil)
+	hr.agg.Set(componentRevocationStore, health.Degraded, "connection refused")
+	ads := &AdminService{Token: testAdminToken, HealthReporter: hr}
+
+	if _, err := ads.Health(adminContext("guess"), &auth.HealthRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Health() with a wrong token = %v, want %v", err, codes.Unauthenticated)
+	}
+
+	resp, err := ads.Health(adminContext(testAdminToken), &auth.HealthRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Level != "degraded" || !resp.Serving {
+		t.Errorf("Health() = %q serving %v, want degraded and serving", resp.Level, resp.Serving)
+	}
+	if len(resp.Components) != 1 {
+		t.Fatalf("Health() components = %+v", resp.Components)
+	}
+	c := resp.Components[0]
+	if c.Name != componentRevocationStore || c.Level != "degraded" || c.Message != "connection refused" {
+		t.Errorf("Health() component = %+v", c)
+	}
+
+	ads.HealthReporter = nil
+	if _, err := ads.Health(adminContext(testAdminToken), &auth.HealthRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("Health() without a reporter = %v, want %v", err, codes.Unimplemented)
+	}
+}
+
+func TestAdminServiceExportStopsOnDrain(t *testing.T) {
+	ads := newTestAdminService(t, 10)
+	ads.Auth.drain.Drain()
+
+	stream := &exportStream{ctx: adminContext(testAdminToken)}
+	if err := ads.Export(&auth.ExportRequest{}, stream); err != errDraining {
+		t.Fatalf("Export() = %v, want %v", err, errDraining)
+	}
+	if len(stream.sent) != 0 {
+		t.Errorf("exported %d sessions while draining", len(stream.sent))
+	}
+}
+
+func TestCreateServiceAccount(t *testing.T) {
+	js := &jwt.SessionService{
+		SecretKey:            []byte("0123456789abcdef0123456789abcdef"),
+		MaxAge:               time.Minute,
+		ServiceAccountMaxAge: 24 * time.Hour,
+	}
+	as := &AuthService{SessionService: js, drain: newDrainer()}
+	ads := &AdminService{Token: testAdminToken, Auth: as}
+	account := &auth.Session{UserId: "billing", ServiceAccount: true}
+
+	tests := []struct {
+		name     string
+		create   func() (*auth.CreateResponse, error)
+		wantCode codes.Code
+	}{
+		{"auth service", func() (*auth.CreateResponse, error) {
+			return as.Create(context.Background(), &auth.CreateRequest{Data: account})
+		}, codes.PermissionDenied},
+		{"admin without token", func() (*auth.CreateResponse, error) {
+			return ads.CreateServiceAccount(context.Background(), &auth.CreateServiceAccountRequest{Data: account})
+		}, codes.Unauthenticated},
+		{"admin without user id", func() (*auth.CreateResponse, error) {
+			return ads.CreateServiceAccount(adminContext(testAdminToken), &auth.CreateServiceAccountRequest{Data: &auth.Session{}})
+		}, codes.InvalidArgument},
+		{"admin", func() (*auth.CreateResponse, error) {
+			return ads.CreateServiceAccount(adminContext(testAdminToken), &auth.CreateServiceAccountRequest{Data: &auth.Session{UserId: "billing"}})
+		}, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.create()
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("got %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+
+			s, err := js.Session(context.Background(), &palermo.SessionCredentials{
+				ValidationToken: resp.Data.ValidationToken,
+				AuthToken:       resp.Data.AuthToken,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.ServiceAccount || s.UserID != "billing" {
+				t.Errorf("got session %+v, want the billing service account", s)
+			}
+			if ttl := time.Until(s.ExpiresAt); ttl < 23*time.Hour {
+				t.Errorf("service account credentials expire in %v", ttl)
+			}
+		})
+	}
+}
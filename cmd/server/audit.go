@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/audit"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+// emitAudit sends an audit record of a session lifecycle event to the audit
+// sink, if any, and publishes it to the watchers when successful. s may be nil
+// when the event failed before a session was known. Sink failures are logged
+// and never fail the request.
+func (as *AuthService) emitAudit(ctx context.Context, event audit.AuditRecord_Event, s *palermo.Session, err error) {
+	as.publishEvent(event, s, err)
+	if as.Audit == nil {
+		return
+	}
+
+	r := &audit.AuditRecord{
+		Event:     event,
+		Outcome:   audit.AuditRecord_SUCCESS,
+		Timestamp: time.Now().Unix(),
+		Actor:     sourceFromContext(ctx),
+		Client:    clientIdentityFromContext(ctx),
+	}
+	if s != nil {
+		r.Subject = s.UserID
+		r.Jti = s.TokenID
+	}
+	if err != nil {
+		r.Outcome = audit.AuditRecord_FAILURE
+		r.Error = err.Error()
+	}
+
+	if err := as.Audit.Emit(r); err != nil {
+		logEntry(ctx).Error("AuthService: failed to emit audit record", palermo.Fields{
+			"event": event.String(),
+			"error": err.Error(),
+		})
+	}
+}
+
+// mintedSession returns a copy of s identified by the token id of the given
+// freshly minted credentials, for audit purposes.
+func mintedSession(s *palermo.Session, c *palermo.SessionCredentials) *palermo.Session {
+	ms := *s
+	ms.TokenID, _ = jwt.TokenID(c.AuthToken)
+	return &ms
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo/audit"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/memory"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestAuditRecords(t *testing.T) {
+	sink := &audit.MemorySink{}
+	as := &AuthService{
+		SessionService: &jwt.SessionService{
+			SecretKey:       []byte("0123456789abcdef0123456789abcdef"),
+			MaxAge:          time.Minute,
+			RefreshMaxAge:   time.Hour,
+			RevocationStore: &memory.RevocationStore{},
+		},
+		Audit: sink,
+		drain: newDrainer(),
+	}
+	ctx := peerContext(tcpAddr("203.0.113.7"), "")
+
+	// Each step runs a lifecycle event with the credentials of the previous
+	// steps, and returns the token id its record must carry.
+	var creds, refreshed *auth.SessionCredentials
+	var tokens []string
+	tokenID := func(c *auth.SessionCredentials) string {
+		tokens = append(tokens, c.ValidationToken, c.AuthToken, c.RefreshToken)
+		id, err := jwt.TokenID(c.AuthToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	tests := []struct {
+		name        string
+		step        func() (jti string, err error)
+		wantEvent   audit.AuditRecord_Event
+		wantSubject string
+		wantOutcome audit.AuditRecord_Outcome
+	}{
+		{"create", func() (string, error) {
+			resp, err := as.Create(ctx, &auth.CreateRequest{Data: &auth.Session{UserId: "42", Email: "jane@example.com"}})
+			if err != nil {
+				return "", err
+			}
+			creds = resp.Data
+			return tokenID(creds), nil
+		}, audit.AuditRecord_CREATED, "42", audit.AuditRecord_SUCCESS},
+		{"validate", func() (string, error) {
+			_, err := as.Get(ctx, &auth.GetRequest{Data: creds})
+			return tokenID(creds), err
+		}, audit.AuditRecord_VALIDATED, "42", audit.AuditRecord_SUCCESS},
+		{"refresh", func() (string, error) {
+			resp, err := as.Update(ctx, &auth.UpdateRequest{Data: creds})
+			if err != nil {
+				return "", err
+			}
+			refreshed = resp.Credentials
+			return tokenID(refreshed), nil
+		}, audit.AuditRecord_REFRESHED, "42", audit.AuditRecord_SUCCESS},
+		{"revoke another user's session", func() (string, error) {
+			_, err := as.Delete(ctx, &auth.DeleteRequest{UserId: "43", Credentials: refreshed})
+			if err == nil {
+				t.Error("Delete() revoked the credentials of another user")
+			}
+			return tokenID(refreshed), nil
+		}, audit.AuditRecord_REVOKED, "42", audit.AuditRecord_FAILURE},
+		{"revoke", func() (string, error) {
+			_, err := as.Delete(ctx, &auth.DeleteRequest{UserId: "42", Credentials: refreshed})
+			return tokenID(refreshed), err
+		}, audit.AuditRecord_REVOKED, "42", audit.AuditRecord_SUCCESS},
+		{"validate revoked", func() (string, error) {
+			if _, err := as.Get(ctx, &auth.GetRequest{Data: refreshed}); err == nil {
+				t.Error("Get() accepted revoked credentials")
+			}
+			return "", nil
+		}, audit.AuditRecord_VALIDATED, "", audit.AuditRecord_FAILURE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(sink.Records())
+			start := time.Now().Unix()
+			jti, err := tt.step()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			records := sink.Records()[before:]
+			if len(records) != 1 {
+				t.Fatalf("emitted %d records, want 1", len(records))
+			}
+			r := records[0]
+			if r.Event != tt.wantEvent || r.Outcome != tt.wantOutcome || r.Subject != tt.wantSubject || r.Jti != jti {
+				t.Errorf("got record %v, want %v %v of %q with jti %q", r, tt.wantEvent, tt.wantOutcome, tt.wantSubject, jti)
+			}
+			if r.Actor != "ip:203.0.113.7" {
+				t.Errorf("actor = %q", r.Actor)
+			}
+			if r.Timestamp < start || r.Timestamp > time.Now().Unix() {
+				t.Errorf("timestamp = %d", r.Timestamp)
+			}
+			if (r.Error != "") != (tt.wantOutcome == audit.AuditRecord_FAILURE) {
+				t.Errorf("error = %q on %v", r.Error, r.Outcome)
+			}
+
+			dump := proto.MarshalTextString(r)
+			for _, tok := range tokens {
+				if tok != "" && strings.Contains(dump, tok) {
+					t.Errorf("record carries a token: %s", dump)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/audit"
+	"github.com/go-toschool/palermo/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxBatchSize bounds the credentials validated by a single
+	// ValidateBatch call.
+	maxBatchSize = 100
+
+	// batchConcurrency bounds the credentials of a batch validated at once,
+	// as each may cost a round trip to a remote session store.
+	batchConcurrency = 16
+)
+
+// ValidateBatch validates many credentials in one round trip, e.g. for API
+// gateways fanning a request out. Each credentials is validated as by Get,
+// and invalid ones are reported in their result rather than failing the
+// call.
+func (as *AuthService) ValidateBatch(ctx context.Context, br *auth.ValidateBatchRequest) (*auth.ValidateBatchResponse, error) {
+	logEntry(ctx).Info("AuthService: Method ValidateBatch", nil)
+	if len(br.Credentials) > maxBatchSize {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("at most %d credentials may be validated at once", maxBatchSize))
+	}
+
+	results := make([]*auth.ValidateBatchResponse_Result, len(br.Credentials))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, c := range br.Credentials {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, c *auth.SessionCredentials) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = as.validateCredentials(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	return &auth.ValidateBatchResponse{Results: results}, nil
+}
+
+func (as *AuthService) validateCredentials(ctx context.Context, c *auth.SessionCredentials) *auth.ValidateBatchResponse_Result {
+	if c == nil {
+		return &auth.ValidateBatchResponse_Result{Error: "missing credentials"}
+	}
+
+	s, err := as.SessionService.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: c.ValidationToken,
+		AuthToken:       c.AuthToken,
+	})
+	if err == nil {
+		err = as.SourcePolicy.Check(ctx, s)
+	} else {
+		as.logSkewError(ctx, err)
+	}
+
+	as.emitAudit(ctx, audit.AuditRecord_VALIDATED, s, err)
+	if err != nil {
+		return &auth.ValidateBatchResponse_Result{Error: status.Convert(err).Message()}
+	}
+	return &auth.ValidateBatchResponse_Result{Data: sessionToProto(s)}
+}
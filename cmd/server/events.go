@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/audit"
+	"github.com/go-toschool/palermo/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watcherBufferSize is how many events a watcher may lag behind before being
+// dropped.
+const watcherBufferSize = 256
+
+// errWatcherTooSlow ends the Watch streams not keeping up with the events,
+// rather than blocking the requests publishing them. Clients are expected to
+// resubscribe and resynchronize their caches.
+var errWatcherTooSlow = status.Error(codes.ResourceExhausted, "palermo: watcher too slow, events dropped")
+
+// eventTypes maps the audited events to the watched ones. Other audited
+// events are not published.
+var eventTypes = map[audit.AuditRecord_Event]auth.SessionEvent_Type{
+	audit.AuditRecord_CREATED:   auth.SessionEvent_CREATED,
+	audit.AuditRecord_REFRESHED: auth.SessionEvent_REFRESHED,
+	audit.AuditRecord_REVOKED:   auth.SessionEvent_REVOKED,
+}
+
+// eventHub fans the session events of this instance out to the Watch
+// streams.
+type eventHub struct {
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+type watcher struct {
+	userID  string
+	events  chan *auth.SessionEvent
+	dropped chan struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{watchers: make(map[*watcher]struct{})}
+}
+
+// Subscribe returns a watcher receiving the events of the given user, or of
+// every user when empty. It must be unsubscribed once done.
+func (h *eventHub) Subscribe(userID string) *watcher {
+	w := &watcher{
+		userID:  userID,
+		events:  make(chan *auth.SessionEvent, watcherBufferSize),
+		dropped: make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+	return w
+}
+
+// Unsubscribe stops sending events to w.
+func (h *eventHub) Unsubscribe(w *watcher) {
+	h.mu.Lock()
+	delete(h.watchers, w)
+	h.mu.Unlock()
+}
+
+// Publish sends ev to the interested watchers without blocking. Watchers
+// whose buffer is full are dropped.
+func (h *eventHub) Publish(ev *auth.SessionEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for w := range h.watchers {
+		if w.userID != "" && w.userID != ev.UserId {
+			continue
+		}
+		select {
+		case w.events <- ev:
+		default:
+			delete(h.watchers, w)
+			close(w.dropped)
+		}
+	}
+}
+
+// publishEvent publishes the successful session lifecycle events to the
+// watchers, if any.
+func (as *AuthService) publishEvent(event audit.AuditRecord_Event, s *palermo.Session, err error) {
+	t, ok := eventTypes[event]
+	if as.Events == nil || !ok || s == nil || err != nil {
+		return
+	}
+
+	as.Events.Publish(&auth.SessionEvent{
+		Type:      t,
+		SessionId: s.ID,
+		UserId:    s.UserID,
+		TokenId:   s.TokenID,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// Watch streams the session lifecycle events handled by this instance, e.g.
+// so that downstream services drop cached sessions on logout. Only the
+// events following the subscription are streamed. Users may only watch their
+// own sessions, given the credentials of one of them; the admin token is
+// required to watch other users, or every user at once.
+func (as *AuthService) Watch(wr *auth.WatchRequest, stream auth.AuthService_WatchServer) error {
+	ctx := stream.Context()
+	logEntry(ctx).Info("AuthService: Method Watch", nil)
+	if as.Events == nil {
+		return status.Error(codes.Unimplemented, "session events are disabled")
+	}
+	if err := as.authorizeWatch(ctx, wr); err != nil {
+		return err
+	}
+
+	w := as.Events.Subscribe(wr.UserId)
+	defer as.Events.Unsubscribe(w)
+
+	for {
+		select {
+		case <-as.drain.Done():
+			return errDraining
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.dropped:
+			return errWatcherTooSlow
+		case ev := <-w.events:
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// authorizeWatch checks that the caller may watch the events requested by wr.
+func (as *AuthService) authorizeWatch(ctx context.Context, wr *auth.WatchRequest) error {
+	if checkAdminToken(ctx, as.AdminToken) == nil {
+		return nil
+	}
+	if wr.UserId == "" {
+		return status.Error(codes.PermissionDenied, "watching every user requires the admin token")
+	}
+	if wr.Credentials == nil {
+		return status.Error(codes.Unauthenticated, "missing credentials")
+	}
+
+	s, err := as.SessionService.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: wr.Credentials.ValidationToken,
+		AuthToken:       wr.Credentials.AuthToken,
+	})
+	if err != nil {
+		return as.logSkewError(ctx, err)
+	}
+	if err := as.SourcePolicy.Check(ctx, s); err != nil {
+		return err
+	}
+	if s.UserID != wr.UserId {
+		return status.Error(codes.PermissionDenied, "credentials do not belong to user")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watchStream is an auth.AuthService_WatchServer forwarding the events sent.
+type watchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *auth.SessionEvent
+}
+
+func (ws *watchStream) Context() context.Context { return ws.ctx }
+
+func (ws *watchStream) Send(ev *auth.SessionEvent) error {
+	ws.events <- ev
+	return nil
+}
+
+func TestWatchAuthorization(t *testing.T) {
+	ms := &memory.SessionService{MaxAge: time.Hour}
+	creds, err := ms.CreateSession(context.Background(), &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	own := &auth.SessionCredentials{ValidationToken: creds.ValidationToken, AuthToken: creds.AuthToken}
+
+	tests := []struct {
+		name       string
+		adminToken string
+		ctx        context.Context
+		req        *auth.WatchRequest
+		wantCode   codes.Code
+	}{
+		{"own user", testAdminToken, context.Background(), &auth.WatchRequest{UserId: "u1", Credentials: own}, codes.OK},
+		{"other user", testAdminToken, context.Background(), &auth.WatchRequest{UserId: "u2", Credentials: own}, codes.PermissionDenied},
+		{"without credentials", testAdminToken, context.Background(), &auth.WatchRequest{UserId: "u1"}, codes.Unauthenticated},
+		{"invalid credentials", testAdminToken, context.Background(), &auth.WatchRequest{UserId: "u1", Credentials: &auth.SessionCredentials{AuthToken: "forged"}}, codes.Unknown},
+		{"every user", testAdminToken, context.Background(), &auth.WatchRequest{Credentials: own}, codes.PermissionDenied},
+		{"every user as admin", testAdminToken, adminContext(testAdminToken), &auth.WatchRequest{}, codes.OK},
+		{"other user as admin", testAdminToken, adminContext(testAdminToken), &auth.WatchRequest{UserId: "u2"}, codes.OK},
+		{"wrong admin token", testAdminToken, adminContext("guess"), &auth.WatchRequest{}, codes.PermissionDenied},
+		{"admin disabled", "", adminContext(""), &auth.WatchRequest{}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := &AuthService{SessionService: ms, Events: newEventHub(), AdminToken: tt.adminToken, drain: newDrainer()}
+			ctx, cancel := context.WithCancel(tt.ctx)
+			defer cancel()
+			stream := &watchStream{ctx: ctx, events: make(chan *auth.SessionEvent, 1)}
+
+			done := make(chan error, 1)
+			go func() { done <- as.Watch(tt.req, stream) }()
+
+			if tt.wantCode != codes.OK {
+				if err := <-done; status.Code(err) != tt.wantCode {
+					t.Fatalf("Watch() = %v, want %v", err, tt.wantCode)
+				}
+				return
+			}
+
+			// Publish until the stream subscribed and forwards the event.
+			ev := &auth.SessionEvent{Type: auth.SessionEvent_REVOKED, UserId: tt.req.UserId}
+			tick := time.NewTicker(time.Millisecond)
+			defer tick.Stop()
+			for received := false; !received; {
+				select {
+				case err := <-done:
+					t.Fatalf("Watch() = %v, want a stream", err)
+				case got := <-stream.events:
+					if got != ev {
+						t.Fatalf("got event %v, want %v", got, ev)
+					}
+					received = true
+				case <-tick.C:
+					as.Events.Publish(ev)
+				}
+			}
+			cancel()
+			<-done
+		})
+	}
+}
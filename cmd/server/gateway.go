@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/cookies"
+	"github.com/go-toschool/palermo/server"
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	validationTokenHeader = "X-Validation-Token"
+	requestIDHeader       = "X-Request-Id"
+
+	// maxGatewayBodySize bounds the JSON bodies accepted by the gateway.
+	maxGatewayBodySize = 1 << 20
+)
+
+// sessionCookies reads the credentials of browser clients from their
+// cookies.
+var sessionCookies = cookies.New()
+
+// gateway serves the AuthService over HTTP/JSON, on the routes generated from
+// the google.api.http options of auth.proto and described by the OpenAPI
+// document. Requests go through the interceptors of the gRPC server, so they
+// are rate limited, traced and counted alike.
+type gateway struct {
+	mux *runtime.ServeMux
+}
+
+func newGateway(svc auth.AuthServiceServer, intercept grpc.UnaryServerInterceptor) (*gateway, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{OrigName: true}),
+		runtime.WithProtoErrorHandler(runtime.DefaultHTTPError),
+	)
+	client := &gatewayClient{svc: svc, intercept: intercept}
+	if err := auth.RegisterAuthServiceHandlerClient(context.Background(), mux, client); err != nil {
+		return nil, err
+	}
+	return &gateway{mux: mux}, nil
+}
+
+// Register routes the AuthService paths of mux to the gateway.
+func (gw *gateway) Register(mux *http.ServeMux) {
+	mux.Handle("/v1/", gw)
+}
+
+func (gw *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxGatewayBodySize)
+
+	ctx, id := gatewayContext(r)
+	// Outside of a gRPC stream, the request id cannot be sent as a header by
+	// the interceptor.
+	w.Header().Set(requestIDHeader, id)
+
+	ctx = context.WithValue(ctx, gatewayRequestKey{}, r)
+	gw.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+type gatewayRequestKey struct{}
+
+// gatewayClient is the client of the generated gateway handlers: it calls the
+// AuthService in process, through the interceptors of the gRPC server. Only
+// the methods with an HTTP route are implemented.
+type gatewayClient struct {
+	auth.AuthServiceClient
+
+	svc       auth.AuthServiceServer
+	intercept grpc.UnaryServerInterceptor
+}
+
+func (gc *gatewayClient) Create(ctx context.Context, in *auth.CreateRequest, _ ...grpc.CallOption) (*auth.CreateResponse, error) {
+	resp, err := gc.call(ctx, "Create", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return gc.svc.Create(ctx, req.(*auth.CreateRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*auth.CreateResponse), nil
+}
+
+func (gc *gatewayClient) Get(ctx context.Context, in *auth.GetRequest, _ ...grpc.CallOption) (*auth.GetResponse, error) {
+	if noCredentials(in.Data) {
+		in.Data = credentialsFromContext(ctx)
+	}
+	resp, err := gc.call(ctx, "Get", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return gc.svc.Get(ctx, req.(*auth.GetRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*auth.GetResponse), nil
+}
+
+func (gc *gatewayClient) Update(ctx context.Context, in *auth.UpdateRequest, _ ...grpc.CallOption) (*auth.UpdateResponse, error) {
+	if noCredentials(in.Data) {
+		in.Data = credentialsFromContext(ctx)
+	}
+	resp, err := gc.call(ctx, "Update", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return gc.svc.Update(ctx, req.(*auth.UpdateRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*auth.UpdateResponse), nil
+}
+
+func (gc *gatewayClient) Delete(ctx context.Context, in *auth.DeleteRequest, _ ...grpc.CallOption) (*auth.DeleteResponse, error) {
+	if noCredentials(in.Credentials) {
+		in.Credentials = credentialsFromContext(ctx)
+	}
+	resp, err := gc.call(ctx, "Delete", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return gc.svc.Delete(ctx, req.(*auth.DeleteRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*auth.DeleteResponse), nil
+}
+
+func (gc *gatewayClient) Introspect(ctx context.Context, in *auth.IntrospectRequest, _ ...grpc.CallOption) (*auth.IntrospectResponse, error) {
+	resp, err := gc.call(ctx, "Introspect", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return gc.svc.Introspect(ctx, req.(*auth.IntrospectRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*auth.IntrospectResponse), nil
+}
+
+// call calls the AuthService method through the interceptors.
+func (gc *gatewayClient) call(ctx context.Context, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	info := &grpc.UnaryServerInfo{
+		Server:     gc.svc,
+		FullMethod: "/auth.AuthService/" + method,
+	}
+	return gc.intercept(ctx, req, info, handler)
+}
+
+// noCredentials reports whether the body of a request had no credentials. The
+// generated handlers allocate the field of the body even when it is empty.
+func noCredentials(c *auth.SessionCredentials) bool {
+	return c == nil || proto.Size(c) == 0
+}
+
+// credentialsFromContext reads the credentials from the headers of the
+// gateway request of ctx, for the requests whose body has none.
+func credentialsFromContext(ctx context.Context) *auth.SessionCredentials {
+	r, ok := ctx.Value(gatewayRequestKey{}).(*http.Request)
+	if !ok {
+		return &auth.SessionCredentials{}
+	}
+	return credentialsFromHeaders(r)
+}
+
+// credentialsFromHeaders reads the authentication token from the bearer
+// Authorization header and the validation token from its header, each
+// falling back to its cookie.
+func credentialsFromHeaders(r *http.Request) *auth.SessionCredentials {
+	fromCookies, _ := sessionCookies.Read(r)
+	c := &auth.SessionCredentials{
+		ValidationToken: r.Header.Get(validationTokenHeader),
+		AuthToken:       fromCookies.AuthToken,
+	}
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		c.AuthToken = strings.TrimSpace(h[7:])
+	}
+	if c.ValidationToken == "" {
+		c.ValidationToken = fromCookies.ValidationToken
+	}
+	return c
+}
+
+// gatewayContext returns the context of r as a gRPC server would set it up:
+// with the request id and device id headers as incoming metadata, and the
+// remote address and TLS state as peer. A request id is generated when the
+// caller sent none, and returned along with the context.
+func gatewayContext(r *http.Request) (context.Context, string) {
+	md := metadata.MD{}
+	id := r.Header.Get(server.RequestIDMetadataKey)
+	if !server.ValidRequestID(id) {
+		id = server.NewRequestID()
+	}
+	md.Set(server.RequestIDMetadataKey, id)
+	if v := r.Header.Get(deviceIDMetadataKey); v != "" {
+		md.Set(deviceIDMetadataKey, v)
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+
+	p := &peer.Peer{Addr: gatewayAddr(r.RemoteAddr)}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+	}
+	return peer.NewContext(ctx, p), id
+}
+
+func gatewayAddr(remoteAddr string) net.Addr {
+	if addr, err := net.ResolveTCPAddr("tcp", remoteAddr); err == nil {
+		return addr
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// newTestGateway returns an HTTP server for the gateway of an AuthService
+// backed by the memory store, along with the credentials of a session of
+// user 42 and the methods seen by the interceptor.
+func newTestGateway(t *testing.T) (*httptest.Server, *auth.SessionCredentials, *[]string) {
+	as := &AuthService{SessionService: &memory.SessionService{MaxAge: time.Hour}, drain: newDrainer()}
+	cr, err := as.Create(context.Background(), &auth.CreateRequest{Data: &auth.Session{UserId: "42", Email: "jane@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var methods []string
+	intercept := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := peer.FromContext(ctx); !ok {
+			t.Errorf("%s called without peer", info.FullMethod)
+		}
+		methods = append(methods, info.FullMethod)
+		return handler(ctx, req)
+	}
+	gw, err := newGateway(as, intercept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	gw.Register(mux)
+	return httptest.NewServer(mux), cr.Data, &methods
+}
+
+func TestGatewayDelete(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		body       func(c *auth.SessionCredentials) string
+		header     func(r *http.Request, c *auth.SessionCredentials)
+		wantStatus int
+	}{
+		{
+			name: "credentials in body",
+			user: "42",
+			body: func(c *auth.SessionCredentials) string {
+				return `{"validation_token":"` + c.ValidationToken + `","auth_token":"` + c.AuthToken + `"}`
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "credentials in headers",
+			user: "42",
+			header: func(r *http.Request, c *auth.SessionCredentials) {
+				r.Header.Set("Authorization", "Bearer "+c.AuthToken)
+				r.Header.Set(validationTokenHeader, c.ValidationToken)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "credentials in cookies",
+			user: "42",
+			header: func(r *http.Request, c *auth.SessionCredentials) {
+				r.AddCookie(&http.Cookie{Name: "access_token", Value: c.AuthToken})
+				r.AddCookie(&http.Cookie{Name: "validation_token", Value: c.ValidationToken})
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "empty body",
+			user: "42",
+			body: func(*auth.SessionCredentials) string { return `{}` },
+			header: func(r *http.Request, c *auth.SessionCredentials) {
+				r.Header.Set("Authorization", "Bearer "+c.AuthToken)
+				r.Header.Set(validationTokenHeader, c.ValidationToken)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "body before headers",
+			user: "42",
+			body: func(c *auth.SessionCredentials) string {
+				return `{"validation_token":"` + c.ValidationToken + `","auth_token":"` + c.AuthToken + `"}`
+			},
+			header: func(r *http.Request, c *auth.SessionCredentials) {
+				r.Header.Set("Authorization", "Bearer forged")
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "credentials of another user",
+			user: "7",
+			body: func(c *auth.SessionCredentials) string {
+				return `{"validation_token":"` + c.ValidationToken + `","auth_token":"` + c.AuthToken + `"}`
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "invalid body",
+			user:       "42",
+			body:       func(*auth.SessionCredentials) string { return `{"auth_token":` },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, creds, methods := newTestGateway(t)
+			defer srv.Close()
+
+			var body string
+			if tt.body != nil {
+				body = tt.body(creds)
+			}
+			req, err := http.NewRequest(http.MethodDelete, srv.URL+"/v1/users/"+tt.user+"/sessions", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != nil {
+				tt.header(req, creds)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.Header.Get(requestIDHeader) == "" {
+				t.Error("no request id header")
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				return
+			}
+			if len(*methods) != 1 || (*methods)[0] != "/auth.AuthService/Delete" {
+				t.Errorf("intercepted %q, want Delete", *methods)
+			}
+		})
+	}
+}
+
+func TestGatewayRoutes(t *testing.T) {
+	srv, creds, methods := newTestGateway(t)
+	defer srv.Close()
+	credsBody := `{"validation_token":"` + creds.ValidationToken + `","auth_token":"` + creds.AuthToken + `"}`
+
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantMethod string
+	}{
+		{http.MethodPost, "/v1/sessions", `{"user_id":"43","email":"john@example.com"}`, http.StatusOK, "/auth.AuthService/Create"},
+		{http.MethodPost, "/v1/sessions/validate", credsBody, http.StatusOK, "/auth.AuthService/Get"},
+		{http.MethodPost, "/v1/sessions/introspect", `{"credentials":` + credsBody + `}`, http.StatusOK, "/auth.AuthService/Introspect"},
+		{http.MethodGet, "/v1/sessions/validate", "", http.StatusNotImplemented, ""},
+		{http.MethodPost, "/v1/unknown", "", http.StatusNotImplemented, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			*methods = nil
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			var got map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if tt.wantMethod == "" {
+				if len(*methods) != 0 {
+					t.Errorf("intercepted %q", *methods)
+				}
+				return
+			}
+			if len(*methods) != 1 || (*methods)[0] != tt.wantMethod {
+				t.Errorf("intercepted %q, want %s", *methods, tt.wantMethod)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/health"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// authServiceName is the gRPC service name whose health reflects the overall
+// health of the server, along with the empty service name.
+const authServiceName = "auth.AuthService"
+
+const (
+	healthCheckInterval = 10 * time.Second
+	healthCheckTimeout  = 2 * time.Second
+)
+
+// degradingComponents lists the components whose failure degrades the server
+// rather than stopping it, as it still serves the requests not depending on
+// them.
+var degradingComponents = map[string]bool{
+	componentRevocationStore: true,
+	componentHandleStore:     true,
+}
+
+// healthReporter periodically checks the backends and reports their health
+// through the standard gRPC health service: each backend under its component
+// name, and the server as a whole under the empty and AuthService names.
+type healthReporter struct {
+	components map[string]palermo.HealthChecker
+	agg        *health.Aggregator
+	srv        *grpchealth.Server
+}
+
+func newHealthReporter(components map[string]palermo.HealthChecker) *healthReporter {
+	hr := &healthReporter{
+		components: components,
+		srv:        grpchealth.NewServer(),
+	}
+	hr.agg = &health.Aggregator{OnChange: hr.setServing, Logger: logger}
+	hr.setServing(true)
+	return hr
+}
+
+// Server returns the gRPC health service.
+func (hr *healthReporter) Server() healthpb.HealthServer {
+	return hr.srv
+}
+
+// Run checks the backends every healthCheckInterval until done is closed.
+func (hr *healthReporter) Run(done <-chan struct{}) {
+	hr.check()
+
+	t := time.NewTicker(healthCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			hr.check()
+		case <-done:
+			return
+		}
+	}
+}
+
+// Shutdown reports every service as not serving, so load balancers stop
+// routing requests to the server.
+func (hr *healthReporter) Shutdown() {
+	hr.srv.Shutdown()
+}
+
+// healthResponse is the body of the HTTP health endpoints.
+type healthResponse struct {
+	Status     string            `json:"status"`
+	Components []componentHealth `json:"components,omitempty"`
+}
+
+type componentHealth struct {
+	Name    string `json:"name"`
+	Level   string `json:"level"`
+	Message string `json:"message,omitempty"`
+}
+
+// Handler serves the health over HTTP, for orchestrators unable to call the
+// gRPC health service: /healthz answers as long as the process runs, and
+// /readyz only while the server is serving, i.e. its backends are reachable,
+// its keys available and it is not shutting down.
+func (hr *healthReporter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, &healthResponse{Status: "ok"})
+	})
+	mux.HandleFunc("/readyz", hr.serveReady)
+	return mux
+}
+
+// Detail returns the health of each component, for the AdminService.
+func (hr *healthReporter) Detail(ctx context.Context) *auth.HealthResponse {
+	level, statuses := hr.agg.Status()
+	resp := &auth.HealthResponse{Level: level.String(), Serving: hr.serving(ctx)}
+	for _, s := range statuses {
+		resp.Components = append(resp.Components, &auth.ComponentHealth{
+			Name:    s.Component,
+			Level:   s.Level.String(),
+			Message: s.Message,
+		})
+	}
+	return resp
+}
+
+// serving reports whether the server is serving: its components are healthy
+// enough and it is not shutting down.
+func (hr *healthReporter) serving(ctx context.Context) bool {
+	hc, err := hr.srv.Check(ctx, &healthpb.HealthCheckRequest{})
+	return err == nil && hc.Status == healthpb.HealthCheckResponse_SERVING
+}
+
+func (hr *healthReporter) serveReady(w http.ResponseWriter, r *http.Request) {
+	resp := &healthResponse{Status: "ok"}
+	_, statuses := hr.agg.Status()
+	for _, s := range statuses {
+		resp.Components = append(resp.Components, componentHealth{
+			Name:    s.Component,
+			Level:   s.Level.String(),
+			Message: s.Message,
+		})
+	}
+
+	code := http.StatusOK
+	if !hr.serving(r.Context()) {
+		code = http.StatusServiceUnavailable
+		resp.Status = "unavailable"
+	}
+	writeHealth(w, code, resp)
+}
+
+func writeHealth(w http.ResponseWriter, code int, resp *healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (hr *healthReporter) check() {
+	for name, hc := range hr.components {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		err := hc.Check(ctx)
+		cancel()
+
+		status := healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			level := health.Down
+			if degradingComponents[name] {
+				level = health.Degraded
+			}
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			hr.agg.Set(name, level, err.Error())
+		} else {
+			hr.agg.Set(name, health.OK, "")
+		}
+		hr.srv.SetServingStatus(name, status)
+	}
+}
+
+func (hr *healthReporter) setServing(serving bool) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if !serving {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	hr.srv.SetServingStatus("", status)
+	hr.srv.SetServingStatus(authServiceName, status)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthReporter(t *testing.T) {
+	tests := []struct {
+		name       string
+		level      health.Level
+		wantStatus healthpb.HealthCheckResponse_ServingStatus
+		wantCode   int
+		wantReadyz string
+		wantLevel  string
+	}{
+		{"ok", health.OK, healthpb.HealthCheckResponse_SERVING, http.StatusOK, "ok", "ok"},
+		{"degraded", health.Degraded, healthpb.HealthCheckResponse_SERVING, http.StatusOK, "ok", "degraded"},
+		{"down", health.Down, healthpb.HealthCheckResponse_NOT_SERVING, http.StatusServiceUnavailable, "unavailable", "down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hr := newHealthReporter(nil)
+			hr.agg.Set("revocation", tt.level, "")
+
+			for _, svc := range []string{"", authServiceName} {
+				hc, err := hr.Server().Check(context.Background(), &healthpb.HealthCheckRequest{Service: svc})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if hc.Status != tt.wantStatus {
+					t.Errorf("%q status = %v, want %v", svc, hc.Status, tt.wantStatus)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			hr.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			var resp healthResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.wantCode || resp.Status != tt.wantReadyz {
+				t.Errorf("/readyz = %d %q, want %d %q", rec.Code, resp.Status, tt.wantCode, tt.wantReadyz)
+			}
+			if len(resp.Components) != 1 || resp.Components[0].Name != "revocation" || resp.Components[0].Level != tt.wantLevel {
+				t.Errorf("/readyz components = %+v", resp.Components)
+			}
+		})
+	}
+}
+
+// healthCheckFunc is a palermo.HealthChecker returning err.
+type healthCheckFunc func(context.Context) error
+
+func (f healthCheckFunc) Check(ctx context.Context) error { return f(ctx) }
+
+func TestHealthReporterCheck(t *testing.T) {
+	failing := healthCheckFunc(func(context.Context) error { return errors.New("connection refused") })
+	healthy := healthCheckFunc(func(context.Context) error { return nil })
+
+	tests := []struct {
+		name        string
+		failing     string
+		wantLevel   health.Level
+		wantServing bool
+	}{
+		{"healthy", "", health.OK, true},
+		{"revocation store failing", componentRevocationStore, health.Degraded, true},
+		{"handle store failing", componentHandleStore, health.Degraded, true},
+		{"session store failing", componentSessionStore, health.Down, false},
+		{"keys failing", componentKeys, health.Down, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			components := make(map[string]palermo.HealthChecker)
+			for _, name := range []string{componentSessionStore, componentRevocationStore, componentHandleStore, componentKeys} {
+				components[name] = healthy
+			}
+			if tt.failing != "" {
+				components[tt.failing] = failing
+			}
+			hr := newHealthReporter(components)
+			hr.check()
+
+			if level, _ := hr.agg.Status(); level != tt.wantLevel {
+				t.Errorf("level = %v, want %v", level, tt.wantLevel)
+			}
+			if serving := hr.serving(context.Background()); serving != tt.wantServing {
+				t.Errorf("serving = %v, want %v", serving, tt.wantServing)
+			}
+		})
+	}
+}
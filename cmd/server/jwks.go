@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-toschool/palermo/jwt"
+)
+
+// jwksMaxAge is how long relying parties may cache the published keys.
+const jwksMaxAge = "300"
+
+// jwksHandler publishes the verification keys of svc as a JSON Web Key Set,
+// so relying parties can validate tokens locally. Nothing is published when
+// tokens are signed with a shared secret.
+func jwksHandler(svc *jwt.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		set, err := svc.JWKS()
+		if err == jwt.ErrNoPublicKeys {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "keys unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age="+jwksMaxAge)
+		json.NewEncoder(w).Encode(set)
+	}
+}
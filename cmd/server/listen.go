@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const unixScheme = "unix://"
+
+// validateListenAddr checks the address of the additional listener, a Unix
+// socket path prefixed with unix://.
+func validateListenAddr(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	if !strings.HasPrefix(addr, unixScheme) || len(addr) == len(unixScheme) {
+		return fmt.Errorf("invalid listen address: %q, expected unix:///path/to/socket", addr)
+	}
+	return nil
+}
+
+// listenUnix listens on the Unix socket of the given unix:// address, for
+// callers colocated with the service, e.g. sidecars. A socket left over by a
+// previous run is replaced. The socket is removed once the listener is
+// closed.
+func listenUnix(addr string) (net.Listener, error) {
+	path := strings.TrimPrefix(addr, unixScheme)
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -4,25 +4,52 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/audit"
 	"github.com/go-toschool/palermo/auth"
 	"github.com/go-toschool/palermo/jwt"
+	palermologrus "github.com/go-toschool/palermo/logrus"
+	"github.com/go-toschool/palermo/oidc"
+	"github.com/go-toschool/palermo/otlp"
+	"github.com/go-toschool/palermo/prometheus"
+	"github.com/go-toschool/palermo/server"
+	"github.com/go-toschool/palermo/tracing"
+	"github.com/go-toschool/palermo/vault"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 
 	_ "github.com/lib/pq"
 )
 
-const (
-	authSecretKey       = "palermoAuthSecretKey"
-	authTokenMaxAge     = 25 * time.Minute
-	authTokenCookieName = "access_token"
-)
+// defaultSecretKey is the development secret, used when none is configured.
+const defaultSecretKey = "palermoAuthSecretKey"
+
+// logger receives the server logs.
+var logger palermo.Logger = palermologrus.NewLogger(nil)
+
+// logEntry returns the server logger, tagging entries with the request id of
+// the RPC, if any.
+func logEntry(ctx context.Context) palermo.Logger {
+	if id := server.RequestIDFromContext(ctx); id != "" {
+		return logger.With(palermo.Fields{"request_id": id})
+	}
+	return logger
+}
 
 func init() {
 	logrus.SetLevel(logrus.DebugLevel)
@@ -39,109 +66,832 @@ func init() {
 }
 
 func main() {
+	flag.String(configFlag, "", "flat TOML file setting flags by name, below the environment and the command line")
 	port := flag.Int64("port", 8003, "listening port")
+	listenAddr := flag.String("listen", "", "additional Unix socket listener, e.g. unix:///var/run/palermo.sock, disabled when empty")
+	secret := flag.String("secret", defaultSecretKey, "secret signing HS256 JWTs and PASETO tokens")
+	secretFile := flag.String("secret-file", "", "file holding the secret, replacing -secret when set and read again on SIGHUP")
+	httpPort := flag.Int64("http-port", 0, "HTTP/JSON gateway and OpenAPI listening port, disabled when 0")
+	otlpEndpoint := flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP collector receiving traces, defaults to $OTEL_EXPORTER_OTLP_ENDPOINT, disabled when empty")
+	otlpServiceName := flag.String("otlp-service-name", envOr("OTEL_SERVICE_NAME", "palermo"), "service name of the exported traces, defaults to $OTEL_SERVICE_NAME")
+	metricsPort := flag.Int64("metrics-port", 0, "Prometheus /metrics listening port, disabled when 0")
+	healthPort := flag.Int64("health-port", 0, "HTTP /healthz and /readyz listening port, disabled when 0")
+	pprofPort := flag.Int64("pprof-port", 0, "net/http/pprof listening port, on localhost only, disabled when 0")
+	refreshWindow := flag.Duration("refresh-window", 5*time.Minute, "time before expiry from which credentials may be refreshed")
+	enableReflection := flag.Bool("reflection", false, "register the gRPC reflection service, for debugging with grpcurl or evans")
+	rpcTimeout := flag.Duration("rpc-timeout", 10*time.Second, "time unary RPCs may take, store calls included, unbounded when 0")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "time given to in-flight requests to complete on shutdown")
+	auditFile := flag.String("audit-file", "", "append session audit records to this file, disabled when empty")
+	adminToken := flag.String("admin-token", "", "bearer token of the AdminService callers, disabled when empty")
+	vaultConf := &vaultConfig{}
+	flag.StringVar(&vaultConf.Addr, "vault-addr", os.Getenv("VAULT_ADDR"), "Vault server reading the secret, defaults to $VAULT_ADDR")
+	flag.StringVar(&vaultConf.Token, "vault-token", os.Getenv("VAULT_TOKEN"), "Vault token reading the secret, defaults to $VAULT_TOKEN")
+	flag.StringVar(&vaultConf.Path, "vault-secret-path", "", "Vault KV path of the secret, e.g. secret/data/palermo, replacing -secret when set")
+	flag.StringVar(&vaultConf.Field, "vault-secret-field", vault.DefaultField, "field of the Vault secret holding its value")
+	flag.DurationVar(&vaultConf.RefreshInterval, "secret-refresh-interval", 5*time.Minute, "how often the Vault secret is read again to rotate the JWT signing key, never when 0")
+	kdfSalt := flag.String("kdf-salt", "", "derive the signing key from the secret using this salt (must match across instances)")
+	store := &storeConfig{Logger: logger}
+	flag.StringVar(&store.Kind, "store", storeJWT, "session store: jwt, paseto, redis, postgres or memory (development only)")
+	flag.StringVar(&store.RedisAddr, "redis-addr", "localhost:6379", "Redis address of the redis store and revocations")
+	flag.StringVar(&store.Revocation, "revocation-store", revocationMemory, "where the jwt store records revoked credentials and used refresh tokens: memory or redis")
+	flag.IntVar(&store.RevocationMaxEntries, "revocation-max-entries", 1000000, "revocations kept by the memory revocation store before evicting the ones expiring first, unbounded when 0")
+	flag.StringVar(&store.Handles, "handle-store", "", "hand out opaque handles to jwt or paseto credentials kept in memory or redis, disabled when empty")
+	flag.StringVar(&store.SigningMethod, "signing-method", jwt.SigningMethodHS256, "JWT signing method: HS256, RS256, ES256 or EdDSA")
+	flag.BoolVar(&store.DeriveTokenKeys, "derive-token-keys", false, "sign each JWT type with its own key derived from the HS256 secret (invalidates outstanding tokens when toggled)")
+	flag.StringVar(&store.VerifyMethods, "verify-methods", "", "comma separated JWT signing methods accepted besides -signing-method, e.g. HS256 while moving to RS256")
+	flag.StringVar(&store.PrivateKeyFile, "private-key-file", "", "PEM private key signing JWTs with asymmetric signing methods")
+	flag.StringVar(&store.Issuer, "issuer", "", "issuer (iss) of minted tokens, required on validation when set")
+	flag.StringVar(&store.Audience, "audience", "", "audience (aud) of minted tokens, required on validation when set")
+	flag.DurationVar(&store.MaxAge, "token-max-age", 25*time.Minute, "time minted credentials are valid")
+	flag.DurationVar(&store.Leeway, "leeway", 0, "clock skew tolerated on JWT time claims")
+	flag.DurationVar(&store.RefreshTokenMaxAge, "refresh-token-max-age", 0, "issue JWT refresh tokens valid that long, disabled when 0")
+	flag.DurationVar(&store.ServiceAccountMaxAge, "service-account-max-age", 0, "issue JWT service account credentials valid that long, disabled when 0")
+	flag.StringVar(&store.PostgresDSN, "postgres-dsn", "", "PostgreSQL DSN of the postgres store")
+	flag.DurationVar(&store.PostgresPurgeInterval, "postgres-purge-interval", time.Hour, "how often the postgres store deletes expired sessions, never when 0")
+	srcPolicy := &sourcePolicy{}
+	flag.StringVar(&srcPolicy.Mode, "source-policy", sourcePolicyOff, "session source check: off, log or reject")
+	flag.IntVar(&srcPolicy.IPv4Bits, "source-ipv4-bits", 24, "IPv4 prefix length considered the same source")
+	flag.IntVar(&srcPolicy.IPv6Bits, "source-ipv6-bits", 64, "IPv6 prefix length considered the same source")
+	rateLimit := &rateLimitConfig{}
+	flag.Float64Var(&rateLimit.Rate, "rate-limit", 0, "requests per second served overall, unlimited when 0")
+	flag.IntVar(&rateLimit.Burst, "rate-limit-burst", 100, "requests served at once over the overall rate limit")
+	flag.Float64Var(&rateLimit.PeerRate, "peer-rate-limit", 0, "requests per second served to each peer address, unlimited when 0")
+	flag.IntVar(&rateLimit.PeerBurst, "peer-rate-limit-burst", 20, "requests served at once to a peer over its rate limit")
+	oidcConf := &oidcConfig{}
+	flag.StringVar(&oidcConf.Issuer, "oidc-issuer", "", "issuer URL of the OpenID Connect provider whose ID tokens Create exchanges for credentials, disabled when empty")
+	flag.StringVar(&oidcConf.ClientIDs, "oidc-client-ids", "", "comma separated client ids the ID tokens must be issued to")
+	flag.StringVar(&oidcConf.JWKSURL, "oidc-jwks-url", "", "JWKS URL of the OpenID Connect provider, discovered from the issuer when empty")
+	flag.BoolVar(&oidcConf.AllowUnverifiedEmail, "oidc-allow-unverified-email", false, "accept ID tokens whose email the provider did not verify")
+	tlsConf := &tlsConfig{}
+	flag.StringVar(&tlsConf.CertFile, "tls-cert", "", "PEM certificate serving gRPC over TLS, plaintext when empty")
+	flag.StringVar(&tlsConf.KeyFile, "tls-key", "", "PEM private key of the TLS certificate")
+	flag.StringVar(&tlsConf.ClientCAFile, "client-ca", "", "PEM CA certificates that client certificates must chain to, client certificates are not required when empty")
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nEvery flag may be set by a %s variable instead, e.g. %s.\n", envPrefix+"<FLAG>", envName("token-max-age"))
+	}
 	flag.Parse()
 
-	srv := grpc.NewServer()
+	if err := loadConfig(flag.CommandLine); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-	sessSvc := &jwt.SessionService{
-		SecretKey: []byte(authSecretKey),
-		MaxAge:    authTokenMaxAge,
+	if err := vaultConf.validate(); err != nil {
+		log.Fatal(err)
 	}
+	if *secretFile != "" && vaultConf.enabled() {
+		log.Fatal("secret file and Vault secret are mutually exclusive")
+	}
+	secrets := secretProvider(*secretFile, vaultConf)
 
-	auth.RegisterAuthServiceServer(srv, &AuthService{
-		SessionService: sessSvc,
-	})
+	if *secret == "" {
+		log.Fatal("secret must not be empty")
+	}
+	if *secret == defaultSecretKey && secrets == nil {
+		log.Printf("Using the development secret, set %s in production", envName("secret"))
+	}
+
+	if err := srcPolicy.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := store.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if vaultConf.enabled() && vaultConf.RefreshInterval > 0 && store.Kind != storeJWT {
+		log.Fatalf("%s store does not support rotating the Vault secret, set -secret-refresh-interval to 0", store.Kind)
+	}
+
+	if err := tlsConf.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := oidcConf.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := rateLimit.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := validateListenAddr(*listenAddr); err != nil {
+		log.Fatal(err)
+	}
+
+	if store.ServiceAccountMaxAge > 0 && *adminToken == "" {
+		log.Fatal("service accounts are created through the AdminService and require an admin token")
+	}
+
+	if *rpcTimeout < 0 {
+		log.Fatal("RPC timeout must not be negative")
+	}
+
+	if *drainTimeout <= 0 {
+		log.Fatal("drain timeout must be positive")
+	}
+
+	tlsCfg, err := tlsConf.config()
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificate: %v", err)
+	}
+	srvOpts := &server.Options{
+		Logger:        logger,
+		ServerOptions: serverOptions(tlsCfg),
+		Order: []string{
+			server.RequestIDInterceptor,
+			server.LoggingInterceptor,
+		},
+	}
+	// use registers an interceptor of the server, inside the ones before it.
+	use := func(i server.Interceptor) {
+		srvOpts.Interceptors = append(srvOpts.Interceptors, i)
+		srvOpts.Order = append(srvOpts.Order, i.Name)
+	}
+	var metricsSrv *http.Server
+	if *metricsPort != 0 {
+		m := prometheus.NewMetrics(nil)
+		store.Metrics = m
+		srvOpts.Metrics = m
+		srvOpts.Order = append(srvOpts.Order, server.MetricsInterceptor)
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		metricsSrv = &http.Server{Addr: fmt.Sprintf(":%d", *metricsPort), Handler: mux}
+		go func() {
+			log.Println(fmt.Sprintf("Palermo metrics, Listening on: %d", *metricsPort))
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to serve metrics: %v", err)
+			}
+		}()
+	}
+
+	// Time out above the recovery, so panics of abandoned handlers are
+	// recovered as well.
+	if *rpcTimeout > 0 {
+		use(server.Interceptor{
+			Name:  "timeout",
+			Unary: timeoutUnaryInterceptor(*rpcTimeout),
+		})
+	}
+
+	// Recover below the metrics, so panics are counted as INTERNAL errors.
+	srvOpts.Order = append(srvOpts.Order, server.RecoveryInterceptor)
+
+	if rateLimit.enabled() {
+		rl := newRateLimiter(*rateLimit)
+		use(server.Interceptor{
+			Name:   "ratelimit",
+			Unary:  rl.UnaryInterceptor,
+			Stream: rl.StreamInterceptor,
+		})
+	}
+
+	var tracer *otlp.Tracer
+	if *otlpEndpoint != "" {
+		tracer = otlp.NewTracer(*otlpEndpoint, *otlpServiceName)
+		tracer.Logger = logger
+		use(server.Interceptor{
+			Name:   "tracing",
+			Unary:  tracingUnaryInterceptor(tracer),
+			Stream: tracingStreamInterceptor(tracer),
+		})
+	}
+
+	unaryChain, streamChain, err := srvOpts.Chain()
+	if err != nil {
+		log.Fatalf("Invalid interceptors: %v", err)
+	}
+	srv := grpc.NewServer(append(srvOpts.ServerOptions,
+		grpc.UnaryInterceptor(unaryChain),
+		grpc.StreamInterceptor(streamChain),
+	)...)
+
+	rawSecret := []byte(*secret)
+	if secrets != nil {
+		rawSecret, err = fetchSecret(secrets)
+		if err != nil {
+			log.Fatalf("Failed to read secret: %v", err)
+		}
+	}
+	secretKey, err := signingKey(rawSecret, *kdfSalt)
+	if err != nil {
+		log.Fatalf("Failed to derive signing key: %v", err)
+	}
+
+	sessSvc, err := store.open(secretKey, *refreshWindow)
+	if err != nil {
+		log.Fatalf("Failed to open session store: %v", err)
+	}
+
+	var auditSink audit.Sink
+	if *auditFile != "" {
+		fs, err := audit.NewFileSink(*auditFile)
+		if err != nil {
+			log.Fatalf("Failed to open audit file: %v", err)
+		}
+		auditSink = fs
+	}
+
+	var handlerSvc palermo.SessionService = sessSvc
+	if tracer != nil {
+		handlerSvc = &tracing.SessionService{
+			SessionService: sessSvc,
+			Tracer:         tracer,
+			Backend:        store.Kind,
+		}
+	}
+	exporter, _ := sessSvc.(palermo.SessionExporter)
+	admin, _ := sessSvc.(palermo.SessionAdmin)
+
+	drain := newDrainer()
+	js := store.jwtSessions
+	if js != nil && vaultConf.enabled() && vaultConf.RefreshInterval > 0 {
+		go refreshSecret(secrets, vaultConf.RefreshInterval, *kdfSalt, js, drain.Done())
+	}
+	if store.purger != nil && store.PostgresPurgeInterval > 0 {
+		go store.purgeExpired(store.PostgresPurgeInterval, drain.Done())
+	}
+
+	reloader := &keyReloader{
+		KDFSalt:        *kdfSalt,
+		PrivateKeyFile: store.PrivateKeyFile,
+		Sessions:       js,
+		Certs:          tlsConf.certs,
+	}
+	if store.SigningMethod == jwt.SigningMethodHS256 {
+		reloader.Secret = secrets
+	}
+	go reloader.Run(drain.Done())
+
+	authSvc := &AuthService{
+		SessionService: handlerSvc,
+		Admin:          admin,
+		SourcePolicy:   srcPolicy,
+		OIDC:           oidcConf.verifier(),
+		Audit:          auditSink,
+		Events:         newEventHub(),
+		AdminToken:     *adminToken,
+		drain:          drain,
+	}
+	auth.RegisterAuthServiceServer(srv, authSvc)
+
+	hr := newHealthReporter(store.components)
+	if *adminToken != "" {
+		auth.RegisterAdminServiceServer(srv, &AdminService{
+			Admin:          admin,
+			Exporter:       exporter,
+			Token:          *adminToken,
+			Auth:           authSvc,
+			HealthReporter: hr,
+		})
+	}
+
+	healthpb.RegisterHealthServer(srv, hr.Server())
+	go hr.Run(drain.Done())
+
+	var pprofSrv *http.Server
+	if *pprofPort != 0 {
+		pprofSrv = pprofServer(*pprofPort)
+		go func() {
+			log.Println(fmt.Sprintf("Palermo pprof, Listening on: %s", pprofSrv.Addr))
+			if err := pprofSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to serve pprof: %v", err)
+			}
+		}()
+	}
+
+	var healthSrv *http.Server
+	if *healthPort != 0 {
+		healthSrv = &http.Server{Addr: fmt.Sprintf(":%d", *healthPort), Handler: hr.Handler()}
+		go func() {
+			log.Println(fmt.Sprintf("Palermo health, Listening on: %d", *healthPort))
+			if err := healthSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to serve health: %v", err)
+			}
+		}()
+	}
+
+	if *enableReflection {
+		reflection.Register(srv)
+	}
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
+	if *listenAddr != "" {
+		unixLis, err := listenUnix(*listenAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen: %v", err)
+		}
+		go func() {
+			log.Println(fmt.Sprintf("Palermo service, Listening on: %s", *listenAddr))
+			if err := srv.Serve(unixLis); err != nil && err != grpc.ErrServerStopped {
+				log.Fatalf("Failed to serve: %v", err)
+			}
+		}()
+	}
+
+	var httpSrv *http.Server
+	if *httpPort != 0 {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/openapi.json", openAPIHandler)
+		gw, err := newGateway(authSvc, unaryChain)
+		if err != nil {
+			log.Fatalf("Failed to set up the HTTP gateway: %v", err)
+		}
+		gw.Register(mux)
+		if js != nil {
+			mux.Handle("/.well-known/jwks.json", jwksHandler(js))
+		}
+
+		httpSrv = &http.Server{Addr: fmt.Sprintf(":%d", *httpPort), Handler: mux, TLSConfig: tlsCfg}
+		go func() {
+			log.Println(fmt.Sprintf("Palermo HTTP, Listening on: %d", *httpPort))
+			serve := httpSrv.ListenAndServe
+			if tlsCfg != nil {
+				serve = func() error { return httpSrv.ListenAndServeTLS("", "") }
+			}
+			if err := serve(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to serve HTTP: %v", err)
+			}
+		}()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+
+		log.Println("Stopping palermo service...")
+		hr.Shutdown()
+		drain.Drain()
+		// The health server stops last, so that readiness probes see the
+		// server as not serving while it drains.
+		gracefulStop(srv, *drainTimeout, httpSrv, metricsSrv, pprofSrv, healthSrv)
+		if c, ok := sessSvc.(io.Closer); ok {
+			c.Close()
+		}
+		if tracer != nil {
+			tracer.Close()
+		}
+		// No request is left to audit: flush the records emitted so far.
+		if c, ok := auditSink.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("Failed to close audit file: %v", err)
+			}
+		}
+		close(stopped)
+	}()
+
 	log.Println("Starting palermo service...")
 	log.Println(fmt.Sprintf("Palermo service, Listening on: %d", *port))
 	if err := srv.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
+	<-stopped
+}
+
+// envOr returns the value of the environment variable key, or def when it is
+// unset or empty.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
 }
 
 // AuthService ...
 type AuthService struct {
 	SessionService palermo.SessionService
+	SourcePolicy   *sourcePolicy
+
+	// Admin revokes every session of a user on DeleteAll, which is
+	// unimplemented when nil.
+	Admin palermo.SessionAdmin
+
+	// OIDC verifies the ID tokens exchanged for credentials on Create. The
+	// exchange is disabled when nil.
+	OIDC *oidc.Verifier
+
+	// Audit receives a record of every session lifecycle event. Disabled
+	// when nil.
+	Audit audit.Sink
+
+	// Events publishes the session lifecycle events to the Watch streams.
+	// Watch is unimplemented when nil.
+	Events *eventHub
+
+	// AdminToken authorizes the Watch streams of every user, which are
+	// refused when empty.
+	AdminToken string
+
+	drain *drainer
 }
 
 // Get ...
 func (as *AuthService) Get(ctx context.Context, gr *auth.GetRequest) (*auth.GetResponse, error) {
-	logrus.Info("AuthService: Method Get")
-	s, err := as.SessionService.Session(&palermo.SessionCredentials{
+	logEntry(ctx).Info("AuthService: Method Get", nil)
+	s, err := as.SessionService.Session(ctx, &palermo.SessionCredentials{
 		ValidationToken: gr.Data.ValidationToken,
 		AuthToken:       gr.Data.AuthToken,
 	})
 	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_VALIDATED, nil, err)
+		return nil, as.logSkewError(ctx, err)
+	}
+
+	if err := as.SourcePolicy.Check(ctx, s); err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_VALIDATED, s, err)
 		return nil, err
 	}
 
+	as.emitAudit(ctx, audit.AuditRecord_VALIDATED, s, nil)
 	return &auth.GetResponse{
-		Data: &auth.Session{
-			Id:        s.ID,
-			UserId:    s.UserID,
-			Email:     s.Email,
-			Token:     s.Token,
-			CreatedAt: s.CreatedAt.Unix(),
-			UpdatedAt: s.UpdatedAt.Unix(),
-		},
+		Data: sessionToProto(s),
 	}, nil
 }
 
 // Create ...
 func (as *AuthService) Create(ctx context.Context, gr *auth.CreateRequest) (*auth.CreateResponse, error) {
-	logrus.Info("AuthService: Method Create")
-	ss, err := as.SessionService.CreateSession(&palermo.Session{
-		ID:        gr.Data.Id,
-		UserID:    gr.Data.UserId,
-		Email:     gr.Data.Email,
-		Token:     gr.Data.Token,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	})
+	logEntry(ctx).Info("AuthService: Method Create", nil)
+	data := gr.Data
+	if data == nil {
+		data = &auth.Session{}
+	}
+	if data.ServiceAccount {
+		return nil, status.Error(codes.PermissionDenied, "service account credentials are only created by the AdminService")
+	}
+	s := &palermo.Session{
+		ID:             data.Id,
+		UserID:         data.UserId,
+		Email:          data.Email,
+		Token:          data.Token,
+		Anonymous:      data.Anonymous,
+		Source:         sourceFromContext(ctx),
+		Scopes:         data.Scopes,
+		APIVersion:     data.ApiVersion,
+		AllowedMethods: data.AllowedMethods,
+		Metadata:       data.Metadata,
+		NotBefore:      timeFromUnix(data.NotBefore),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if gr.IdToken != "" {
+		if err := as.exchangeIDToken(ctx, gr.IdToken, gr.AccessToken, s); err != nil {
+			as.emitAudit(ctx, audit.AuditRecord_CREATED, s, err)
+			return nil, err
+		}
+	}
+	ss, err := as.SessionService.CreateSession(ctx, s)
 	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_CREATED, s, err)
 		return nil, err
 	}
 
+	as.emitAudit(ctx, audit.AuditRecord_CREATED, mintedSession(s, ss), nil)
 	return &auth.CreateResponse{
 		Data: &auth.SessionCredentials{
 			ValidationToken: ss.ValidationToken,
 			AuthToken:       ss.AuthToken,
+			RefreshToken:    ss.RefreshToken,
 		},
 	}, nil
 }
 
 // Update ...
 func (as *AuthService) Update(ctx context.Context, gr *auth.UpdateRequest) (*auth.UpdateResponse, error) {
-	logrus.Info("AuthService: Method Update")
-	s, err := as.SessionService.RefreshSession(&palermo.SessionCredentials{
+	logEntry(ctx).Info("AuthService: Method Update", nil)
+	s, err := as.SessionService.RefreshSession(ctx, &palermo.SessionCredentials{
 		ValidationToken: gr.Data.ValidationToken,
 		AuthToken:       gr.Data.AuthToken,
+		RefreshToken:    gr.Data.RefreshToken,
 	})
 	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REFRESHED, nil, err)
+		return nil, as.logSkewError(ctx, err)
+	}
+
+	if err := as.SourcePolicy.Check(ctx, s); err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REFRESHED, s, err)
 		return nil, err
 	}
 
+	if gr.Data.RefreshToken == "" {
+		as.emitAudit(ctx, audit.AuditRecord_REFRESHED, s, nil)
+		return &auth.UpdateResponse{
+			Data: sessionToProto(s),
+		}, nil
+	}
+
+	// Refresh tokens may be single-use: hand out new credentials so that
+	// the client can refresh again.
+	nc, err := as.SessionService.UpdateSession(ctx, s)
+	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REFRESHED, s, err)
+		return nil, err
+	}
+
+	as.emitAudit(ctx, audit.AuditRecord_REFRESHED, mintedSession(s, nc), nil)
+
 	return &auth.UpdateResponse{
-		Data: &auth.Session{
-			Id:        s.ID,
-			UserId:    s.UserID,
-			Email:     s.Email,
-			Token:     s.Token,
-			CreatedAt: s.CreatedAt.Unix(),
-			UpdatedAt: s.UpdatedAt.Unix(),
+		Data: sessionToProto(s),
+		Credentials: &auth.SessionCredentials{
+			ValidationToken: nc.ValidationToken,
+			AuthToken:       nc.AuthToken,
+			RefreshToken:    nc.RefreshToken,
+		},
+	}, nil
+}
+
+// GetOrRefresh validates the given credentials and, once their refresh window
+// is open, returns new credentials along with the session. Invalid
+// credentials carrying a refresh token are refreshed as well, e.g. once the
+// authentication token expired.
+func (as *AuthService) GetOrRefresh(ctx context.Context, gr *auth.GetOrRefreshRequest) (*auth.GetOrRefreshResponse, error) {
+	logEntry(ctx).Info("AuthService: Method GetOrRefresh", nil)
+	c := &palermo.SessionCredentials{
+		ValidationToken: gr.Data.ValidationToken,
+		AuthToken:       gr.Data.AuthToken,
+		RefreshToken:    gr.Data.RefreshToken,
+	}
+
+	s, err := as.SessionService.Session(ctx, c)
+	if err != nil && c.RefreshToken == "" {
+		as.emitAudit(ctx, audit.AuditRecord_VALIDATED, nil, err)
+		return nil, as.logSkewError(ctx, err)
+	}
+
+	if err == nil {
+		if err := as.SourcePolicy.Check(ctx, s); err != nil {
+			as.emitAudit(ctx, audit.AuditRecord_VALIDATED, s, err)
+			return nil, err
+		}
+
+		as.emitAudit(ctx, audit.AuditRecord_VALIDATED, s, nil)
+		if s.RefreshableAt.IsZero() || time.Now().Before(s.RefreshableAt) {
+			return &auth.GetOrRefreshResponse{
+				Data: sessionToProto(s),
+			}, nil
+		}
+	}
+
+	s, err = as.SessionService.RefreshSession(ctx, c)
+	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REFRESHED, nil, err)
+		return nil, as.logSkewError(ctx, err)
+	}
+
+	if err := as.SourcePolicy.Check(ctx, s); err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REFRESHED, s, err)
+		return nil, err
+	}
+
+	nc, err := as.SessionService.UpdateSession(ctx, s)
+	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REFRESHED, s, err)
+		return nil, err
+	}
+
+	as.emitAudit(ctx, audit.AuditRecord_REFRESHED, mintedSession(s, nc), nil)
+
+	return &auth.GetOrRefreshResponse{
+		Data: sessionToProto(s),
+		Credentials: &auth.SessionCredentials{
+			ValidationToken: nc.ValidationToken,
+			AuthToken:       nc.AuthToken,
+			RefreshToken:    nc.RefreshToken,
 		},
 	}, nil
 }
 
-// Delete ...
+// Delete revokes the given credentials of a user, e.g. on logout.
 func (as *AuthService) Delete(ctx context.Context, gr *auth.DeleteRequest) (*auth.DeleteResponse, error) {
-	logrus.Info("AuthService: Method Delete")
-	return nil, nil
+	logEntry(ctx).Info("AuthService: Method Delete", nil)
+	if gr.Credentials == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+
+	c := &palermo.SessionCredentials{
+		ValidationToken: gr.Credentials.ValidationToken,
+		AuthToken:       gr.Credentials.AuthToken,
+	}
+
+	s, err := as.SessionService.Session(ctx, c)
+	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REVOKED, nil, err)
+		return nil, as.logSkewError(ctx, err)
+	}
+
+	if s.UserID != gr.UserId {
+		err := status.Error(codes.PermissionDenied, "credentials do not belong to user")
+		as.emitAudit(ctx, audit.AuditRecord_REVOKED, s, err)
+		return nil, err
+	}
+
+	if err := as.SessionService.RevokeSession(ctx, c); err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REVOKED, s, err)
+		return nil, err
+	}
+
+	as.emitAudit(ctx, audit.AuditRecord_REVOKED, s, nil)
+	return &auth.DeleteResponse{
+		Data: &auth.User{
+			UserId: s.UserID,
+			Email:  s.Email,
+		},
+	}, nil
+}
+
+// DeleteAll revokes every session of a user given the credentials of one of
+// them, e.g. to log out all devices after a password change. It requires a
+// store-backed session backend.
+func (as *AuthService) DeleteAll(ctx context.Context, dr *auth.DeleteAllRequest) (*auth.DeleteAllResponse, error) {
+	logEntry(ctx).Info("AuthService: Method DeleteAll", nil)
+	if as.Admin == nil {
+		return nil, status.Error(codes.Unimplemented, "session backend does not support revoking every session of a user")
+	}
+	if dr.Credentials == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+
+	s, err := as.SessionService.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: dr.Credentials.ValidationToken,
+		AuthToken:       dr.Credentials.AuthToken,
+	})
+	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REVOKED, nil, err)
+		return nil, as.logSkewError(ctx, err)
+	}
+
+	if s.UserID != dr.UserId {
+		err := status.Error(codes.PermissionDenied, "credentials do not belong to user")
+		as.emitAudit(ctx, audit.AuditRecord_REVOKED, s, err)
+		return nil, err
+	}
+
+	sessions, err := as.Admin.RevokeUserSessions(ctx, s.UserID)
+	if err != nil {
+		as.emitAudit(ctx, audit.AuditRecord_REVOKED, s, err)
+		return nil, err
+	}
+	for _, rs := range sessions {
+		as.emitAudit(ctx, audit.AuditRecord_REVOKED, rs, nil)
+	}
+
+	return &auth.DeleteAllResponse{
+		Data: &auth.User{
+			UserId: s.UserID,
+			Email:  s.Email,
+		},
+		Revoked: int32(len(sessions)),
+	}, nil
+}
+
+// Introspect reports whether the given credentials are active along with a
+// few of their claims, RFC 7662 style, so resource servers can check them
+// cheaply. Invalid credentials are reported inactive rather than failing.
+// The source policy is not applied, as callers are resource servers rather
+// than the session holder.
+func (as *AuthService) Introspect(ctx context.Context, ir *auth.IntrospectRequest) (*auth.IntrospectResponse, error) {
+	logEntry(ctx).Info("AuthService: Method Introspect", nil)
+	if ir.Credentials == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+
+	s, err := as.SessionService.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: ir.Credentials.ValidationToken,
+		AuthToken:       ir.Credentials.AuthToken,
+	})
+	as.emitAudit(ctx, audit.AuditRecord_VALIDATED, s, err)
+	if err != nil {
+		as.logSkewError(ctx, err)
+		return &auth.IntrospectResponse{}, nil
+	}
+
+	return &auth.IntrospectResponse{
+		Active:         true,
+		Scope:          strings.Join(s.Scopes, " "),
+		Sub:            s.UserID,
+		Exp:            unixTime(s.ExpiresAt),
+		Nbf:            unixTime(s.NotBefore),
+		Jti:            s.TokenID,
+		Anonymous:      s.Anonymous,
+		ServiceAccount: s.ServiceAccount,
+	}, nil
+}
+
+// Validate reports whether the given credentials are valid along with their
+// expiry, skipping the session payload for callers on hot paths. Invalid
+// credentials are reported rather than failing, and the source policy is
+// applied as by Get.
+func (as *AuthService) Validate(ctx context.Context, vr *auth.ValidateRequest) (*auth.ValidateResponse, error) {
+	logEntry(ctx).Info("AuthService: Method Validate", nil)
+	if vr.Credentials == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+
+	s, err := as.SessionService.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: vr.Credentials.ValidationToken,
+		AuthToken:       vr.Credentials.AuthToken,
+	})
+	if err == nil {
+		err = as.SourcePolicy.Check(ctx, s)
+	} else {
+		as.logSkewError(ctx, err)
+	}
+
+	as.emitAudit(ctx, audit.AuditRecord_VALIDATED, s, err)
+	if err != nil {
+		return &auth.ValidateResponse{}, nil
+	}
+	return &auth.ValidateResponse{
+		Valid:     true,
+		ExpiresAt: unixTime(s.ExpiresAt),
+	}, nil
+}
+
+func sessionToProto(s *palermo.Session) *auth.Session {
+	return &auth.Session{
+		Id:             s.ID,
+		UserId:         s.UserID,
+		Email:          s.Email,
+		Token:          s.Token,
+		Anonymous:      s.Anonymous,
+		ServiceAccount: s.ServiceAccount,
+		Source:         s.Source,
+		Scopes:         s.Scopes,
+		ApiVersion:     s.APIVersion,
+		AllowedMethods: s.AllowedMethods,
+		Metadata:       s.Metadata,
+		CreatedAt:      s.CreatedAt.Unix(),
+		UpdatedAt:      s.UpdatedAt.Unix(),
+		ExpiresAt:      s.ExpiresAt.Unix(),
+		RefreshableAt:  unixTime(s.RefreshableAt),
+		NotBefore:      unixTime(s.NotBefore),
+		TokenId:        s.TokenID,
+	}
+}
+
+// logSkewError logs the timing details of token time validation failures so
+// clock skew between hosts can be diagnosed, and returns err. The details
+// are only attached to the returned status for trusted callers, sending the
+// admin token, as they reveal the server clock.
+func (as *AuthService) logSkewError(ctx context.Context, err error) error {
+	se, ok := err.(*jwt.SkewError)
+	if !ok {
+		return err
+	}
+
+	logEntry(ctx).Warn("AuthService: token time validation failed", palermo.Fields{
+		"error":      se.Err.Error(),
+		"server_now": se.Now.Format(time.RFC3339),
+		"leeway":     se.Leeway.String(),
+		"iat":        formatTime(se.IssuedAt),
+		"exp":        formatTime(se.ExpiresAt),
+		"nbf":        formatTime(se.NotBefore),
+	})
+
+	if checkAdminToken(ctx, as.AdminToken) != nil {
+		return err
+	}
+	st, derr := status.Convert(err).WithDetails(&auth.SkewDetails{
+		ServerNow: se.Now.Unix(),
+		LeewayMs:  int64(se.Leeway / time.Millisecond),
+		Iat:       unixTime(se.IssuedAt),
+		Exp:       unixTime(se.ExpiresAt),
+		Nbf:       unixTime(se.NotBefore),
+	})
+	if derr != nil {
+		return err
+	}
+	return st.Err()
+}
+
+// unixTime returns t in Unix seconds, or 0 when t is the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// timeFromUnix returns the time of the given Unix seconds, or the zero time
+// for 0.
+func timeFromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
 }
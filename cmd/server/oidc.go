@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/oidc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// oidcConfig enables the exchange of the ID tokens of an external OpenID
+// Connect provider for palermo credentials on Create.
+type oidcConfig struct {
+	Issuer               string
+	ClientIDs            string
+	JWKSURL              string
+	AllowUnverifiedEmail bool
+}
+
+func (oc *oidcConfig) validate() error {
+	if oc.Issuer == "" {
+		if oc.ClientIDs != "" || oc.JWKSURL != "" {
+			return errors.New("OIDC token exchange requires an issuer")
+		}
+		return nil
+	}
+	if oc.ClientIDs == "" {
+		return errors.New("OIDC token exchange requires client ids")
+	}
+	return nil
+}
+
+// verifier returns the verifier of the ID tokens, nil when the exchange is
+// disabled.
+func (oc *oidcConfig) verifier() *oidc.Verifier {
+	if oc.Issuer == "" {
+		return nil
+	}
+
+	v := &oidc.Verifier{
+		Issuer:               oc.Issuer,
+		ClientIDs:            strings.Split(oc.ClientIDs, ","),
+		AllowUnverifiedEmail: oc.AllowUnverifiedEmail,
+		Logger:               logger,
+	}
+	if oc.JWKSURL != "" {
+		v.Keys = &jwt.RemoteKeySet{URL: oc.JWKSURL, Logger: logger}
+	}
+	return v
+}
+
+// exchangeIDToken verifies the given ID token, along with the access token
+// issued with it when given, and sets the user of s to the one it was issued
+// to.
+func (as *AuthService) exchangeIDToken(ctx context.Context, idToken, accessToken string, s *palermo.Session) error {
+	if as.OIDC == nil {
+		return status.Error(codes.FailedPrecondition, "OIDC token exchange is not enabled")
+	}
+
+	var claims *oidc.Claims
+	var err error
+	if accessToken != "" {
+		claims, err = as.OIDC.VerifyWithAccessToken(ctx, idToken, accessToken)
+	} else {
+		claims, err = as.OIDC.Verify(ctx, idToken)
+	}
+	switch err {
+	case nil:
+	case oidc.ErrProviderUnavailable, jwt.ErrRemoteKeysUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		logEntry(ctx).Info("AuthService: rejected ID token", palermo.Fields{"error": err.Error()})
+		return status.Error(codes.Unauthenticated, "invalid ID token")
+	}
+
+	s.UserID = claims.Subject
+	s.Email = claims.Email
+	s.Anonymous = false
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import "net/http"
+
+// openAPIDocument describes the HTTP/JSON API of the AuthService. Field names
+// follow the original proto names and 64 bits integers are encoded as strings,
+// as mandated by the proto3 JSON mapping.
+const openAPIDocument = `{
+  "openapi": "3.0.2",
+  "info": {
+    "title": "Palermo AuthService",
+    "description": "Creates, validates, refreshes and revokes user sessions.",
+    "version": "v1"
+  },
+  "paths": {
+    "/v1/sessions": {
+      "post": {
+        "operationId": "Create",
+        "summary": "Creates credentials for a new session.",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Session"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Session credentials.",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CreateResponse"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/sessions/validate": {
+      "post": {
+        "operationId": "Get",
+        "summary": "Validates credentials and returns the associated session.",
+        "description": "Credentials are read from the body or, when it is empty, from the Authorization and X-Validation-Token headers or the access_token cookie.",
+        "security": [{"bearerAuth": [], "validationToken": []}, {"cookieAuth": [], "validationToken": []}],
+        "requestBody": {
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SessionCredentials"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "The validated session.",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SessionResponse"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/sessions/refresh": {
+      "post": {
+        "operationId": "Update",
+        "summary": "Validates possibly expired credentials and returns the refreshed session.",
+        "description": "Credentials are read from the body or, when it is empty, from the Authorization and X-Validation-Token headers or the access_token cookie.",
+        "security": [{"bearerAuth": [], "validationToken": []}, {"cookieAuth": [], "validationToken": []}],
+        "requestBody": {
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SessionCredentials"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "The refreshed session, with new credentials when refreshed with a refresh token.",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/UpdateResponse"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/sessions/introspect": {
+      "post": {
+        "operationId": "Introspect",
+        "summary": "Reports whether credentials are active, RFC 7662 style.",
+        "description": "Invalid credentials are reported inactive rather than failing.",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/IntrospectRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "The credentials status.",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/IntrospectResponse"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/users/{user_id}/sessions": {
+      "delete": {
+        "operationId": "Delete",
+        "summary": "Revokes the session of the given credentials, e.g. on logout.",
+        "description": "Credentials are read from the body or, when it is empty, from the Authorization and X-Validation-Token headers or the access_token cookie, and must belong to the user.",
+        "security": [{"bearerAuth": [], "validationToken": []}, {"cookieAuth": [], "validationToken": []}],
+        "parameters": [
+          {"name": "user_id", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "requestBody": {
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SessionCredentials"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "The user whose session was revoked.",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DeleteResponse"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Session": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "user_id": {"type": "string"},
+          "email": {"type": "string", "format": "email"},
+          "token": {"type": "string"},
+          "created_at": {"type": "string", "format": "int64", "description": "Unix time in seconds."},
+          "updated_at": {"type": "string", "format": "int64", "description": "Unix time in seconds."},
+          "anonymous": {"type": "boolean"},
+          "service_account": {"type": "boolean", "readOnly": true, "description": "Set on the sessions of services, whose credentials are only created by the AdminService."},
+          "source": {"type": "string", "readOnly": true},
+          "scopes": {"type": "array", "items": {"type": "string"}},
+          "api_version": {"type": "string"},
+          "allowed_methods": {"type": "array", "items": {"type": "string"}},
+          "metadata": {"type": "object", "additionalProperties": {"type": "string"}},
+          "not_before": {"type": "string", "format": "int64", "description": "Unix time in seconds from which the session is valid, unset when valid on creation."},
+          "expires_at": {"type": "string", "format": "int64", "readOnly": true, "description": "Unix time in seconds."},
+          "refreshable_at": {"type": "string", "format": "int64", "readOnly": true, "description": "Unix time in seconds from which credentials may be refreshed, unset when they may be refreshed at any time."},
+          "token_id": {"type": "string", "readOnly": true, "description": "Identifies the credentials of the session."}
+        }
+      },
+      "SessionCredentials": {
+        "type": "object",
+        "properties": {
+          "validation_token": {"type": "string"},
+          "auth_token": {"type": "string"},
+          "refresh_token": {"type": "string"}
+        }
+      },
+      "User": {
+        "type": "object",
+        "properties": {
+          "user_id": {"type": "string"},
+          "fullname": {"type": "string"},
+          "email": {"type": "string", "format": "email"}
+        }
+      },
+      "CreateResponse": {
+        "type": "object",
+        "properties": {"data": {"$ref": "#/components/schemas/SessionCredentials"}}
+      },
+      "SessionResponse": {
+        "type": "object",
+        "properties": {"data": {"$ref": "#/components/schemas/Session"}}
+      },
+      "UpdateResponse": {
+        "type": "object",
+        "properties": {
+          "data": {"$ref": "#/components/schemas/Session"},
+          "credentials": {"$ref": "#/components/schemas/SessionCredentials"}
+        }
+      },
+      "DeleteResponse": {
+        "type": "object",
+        "properties": {"data": {"$ref": "#/components/schemas/User"}}
+      },
+      "IntrospectRequest": {
+        "type": "object",
+        "properties": {"credentials": {"$ref": "#/components/schemas/SessionCredentials"}}
+      },
+      "IntrospectResponse": {
+        "type": "object",
+        "properties": {
+          "active": {"type": "boolean"},
+          "scope": {"type": "string", "description": "Space-separated scopes."},
+          "sub": {"type": "string"},
+          "exp": {"type": "string", "format": "int64", "description": "Unix time in seconds."},
+          "nbf": {"type": "string", "format": "int64", "description": "Unix time in seconds."},
+          "jti": {"type": "string"},
+          "anonymous": {"type": "boolean"},
+          "service_account": {"type": "boolean"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error": {"type": "string"},
+          "code": {"type": "integer", "format": "int32", "description": "gRPC status code."},
+          "message": {"type": "string"},
+          "details": {"type": "array", "items": {"type": "object"}}
+        }
+      }
+    },
+    "responses": {
+      "Error": {
+        "description": "The request failed.",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    },
+    "securitySchemes": {
+      "bearerAuth": {"type": "http", "scheme": "bearer", "bearerFormat": "JWT", "description": "Authentication token."},
+      "cookieAuth": {"type": "apiKey", "in": "cookie", "name": "access_token", "description": "Authentication token."},
+      "validationToken": {"type": "apiKey", "in": "header", "name": "X-Validation-Token"}
+    }
+  }
+}
+`
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(openAPIDocument))
+}
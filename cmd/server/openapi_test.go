@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Responses   map[string]json.RawMessage `json:"responses"`
+}
+
+type openAPIDoc struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components map[string]map[string]json.RawMessage  `json:"components"`
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	rec := httptest.NewRecorder()
+	openAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("served as %q", ct)
+	}
+
+	var doc openAPIDoc
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") || doc.Info.Title == "" || doc.Info.Version == "" {
+		t.Errorf("invalid OpenAPI header: %q %+v", doc.OpenAPI, doc.Info)
+	}
+
+	var ops []string
+	for path, methods := range doc.Paths {
+		for method, op := range methods {
+			if op.OperationID == "" || len(op.Responses) == 0 {
+				t.Errorf("%s %s has no operation id or responses", method, path)
+			}
+			ops = append(ops, op.OperationID)
+		}
+	}
+	sort.Strings(ops)
+	if want := []string{"Create", "Delete", "Get", "Introspect", "Update"}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("got operations %q, want %q", ops, want)
+	}
+
+	// Every reference resolves to a component.
+	for _, ref := range strings.Split(rec.Body.String(), `"$ref": "`)[1:] {
+		ref = ref[:strings.Index(ref, `"`)]
+		parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+		if len(parts) != 2 || doc.Components[parts[0]][parts[1]] == nil {
+			t.Errorf("unresolved reference %s", ref)
+		}
+	}
+}
+
+func TestOpenAPIDocumentMatchesGateway(t *testing.T) {
+	var doc openAPIDoc
+	if err := json.Unmarshal([]byte(openAPIDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, _, methods := newTestGateway(t)
+	defer srv.Close()
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			t.Run(op.OperationID, func(t *testing.T) {
+				*methods = nil
+				req, err := http.NewRequest(strings.ToUpper(method), srv.URL+strings.Replace(path, "{user_id}", "42", 1), strings.NewReader("{}"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+
+				if len(*methods) != 1 || (*methods)[0] != "/auth.AuthService/"+op.OperationID {
+					t.Errorf("%s %s called %q, want %s", method, path, *methods, op.OperationID)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+)
+
+// pprofServer returns the server exposing the runtime profiles on the given
+// port of the loopback interface only, as profiles leak implementation
+// details and are costly to collect. Operators reach it through SSH or
+// kubectl port-forward.
+func pprofServer(port int64) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return &http.Server{Addr: fmt.Sprintf("127.0.0.1:%d", port), Handler: mux}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// errRateLimited is returned to callers exceeding the rate limits.
+var errRateLimited = status.Error(codes.ResourceExhausted, "rate limit exceeded")
+
+// peerSweepInterval is how often the buckets of idle peers are dropped.
+const peerSweepInterval = time.Minute
+
+// rateLimitConfig limits the request rate of the server as a whole and of
+// each peer, with token buckets: a bucket holds up to Burst requests and
+// refills at Rate requests per second. Limits are disabled when their rate
+// is zero.
+type rateLimitConfig struct {
+	Rate      float64
+	Burst     int
+	PeerRate  float64
+	PeerBurst int
+}
+
+func (rc *rateLimitConfig) validate() error {
+	if rc.Rate < 0 || rc.PeerRate < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+	if rc.Rate > 0 && rc.Burst < 1 || rc.PeerRate > 0 && rc.PeerBurst < 1 {
+		return errors.New("rate limit bursts must be at least 1")
+	}
+	return nil
+}
+
+func (rc *rateLimitConfig) enabled() bool {
+	return rc.Rate > 0 || rc.PeerRate > 0
+}
+
+// rateLimiter enforces a rateLimitConfig.
+type rateLimiter struct {
+	conf rateLimitConfig
+	now  func() time.Time
+
+	mu        sync.Mutex
+	global    bucket
+	peers     map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(conf rateLimitConfig) *rateLimiter {
+	rl := &rateLimiter{
+		conf:  conf,
+		now:   time.Now,
+		peers: make(map[string]*bucket),
+	}
+	rl.global = bucket{tokens: float64(conf.Burst), last: rl.now()}
+	return rl
+}
+
+// Allow reports whether a request from the given peer is within the limits,
+// consuming a token from the buckets when it is.
+func (rl *rateLimiter) Allow(peerAddr string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.sweep(now)
+
+	var pb *bucket
+	if rl.conf.PeerRate > 0 {
+		pb = rl.peers[peerAddr]
+		if pb == nil {
+			pb = &bucket{tokens: float64(rl.conf.PeerBurst), last: now}
+			rl.peers[peerAddr] = pb
+		}
+		pb.refill(now, rl.conf.PeerRate, rl.conf.PeerBurst)
+		if pb.tokens < 1 {
+			return false
+		}
+	}
+
+	if rl.conf.Rate > 0 {
+		rl.global.refill(now, rl.conf.Rate, rl.conf.Burst)
+		if rl.global.tokens < 1 {
+			return false
+		}
+		rl.global.tokens--
+	}
+
+	if pb != nil {
+		pb.tokens--
+	}
+	return true
+}
+
+// sweep drops the buckets of the peers idle long enough for their bucket to
+// be full again, as they are indistinguishable from new ones.
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < peerSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+
+	for addr, b := range rl.peers {
+		b.refill(now, rl.conf.PeerRate, rl.conf.PeerBurst)
+		if b.tokens >= float64(rl.conf.PeerBurst) {
+			delete(rl.peers, addr)
+		}
+	}
+}
+
+// UnaryInterceptor rejects the unary RPCs exceeding the limits.
+func (rl *rateLimiter) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !rl.Allow(peerHost(ctx)) {
+		return nil, errRateLimited
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor rejects the streaming RPCs exceeding the limits.
+func (rl *rateLimiter) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !rl.Allow(peerHost(ss.Context())) {
+		return errRateLimited
+	}
+	return handler(srv, ss)
+}
+
+// peerHost returns the network address of the caller without its port.
+// Unlike sourceFromContext, it ignores the device id sent by the caller,
+// which could be forged to evade the limits.
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// bucket is a token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) refill(now time.Time, rate float64, burst int) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+	b.last = now
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/handle"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/memory"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+func TestUpdateRotatesRefreshHandles(t *testing.T) {
+	logger := &palermotest.Logger{}
+	js := &jwt.SessionService{
+		SecretKey:       []byte("0123456789abcdef0123456789abcdef"),
+		MaxAge:          time.Minute,
+		RefreshMaxAge:   time.Hour,
+		RevocationStore: &memory.RevocationStore{},
+		ReplayGuard:     &memory.ReplayGuard{},
+		Logger:          logger,
+	}
+	as := &AuthService{
+		SessionService: &handle.SessionService{
+			SessionService: js,
+			Store:          &handle.MemoryStore{},
+			MaxAge:         time.Hour,
+		},
+		drain: newDrainer(),
+	}
+
+	ctx := context.Background()
+	cr, err := as.Create(ctx, &auth.CreateRequest{Data: &auth.Session{UserId: "42", Email: "jane@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := cr.Data
+	creds := first
+	for i := 1; i <= 3; i++ {
+		ur, err := as.Update(ctx, &auth.UpdateRequest{Data: creds})
+		if err != nil {
+			t.Fatalf("refresh %d: %v", i, err)
+		}
+		if ur.Credentials == nil || ur.Credentials.RefreshToken == "" {
+			t.Fatalf("refresh %d: no new refresh handle", i)
+		}
+		if ur.Credentials.RefreshToken == creds.RefreshToken {
+			t.Fatalf("refresh %d: refresh handle not rotated", i)
+		}
+		creds = ur.Credentials
+	}
+	if warns := logger.Messages("warn"); len(warns) != 0 {
+		t.Fatalf("legitimate refreshes logged %q", warns)
+	}
+
+	// Reusing the first refresh handle is a replay.
+	if _, err := as.Update(ctx, &auth.UpdateRequest{Data: first}); err != jwt.ErrReplayed {
+		t.Errorf("replayed refresh = %v, want %v", err, jwt.ErrReplayed)
+	}
+	if warns := logger.Messages("warn"); len(warns) != 1 {
+		t.Errorf("replay logged %q, want one warning", warns)
+	}
+}
+
+func TestGetOrRefresh(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	expired, err := (&jwt.SessionService{SecretKey: key, MaxAge: time.Hour, TestMode: true}).CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		window    time.Duration
+		creds     *palermo.SessionCredentials
+		wantErr   bool
+		wantCreds bool
+	}{
+		{"within the refresh window", time.Hour, nil, false, true},
+		{"before the refresh window", 10 * time.Minute, nil, false, false},
+		{"without refresh window", 0, nil, false, false},
+		{"expired", time.Hour, expired, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &jwt.SessionService{SecretKey: key, MaxAge: time.Hour, RefreshWindow: tt.window}
+			as := &AuthService{SessionService: js, drain: newDrainer()}
+			c := tt.creds
+			if c == nil {
+				if c, err = js.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			resp, err := as.GetOrRefresh(ctx, &auth.GetOrRefreshRequest{Data: &auth.SessionCredentials{
+				ValidationToken: c.ValidationToken,
+				AuthToken:       c.AuthToken,
+			}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetOrRefresh() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if resp.Data.GetUserId() != "42" {
+				t.Errorf("got session of %q", resp.Data.GetUserId())
+			}
+			if got := resp.Credentials != nil; got != tt.wantCreds {
+				t.Fatalf("returned new credentials: %v, want %v", got, tt.wantCreds)
+			}
+			if resp.Credentials == nil {
+				return
+			}
+			if resp.Credentials.AuthToken == c.AuthToken {
+				t.Error("returned the current credentials")
+			}
+			nc := &palermo.SessionCredentials{ValidationToken: resp.Credentials.ValidationToken, AuthToken: resp.Credentials.AuthToken}
+			if s, err := js.Session(ctx, nc); err != nil || s.UserID != "42" {
+				t.Errorf("new credentials: %v, %v", s, err)
+			}
+		})
+	}
+}
+
+func TestGetRefreshableAt(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		window time.Duration
+	}{
+		{"with refresh window", 10 * time.Minute},
+		{"without refresh window", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &jwt.SessionService{SecretKey: []byte("0123456789abcdef0123456789abcdef"), MaxAge: time.Hour, RefreshWindow: tt.window}
+			as := &AuthService{SessionService: js, drain: newDrainer()}
+			c, err := js.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := as.Get(ctx, &auth.GetRequest{Data: &auth.SessionCredentials{ValidationToken: c.ValidationToken, AuthToken: c.AuthToken}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want int64
+			if tt.window > 0 {
+				want = resp.Data.ExpiresAt - int64(tt.window/time.Second)
+			}
+			if resp.Data.RefreshableAt != want {
+				t.Errorf("refreshable_at = %d, want %d", resp.Data.RefreshableAt, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+// errNoKeyRotation is reported when reloading keys the session store does
+// not sign with.
+var errNoKeyRotation = errors.New("the session store does not rotate its keys")
+
+// keyReloader reloads the key material from its files and secret store on
+// SIGHUP, so that config management can rotate keys with zero downtime:
+// listeners are kept, and tokens signed with the replaced keys stay valid
+// until they expire.
+type keyReloader struct {
+	// Secret provides the HS256 secret, nil when it is given on the command
+	// line.
+	Secret  palermo.SecretProvider
+	KDFSalt string
+
+	// PrivateKeyFile holds the key signing tokens with asymmetric signing
+	// methods, if any.
+	PrivateKeyFile string
+
+	// Sessions is the service whose keys are rotated, beneath the handles
+	// if any, nil when the store does not sign JWTs. Reloading a secret or a
+	// private key then fails.
+	Sessions *jwt.SessionService
+
+	// Certs serves the TLS certificate, nil when TLS is disabled.
+	Certs *certReloader
+}
+
+// Reload reloads every key material. Keys failing to load are reported and
+// the current ones kept, without preventing the others from being reloaded.
+func (kr *keyReloader) Reload() error {
+	var errs []string
+	if kr.Certs != nil {
+		if err := kr.Certs.Reload(); err != nil {
+			errs = append(errs, "TLS certificate: "+err.Error())
+		}
+	}
+	if kr.Secret != nil {
+		err := errNoKeyRotation
+		if kr.Sessions != nil {
+			err = rotateSecret(kr.Secret, kr.KDFSalt, kr.Sessions)
+		}
+		if err != nil {
+			errs = append(errs, "secret: "+err.Error())
+		}
+	}
+	if kr.PrivateKeyFile != "" {
+		err := errNoKeyRotation
+		if kr.Sessions != nil {
+			var key crypto.Signer
+			key, err = jwt.LoadPrivateKey(kr.PrivateKeyFile)
+			if err == nil {
+				err = kr.Sessions.RotatePrivateKey(key)
+			}
+		}
+		if err != nil {
+			errs = append(errs, "private key: "+err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Run reloads the keys on each SIGHUP until done is closed.
+func (kr *keyReloader) Run(done <-chan struct{}) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-sig:
+		case <-done:
+			return
+		}
+
+		if err := kr.Reload(); err != nil {
+			logger.Error("Failed to reload keys, keeping the current ones", palermo.Fields{"error": err.Error()})
+			continue
+		}
+		logger.Info("Reloaded keys", nil)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+)
+
+func TestKeyReloaderRotatesSecretBeneathHandles(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "palermo-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "secret")
+
+	sc := &storeConfig{Kind: storeJWT, MaxAge: time.Minute, Revocation: revocationMemory, Handles: handleMemory}
+	ss, err := sc.open([]byte("0123456789abcdef0123456789abcdef"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := ss.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(secretFile, []byte("fedcba9876543210fedcba9876543210\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kr := &keyReloader{Secret: fileSecret(secretFile), Sessions: sc.jwtSessions}
+	if err := kr.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ss.Session(ctx, before); err != nil {
+		t.Errorf("Session() of credentials signed before the reload = %v", err)
+	}
+	after, err := ss.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.Session(ctx, after); err != nil {
+		t.Errorf("Session() of credentials signed after the reload = %v", err)
+	}
+}
+
+func TestKeyReloaderWithoutJWTStore(t *testing.T) {
+	kr := &keyReloader{Secret: fileSecret("/nonexistent"), PrivateKeyFile: "/nonexistent"}
+	err := kr.Reload()
+	if err == nil {
+		t.Fatal("Reload() without a JWT store succeeded")
+	}
+	for _, key := range []string{"secret: ", "private key: "} {
+		if !strings.Contains(err.Error(), key+errNoKeyRotation.Error()) {
+			t.Errorf("Reload() = %v, want the %s reported", err, strings.TrimSuffix(key, ": "))
+		}
+	}
+}
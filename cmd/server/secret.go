@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/vault"
+)
+
+// secretFetchTimeout bounds each fetch of the secret.
+const secretFetchTimeout = 10 * time.Second
+
+// vaultConfig reads the secret from HashiCorp Vault instead of the
+// command line, and re-reads it periodically so it can be rotated without
+// restarting the service.
+type vaultConfig struct {
+	Addr            string
+	Token           string
+	Path            string
+	Field           string
+	RefreshInterval time.Duration
+}
+
+func (vc *vaultConfig) enabled() bool {
+	return vc.Path != ""
+}
+
+func (vc *vaultConfig) validate() error {
+	if !vc.enabled() {
+		return nil
+	}
+	if vc.Addr == "" || vc.Token == "" {
+		return errors.New("vault secret requires an address and a token")
+	}
+	if vc.RefreshInterval < 0 {
+		return errors.New("secret refresh interval must not be negative")
+	}
+	return nil
+}
+
+func (vc *vaultConfig) provider() palermo.SecretProvider {
+	return &vault.SecretProvider{
+		Address: vc.Addr,
+		Token:   vc.Token,
+		Path:    vc.Path,
+		Field:   vc.Field,
+	}
+}
+
+// fileSecret reads the secret from a file, e.g. a mounted Kubernetes
+// secret, so that it can be replaced on disk and reloaded.
+type fileSecret string
+
+func (f fileSecret) Secret(context.Context) ([]byte, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimRight(b, "\r\n")
+	if len(b) == 0 {
+		return nil, errors.New("empty secret file " + string(f))
+	}
+	return b, nil
+}
+
+// secretProvider returns the provider of the secret replacing -secret: the
+// secret file when set, else Vault when enabled, else nil.
+func secretProvider(file string, vc *vaultConfig) palermo.SecretProvider {
+	if file != "" {
+		return fileSecret(file)
+	}
+	if vc.enabled() {
+		return vc.provider()
+	}
+	return nil
+}
+
+// fetchSecret reads the current secret from p.
+func fetchSecret(p palermo.SecretProvider) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+	defer cancel()
+	return p.Secret(ctx)
+}
+
+// signingKey returns the key signing tokens with secret: the secret itself,
+// or the key derived from it with salt when set.
+func signingKey(secret []byte, salt string) ([]byte, error) {
+	if salt == "" {
+		return secret, nil
+	}
+	return jwt.DeriveKey(secret, []byte(salt))
+}
+
+// rotateSecret fetches the secret from p and rotates the signing key of svc
+// when it changed. The current key stays in use on failure.
+func rotateSecret(p palermo.SecretProvider, salt string, svc *jwt.SessionService) error {
+	secret, err := fetchSecret(p)
+	if err != nil {
+		return err
+	}
+	key, err := signingKey(secret, salt)
+	if err != nil {
+		return err
+	}
+	return svc.RotateSecretKey(key)
+}
+
+// refreshSecret rotates the signing key of svc with the secret of p every
+// interval until done is closed. Failures keep the current key in use.
+func refreshSecret(p palermo.SecretProvider, interval time.Duration, salt string, svc *jwt.SessionService, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+
+		if err := rotateSecret(p, salt, svc); err != nil {
+			logger.Warn("Failed to refresh secret", palermo.Fields{"error": err.Error()})
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errDraining is the terminal status sent to streaming RPCs when the server
+// shuts down, so clients know to reconnect to another instance.
+var errDraining = status.Error(codes.Unavailable, "palermo: server shutting down")
+
+// drainer signals long-lived streaming RPCs that the server is shutting down.
+// Streams must select on Done and return errDraining, otherwise a graceful
+// stop would wait for them forever.
+type drainer struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func newDrainer() *drainer {
+	return &drainer{done: make(chan struct{})}
+}
+
+// Done returns a channel closed when the server starts shutting down.
+func (d *drainer) Done() <-chan struct{} {
+	return d.done
+}
+
+// Drain notifies every stream that the server is shutting down.
+func (d *drainer) Drain() {
+	d.once.Do(func() {
+		close(d.done)
+	})
+}
+
+// gracefulStop stops the servers, letting in-flight requests finish for up to
+// timeout before cutting the remaining ones off. Nil HTTP servers are
+// skipped.
+func gracefulStop(srv *grpc.Server, timeout time.Duration, httpSrvs ...*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	for _, httpSrv := range httpSrvs {
+		if httpSrv == nil {
+			continue
+		}
+		if err := httpSrv.Shutdown(ctx); err != nil {
+			log.Printf("HTTP server did not drain in time: %v", err)
+			httpSrv.Close()
+		}
+	}
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("gRPC server did not drain in time, closing remaining connections")
+		srv.Stop()
+		<-stopped
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestShutdownDrainsWatchStreams(t *testing.T) {
+	ms := &memory.SessionService{MaxAge: time.Hour}
+	creds, err := ms.CreateSession(context.Background(), &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  *auth.WatchRequest
+	}{
+		{"admin watching every user", metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testAdminToken), &auth.WatchRequest{}},
+		{"user watching own sessions", context.Background(), &auth.WatchRequest{
+			UserId:      "u1",
+			Credentials: &auth.SessionCredentials{ValidationToken: creds.ValidationToken, AuthToken: creds.AuthToken},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as := &AuthService{SessionService: ms, Events: newEventHub(), AdminToken: testAdminToken, drain: newDrainer()}
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := grpc.NewServer()
+			auth.RegisterAuthServiceServer(srv, as)
+			go srv.Serve(lis)
+			defer srv.Stop()
+
+			conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(tt.ctx, 10*time.Second)
+			defer cancel()
+			stream, err := auth.NewAuthServiceClient(conn).Watch(ctx, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Publish until the stream is subscribed, as events published
+			// before are not streamed.
+			received := make(chan error, 1)
+			go func() {
+				_, err := stream.Recv()
+				received <- err
+			}()
+			tick := time.NewTicker(10 * time.Millisecond)
+			defer tick.Stop()
+		wait:
+			for {
+				select {
+				case err := <-received:
+					if err != nil {
+						t.Fatalf("Recv() = %v", err)
+					}
+					break wait
+				case <-tick.C:
+					as.Events.Publish(&auth.SessionEvent{Type: auth.SessionEvent_CREATED, UserId: "u1"})
+				}
+			}
+
+			as.drain.Drain()
+			start := time.Now()
+			gracefulStop(srv, 5*time.Second)
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("graceful stop took %v", d)
+			}
+
+			for {
+				_, err = stream.Recv()
+				if err != nil {
+					break
+				}
+			}
+			if status.Code(err) != codes.Unavailable || status.Convert(err).Message() != status.Convert(errDraining).Message() {
+				t.Errorf("stream ended with %v, want %v", err, errDraining)
+			}
+		})
+	}
+}
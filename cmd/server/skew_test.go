@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/memory"
+	"github.com/go-toschool/palermo/palermotest"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogSkewError(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	skewErr := &jwt.SkewError{
+		Err:       errors.New("token is expired"),
+		Now:       now,
+		Leeway:    5 * time.Second,
+		IssuedAt:  now.Add(-2 * time.Minute),
+		ExpiresAt: now.Add(-time.Minute),
+	}
+	creds := &auth.SessionCredentials{ValidationToken: "v", AuthToken: "a", RefreshToken: "r"}
+
+	calls := []struct {
+		name string
+		call func(context.Context, *AuthService) error
+		// returned reports whether the error reaches the caller, rather
+		// than being reported as inactive credentials.
+		returned bool
+	}{
+		{"Get", func(ctx context.Context, as *AuthService) error {
+			_, err := as.Get(ctx, &auth.GetRequest{Data: creds})
+			return err
+		}, true},
+		{"Update", func(ctx context.Context, as *AuthService) error {
+			_, err := as.Update(ctx, &auth.UpdateRequest{Data: creds})
+			return err
+		}, true},
+		{"GetOrRefresh", func(ctx context.Context, as *AuthService) error {
+			_, err := as.GetOrRefresh(ctx, &auth.GetOrRefreshRequest{Data: creds})
+			return err
+		}, true},
+		{"Delete", func(ctx context.Context, as *AuthService) error {
+			_, err := as.Delete(ctx, &auth.DeleteRequest{UserId: "u1", Credentials: creds})
+			return err
+		}, true},
+		{"DeleteAll", func(ctx context.Context, as *AuthService) error {
+			_, err := as.DeleteAll(ctx, &auth.DeleteAllRequest{UserId: "u1", Credentials: creds})
+			return err
+		}, true},
+		{"Introspect", func(ctx context.Context, as *AuthService) error {
+			_, err := as.Introspect(ctx, &auth.IntrospectRequest{Credentials: creds})
+			return err
+		}, false},
+		{"Validate", func(ctx context.Context, as *AuthService) error {
+			_, err := as.Validate(ctx, &auth.ValidateRequest{Credentials: creds})
+			return err
+		}, false},
+		{"ValidateBatch", func(ctx context.Context, as *AuthService) error {
+			_, err := as.ValidateBatch(ctx, &auth.ValidateBatchRequest{Credentials: []*auth.SessionCredentials{creds}})
+			return err
+		}, false},
+	}
+	callers := []struct {
+		name        string
+		ctx         context.Context
+		wantDetails bool
+	}{
+		{"untrusted", context.Background(), false},
+		{"wrong admin token", adminContext("guess"), false},
+		{"trusted", adminContext(testAdminToken), true},
+	}
+
+	for _, c := range calls {
+		for _, caller := range callers {
+			t.Run(c.name+"/"+caller.name, func(t *testing.T) {
+				recorded := &palermotest.Logger{}
+				defer func(l palermo.Logger) { logger = l }(logger)
+				logger = recorded
+
+				as := &AuthService{
+					SessionService: &palermotest.SessionService{
+						SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+							return nil, skewErr
+						},
+						RefreshSessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+							return nil, skewErr
+						},
+					},
+					Admin:      &memory.SessionService{MaxAge: time.Hour},
+					AdminToken: testAdminToken,
+					drain:      newDrainer(),
+				}
+
+				err := c.call(caller.ctx, as)
+				if warns := recorded.Messages("warn"); len(warns) != 1 {
+					t.Errorf("got warnings %q, want one", warns)
+				}
+				if !c.returned {
+					if err != nil {
+						t.Fatalf("got %v, want inactive credentials", err)
+					}
+					return
+				}
+
+				st := status.Convert(err)
+				if st.Message() != skewErr.Error() {
+					t.Errorf("got message %q, want %q", st.Message(), skewErr.Error())
+				}
+				var details *auth.SkewDetails
+				for _, d := range st.Details() {
+					if sd, ok := d.(*auth.SkewDetails); ok {
+						details = sd
+					}
+				}
+				if (details != nil) != caller.wantDetails {
+					t.Fatalf("got details %v, want details %v", details, caller.wantDetails)
+				}
+				if details != nil && (details.ServerNow != now.Unix() || details.Exp != skewErr.ExpiresAt.Unix() || details.LeewayMs != 5000) {
+					t.Errorf("got details %+v", details)
+				}
+			})
+		}
+	}
+}
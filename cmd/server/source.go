@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-toschool/palermo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	deviceIDMetadataKey = "x-device-id"
+
+	sourceDevicePrefix = "device:"
+	sourceIPPrefix     = "ip:"
+)
+
+// Source policy modes.
+const (
+	sourcePolicyOff    = "off"
+	sourcePolicyLog    = "log"
+	sourcePolicyReject = "reject"
+)
+
+// sourcePolicy compares the peer of a request against the source recorded in
+// the session when it was created. Mismatches may indicate a hijacked session
+// but also happen legitimately when mobile clients roam networks, hence the
+// log-only mode.
+type sourcePolicy struct {
+	Mode     string
+	IPv4Bits int
+	IPv6Bits int
+}
+
+func (sp *sourcePolicy) validate() error {
+	switch sp.Mode {
+	case sourcePolicyOff, sourcePolicyLog, sourcePolicyReject:
+		return nil
+	}
+	return fmt.Errorf("invalid source policy: %q", sp.Mode)
+}
+
+// Check verifies the request peer matches the session source according to the
+// policy mode.
+func (sp *sourcePolicy) Check(ctx context.Context, s *palermo.Session) error {
+	if sp == nil || sp.Mode == sourcePolicyOff || s.Source == "" {
+		return nil
+	}
+
+	current := sourceFromContext(ctx)
+	if sp.matches(s.Source, current) {
+		return nil
+	}
+
+	logEntry(ctx).Warn("AuthService: session source mismatch", palermo.Fields{
+		"session_id": s.ID,
+		"user_id":    s.UserID,
+		"source":     s.Source,
+		"peer":       current,
+	})
+
+	if sp.Mode == sourcePolicyReject {
+		return status.Error(codes.PermissionDenied, "session source mismatch")
+	}
+	return nil
+}
+
+func (sp *sourcePolicy) matches(recorded, current string) bool {
+	if recorded == current {
+		return true
+	}
+
+	if !strings.HasPrefix(recorded, sourceIPPrefix) || !strings.HasPrefix(current, sourceIPPrefix) {
+		return false
+	}
+
+	lhs := net.ParseIP(strings.TrimPrefix(recorded, sourceIPPrefix))
+	rhs := net.ParseIP(strings.TrimPrefix(current, sourceIPPrefix))
+	if lhs == nil || rhs == nil {
+		return false
+	}
+
+	mask := net.CIDRMask(sp.IPv6Bits, 8*net.IPv6len)
+	if lhs.To4() != nil {
+		mask = net.CIDRMask(sp.IPv4Bits, 8*net.IPv4len)
+		lhs, rhs = lhs.To4(), rhs.To4()
+		if rhs == nil {
+			return false
+		}
+	}
+	return lhs.Mask(mask).Equal(rhs.Mask(mask))
+}
+
+// sourceFromContext identifies the caller of a request, preferring a stable
+// device id sent in the metadata over the peer network address. Callers on a
+// Unix socket have no address.
+func sourceFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(deviceIDMetadataKey); len(ids) > 0 && ids[0] != "" {
+			return sourceDevicePrefix + ids[0]
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil || p.Addr.Network() == "unix" {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return sourceIPPrefix + p.Addr.String()
+	}
+	return sourceIPPrefix + host
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/go-toschool/palermo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// peerContext returns a context of a request from addr, with the given device
+// id when not empty.
+func peerContext(addr net.Addr, deviceID string) context.Context {
+	ctx := context.Background()
+	if deviceID != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(deviceIDMetadataKey, deviceID))
+	}
+	return peer.NewContext(ctx, &peer.Peer{Addr: addr})
+}
+
+func tcpAddr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 4242}
+}
+
+func TestSourcePolicyCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		source   string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{"matching peer", sourcePolicyReject, "ip:203.0.113.7", peerContext(tcpAddr("203.0.113.7"), ""), codes.OK},
+		{"peer in the same subnet", sourcePolicyReject, "ip:203.0.113.7", peerContext(tcpAddr("203.0.113.99"), ""), codes.OK},
+		{"matching IPv6 peer", sourcePolicyReject, "ip:2001:db8::1", peerContext(tcpAddr("2001:db8::2"), ""), codes.OK},
+		{"matching device", sourcePolicyReject, "device:phone-1", peerContext(tcpAddr("198.51.100.1"), "phone-1"), codes.OK},
+		{"roamed peer under log", sourcePolicyLog, "ip:203.0.113.7", peerContext(tcpAddr("198.51.100.1"), ""), codes.OK},
+		{"roamed peer under off", sourcePolicyOff, "ip:203.0.113.7", peerContext(tcpAddr("198.51.100.1"), ""), codes.OK},
+		{"mismatch under reject", sourcePolicyReject, "ip:203.0.113.7", peerContext(tcpAddr("198.51.100.1"), ""), codes.PermissionDenied},
+		{"IPv6 peer of an IPv4 session", sourcePolicyReject, "ip:203.0.113.7", peerContext(tcpAddr("2001:db8::1"), ""), codes.PermissionDenied},
+		{"other device under reject", sourcePolicyReject, "device:phone-1", peerContext(tcpAddr("198.51.100.1"), "phone-2"), codes.PermissionDenied},
+		{"unix socket under reject", sourcePolicyReject, "ip:203.0.113.7", peerContext(&net.UnixAddr{Name: "/run/palermo.sock", Net: "unix"}, ""), codes.PermissionDenied},
+		{"session without source", sourcePolicyReject, "", peerContext(tcpAddr("198.51.100.1"), ""), codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := &sourcePolicy{Mode: tt.mode, IPv4Bits: 24, IPv6Bits: 64}
+			err := sp.Check(tt.ctx, &palermo.Session{ID: "s1", UserID: "u1", Source: tt.source})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("Check() = %v, want %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSourcePolicyValidate(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{sourcePolicyOff, false},
+		{sourcePolicyLog, false},
+		{sourcePolicyReject, false},
+		{"", true},
+		{"block", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			sp := &sourcePolicy{Mode: tt.mode}
+			if err := sp.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
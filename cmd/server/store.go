@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/handle"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/memory"
+	"github.com/go-toschool/palermo/paseto"
+	"github.com/go-toschool/palermo/postgres"
+	"github.com/go-toschool/palermo/redis"
+)
+
+// Session stores.
+const (
+	storeJWT      = "jwt"
+	storePaseto   = "paseto"
+	storeRedis    = "redis"
+	storePostgres = "postgres"
+	storeMemory   = "memory"
+)
+
+// Revocation stores of JWT credentials.
+const (
+	revocationMemory = "memory"
+	revocationRedis  = "redis"
+)
+
+// Handle stores of opaque handles to token credentials.
+const (
+	handleNone   = ""
+	handleMemory = "memory"
+	handleRedis  = "redis"
+)
+
+// memoryJanitorInterval is how often the memory store evicts expired
+// sessions.
+const memoryJanitorInterval = time.Minute
+
+// storeConfig selects where sessions live: nowhere with stateless JWT
+// credentials, or server-side in a store handing out opaque credentials.
+type storeConfig struct {
+	Kind        string
+	RedisAddr   string
+	PostgresDSN string
+
+	// SigningMethod and PrivateKeyFile configure asymmetric JWT signing.
+	SigningMethod  string
+	PrivateKeyFile string
+
+	// VerifyMethods lists, comma separated, the JWT signing methods
+	// accepted besides SigningMethod, e.g. HS256 while moving to RS256.
+	VerifyMethods string
+
+	// DeriveTokenKeys signs each JWT type with its own key derived from the
+	// HS256 secret.
+	DeriveTokenKeys bool
+
+	// Issuer and Audience are embedded into minted tokens and required on
+	// validation, unless empty.
+	Issuer   string
+	Audience string
+
+	// MaxAge is how long minted credentials are valid.
+	MaxAge time.Duration
+
+	// Leeway is the clock skew tolerated on JWT time claims.
+	Leeway time.Duration
+
+	// RefreshTokenMaxAge enables JWT refresh tokens valid that long.
+	RefreshTokenMaxAge time.Duration
+
+	// ServiceAccountMaxAge enables JWT service account credentials valid
+	// that long.
+	ServiceAccountMaxAge time.Duration
+
+	// Revocation selects where revoked JWT credentials, and used refresh
+	// tokens, are recorded: in memory, or in Redis at RedisAddr to share
+	// them between instances.
+	Revocation string
+
+	// RevocationMaxEntries bounds the revocations kept in memory, zero
+	// meaning unbounded.
+	RevocationMaxEntries int
+
+	// PostgresPurgeInterval is how often the postgres store deletes its
+	// expired sessions, never when zero.
+	PostgresPurgeInterval time.Duration
+
+	// Handles, when set, hides JWT or PASETO credentials behind opaque
+	// handles kept in memory or in Redis at RedisAddr.
+	Handles string
+
+	// Metrics records the token metrics of the JWT store.
+	Metrics palermo.Metrics
+
+	// Logger receives the logs of the JWT store.
+	Logger palermo.Logger
+
+	// components lists the opened backends relying on a remote service and
+	// the signing keys, by name, for health checking.
+	components map[string]palermo.HealthChecker
+
+	// purger deletes the expired sessions of the opened store, when it
+	// keeps them.
+	purger expiredPurger
+
+	// jwtSessions is the opened JWT store, beneath the handles if any,
+	// whose keys are rotated. Nil with the other stores.
+	jwtSessions *jwt.SessionService
+}
+
+// expiredPurger is implemented by the stores only deleting expired sessions
+// on demand.
+type expiredPurger interface {
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+// Health checked backends.
+const (
+	componentSessionStore    = "session-store"
+	componentRevocationStore = "revocation-store"
+	componentHandleStore     = "handle-store"
+	componentKeys            = "keys"
+)
+
+func (sc *storeConfig) validate() error {
+	if sc.MaxAge <= 0 {
+		return errors.New("token max age must be positive")
+	}
+	if sc.Leeway < 0 {
+		return errors.New("leeway must not be negative")
+	}
+	if sc.RefreshTokenMaxAge != 0 && sc.RefreshTokenMaxAge < sc.MaxAge {
+		return fmt.Errorf("refresh token max age must be zero or at least %v", sc.MaxAge)
+	}
+	if sc.RevocationMaxEntries < 0 {
+		return errors.New("revocation max entries must not be negative")
+	}
+	if sc.PostgresPurgeInterval < 0 {
+		return errors.New("postgres purge interval must not be negative")
+	}
+	if sc.ServiceAccountMaxAge < 0 {
+		return errors.New("service account max age must not be negative")
+	}
+	if sc.ServiceAccountMaxAge > 0 && sc.Kind != storeJWT {
+		return fmt.Errorf("%s store does not support service accounts", sc.Kind)
+	}
+
+	switch sc.Handles {
+	case handleNone:
+	case handleMemory, handleRedis:
+		if sc.Kind != storeJWT && sc.Kind != storePaseto {
+			return fmt.Errorf("%s store credentials are already opaque", sc.Kind)
+		}
+	default:
+		return fmt.Errorf("invalid handle store: %q", sc.Handles)
+	}
+
+	switch sc.Kind {
+	case storeJWT:
+		if sc.Revocation != revocationMemory && sc.Revocation != revocationRedis {
+			return fmt.Errorf("invalid revocation store: %q", sc.Revocation)
+		}
+		return nil
+	case storePaseto, storeRedis, storeMemory:
+		return nil
+	case storePostgres:
+		if sc.PostgresDSN == "" {
+			return errors.New("postgres store requires a DSN")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid session store: %q", sc.Kind)
+}
+
+// memoryRevocationStore returns a revocation store bounded to
+// RevocationMaxEntries.
+func (sc *storeConfig) memoryRevocationStore() *memory.RevocationStore {
+	return &memory.RevocationStore{
+		MaxEntries: sc.RevocationMaxEntries,
+		Metrics:    sc.Metrics,
+		Logger:     sc.Logger,
+	}
+}
+
+// open returns the configured session backend. secretKey applies to JWT and
+// PASETO credentials, refreshWindow only to JWT ones.
+func (sc *storeConfig) open(secretKey []byte, refreshWindow time.Duration) (palermo.SessionService, error) {
+	ss, err := sc.openStore(secretKey, refreshWindow)
+	if err != nil {
+		return nil, err
+	}
+	sc.addComponent(componentSessionStore, ss)
+	if sc.Handles == handleNone {
+		return ss, nil
+	}
+
+	hs := &handle.SessionService{
+		SessionService:       ss,
+		Store:                &handle.MemoryStore{},
+		MaxAge:               sc.MaxAge,
+		ServiceAccountMaxAge: sc.ServiceAccountMaxAge,
+	}
+	if sc.RefreshTokenMaxAge > hs.MaxAge {
+		hs.MaxAge = sc.RefreshTokenMaxAge
+	}
+	if sc.Handles == handleRedis {
+		hs.Store = &redis.HandleStore{
+			Client: goredis.NewClient(&goredis.Options{Addr: sc.RedisAddr}),
+		}
+	}
+	sc.addComponent(componentHandleStore, hs.Store)
+	return hs, nil
+}
+
+// addComponent records v for health checking, if it implements
+// palermo.HealthChecker.
+func (sc *storeConfig) addComponent(name string, v interface{}) {
+	hc, ok := v.(palermo.HealthChecker)
+	if !ok {
+		return
+	}
+	if sc.components == nil {
+		sc.components = make(map[string]palermo.HealthChecker)
+	}
+	sc.components[name] = hc
+}
+
+func (sc *storeConfig) openStore(secretKey []byte, refreshWindow time.Duration) (palermo.SessionService, error) {
+	switch sc.Kind {
+	case storeJWT:
+		ss := &jwt.SessionService{
+			SigningMethod:        sc.SigningMethod,
+			SecretKey:            secretKey,
+			MaxAge:               sc.MaxAge,
+			RefreshWindow:        refreshWindow,
+			Issuer:               sc.Issuer,
+			Audience:             sc.Audience,
+			RefreshMaxAge:        sc.RefreshTokenMaxAge,
+			ServiceAccountMaxAge: sc.ServiceAccountMaxAge,
+			Leeway:               sc.Leeway,
+			DeriveTokenKeys:      sc.DeriveTokenKeys,
+			RevocationStore:      sc.memoryRevocationStore(),
+			Metrics:              sc.Metrics,
+			Logger:               sc.Logger,
+		}
+		if sc.RefreshTokenMaxAge > 0 {
+			// Refresh tokens are rotated on every refresh, so each is
+			// single-use.
+			ss.ReplayGuard = &memory.ReplayGuard{}
+		}
+		if sc.Revocation == revocationRedis {
+			client := goredis.NewClient(&goredis.Options{Addr: sc.RedisAddr})
+			ss.RevocationStore = &redis.RevocationStore{Client: client}
+			if ss.ReplayGuard != nil {
+				ss.ReplayGuard = &redis.ReplayGuard{Client: client}
+			}
+			sc.addComponent(componentRevocationStore, ss.RevocationStore)
+		}
+		if sc.PrivateKeyFile != "" {
+			key, err := jwt.LoadPrivateKey(sc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			ss.PrivateKey = key
+		}
+		if sc.VerifyMethods != "" {
+			for _, m := range strings.Split(sc.VerifyMethods, ",") {
+				ss.VerifyMethods = append(ss.VerifyMethods, strings.TrimSpace(m))
+			}
+		}
+		sc.jwtSessions = ss
+		sc.addComponent(componentKeys, ss)
+		return ss, nil
+	case storePaseto:
+		if len(secretKey) != paseto.KeySize {
+			return nil, errors.New("paseto store requires a key derived with -kdf-salt")
+		}
+		return &paseto.SessionService{
+			SecretKey:       secretKey,
+			Issuer:          sc.Issuer,
+			Audience:        sc.Audience,
+			MaxAge:          sc.MaxAge,
+			RevocationStore: sc.memoryRevocationStore(),
+		}, nil
+	case storeRedis:
+		return &redis.SessionService{
+			Client: goredis.NewClient(&goredis.Options{Addr: sc.RedisAddr}),
+			MaxAge: sc.MaxAge,
+		}, nil
+	case storePostgres:
+		db, err := sql.Open("postgres", sc.PostgresDSN)
+		if err != nil {
+			return nil, err
+		}
+
+		ss := &postgres.SessionService{
+			DB:     db,
+			MaxAge: sc.MaxAge,
+		}
+		if err := ss.CreateSchema(); err != nil {
+			db.Close()
+			return nil, err
+		}
+		sc.purger = ss
+		return ss, nil
+	case storeMemory:
+		return memory.NewSessionService(sc.MaxAge, memoryJanitorInterval), nil
+	}
+	return nil, fmt.Errorf("invalid session store: %q", sc.Kind)
+}
+
+// purgeExpired deletes the expired sessions of the store every interval
+// until done is closed.
+func (sc *storeConfig) purgeExpired(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		n, err := sc.purger.PurgeExpired(ctx)
+		cancel()
+		if err != nil {
+			logger.Warn("Failed to purge expired sessions", palermo.Fields{"error": err.Error()})
+			continue
+		}
+		logger.Debug("Purged expired sessions", palermo.Fields{"sessions": n})
+	}
+}
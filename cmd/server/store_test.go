@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/handle"
+	"github.com/go-toschool/palermo/memory"
+)
+
+type countingPurger struct {
+	calls int32
+	err   error
+}
+
+func (cp *countingPurger) PurgeExpired(ctx context.Context) (int64, error) {
+	atomic.AddInt32(&cp.calls, 1)
+	return 1, cp.err
+}
+
+func TestPurgeExpired(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"purged", nil},
+		{"failing", errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purger := &countingPurger{err: tt.err}
+			sc := &storeConfig{purger: purger}
+			done := make(chan struct{})
+			stopped := make(chan struct{})
+			go func() {
+				sc.purgeExpired(time.Millisecond, done)
+				close(stopped)
+			}()
+
+			// Failures are retried on the next tick.
+			deadline := time.Now().Add(5 * time.Second)
+			for atomic.LoadInt32(&purger.calls) < 2 {
+				if time.Now().After(deadline) {
+					t.Fatal("expired sessions not purged periodically")
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			close(done)
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("purge loop not stopped")
+			}
+		})
+	}
+}
+
+func TestStoreConfigPurgeInterval(t *testing.T) {
+	sc := &storeConfig{Kind: storeMemory, MaxAge: time.Minute, PostgresPurgeInterval: -time.Second}
+	if err := sc.validate(); err == nil || err.Error() != "postgres purge interval must not be negative" {
+		t.Errorf("validate() = %v, want the purge interval rejected", err)
+	}
+}
+
+func TestOpenMemoryStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		handles string
+		wantErr bool
+	}{
+		{"memory store", handleNone, false},
+		{"memory store with handles", handleMemory, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &storeConfig{Kind: storeMemory, MaxAge: time.Minute, Handles: tt.handles}
+			if err := sc.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			ss, err := sc.open(nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms, ok := ss.(*memory.SessionService)
+			if !ok {
+				t.Fatalf("opened a %T", ss)
+			}
+			defer ms.Close()
+
+			c, err := ms.CreateSession(context.Background(), &palermo.Session{UserID: "42", Email: "jane@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s, err := ms.Session(context.Background(), c); err != nil || !s.ExpiresAt.After(time.Now().Add(59*time.Second)) {
+				t.Errorf("Session() = %+v, %v", s, err)
+			}
+		})
+	}
+}
+
+func TestOpenJWTStoreKeepsSigningService(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	for _, handles := range []string{handleNone, handleMemory} {
+		t.Run(handles, func(t *testing.T) {
+			sc := &storeConfig{Kind: storeJWT, MaxAge: time.Minute, Revocation: revocationMemory, Handles: handles}
+			if err := sc.validate(); err != nil {
+				t.Fatal(err)
+			}
+			ss, err := sc.open(key, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sc.jwtSessions == nil {
+				t.Fatal("no JWT store to rotate the keys of")
+			}
+			if hs, ok := ss.(*handle.SessionService); ok && hs.SessionService != sc.jwtSessions {
+				t.Errorf("handles wrap %T, not the JWT store", hs.SessionService)
+			}
+
+			before, err := ss.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sc.jwtSessions.RotateSecretKey([]byte("fedcba9876543210fedcba9876543210")); err != nil {
+				t.Fatal(err)
+			}
+			after, err := ss.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range []*palermo.SessionCredentials{before, after} {
+				if _, err := ss.Session(ctx, c); err != nil {
+					t.Errorf("Session() after rotation = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errTimeout is returned to callers whose unary RPC exceeded the server-side
+// timeout.
+var errTimeout = status.Error(codes.DeadlineExceeded, "palermo: request timed out")
+
+type handlerResult struct {
+	resp interface{}
+	err  error
+}
+
+// timeoutUnaryInterceptor bounds how long unary RPCs may take, store calls
+// included. Handlers run with a context expiring after timeout, or sooner
+// when the caller set a deadline, and are abandoned once it expires: stores
+// ignoring the context, e.g. Redis, would otherwise hang the request.
+// Interceptors below this one run along with the abandoned handler.
+func timeoutUnaryInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		done := make(chan handlerResult, 1)
+		go func() {
+			resp, err := handler(ctx, req)
+			done <- handlerResult{resp: resp, err: err}
+		}()
+
+		select {
+		case r := <-done:
+			return r.resp, r.err
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, errTimeout
+			}
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// tlsConfig enables TLS on the gRPC and HTTP servers, so session tokens are encrypted
+// in transit without relying on a proxy in front of the service. With a
+// ClientCAFile, only clients presenting a certificate issued by one of its
+// CAs may call the service (mutual TLS).
+type tlsConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+
+	// certs serves the certificate once loaded by config.
+	certs *certReloader
+}
+
+func (tc *tlsConfig) validate() error {
+	if (tc.CertFile == "") != (tc.KeyFile == "") {
+		return errors.New("TLS requires both a certificate and a key")
+	}
+	if tc.ClientCAFile != "" && tc.CertFile == "" {
+		return errors.New("client certificate authentication requires TLS")
+	}
+	return nil
+}
+
+// config returns the TLS configuration of the servers, nil when TLS is
+// disabled. It applies to the HTTP server as well, so the gateway does not
+// bypass client certificate authentication. The certificate is served by
+// tc.certs, so that it can be reloaded without restarting the servers.
+func (tc *tlsConfig) config() (*tls.Config, error) {
+	if tc.CertFile == "" {
+		return nil, nil
+	}
+
+	certs := &certReloader{CertFile: tc.CertFile, KeyFile: tc.KeyFile}
+	if err := certs.Reload(); err != nil {
+		return nil, err
+	}
+	tc.certs = certs
+
+	conf := &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if tc.ClientCAFile != "" {
+		b, err := ioutil.ReadFile(tc.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate found in %s", tc.ClientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+// certReloader serves a certificate and its key read from files, reloaded
+// on demand, e.g. after they were renewed.
+type certReloader struct {
+	CertFile string
+	KeyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// Reload reads the certificate and its key again. The current certificate
+// is kept when they cannot be loaded.
+func (cr *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.CertFile, cr.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the certificate last loaded, as tls.Config expects.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// serverOptions returns the gRPC server options serving TLS with conf, none
+// when TLS is disabled.
+func serverOptions(conf *tls.Config) []grpc.ServerOption {
+	if conf == nil {
+		return nil
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(conf))}
+}
+
+// clientIdentityFromContext returns the identity of the calling workload from
+// its verified TLS client certificate: its first URI SAN (e.g. a SPIFFE id),
+// else its first DNS SAN, else its common name. It is empty without mutual
+// TLS.
+func clientIdentityFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-toschool/palermo/otlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const traceparentMetadataKey = "traceparent"
+
+// tracingUnaryInterceptor traces the unary RPCs, continuing the trace of the
+// caller when it sends a traceparent.
+func tracingUnaryInterceptor(t *otlp.Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := t.Start(incomingTrace(ctx), info.FullMethod)
+		span.SetAttribute("rpc.system", "grpc")
+		resp, err := handler(ctx, req)
+		span.End(err)
+		return resp, err
+	}
+}
+
+// tracingStreamInterceptor is the streaming counterpart of
+// tracingUnaryInterceptor.
+func tracingStreamInterceptor(t *otlp.Tracer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := t.Start(incomingTrace(ss.Context()), info.FullMethod)
+		span.SetAttribute("rpc.system", "grpc")
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		span.End(err)
+		return err
+	}
+}
+
+func incomingTrace(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if tp := md.Get(traceparentMetadataKey); len(tp) > 0 {
+		return otlp.Extract(ctx, tp[0])
+	}
+	return ctx
+}
+
+// contextStream overrides the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
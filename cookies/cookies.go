@@ -0,0 +1,146 @@
+// Package cookies stores palermo credentials in a pair of HTTP cookies, for
+// browser clients which cannot keep them out of reach of scripts otherwise.
+//
+// The authentication and validation tokens are written as two cookies
+// expiring along with the credentials:
+//
+//	c := cookies.New()
+//	c.Domain = "example.com"
+//
+//	// on login
+//	c.Set(w, creds, s.ExpiresAt)
+//
+//	// on every request
+//	creds, ok := c.Read(r)
+//
+//	// on logout
+//	c.Clear(w)
+package cookies
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-toschool/palermo"
+)
+
+// Default names of the cookies.
+const (
+	DefaultAuthTokenName       = "access_token"
+	DefaultValidationTokenName = "validation_token"
+)
+
+// Config configures the cookies holding the credentials. Use New to start
+// from safe defaults.
+type Config struct {
+	// AuthTokenName and ValidationTokenName name the cookies. They default
+	// to DefaultAuthTokenName and DefaultValidationTokenName.
+	AuthTokenName       string
+	ValidationTokenName string
+
+	// Domain and Path scope the cookies. An empty Domain restricts them to
+	// the host setting them.
+	Domain string
+	Path   string
+
+	// Secure restricts the cookies to HTTPS requests.
+	Secure bool
+
+	// HttpOnly hides the cookies from scripts.
+	HttpOnly bool
+
+	// SameSite restricts the cookies on cross-site requests.
+	SameSite http.SameSite
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// New returns a configuration writing Secure, HttpOnly, SameSite=Lax cookies
+// valid on every path of the host.
+func New() *Config {
+	return &Config{
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Set writes the cookies holding creds. Their max-age is derived from
+// expiresAt, the expiry of the credentials, so that browsers drop them along
+// with the credentials. They last as long as the browser session when
+// expiresAt is the zero time. The refresh token, if any, is not written.
+func (c *Config) Set(w http.ResponseWriter, creds *palermo.SessionCredentials, expiresAt time.Time) {
+	maxAge := 0
+	if !expiresAt.IsZero() {
+		maxAge = int(expiresAt.Sub(c.now()) / time.Second)
+		if maxAge <= 0 {
+			// Expired credentials: delete the cookies rather than writing
+			// session cookies.
+			maxAge = -1
+		}
+	}
+
+	http.SetCookie(w, c.cookie(c.authTokenName(), creds.AuthToken, maxAge, expiresAt))
+	http.SetCookie(w, c.cookie(c.validationTokenName(), creds.ValidationToken, maxAge, expiresAt))
+}
+
+// Read reads the credentials from the cookies of r and reports whether both
+// tokens were found.
+func (c *Config) Read(r *http.Request) (*palermo.SessionCredentials, bool) {
+	creds := &palermo.SessionCredentials{}
+	if cookie, err := r.Cookie(c.authTokenName()); err == nil {
+		creds.AuthToken = cookie.Value
+	}
+	if cookie, err := r.Cookie(c.validationTokenName()); err == nil {
+		creds.ValidationToken = cookie.Value
+	}
+	return creds, creds.AuthToken != "" && creds.ValidationToken != ""
+}
+
+// Clear deletes the cookies, e.g. on logout.
+func (c *Config) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie(c.authTokenName(), "", -1, time.Time{}))
+	http.SetCookie(w, c.cookie(c.validationTokenName(), "", -1, time.Time{}))
+}
+
+// cookie returns a cookie with the attributes of c. Expires is only set
+// along with a positive maxAge, for the browsers ignoring Max-Age.
+func (c *Config) cookie(name, value string, maxAge int, expiresAt time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		MaxAge:   maxAge,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		SameSite: c.SameSite,
+	}
+	if maxAge > 0 {
+		cookie.Expires = expiresAt.UTC()
+	}
+	return cookie
+}
+
+func (c *Config) authTokenName() string {
+	if c.AuthTokenName == "" {
+		return DefaultAuthTokenName
+	}
+	return c.AuthTokenName
+}
+
+func (c *Config) validationTokenName() string {
+	if c.ValidationTokenName == "" {
+		return DefaultValidationTokenName
+	}
+	return c.ValidationTokenName
+}
+
+func (c *Config) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
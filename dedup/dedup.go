@@ -0,0 +1,92 @@
+// Package dedup implements a palermo.SessionService decorator that
+// de-duplicates concurrent validations of the same credentials.
+package dedup
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"golang.org/x/sync/singleflight"
+)
+
+// SessionService decorates a palermo.SessionService so concurrent validations
+// of identical credentials share a single backend call. Results are not
+// cached: once the shared call returns, the next validation hits the backend
+// again, so an error never outlives the calls that were waiting for it. The
+// shared call runs detached from the cancellation of the caller that started
+// it: each caller stops waiting when its own context is done, without failing
+// the others. The shared call is bounded by Timeout instead.
+type SessionService struct {
+	palermo.SessionService
+
+	// Timeout bounds each shared validation, failing every caller waiting
+	// for it with context.DeadlineExceeded. The next validations of the
+	// same credentials then reach the backend again. Defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	group singleflight.Group
+}
+
+// DefaultTimeout bounds the shared validations when Timeout is zero.
+const DefaultTimeout = 10 * time.Second
+
+// Session validates the given credentials, joining any in-flight validation
+// of the same credentials.
+func (s *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	ch := s.group.DoChan(c.AuthToken+"\x00"+c.ValidationToken, func() (interface{}, error) {
+		shared, cancel := context.WithTimeout(detachedContext{ctx}, s.timeout())
+		defer cancel()
+
+		// The backend call is abandoned on timeout, even when it ignores
+		// the cancellation, so that it cannot hold up the next validations.
+		done := make(chan validation, 1)
+		go func() {
+			us, err := s.SessionService.Session(shared, c)
+			done <- validation{us, err}
+		}()
+		select {
+		case v := <-done:
+			return v.session, v.err
+		case <-shared.Done():
+			return nil, shared.Err()
+		}
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		// Every caller gets its own copy as the session is shared between
+		// them.
+		return r.Val.(*palermo.Session).Clone(), nil
+	}
+}
+
+// validation is the result of a backend validation.
+type validation struct {
+	session *palermo.Session
+	err     error
+}
+
+func (s *SessionService) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+// detachedContext carries the values of its parent, e.g. the request logger,
+// but neither its deadline nor its cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)          { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}                { return nil }
+func (detachedContext) Err() error                           { return nil }
+func (dc detachedContext) Value(key interface{}) interface{} { return dc.parent.Value(key) }
@@ -0,0 +1,192 @@
+package dedup_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/dedup"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+// blockingBackend returns a backend whose validations wait for release, and
+// the number of validations it received.
+func blockingBackend(release <-chan struct{}) (*palermotest.SessionService, *int32) {
+	var calls int32
+	return &palermotest.SessionService{
+		SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+			atomic.AddInt32(&calls, 1)
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return &palermo.Session{
+				UserID:         "u1",
+				Scopes:         []string{"read"},
+				AllowedMethods: []string{"/auth.AuthService/Get"},
+				Metadata:       map[string]string{"plan": "free"},
+			}, nil
+		},
+	}, &calls
+}
+
+// waitCalls waits until the backend received n validations.
+func waitCalls(t *testing.T, calls *int32, n int32) {
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(calls) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("backend received %d validations, want %d", atomic.LoadInt32(calls), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSessionServiceCancelledLeader(t *testing.T) {
+	release := make(chan struct{})
+	backend, calls := blockingBackend(release)
+	ds := &dedup.SessionService{SessionService: backend}
+	creds := &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := ds.Session(leaderCtx, creds)
+		leaderErr <- err
+	}()
+	waitCalls(t, calls, 1)
+
+	const followers = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, followers)
+	for i := 0; i < followers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ds.Session(context.Background(), creds)
+			errs <- err
+		}()
+	}
+
+	cancel()
+	if err := <-leaderErr; err != context.Canceled {
+		t.Errorf("leader got %v, want %v", err, context.Canceled)
+	}
+	// Let the followers join the shared call before it returns.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("follower failed with the leader: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("backend received %d validations, want 1", n)
+	}
+}
+
+func TestSessionServiceHungBackend(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+	var calls int32
+	backend := &palermotest.SessionService{
+		SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				// Hangs whatever the context.
+				<-hang
+			}
+			return &palermo.Session{UserID: "u1"}, nil
+		},
+	}
+	ds := &dedup.SessionService{SessionService: backend, Timeout: 50 * time.Millisecond}
+	creds := &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := ds.Session(context.Background(), creds)
+			errs <- err
+		}()
+		// The second caller joins the hung call.
+		waitCalls(t, &calls, 1)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != context.DeadlineExceeded {
+			t.Errorf("Session() of the hung call = %v, want %v", err, context.DeadlineExceeded)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("backend received %d validations, want 1", n)
+	}
+
+	// The hung call no longer holds the credentials.
+	s, err := ds.Session(context.Background(), creds)
+	if err != nil || s.UserID != "u1" {
+		t.Errorf("Session() after the timeout = %+v, %v", s, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("backend received %d validations, want 2", n)
+	}
+}
+
+func TestSessionServiceIsolation(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*palermo.Session)
+	}{
+		{"scopes", func(s *palermo.Session) { s.Scopes[0] = "admin" }},
+		{"allowed methods", func(s *palermo.Session) { s.AllowedMethods[0] = "/auth.AdminService/Export" }},
+		{"metadata", func(s *palermo.Session) { s.Metadata["plan"] = "enterprise" }},
+		{"fields", func(s *palermo.Session) { s.UserID = "u2" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			backend, calls := blockingBackend(release)
+			ds := &dedup.SessionService{SessionService: backend}
+			creds := &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"}
+
+			const callers = 4
+			var wg sync.WaitGroup
+			sessions := make([]*palermo.Session, callers)
+			for i := range sessions {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					us, err := ds.Session(context.Background(), creds)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if i == 0 {
+						tt.mutate(us)
+					}
+					sessions[i] = us
+				}(i)
+			}
+			waitCalls(t, calls, 1)
+			time.Sleep(10 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			want := &palermo.Session{
+				UserID:         "u1",
+				Scopes:         []string{"read"},
+				AllowedMethods: []string{"/auth.AuthService/Get"},
+				Metadata:       map[string]string{"plan": "free"},
+			}
+			for _, us := range sessions[1:] {
+				if us != nil && !reflect.DeepEqual(us, want) {
+					t.Errorf("got session %+v, want %+v", us, want)
+				}
+			}
+		})
+	}
+}
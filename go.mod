@@ -1,8 +1,23 @@
 module github.com/go-toschool/palermo
 
+go 1.13
+
 require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
-	github.com/golang/protobuf v1.2.1-0.20190205222052-c823c79ea157
+	github.com/gin-gonic/gin v1.6.3
+	github.com/go-chi/chi v4.1.2+incompatible
+	github.com/go-redis/redis v6.15.2+incompatible
+	github.com/golang/protobuf v1.3.3
+	github.com/grpc-ecosystem/grpc-gateway v1.5.1
+	github.com/labstack/echo/v4 v4.1.17
 	github.com/lib/pq v1.0.0
+	github.com/prometheus/client_golang v0.9.2
+	github.com/rs/zerolog v1.18.0
+	github.com/sirupsen/logrus v1.3.0
+	go.uber.org/zap v1.16.0
+	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
+	golang.org/x/net v0.0.0-20200822124328-c89045814202
+	golang.org/x/sync v0.0.0-20190423024810-112230192c58
+	google.golang.org/genproto v0.0.0-20180831171423-11092d34479b
 	google.golang.org/grpc v1.18.0
 )
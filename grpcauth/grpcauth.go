@@ -0,0 +1,225 @@
+// Package grpcauth authenticates gRPC requests with palermo sessions and
+// forwards the caller identity to backends as trusted metadata.
+//
+// Gateways terminating authentication validate the credentials sent by the
+// client, strip any identity header the client may have supplied and inject
+// the canonical ones derived from the validated session. Backends must only
+// trust these headers when they come from the gateway over an authenticated
+// channel (e.g. mTLS).
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-toschool/palermo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys carrying the credentials of a request.
+const (
+	AuthorizationHeader   = "authorization"
+	ValidationTokenHeader = "x-validation-token"
+)
+
+// Metadata keys carrying the identity of a validated session.
+const (
+	UserIDHeader    = "x-user-id"
+	UserEmailHeader = "x-user-email"
+	ScopesHeader    = "x-scopes"
+)
+
+const bearerPrefix = "bearer "
+
+// ErrAPIVersionMismatch is returned when a session restricted to an API
+// version is used on another one.
+var ErrAPIVersionMismatch = errors.New("grpcauth: session not valid for this API version")
+
+// ErrMethodNotAllowed is returned when a session restricted to some methods is
+// used on another one.
+var ErrMethodNotAllowed = errors.New("grpcauth: session not valid for this method")
+
+var forwardHeaders = []string{UserIDHeader, UserEmailHeader, ScopesHeader}
+
+type sessionKey struct{}
+
+// NewContext returns a copy of ctx carrying the given session.
+func NewContext(ctx context.Context, s *palermo.Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// FromContext returns the session stored in ctx by the interceptors, if any.
+func FromContext(ctx context.Context) (*palermo.Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*palermo.Session)
+	return s, ok
+}
+
+// ForwardHeaders returns the canonical identity headers of a validated
+// session.
+func ForwardHeaders(s *palermo.Session) metadata.MD {
+	md := metadata.Pairs(UserIDHeader, s.UserID, UserEmailHeader, s.Email)
+	if len(s.Scopes) > 0 {
+		md.Set(ScopesHeader, strings.Join(s.Scopes, " "))
+	}
+	return md
+}
+
+// StripForwardHeaders returns a copy of md without identity headers, so they
+// cannot be spoofed by clients.
+func StripForwardHeaders(md metadata.MD) metadata.MD {
+	md = md.Copy()
+	for _, k := range forwardHeaders {
+		delete(md, k)
+	}
+	return md
+}
+
+// CredentialsFromMetadata extracts session credentials from the authorization
+// ("Bearer <auth token>") and x-validation-token headers.
+func CredentialsFromMetadata(md metadata.MD) (*palermo.SessionCredentials, bool) {
+	auth := md.Get(AuthorizationHeader)
+	val := md.Get(ValidationTokenHeader)
+	if len(auth) == 0 || len(val) == 0 {
+		return nil, false
+	}
+
+	if len(auth[0]) < len(bearerPrefix) || !strings.EqualFold(auth[0][:len(bearerPrefix)], bearerPrefix) {
+		return nil, false
+	}
+
+	return &palermo.SessionCredentials{
+		AuthToken:       auth[0][len(bearerPrefix):],
+		ValidationToken: val[0],
+	}, true
+}
+
+// APIVersionFromMethod extracts the API version from the proto package of a
+// full gRPC method name, e.g. "v1" for "/auth.v1.AuthService/Get". It returns
+// an empty string for unversioned packages.
+func APIVersionFromMethod(fullMethod string) string {
+	svc := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(svc, "/"); i >= 0 {
+		svc = svc[:i]
+	}
+
+	parts := strings.Split(svc, ".")
+	for i := len(parts) - 2; i >= 0; i-- {
+		if isAPIVersion(parts[i]) {
+			return parts[i]
+		}
+	}
+	return ""
+}
+
+// APIVersionFromPath extracts the API version from the first segment of an
+// HTTP path, e.g. "v2" for "/v2/sessions". It returns an empty string for
+// unversioned paths.
+func APIVersionFromPath(path string) string {
+	seg := strings.TrimPrefix(path, "/")
+	if i := strings.Index(seg, "/"); i >= 0 {
+		seg = seg[:i]
+	}
+
+	if isAPIVersion(seg) {
+		return seg
+	}
+	return ""
+}
+
+// CheckAPIVersion verifies the session may be used on the given API version.
+// Sessions without an API version, and unversioned APIs, are always allowed.
+func CheckAPIVersion(s *palermo.Session, version string) error {
+	if s.APIVersion == "" || version == "" || s.APIVersion == version {
+		return nil
+	}
+	return ErrAPIVersionMismatch
+}
+
+// CheckMethod verifies the session may be used on the given full gRPC method
+// name.
+func CheckMethod(s *palermo.Session, fullMethod string) error {
+	if len(s.AllowedMethods) == 0 {
+		return nil
+	}
+
+	for _, m := range s.AllowedMethods {
+		if m == fullMethod {
+			return nil
+		}
+	}
+	return ErrMethodNotAllowed
+}
+
+func isAPIVersion(s string) bool {
+	return len(s) >= 2 && s[0] == 'v' && s[1] >= '0' && s[1] <= '9'
+}
+
+// UnaryServerInterceptor returns an interceptor validating the credentials
+// of incoming requests with svc. The validated session is stored in the
+// context and its identity headers replace any client-supplied ones in the
+// incoming metadata and are set in the outgoing metadata, so calls made by
+// the handler forward them to backends. Sessions restricted to an API
+// version or to some methods are rejected on any other method.
+func UnaryServerInterceptor(svc palermo.SessionService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, svc, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor(svc palermo.SessionService) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), svc, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, svc palermo.SessionService, fullMethod string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = StripForwardHeaders(md)
+
+	c, ok := CredentialsFromMetadata(md)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing session credentials")
+	}
+
+	s, err := svc.Session(ctx, c)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid session credentials")
+	}
+
+	if err := CheckAPIVersion(s, APIVersionFromMethod(fullMethod)); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if err := CheckMethod(s, fullMethod); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	fwd := ForwardHeaders(s)
+	ctx = metadata.NewIncomingContext(ctx, metadata.Join(md, fwd))
+	out, _ := metadata.FromOutgoingContext(ctx)
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Join(StripForwardHeaders(out), fwd))
+	return NewContext(ctx, s), nil
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
@@ -0,0 +1,310 @@
+package grpcauth_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/grpcauth"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/palermotest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestForwardHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		session *palermo.Session
+		want    metadata.MD
+	}{
+		{"without scopes", &palermo.Session{UserID: "42", Email: "jane@example.com"}, metadata.MD{
+			grpcauth.UserIDHeader:    {"42"},
+			grpcauth.UserEmailHeader: {"jane@example.com"},
+		}},
+		{"with scopes", &palermo.Session{UserID: "42", Email: "jane@example.com", Scopes: []string{"read", "write"}}, metadata.MD{
+			grpcauth.UserIDHeader:    {"42"},
+			grpcauth.UserEmailHeader: {"jane@example.com"},
+			grpcauth.ScopesHeader:    {"read write"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grpcauth.ForwardHeaders(tt.session); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ForwardHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripForwardHeaders(t *testing.T) {
+	md := metadata.Pairs(
+		grpcauth.UserIDHeader, "1",
+		grpcauth.UserEmailHeader, "root@example.com",
+		grpcauth.ScopesHeader, "admin",
+		grpcauth.AuthorizationHeader, "Bearer a",
+		"x-request-id", "r1",
+	)
+	got := grpcauth.StripForwardHeaders(md)
+	want := metadata.Pairs(grpcauth.AuthorizationHeader, "Bearer a", "x-request-id", "r1")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StripForwardHeaders() = %v, want %v", got, want)
+	}
+	if len(md.Get(grpcauth.UserIDHeader)) == 0 {
+		t.Error("StripForwardHeaders() modified its argument")
+	}
+}
+
+func TestCredentialsFromMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		md     metadata.MD
+		want   *palermo.SessionCredentials
+		wantOK bool
+	}{
+		{"bearer", metadata.Pairs("authorization", "Bearer a", "x-validation-token", "v"), &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"}, true},
+		{"case insensitive scheme", metadata.Pairs("authorization", "bearer a", "x-validation-token", "v"), &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"}, true},
+		{"other scheme", metadata.Pairs("authorization", "Basic a", "x-validation-token", "v"), nil, false},
+		{"short authorization", metadata.Pairs("authorization", "a", "x-validation-token", "v"), nil, false},
+		{"no validation token", metadata.Pairs("authorization", "Bearer a"), nil, false},
+		{"no authorization", metadata.Pairs("x-validation-token", "v"), nil, false},
+		{"empty", nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := grpcauth.CredentialsFromMetadata(tt.md)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CredentialsFromMetadata() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAPIVersion(t *testing.T) {
+	methods := []struct {
+		method string
+		want   string
+	}{
+		{"/auth.v1.AuthService/Get", "v1"},
+		{"/palermo.auth.v2beta.AuthService/Get", "v2beta"},
+		{"/auth.AuthService/Get", ""},
+		{"/v1.AuthService/Get", "v1"},
+		{"", ""},
+	}
+	for _, tt := range methods {
+		if got := grpcauth.APIVersionFromMethod(tt.method); got != tt.want {
+			t.Errorf("APIVersionFromMethod(%q) = %q, want %q", tt.method, got, tt.want)
+		}
+	}
+
+	paths := []struct {
+		path string
+		want string
+	}{
+		{"/v1/sessions", "v1"},
+		{"/v2", "v2"},
+		{"/sessions", ""},
+		{"/version/sessions", ""},
+		{"", ""},
+	}
+	for _, tt := range paths {
+		if got := grpcauth.APIVersionFromPath(tt.path); got != tt.want {
+			t.Errorf("APIVersionFromPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	session := &palermo.Session{ID: "s1", UserID: "42", Email: "jane@example.com", Scopes: []string{"read"}}
+	sessions := &palermotest.SessionService{
+		SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+			if c.AuthToken != "good" || c.ValidationToken != "v" {
+				return nil, errors.New("invalid token")
+			}
+			return session, nil
+		},
+	}
+	intercept := grpcauth.UnaryServerInterceptor(sessions)
+
+	tests := []struct {
+		name     string
+		incoming metadata.MD
+		outgoing metadata.MD
+		wantCode codes.Code
+	}{
+		{"valid credentials", metadata.Pairs("authorization", "Bearer good", "x-validation-token", "v"), nil, codes.OK},
+		{"spoofed incoming identity", metadata.Pairs(
+			"authorization", "Bearer good", "x-validation-token", "v",
+			"x-user-id", "1", "x-user-email", "root@example.com", "x-scopes", "admin",
+		), nil, codes.OK},
+		{"spoofed outgoing identity", metadata.Pairs("authorization", "Bearer good", "x-validation-token", "v"), metadata.Pairs("x-user-id", "1", "x-trace", "t1"), codes.OK},
+		{"spoofed identity without credentials", metadata.Pairs("x-user-id", "42"), nil, codes.Unauthenticated},
+		{"missing credentials", nil, nil, codes.Unauthenticated},
+		{"invalid credentials", metadata.Pairs("authorization", "Bearer bad", "x-validation-token", "v"), nil, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.incoming != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.incoming)
+			}
+			if tt.outgoing != nil {
+				ctx = metadata.NewOutgoingContext(ctx, tt.outgoing)
+			}
+
+			var handled context.Context
+			_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/auth.AuthService/Get"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				handled = ctx
+				return nil, nil
+			})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("interceptor = %v, want %v", err, tt.wantCode)
+			}
+			if err != nil {
+				if handled != nil {
+					t.Error("handler called on failure")
+				}
+				return
+			}
+
+			if s, ok := grpcauth.FromContext(handled); !ok || s != session {
+				t.Errorf("FromContext() = %+v, %v", s, ok)
+			}
+			in, _ := metadata.FromIncomingContext(handled)
+			out, _ := metadata.FromOutgoingContext(handled)
+			for _, md := range []metadata.MD{in, out} {
+				for k, want := range map[string]string{"x-user-id": "42", "x-user-email": "jane@example.com", "x-scopes": "read"} {
+					if got := md.Get(k); !reflect.DeepEqual(got, []string{want}) {
+						t.Errorf("%s = %q, want %q", k, got, want)
+					}
+				}
+			}
+			if tt.outgoing != nil && !reflect.DeepEqual(out.Get("x-trace"), []string{"t1"}) {
+				t.Errorf("outgoing metadata lost: %v", out)
+			}
+		})
+	}
+}
+
+func TestAPIVersionRouting(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: []byte("0123456789abcdef0123456789abcdef"), MaxAge: time.Hour}
+	v1, err := js.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com", APIVersion: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unscoped, err := js.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		creds    *palermo.SessionCredentials
+		method   string
+		wantCode codes.Code
+	}{
+		{"v1 token on v1", v1, "/auth.v1.AuthService/Get", codes.OK},
+		{"v1 token on v2", v1, "/auth.v2.AuthService/Get", codes.PermissionDenied},
+		{"v1 token on unversioned API", v1, "/auth.AuthService/Get", codes.OK},
+		{"unversioned token on v2", unscoped, "/auth.v2.AuthService/Get", codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := call(js, tt.creds, tt.method); status.Code(err) != tt.wantCode {
+				t.Errorf("interceptor = %v, want %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCheckAPIVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		session string
+		path    string
+		wantErr error
+	}{
+		{"same version", "v1", "/v1/sessions", nil},
+		{"other version", "v1", "/v2/sessions", grpcauth.ErrAPIVersionMismatch},
+		{"unversioned path", "v1", "/sessions", nil},
+		{"unversioned session", "", "/v2/sessions", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &palermo.Session{APIVersion: tt.session}
+			if err := grpcauth.CheckAPIVersion(s, grpcauth.APIVersionFromPath(tt.path)); err != tt.wantErr {
+				t.Errorf("CheckAPIVersion() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSingleMethodToken(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: []byte("0123456789abcdef0123456789abcdef"), MaxAge: time.Hour}
+	download, err := js.CreateSession(ctx, &palermo.Session{
+		UserID:         "42",
+		Email:          "jane@example.com",
+		AllowedMethods: []string{"/files.FileService/Download"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		wantCode codes.Code
+	}{
+		{"allowed method", "/files.FileService/Download", codes.OK},
+		{"other method of the service", "/files.FileService/Delete", codes.PermissionDenied},
+		{"same method of another service", "/backup.FileService/Download", codes.PermissionDenied},
+		{"method prefix", "/files.FileService/DownloadAll", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := call(js, download, tt.method); status.Code(err) != tt.wantCode {
+				t.Errorf("unary interceptor = %v, want %v", err, tt.wantCode)
+			}
+
+			ss := &serverStream{ctx: incomingContext(ctx, download)}
+			err := grpcauth.StreamServerInterceptor(js)(nil, ss, &grpc.StreamServerInfo{FullMethod: tt.method}, func(srv interface{}, ss grpc.ServerStream) error {
+				return nil
+			})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("stream interceptor = %v, want %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+// call runs the unary interceptor of svc on the given method with the given
+// credentials.
+func call(svc palermo.SessionService, c *palermo.SessionCredentials, method string) error {
+	_, err := grpcauth.UnaryServerInterceptor(svc)(incomingContext(context.Background(), c), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	return err
+}
+
+func incomingContext(ctx context.Context, c *palermo.SessionCredentials) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(
+		grpcauth.AuthorizationHeader, "Bearer "+c.AuthToken,
+		grpcauth.ValidationTokenHeader, c.ValidationToken,
+	))
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
@@ -0,0 +1,197 @@
+// Package handle implements a palermo.SessionService decorator handing out
+// opaque random handles instead of the credentials of the decorated service.
+//
+// The decorated credentials, e.g. JWT or PASETO tokens, never leave the
+// server: they are kept in a Store under the hash of the authentication
+// handle and resolved on every call, so clients cannot read user data out of
+// their bearer tokens. Deleting a handle revokes it immediately.
+//
+// Decorated credentials carrying a refresh token get a refresh handle as
+// well, required to refresh them. As refreshing hands out new handles along
+// with new decorated credentials, single-use refresh tokens rotate through
+// the handles.
+package handle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/opaque"
+)
+
+// ErrHandleNotFound is returned when the handles match no stored credentials,
+// e.g. because they expired or were revoked.
+var ErrHandleNotFound = errors.New("handle: handle not found")
+
+// ErrInvalidMaxAge is returned when handles would expire on creation.
+var ErrInvalidMaxAge = errors.New("handle: MaxAge must be positive")
+
+// Record holds the decorated credentials behind a pair of handles.
+type Record struct {
+	// ValidationHash is the hash of the validation handle.
+	ValidationHash string `json:"validation_hash"`
+
+	// RefreshHash is the hash of the refresh handle, set when the decorated
+	// credentials carry a refresh token.
+	RefreshHash string `json:"refresh_hash,omitempty"`
+
+	// Credentials are the credentials of the decorated service.
+	Credentials palermo.SessionCredentials `json:"credentials"`
+}
+
+// Store keeps records under the hash of their authentication handle.
+type Store interface {
+	// Put stores r under key. The record may be dropped at expiresAt.
+	Put(ctx context.Context, key string, r *Record, expiresAt time.Time) error
+
+	// Get returns the record stored under key, or ErrHandleNotFound.
+	Get(ctx context.Context, key string) (*Record, error)
+
+	// Delete removes the record stored under key, if any.
+	Delete(ctx context.Context, key string) error
+}
+
+// SessionService decorates a palermo.SessionService issuing self-contained
+// credentials so that it hands out opaque handles instead.
+type SessionService struct {
+	palermo.SessionService
+
+	// Store keeps the decorated credentials.
+	Store Store
+
+	// MaxAge is how long handles are kept. It must cover the lifetime of
+	// the decorated credentials, refresh tokens included, or handles will
+	// expire before them.
+	MaxAge time.Duration
+
+	// ServiceAccountMaxAge is how long the handles of service accounts are
+	// kept, as their credentials typically outlive the ones of users.
+	// Defaults to MaxAge.
+	ServiceAccountMaxAge time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Session validates and returns the user session associated with the given
+// handles.
+func (ss *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	r, err := ss.resolve(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return ss.SessionService.Session(ctx, &r.Credentials)
+}
+
+// RefreshSession validates and returns the user session associated with the
+// given handles, updated. The refresh handle is required when the decorated
+// credentials carry a refresh token.
+func (ss *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	r, err := ss.resolve(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if r.RefreshHash != "" && !opaque.Equal(r.RefreshHash, opaque.Hash(c.RefreshToken)) {
+		return nil, ErrHandleNotFound
+	}
+	return ss.SessionService.RefreshSession(ctx, &r.Credentials)
+}
+
+// CreateSession creates credentials for the given session and returns new
+// handles for them.
+func (ss *SessionService) CreateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if ss.MaxAge <= 0 {
+		return nil, ErrInvalidMaxAge
+	}
+
+	c, err := ss.SessionService.CreateSession(ctx, us)
+	if err != nil {
+		return nil, err
+	}
+	return ss.store(ctx, c, ss.maxAge(us))
+}
+
+// UpdateSession creates credentials for the given session and returns new
+// handles for them. Previous handles stay valid until they expire.
+func (ss *SessionService) UpdateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if ss.MaxAge <= 0 {
+		return nil, ErrInvalidMaxAge
+	}
+
+	c, err := ss.SessionService.UpdateSession(ctx, us)
+	if err != nil {
+		return nil, err
+	}
+	return ss.store(ctx, c, ss.maxAge(us))
+}
+
+// RevokeSession deletes the credentials associated with the given handles.
+// As they never left the server, the decorated credentials need no
+// revocation.
+func (ss *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	if _, err := ss.resolve(ctx, c); err != nil {
+		return err
+	}
+	return ss.Store.Delete(ctx, opaque.Hash(c.AuthToken))
+}
+
+// Close closes the decorated service, if it can be closed.
+func (ss *SessionService) Close() error {
+	if c, ok := ss.SessionService.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (ss *SessionService) resolve(ctx context.Context, c *palermo.SessionCredentials) (*Record, error) {
+	r, err := ss.Store.Get(ctx, opaque.Hash(c.AuthToken))
+	if err != nil {
+		return nil, err
+	}
+	if !opaque.Equal(r.ValidationHash, opaque.Hash(c.ValidationToken)) {
+		return nil, ErrHandleNotFound
+	}
+	return r, nil
+}
+
+// maxAge returns how long the handles of the given session are kept.
+func (ss *SessionService) maxAge(us *palermo.Session) time.Duration {
+	if us.ServiceAccount && ss.ServiceAccountMaxAge > 0 {
+		return ss.ServiceAccountMaxAge
+	}
+	return ss.MaxAge
+}
+
+func (ss *SessionService) store(ctx context.Context, c *palermo.SessionCredentials, maxAge time.Duration) (*palermo.SessionCredentials, error) {
+	h, err := opaque.NewCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Record{
+		ValidationHash: opaque.Hash(h.ValidationToken),
+		Credentials:    *c,
+	}
+	if c.RefreshToken != "" {
+		rh, err := opaque.NewCredentials()
+		if err != nil {
+			return nil, err
+		}
+		h.RefreshToken = rh.AuthToken
+		r.RefreshHash = opaque.Hash(h.RefreshToken)
+	}
+	if err := ss.Store.Put(ctx, opaque.Hash(h.AuthToken), r, ss.now().Add(maxAge)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (ss *SessionService) now() time.Time {
+	if ss.Now != nil {
+		return ss.Now()
+	}
+	return time.Now()
+}
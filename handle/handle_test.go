@@ -0,0 +1,142 @@
+package handle_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/handle"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/memory"
+)
+
+func TestSessionServiceMaxAge(t *testing.T) {
+	tests := []struct {
+		name                 string
+		session              *palermo.Session
+		serviceAccountMaxAge time.Duration
+		alive, expired       time.Duration
+	}{
+		{"user", &palermo.Session{UserID: "42", Email: "jane@example.com"}, 48 * time.Hour, 50 * time.Minute, 70 * time.Minute},
+		{"service account", &palermo.Session{UserID: "billing", ServiceAccount: true}, 48 * time.Hour, 47 * time.Hour, 49 * time.Hour},
+		{"service account default", &palermo.Session{UserID: "billing", ServiceAccount: true}, 0, 50 * time.Minute, 70 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			clock := func() time.Time { return now }
+			hs := &handle.SessionService{
+				// The memory service does not create service accounts, so
+				// the handles are checked against the store only.
+				SessionService:       &recordingService{},
+				Store:                &handle.MemoryStore{Now: clock},
+				MaxAge:               time.Hour,
+				ServiceAccountMaxAge: tt.serviceAccountMaxAge,
+				Now:                  clock,
+			}
+
+			ctx := context.Background()
+			c, err := hs.CreateSession(ctx, tt.session)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now = now.Add(tt.alive)
+			if _, err := hs.Session(ctx, c); err != nil {
+				t.Errorf("after %v: %v", tt.alive, err)
+			}
+			now = now.Add(tt.expired - tt.alive)
+			if _, err := hs.Session(ctx, c); err != handle.ErrHandleNotFound {
+				t.Errorf("after %v: got %v, want %v", tt.expired, err, handle.ErrHandleNotFound)
+			}
+		})
+	}
+}
+
+// recordingService is a palermo.SessionService minting fixed credentials and
+// resolving them to the last created session.
+type recordingService struct {
+	memory.SessionService
+	last *palermo.Session
+}
+
+func (rs *recordingService) CreateSession(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error) {
+	rs.last = s
+	return &palermo.SessionCredentials{ValidationToken: "v", AuthToken: "a"}, nil
+}
+
+func (rs *recordingService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	return rs.last, nil
+}
+
+func TestSessionServiceRefreshHandle(t *testing.T) {
+	js := &jwt.SessionService{
+		SecretKey:     []byte("0123456789abcdef0123456789abcdef"),
+		MaxAge:        time.Minute,
+		RefreshMaxAge: time.Hour,
+	}
+	hs := &handle.SessionService{
+		SessionService: js,
+		Store:          &handle.MemoryStore{},
+		MaxAge:         time.Hour,
+	}
+
+	ctx := context.Background()
+	c, err := hs.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RefreshToken == "" {
+		t.Fatal("no refresh handle handed out")
+	}
+	if strings.Count(c.RefreshToken, ".") == 2 {
+		t.Fatal("decorated refresh token handed out")
+	}
+
+	tests := []struct {
+		name         string
+		refreshToken string
+		wantErr      error
+	}{
+		{"missing refresh handle", "", handle.ErrHandleNotFound},
+		{"other refresh handle", c.AuthToken, handle.ErrHandleNotFound},
+		{"refresh handle", c.RefreshToken, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := hs.RefreshSession(ctx, &palermo.SessionCredentials{
+				ValidationToken: c.ValidationToken,
+				AuthToken:       c.AuthToken,
+				RefreshToken:    tt.refreshToken,
+			})
+			if err != tt.wantErr {
+				t.Errorf("RefreshSession() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionServiceWithoutRefreshTokens(t *testing.T) {
+	hs := &handle.SessionService{
+		SessionService: &jwt.SessionService{
+			SecretKey: []byte("0123456789abcdef0123456789abcdef"),
+			MaxAge:    time.Minute,
+		},
+		Store:  &handle.MemoryStore{},
+		MaxAge: time.Hour,
+	}
+
+	ctx := context.Background()
+	c, err := hs.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RefreshToken != "" {
+		t.Error("refresh handle handed out without refresh token")
+	}
+	if _, err := hs.RefreshSession(ctx, c); err != nil {
+		t.Errorf("RefreshSession() = %v", err)
+	}
+}
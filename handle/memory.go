@@ -0,0 +1,77 @@
+package handle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements Store in memory. Handles are lost on restart and
+// not shared between instances.
+type MemoryStore struct {
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	records   map[string]*memoryRecord
+	lastSweep time.Time
+}
+
+type memoryRecord struct {
+	record    Record
+	expiresAt time.Time
+}
+
+// Put stores r under key until expiresAt.
+func (ms *MemoryStore) Put(ctx context.Context, key string, r *Record, expiresAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.records == nil {
+		ms.records = make(map[string]*memoryRecord)
+	}
+	ms.records[key] = &memoryRecord{record: *r, expiresAt: expiresAt}
+
+	// Expired records are rejected anyway, so they can be dropped to keep
+	// memory bounded.
+	now := ms.now()
+	if now.Sub(ms.lastSweep) > time.Minute {
+		for k, mr := range ms.records {
+			if !now.Before(mr.expiresAt) {
+				delete(ms.records, k)
+			}
+		}
+		ms.lastSweep = now
+	}
+	return nil
+}
+
+// Get returns the record stored under key, or ErrHandleNotFound once
+// expired.
+func (ms *MemoryStore) Get(ctx context.Context, key string) (*Record, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mr, ok := ms.records[key]
+	if !ok || !ms.now().Before(mr.expiresAt) {
+		return nil, ErrHandleNotFound
+	}
+	r := mr.record
+	return &r, nil
+}
+
+// Delete removes the record stored under key, if any.
+func (ms *MemoryStore) Delete(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.records, key)
+	return nil
+}
+
+func (ms *MemoryStore) now() time.Time {
+	if ms.Now != nil {
+		return ms.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,142 @@
+// Package health aggregates the health of palermo components.
+//
+// Components (session backend, revocation store, signing keys...) report
+// their own level and the aggregator derives the overall service health from
+// the worst of them. Degraded components keep the service serving unless the
+// aggregator is configured otherwise.
+package health
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-toschool/palermo"
+)
+
+// Level represents the health of a component.
+type Level int
+
+// Health levels, from best to worst.
+const (
+	OK Level = iota
+	Degraded
+	Down
+)
+
+func (l Level) String() string {
+	switch l {
+	case OK:
+		return "ok"
+	case Degraded:
+		return "degraded"
+	case Down:
+		return "down"
+	}
+	return "unknown"
+}
+
+// Status is the health reported by a component.
+type Status struct {
+	Component string
+	Level     Level
+	Message   string
+}
+
+// Aggregator collects component statuses.
+type Aggregator struct {
+	// DegradedNotServing makes a degraded service report as not serving.
+	// By default degraded services keep serving and a warning is logged.
+	DegradedNotServing bool
+
+	// OnChange, when set, is called whenever the serving state changes, e.g.
+	// to update the gRPC health service.
+	OnChange func(serving bool)
+
+	// Logger receives the warnings about unhealthy components. Defaults to
+	// palermo.NopLogger.
+	Logger palermo.Logger
+
+	mu         sync.Mutex
+	components map[string]Status
+	serving    bool
+}
+
+// Set records the health level of a component.
+func (a *Aggregator) Set(component string, level Level, message string) {
+	a.mu.Lock()
+	if a.components == nil {
+		a.components = make(map[string]Status)
+		a.serving = true
+	}
+
+	prev, ok := a.components[component]
+	a.components[component] = Status{Component: component, Level: level, Message: message}
+	if level != OK && (!ok || prev.Level != level) {
+		a.logger().Warn("Health: component not healthy", palermo.Fields{
+			"component": component,
+			"level":     level.String(),
+			"message":   message,
+		})
+	}
+
+	serving := a.servingLocked()
+	changed := serving != a.serving
+	a.serving = serving
+	a.mu.Unlock()
+
+	if changed && a.OnChange != nil {
+		a.OnChange(serving)
+	}
+}
+
+// Status returns the overall health level, the worst of every component, and
+// the status of each component sorted by name.
+func (a *Aggregator) Status() (Level, []Status) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	overall := OK
+	statuses := make([]Status, 0, len(a.components))
+	for _, s := range a.components {
+		if s.Level > overall {
+			overall = s.Level
+		}
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Component < statuses[j].Component
+	})
+	return overall, statuses
+}
+
+// Serving reports whether the service should be considered as serving.
+func (a *Aggregator) Serving() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.servingLocked()
+}
+
+func (a *Aggregator) servingLocked() bool {
+	overall := OK
+	for _, s := range a.components {
+		if s.Level > overall {
+			overall = s.Level
+		}
+	}
+
+	switch overall {
+	case Down:
+		return false
+	case Degraded:
+		return !a.DegradedNotServing
+	}
+	return true
+}
+
+func (a *Aggregator) logger() palermo.Logger {
+	if a.Logger == nil {
+		return palermo.NopLogger{}
+	}
+	return a.Logger
+}
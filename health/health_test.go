@@ -0,0 +1,119 @@
+package health_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-toschool/palermo/health"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+func TestAggregator(t *testing.T) {
+	components := []string{"backend", "keys", "revocation"}
+
+	tests := []struct {
+		name               string
+		levels             map[string]health.Level
+		degradedNotServing bool
+		wantLevel          health.Level
+		wantServing        bool
+	}{
+		{"all ok", nil, false, health.OK, true},
+		{"backend slow", map[string]health.Level{"backend": health.Degraded}, false, health.Degraded, true},
+		{"revocation store failing open", map[string]health.Level{"revocation": health.Degraded}, false, health.Degraded, true},
+		{"key near rotation deadline", map[string]health.Level{"keys": health.Degraded}, false, health.Degraded, true},
+		{"degraded not serving", map[string]health.Level{"keys": health.Degraded}, true, health.Degraded, false},
+		{"backend down", map[string]health.Level{"backend": health.Down}, false, health.Down, false},
+		{"worst level wins", map[string]health.Level{"backend": health.Degraded, "revocation": health.Down}, false, health.Down, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []bool
+			a := &health.Aggregator{
+				DegradedNotServing: tt.degradedNotServing,
+				OnChange:           func(serving bool) { changes = append(changes, serving) },
+			}
+			for _, c := range components {
+				a.Set(c, health.OK, "")
+			}
+			for c, l := range tt.levels {
+				a.Set(c, l, "forced "+l.String())
+			}
+
+			level, statuses := a.Status()
+			if level != tt.wantLevel {
+				t.Errorf("Status() level = %v, want %v", level, tt.wantLevel)
+			}
+			var names []string
+			for _, s := range statuses {
+				names = append(names, s.Component)
+				if want := tt.levels[s.Component]; s.Level != want {
+					t.Errorf("%s level = %v, want %v", s.Component, s.Level, want)
+				}
+				if s.Level != health.OK && s.Message != "forced "+s.Level.String() {
+					t.Errorf("%s message = %q", s.Component, s.Message)
+				}
+			}
+			if !reflect.DeepEqual(names, components) {
+				t.Errorf("got components %q, want %q", names, components)
+			}
+
+			if got := a.Serving(); got != tt.wantServing {
+				t.Errorf("Serving() = %v, want %v", got, tt.wantServing)
+			}
+			var wantChanges []bool
+			if !tt.wantServing {
+				wantChanges = []bool{false}
+			}
+			if !reflect.DeepEqual(changes, wantChanges) {
+				t.Errorf("OnChange calls %v, want %v", changes, wantChanges)
+			}
+
+			// Recovering restores the serving state.
+			for c := range tt.levels {
+				a.Set(c, health.OK, "")
+			}
+			if level, _ := a.Status(); level != health.OK || !a.Serving() {
+				t.Errorf("after recovery: level %v, serving %v", level, a.Serving())
+			}
+		})
+	}
+}
+
+func TestLevelString(t *testing.T) {
+	tests := []struct {
+		level health.Level
+		want  string
+	}{
+		{health.OK, "ok"},
+		{health.Degraded, "degraded"},
+		{health.Down, "down"},
+		{health.Level(42), "unknown"},
+	}
+	for _, tt := range tests {
+		if got := tt.level.String(); got != tt.want {
+			t.Errorf("Level(%d).String() = %q, want %q", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestAggregatorLogsUnhealthyComponents(t *testing.T) {
+	log := &palermotest.Logger{}
+	a := &health.Aggregator{Logger: log}
+
+	a.Set("backend", health.OK, "")
+	a.Set("revocation", health.Degraded, "connection refused")
+	a.Set("revocation", health.Degraded, "connection refused")
+	a.Set("revocation", health.Down, "connection refused")
+
+	entries := log.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("logged %+v, want a warning per level change", entries)
+	}
+	for i, level := range []string{"degraded", "down"} {
+		e := entries[i]
+		if e.Level != "warn" || e.Fields["component"] != "revocation" || e.Fields["level"] != level {
+			t.Errorf("entry %d = %+v", i, e)
+		}
+	}
+}
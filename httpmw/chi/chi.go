@@ -0,0 +1,30 @@
+// Package chi adapts the httpmw middleware to chi routers. chi middlewares
+// being net/http ones, the session of the requests is in their context.
+package chi
+
+import (
+	"net/http"
+
+	gchi "github.com/go-chi/chi"
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/httpmw"
+)
+
+// RequireSession returns a router of the routes of r only serving the
+// requests with valid credentials, as m does, their methods being named
+// after the chi route patterns:
+//
+//	chi.RequireSession(r, mw).Get("/account", accountHandler)
+func RequireSession(r gchi.Router, m *httpmw.Middleware) gchi.Router {
+	return r.With(func(next http.Handler) http.Handler {
+		h := m.RequireSession(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, httpmw.WithRoute(r, gchi.RouteContext(r.Context()).RoutePattern()))
+		})
+	})
+}
+
+// Session returns the session of r set by RequireSession, if any.
+func Session(r *http.Request) (*palermo.Session, bool) {
+	return httpmw.FromContext(r.Context())
+}
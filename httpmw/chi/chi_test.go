@@ -0,0 +1,47 @@
+package chi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gchi "github.com/go-chi/chi"
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/httpmw"
+	"github.com/go-toschool/palermo/httpmw/chi"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+func TestRequireSessionRoutePattern(t *testing.T) {
+	mw := &httpmw.Middleware{
+		Sessions: &palermotest.SessionService{
+			SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+				return &palermo.Session{AllowedMethods: []string{"GET /users/{id}"}}, nil
+			},
+		},
+	}
+	r := gchi.NewRouter()
+	chi.RequireSession(r, mw).Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	chi.RequireSession(r, mw).Delete("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		method     string
+		wantStatus int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodDelete, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/users/42", nil)
+			req.Header.Set("Authorization", "Bearer auth")
+			req.Header.Set(httpmw.ValidationTokenHeader, "validation")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
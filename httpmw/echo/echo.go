@@ -0,0 +1,38 @@
+// Package echo adapts the httpmw middleware to Echo, exposing the session of
+// the requests through the Echo context.
+package echo
+
+import (
+	"net/http"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/httpmw"
+	lecho "github.com/labstack/echo/v4"
+)
+
+// SessionKey is the key of the session in the Echo context.
+const SessionKey = "palermo.session"
+
+// RequireSession returns an Echo middleware rejecting the requests without
+// valid credentials, as m does, and setting the session of the others in
+// the Echo context. Their methods are named after the Echo routes.
+func RequireSession(m *httpmw.Middleware) lecho.MiddlewareFunc {
+	return func(next lecho.HandlerFunc) lecho.HandlerFunc {
+		return func(c lecho.Context) error {
+			var err error
+			m.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				s, _ := httpmw.FromContext(r.Context())
+				c.SetRequest(r)
+				c.Set(SessionKey, s)
+				err = next(c)
+			})).ServeHTTP(c.Response(), httpmw.WithRoute(c.Request(), c.Path()))
+			return err
+		}
+	}
+}
+
+// Session returns the session set in c by RequireSession, if any.
+func Session(c lecho.Context) (*palermo.Session, bool) {
+	s, ok := c.Get(SessionKey).(*palermo.Session)
+	return s, ok
+}
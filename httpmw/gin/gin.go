@@ -0,0 +1,44 @@
+// Package gin adapts the httpmw middleware to Gin, exposing the session of
+// the requests through the Gin context.
+package gin
+
+import (
+	"net/http"
+
+	ggin "github.com/gin-gonic/gin"
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/httpmw"
+)
+
+// SessionKey is the key of the session in the Gin context.
+const SessionKey = "palermo.session"
+
+// RequireSession returns a Gin middleware aborting the requests without
+// valid credentials, as m does, and setting the session of the others in
+// the Gin context. Their methods are named after the Gin routes.
+func RequireSession(m *httpmw.Middleware) ggin.HandlerFunc {
+	return func(c *ggin.Context) {
+		authenticated := false
+		m.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authenticated = true
+			s, _ := httpmw.FromContext(r.Context())
+			c.Request = r
+			c.Set(SessionKey, s)
+			c.Next()
+		})).ServeHTTP(c.Writer, httpmw.WithRoute(c.Request, c.FullPath()))
+
+		if !authenticated {
+			c.Abort()
+		}
+	}
+}
+
+// Session returns the session set in c by RequireSession, if any.
+func Session(c *ggin.Context) (*palermo.Session, bool) {
+	v, ok := c.Get(SessionKey)
+	if !ok {
+		return nil, false
+	}
+	s, ok := v.(*palermo.Session)
+	return s, ok
+}
@@ -0,0 +1,180 @@
+// Package httpmw authenticates net/http requests with palermo sessions.
+//
+// The middleware reads the credentials of a request from its Authorization
+// and X-Validation-Token headers, else from its cookies, validates them with
+// a palermo.SessionService, typically a client.Client calling the
+// AuthService, and hands the session to the next handler through the request
+// context. As the gRPC interceptors of grpcauth do, it rejects the sessions
+// restricted to another API version, read from the first path segment, or to
+// other methods, named after the HTTP method and route of the request:
+//
+//	mw := &httpmw.Middleware{Sessions: c}
+//	http.Handle("/account", mw.RequireSession(accountHandler))
+//
+//	func accountHandler(w http.ResponseWriter, r *http.Request) {
+//		s, _ := httpmw.FromContext(r.Context())
+//		...
+//	}
+package httpmw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/cookies"
+	"github.com/go-toschool/palermo/grpcauth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Names of the headers and cookies carrying the credentials.
+const (
+	ValidationTokenHeader = "X-Validation-Token"
+	AuthTokenCookie       = cookies.DefaultAuthTokenName
+	ValidationTokenCookie = cookies.DefaultValidationTokenName
+)
+
+const bearerPrefix = "bearer "
+
+// ErrMissingCredentials is handed to the error handler of requests carrying
+// no credentials.
+var ErrMissingCredentials = errors.New("httpmw: missing credentials")
+
+type sessionKey struct{}
+
+type routeKey struct{}
+
+// NewContext returns a copy of ctx carrying the given session.
+func NewContext(ctx context.Context, s *palermo.Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// FromContext returns the session stored in ctx by the middleware, if any.
+func FromContext(ctx context.Context) (*palermo.Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*palermo.Session)
+	return s, ok
+}
+
+// Middleware authenticates requests with the sessions of Sessions.
+type Middleware struct {
+	// Sessions validates the credentials of the requests.
+	Sessions palermo.SessionService
+
+	// ErrorHandler writes the response of the requests whose session could
+	// not be validated. Defaults to DefaultErrorHandler.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+	// Method returns the method name of a request, checked against the
+	// AllowedMethods of its session. Defaults to RouteMethod.
+	Method func(r *http.Request) string
+}
+
+// RequireSession returns a handler only calling next for requests carrying
+// valid credentials for their API version and method, with their session in
+// the request context.
+func (m *Middleware) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := Credentials(r)
+		if !ok {
+			m.errorHandler()(w, r, ErrMissingCredentials)
+			return
+		}
+
+		s, err := m.Sessions.Session(r.Context(), c)
+		if err != nil {
+			m.errorHandler()(w, r, err)
+			return
+		}
+
+		if err := grpcauth.CheckAPIVersion(s, grpcauth.APIVersionFromPath(r.URL.Path)); err != nil {
+			m.errorHandler()(w, r, status.Error(codes.PermissionDenied, err.Error()))
+			return
+		}
+		if err := grpcauth.CheckMethod(s, m.method(r)); err != nil {
+			m.errorHandler()(w, r, status.Error(codes.PermissionDenied, err.Error()))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), s)))
+	})
+}
+
+func (m *Middleware) method(r *http.Request) string {
+	if m.Method == nil {
+		return RouteMethod(r)
+	}
+	return m.Method(r)
+}
+
+func (m *Middleware) errorHandler() func(w http.ResponseWriter, r *http.Request, err error) {
+	if m.ErrorHandler == nil {
+		return DefaultErrorHandler
+	}
+	return m.ErrorHandler
+}
+
+// WithRoute returns a shallow copy of r recording the route pattern that
+// matched it, e.g. "/users/{id}", for RouteMethod. The framework adapters
+// record the routes of their routers.
+func WithRoute(r *http.Request, route string) *http.Request {
+	if route == "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+}
+
+// RouteMethod names the method of r after its HTTP method and route, e.g.
+// "GET /v1/users/{id}", the route being the one recorded by WithRoute, else
+// the path of r. Sessions restricted to some HTTP routes list these names in
+// their AllowedMethods.
+func RouteMethod(r *http.Request) string {
+	route, ok := r.Context().Value(routeKey{}).(string)
+	if !ok {
+		route = r.URL.Path
+	}
+	return r.Method + " " + route
+}
+
+// Credentials reads the credentials of r: the authentication token from the
+// bearer Authorization header, else from its cookie, and the validation
+// token from its header, else from its cookie. It reports whether both were
+// found.
+func Credentials(r *http.Request) (*palermo.SessionCredentials, bool) {
+	c := &palermo.SessionCredentials{
+		ValidationToken: r.Header.Get(ValidationTokenHeader),
+	}
+	if h := r.Header.Get("Authorization"); len(h) > len(bearerPrefix) && strings.EqualFold(h[:len(bearerPrefix)], bearerPrefix) {
+		c.AuthToken = strings.TrimSpace(h[len(bearerPrefix):])
+	} else if cookie, err := r.Cookie(AuthTokenCookie); err == nil {
+		c.AuthToken = cookie.Value
+	}
+	if c.ValidationToken == "" {
+		if cookie, err := r.Cookie(ValidationTokenCookie); err == nil {
+			c.ValidationToken = cookie.Value
+		}
+	}
+	return c, c.AuthToken != "" && c.ValidationToken != ""
+}
+
+// DefaultErrorHandler answers 503 Service Unavailable when the sessions could
+// not be validated for lack of an AuthService, so that clients retry rather
+// than log users out, 403 Forbidden when they are not valid for the request
+// and 401 Unauthorized otherwise.
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	code := status.Code(err)
+	if err == context.DeadlineExceeded {
+		code = codes.DeadlineExceeded
+	}
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	case codes.PermissionDenied:
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="palermo"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,91 @@
+package httpmw_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/httpmw"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+func TestRequireSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		session    palermo.Session
+		method     func(r *http.Request) string
+		req        string // "<method> <path>"
+		noCreds    bool
+		wantStatus int
+	}{
+		{"unrestricted", palermo.Session{}, nil, "GET /v1/account", false, http.StatusOK},
+		{"missing credentials", palermo.Session{}, nil, "GET /v1/account", true, http.StatusUnauthorized},
+		{"same api version", palermo.Session{APIVersion: "v1"}, nil, "GET /v1/account", false, http.StatusOK},
+		{"other api version", palermo.Session{APIVersion: "v1"}, nil, "GET /v2/account", false, http.StatusForbidden},
+		{"unversioned path", palermo.Session{APIVersion: "v1"}, nil, "GET /account", false, http.StatusOK},
+		{"allowed method", palermo.Session{AllowedMethods: []string{"GET /v1/account"}}, nil, "GET /v1/account", false, http.StatusOK},
+		{"other http method", palermo.Session{AllowedMethods: []string{"GET /v1/account"}}, nil, "DELETE /v1/account", false, http.StatusForbidden},
+		{"other path", palermo.Session{AllowedMethods: []string{"GET /v1/account"}}, nil, "GET /v1/orders", false, http.StatusForbidden},
+		{"mapped method", palermo.Session{AllowedMethods: []string{"/auth.AuthService/Get"}}, func(r *http.Request) string {
+			return "/auth.AuthService/Get"
+		}, "GET /v1/account", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &httpmw.Middleware{
+				Sessions: &palermotest.SessionService{
+					SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+						s := tt.session
+						return &s, nil
+					},
+				},
+				Method: tt.method,
+			}
+			h := mw.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := httpmw.FromContext(r.Context()); !ok {
+					t.Error("no session in the request context")
+				}
+			}))
+
+			r := newRequest(tt.req)
+			if !tt.noCreds {
+				r.Header.Set("Authorization", "Bearer auth")
+				r.Header.Set(httpmw.ValidationTokenHeader, "validation")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRouteMethod(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   string
+		route string
+		want  string
+	}{
+		{"path", "GET /v1/users/42", "", "GET /v1/users/42"},
+		{"route", "GET /v1/users/42", "/v1/users/{id}", "GET /v1/users/{id}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httpmw.WithRoute(newRequest(tt.req), tt.route)
+			if got := httpmw.RouteMethod(r); got != tt.want {
+				t.Errorf("RouteMethod() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// newRequest returns a request for "<method> <path>".
+func newRequest(req string) *http.Request {
+	f := strings.Fields(req)
+	return httptest.NewRequest(f[0], f[1], nil)
+}
@@ -0,0 +1,190 @@
+// Package idle implements a palermo.SessionService decorator that expires
+// sessions after a period of inactivity.
+//
+// The decorator reads and updates the last time each session was used in a
+// Store, typically kept by the stateful backend next to the sessions (see
+// redis.ActivityStore and postgres.ActivityStore), so that activity is shared
+// between replicas and survives restarts. Sessions are rejected with
+// ErrIdleTimeout once they have been idle for longer than their idle timeout,
+// independently of their absolute max age. The timeout defaults to
+// IdleTimeout and may be set per session with SessionIdleTimeout. Activity is
+// first recorded when the session is created or updated through the
+// decorator, so sessions without activity recorded, e.g. created elsewhere or
+// whose record was dropped, are idle. Activity is tracked by session id:
+// sessions without id are rejected with ErrNoSessionID.
+package idle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-toschool/palermo"
+)
+
+// ErrIdleTimeout is returned when a session has been inactive for longer than
+// the configured idle timeout.
+var ErrIdleTimeout = errors.New("idle: session idle timeout")
+
+// ErrNoStore is returned when the decorator has no Store.
+var ErrNoStore = errors.New("idle: no activity store configured")
+
+// ErrNoSessionID is returned for sessions without id, whose activity cannot
+// be tracked.
+var ErrNoSessionID = errors.New("idle: session has no id")
+
+// Store keeps the last time each session was used, by session id.
+type Store interface {
+	// LastUsed returns the last time the session was used, or the zero time
+	// when no activity was recorded.
+	LastUsed(ctx context.Context, sessionID string) (time.Time, error)
+
+	// Touch records the session as used at usedAt. The record may be dropped
+	// at expiresAt.
+	Touch(ctx context.Context, sessionID string, usedAt, expiresAt time.Time) error
+}
+
+// SessionService decorates a palermo.SessionService with an idle timeout.
+type SessionService struct {
+	palermo.SessionService
+
+	// IdleTimeout is the maximum inactivity period of a session.
+	IdleTimeout time.Duration
+
+	// SessionIdleTimeout, when set, returns the maximum inactivity period
+	// of the given session, e.g. from its scopes or metadata. IdleTimeout
+	// applies when it returns zero.
+	SessionIdleTimeout func(*palermo.Session) time.Duration
+
+	// Store keeps the last use of the sessions.
+	Store Store
+
+	// RefreshMaxAge is the lifetime of the refresh tokens of the decorated
+	// service, if any. Activity records are kept at least that long after
+	// each use, so that refreshing the session later finds them.
+	RefreshMaxAge time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Session validates the given credentials and rejects sessions that have been
+// idle for too long. Every successful validation counts as activity.
+func (s *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	us, err := s.SessionService.Session(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.touch(ctx, us); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+// RefreshSession refreshes the given credentials unless the session has been
+// idle for too long.
+func (s *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	us, err := s.SessionService.RefreshSession(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.touch(ctx, us); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+// CreateSession creates credentials for the given session and records it as
+// active.
+func (s *SessionService) CreateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if err := s.checkStore(us); err != nil {
+		return nil, err
+	}
+	c, err := s.SessionService.CreateSession(ctx, us)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.record(ctx, us, s.now()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UpdateSession creates new credentials for the given session and records it
+// as active.
+func (s *SessionService) UpdateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if err := s.checkStore(us); err != nil {
+		return nil, err
+	}
+	c, err := s.SessionService.UpdateSession(ctx, us)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.record(ctx, us, s.now()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// touch records activity for the given session, failing if it was idle for
+// too long or has no activity recorded.
+func (s *SessionService) touch(ctx context.Context, us *palermo.Session) error {
+	if err := s.checkStore(us); err != nil {
+		return err
+	}
+
+	now := s.now()
+	last, err := s.Store.LastUsed(ctx, us.ID)
+	if err != nil {
+		return err
+	}
+	if last.IsZero() || now.Sub(last) > s.idleTimeout(us) {
+		return ErrIdleTimeout
+	}
+	return s.record(ctx, us, now)
+}
+
+// record records the given session as used at now. The record must outlive
+// the credentials and the refresh tokens, or the session would be rejected
+// as idle while still in use.
+func (s *SessionService) record(ctx context.Context, us *palermo.Session, now time.Time) error {
+	expiresAt := now.Add(s.idleTimeout(us))
+	if us.ExpiresAt.After(expiresAt) {
+		expiresAt = us.ExpiresAt
+	}
+	if r := now.Add(s.RefreshMaxAge); r.After(expiresAt) {
+		expiresAt = r
+	}
+	return s.Store.Touch(ctx, us.ID, now, expiresAt)
+}
+
+// checkStore returns an error when the activity of us cannot be tracked.
+func (s *SessionService) checkStore(us *palermo.Session) error {
+	if us.ID == "" {
+		return ErrNoSessionID
+	}
+	if s.Store == nil {
+		return ErrNoStore
+	}
+	return nil
+}
+
+func (s *SessionService) idleTimeout(us *palermo.Session) time.Duration {
+	if s.SessionIdleTimeout != nil {
+		if d := s.SessionIdleTimeout(us); d > 0 {
+			return d
+		}
+	}
+	return s.IdleTimeout
+}
+
+func (s *SessionService) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,208 @@
+package idle_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/idle"
+	"github.com/go-toschool/palermo/memory"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+func TestSessionService(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		id      string
+		touched bool
+		uses    []time.Duration // since start
+		wantErr error           // of the last use
+	}{
+		{"unknown session", "s1", false, []time.Duration{time.Minute}, idle.ErrIdleTimeout},
+		{"active", "s1", true, []time.Duration{10 * time.Minute, 20 * time.Minute, 30 * time.Minute}, nil},
+		{"at the timeout", "s1", true, []time.Duration{15 * time.Minute}, nil},
+		{"idle", "s1", true, []time.Duration{16 * time.Minute}, idle.ErrIdleTimeout},
+		{"idle after activity", "s1", true, []time.Duration{10 * time.Minute, 30 * time.Minute}, idle.ErrIdleTimeout},
+		{"without id", "", true, []time.Duration{time.Minute}, idle.ErrNoSessionID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			clock := func() time.Time { return now }
+			store := &memory.ActivityStore{Now: clock}
+			backend := &palermotest.SessionService{
+				SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+					return &palermo.Session{ID: tt.id, ExpiresAt: start.Add(24 * time.Hour)}, nil
+				},
+			}
+			ctx := context.Background()
+			if tt.touched {
+				store.Touch(ctx, "s1", start, start.Add(24*time.Hour))
+			}
+
+			// Each use goes through a new decorator, as on another replica.
+			var err error
+			for _, d := range tt.uses {
+				now = start.Add(d)
+				is := &idle.SessionService{SessionService: backend, IdleTimeout: 15 * time.Minute, Store: store, Now: clock}
+				if _, err = is.Session(ctx, &palermo.SessionCredentials{}); err != nil {
+					break
+				}
+			}
+			if err != tt.wantErr {
+				t.Errorf("Session() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionServiceRecordsNewSessions(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	clock := func() time.Time { return now }
+	store := &memory.ActivityStore{Now: clock}
+	backend := &palermotest.SessionService{Backend: &memory.SessionService{MaxAge: time.Hour}}
+	is := &idle.SessionService{SessionService: backend, IdleTimeout: 15 * time.Minute, Store: store, Now: clock}
+
+	for _, create := range []func(us *palermo.Session) (*palermo.SessionCredentials, error){
+		func(us *palermo.Session) (*palermo.SessionCredentials, error) { return is.CreateSession(ctx, us) },
+		func(us *palermo.Session) (*palermo.SessionCredentials, error) { return is.UpdateSession(ctx, us) },
+	} {
+		now = start
+		if _, err := create(&palermo.Session{ID: "s1", UserID: "42", Email: "jane@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		now = start.Add(10 * time.Minute)
+		if last, err := store.LastUsed(ctx, "s1"); err != nil || !last.Equal(start) {
+			t.Errorf("LastUsed() = %v, %v, want %v", last, err, start)
+		}
+	}
+}
+
+func TestSessionServiceSessionIdleTimeout(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		timeout string // idle_timeout metadata of the session
+		use     time.Duration
+		wantErr error
+	}{
+		{"default", "", 20 * time.Minute, idle.ErrIdleTimeout},
+		{"longer", "1h", 50 * time.Minute, nil},
+		{"past longer", "1h", 61 * time.Minute, idle.ErrIdleTimeout},
+		{"shorter", "5m", 6 * time.Minute, idle.ErrIdleTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			clock := func() time.Time { return now }
+			us := &palermo.Session{ID: "s1", Metadata: map[string]string{"idle_timeout": tt.timeout}, ExpiresAt: start.Add(24 * time.Hour)}
+			is := &idle.SessionService{
+				SessionService: &palermotest.SessionService{
+					SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+						return us, nil
+					},
+					CreateSessionFunc: func(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error) {
+						return &palermo.SessionCredentials{}, nil
+					},
+				},
+				IdleTimeout: 15 * time.Minute,
+				SessionIdleTimeout: func(us *palermo.Session) time.Duration {
+					d, _ := time.ParseDuration(us.Metadata["idle_timeout"])
+					return d
+				},
+				Store: &memory.ActivityStore{Now: clock},
+				Now:   clock,
+			}
+
+			ctx := context.Background()
+			if _, err := is.CreateSession(ctx, us); err != nil {
+				t.Fatal(err)
+			}
+			now = start.Add(tt.use)
+			if _, err := is.Session(ctx, &palermo.SessionCredentials{}); err != tt.wantErr {
+				t.Errorf("Session() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionServiceRejectsSessionsWithoutID(t *testing.T) {
+	is := &idle.SessionService{
+		SessionService: &palermotest.SessionService{Backend: &memory.SessionService{MaxAge: time.Hour}},
+		IdleTimeout:    time.Minute,
+		Store:          &memory.ActivityStore{},
+	}
+	if _, err := is.CreateSession(context.Background(), &palermo.Session{UserID: "42", Email: "jane@example.com"}); err != idle.ErrNoSessionID {
+		t.Errorf("CreateSession() = %v, want %v", err, idle.ErrNoSessionID)
+	}
+}
+
+func TestSessionServiceRefreshAfterRecordExpired(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		refreshMaxAge time.Duration
+		wantRecord    bool // still recorded when refreshing
+	}{
+		{"record kept until the credentials expire", 0, false},
+		{"record kept until the refresh token expires", 7 * 24 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			clock := func() time.Time { return now }
+			store := &memory.ActivityStore{Now: clock}
+			backend := &palermotest.SessionService{
+				SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+					return &palermo.Session{ID: "s1", ExpiresAt: start.Add(time.Hour)}, nil
+				},
+				RefreshSessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+					return &palermo.Session{ID: "s1", ExpiresAt: now.Add(time.Hour)}, nil
+				},
+			}
+			is := &idle.SessionService{
+				SessionService: backend,
+				IdleTimeout:    15 * time.Minute,
+				Store:          store,
+				RefreshMaxAge:  tt.refreshMaxAge,
+				Now:            clock,
+			}
+			store.Touch(ctx, "s1", start, start.Add(time.Hour))
+			if _, err := is.Session(ctx, &palermo.SessionCredentials{}); err != nil {
+				t.Fatal(err)
+			}
+
+			// The refresh token outlives the credentials and their record.
+			now = start.Add(2 * time.Hour)
+			last, _ := store.LastUsed(ctx, "s1")
+			if !last.IsZero() != tt.wantRecord {
+				t.Errorf("LastUsed() = %v, want recorded %v", last, tt.wantRecord)
+			}
+			if _, err := is.RefreshSession(ctx, &palermo.SessionCredentials{}); err != idle.ErrIdleTimeout {
+				t.Errorf("RefreshSession() = %v, want %v", err, idle.ErrIdleTimeout)
+			}
+		})
+	}
+}
+
+func TestSessionServiceWithoutStore(t *testing.T) {
+	is := &idle.SessionService{
+		SessionService: &palermotest.SessionService{
+			SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+				return &palermo.Session{ID: "s1"}, nil
+			},
+		},
+		IdleTimeout: time.Minute,
+	}
+	if _, err := is.Session(context.Background(), &palermo.SessionCredentials{}); err != idle.ErrNoStore {
+		t.Errorf("Session() = %v, want %v", err, idle.ErrNoStore)
+	}
+}
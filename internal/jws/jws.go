@@ -0,0 +1,238 @@
+// Package jws signs and parses compact JSON Web Signature tokens.
+//
+// It is the only package depending on a JWT library, so the library can be
+// swapped, e.g. for golang-jwt/jwt, without changing the public API of the
+// jwt package. Claims are plain JSON values: validating them is left to the
+// caller.
+package jws
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// EdDSA is the name of the Ed25519 EdDSA signing method (RFC 8037).
+const EdDSA = "EdDSA"
+
+// ErrEdDSAVerification is returned when an EdDSA token signature is invalid.
+var ErrEdDSAVerification = errors.New("jwt: EdDSA verification error")
+
+// ErrUnsupportedAlg is returned when signing with an unknown algorithm, or
+// parsing a token signed with one.
+var ErrUnsupportedAlg = errors.New("jwt: unsupported signing method")
+
+// ErrMalformed is returned when parsing a token that is not a compact JWS
+// holding JSON header and claims.
+var ErrMalformed = errors.New("jwt: malformed token")
+
+// Header holds the token header fields selecting the verification key.
+type Header struct {
+	Alg string
+	Kid string
+}
+
+// KeyFunc returns the key verifying a token with the given header, or Keys
+// to try in turn.
+type KeyFunc func(h Header) (interface{}, error)
+
+// Keys lists candidate verification keys, e.g. a secret and the secrets it
+// replaced. A token is valid when any of them verifies it.
+type Keys []interface{}
+
+func init() {
+	// The jwt library has no EdDSA support: register ours so it can parse
+	// EdDSA tokens.
+	jwt.RegisterSigningMethod(EdDSA, func() jwt.SigningMethod {
+		return signingMethodEdDSA{}
+	})
+}
+
+// Supported reports whether tokens can be signed with alg.
+func Supported(alg string) bool {
+	return jwt.GetSigningMethod(alg) != nil
+}
+
+// Symmetric reports whether alg is an HMAC signing method.
+func Symmetric(alg string) bool {
+	return strings.HasPrefix(alg, "HS")
+}
+
+// SignFunc returns the JWS signature of the given signing input.
+type SignFunc func(signingInput []byte) ([]byte, error)
+
+// Sign returns the token holding the JSON encoding of claims, signed by sign
+// using alg. The key id is set in the header unless empty.
+func Sign(alg, kid string, claims interface{}, sign SignFunc) (string, error) {
+	if !Supported(alg) {
+		return "", ErrUnsupportedAlg
+	}
+
+	h := map[string]string{"typ": "JWT", "alg": alg}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	header, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := jwt.EncodeSegment(header) + "." + jwt.EncodeSegment(payload)
+	sig, err := sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + jwt.EncodeSegment(sig), nil
+}
+
+// Signature returns the JWS signature of signingInput with key using alg.
+func Signature(alg string, signingInput []byte, key interface{}) ([]byte, error) {
+	m := jwt.GetSigningMethod(alg)
+	if m == nil {
+		return nil, ErrUnsupportedAlg
+	}
+
+	sig, err := m.Sign(string(signingInput), key)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.DecodeSegment(sig)
+}
+
+// Parse verifies the given token with the key returned by keyFunc and decodes
+// its claims into claims. Claims are left untouched unless the token verifies:
+// malformed tokens, the none algorithm and tokens no key verifies are
+// rejected before their claims are decoded. Errors of keyFunc are returned as
+// is, e.g. so that callers can tell unavailable keys from invalid tokens.
+func Parse(token string, claims interface{}, keyFunc KeyFunc) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return err
+	}
+
+	key, err := keyFunc(Header{Alg: h.Alg, Kid: h.Kid})
+	if err != nil {
+		return err
+	}
+	m := jwt.GetSigningMethod(h.Alg)
+	if m == nil || m == jwt.SigningMethodNone {
+		return ErrUnsupportedAlg
+	}
+
+	keys, ok := key.(Keys)
+	if !ok {
+		keys = Keys{key}
+	}
+	if len(keys) == 0 {
+		return errors.New("jwt: no verification key")
+	}
+
+	// Any key may have signed the token: a key of the wrong type or a bad
+	// signature only rules out that key.
+	input := parts[0] + "." + parts[1]
+	var verifyErr error
+	for _, k := range keys {
+		if err := m.Verify(input, parts[2], k); err != nil {
+			if verifyErr == nil {
+				verifyErr = err
+			}
+			continue
+		}
+		return decodeSegment(parts[1], claims)
+	}
+	return verifyErr
+}
+
+// decodeSegment decodes the JSON value of the given token segment into v.
+func decodeSegment(seg string, v interface{}) error {
+	b, err := jwt.DecodeSegment(seg)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+// ParseUnverified decodes the header and claims of the given token without
+// verifying it.
+func ParseUnverified(token string, claims interface{}) (Header, error) {
+	t, _, err := new(jwt.Parser).ParseUnverified(token, &jsonClaims{claims})
+	if err != nil {
+		return Header{}, err
+	}
+	return header(t), nil
+}
+
+func header(t *jwt.Token) Header {
+	h := Header{}
+	h.Alg, _ = t.Header["alg"].(string)
+	h.Kid, _ = t.Header["kid"].(string)
+	return h
+}
+
+// jsonClaims adapts any JSON value to the claims of the jwt library, which
+// would otherwise validate them itself.
+type jsonClaims struct {
+	v interface{}
+}
+
+func (c *jsonClaims) Valid() error {
+	return nil
+}
+
+func (c *jsonClaims) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.v)
+}
+
+func (c *jsonClaims) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, c.v)
+}
+
+// signingMethodEdDSA implements the Ed25519 EdDSA signing method (RFC 8037).
+type signingMethodEdDSA struct{}
+
+func (signingMethodEdDSA) Alg() string {
+	return EdDSA
+}
+
+func (signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return ErrEdDSAVerification
+	}
+	return nil
+}
+
+func (signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(priv, []byte(signingString))), nil
+}
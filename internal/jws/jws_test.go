@@ -0,0 +1,122 @@
+package jws_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-toschool/palermo/internal/jws"
+)
+
+var (
+	testSecret  = []byte("0123456789abcdef0123456789abcdef")
+	otherSecret = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func sign(t *testing.T, alg string, claims interface{}, key interface{}) string {
+	token, err := jws.Sign(alg, "", claims, func(input []byte) ([]byte, error) {
+		return jws.Signature(alg, input, key)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// rawToken returns a token made of the given raw header and claims, signed
+// with the HS256 secret, or unsigned when nil.
+func rawToken(t *testing.T, header, claims string, secret []byte) string {
+	enc := base64.RawURLEncoding
+	input := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims))
+	if secret == nil {
+		return input + "."
+	}
+	sig, err := jws.Signature("HS256", []byte(input), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + enc.EncodeToString(sig)
+}
+
+func keyFunc(key interface{}) jws.KeyFunc {
+	return func(jws.Header) (interface{}, error) { return key, nil }
+}
+
+func TestParse(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	claims := map[string]interface{}{"sub": "jane@example.com"}
+	hs256 := sign(t, "HS256", claims, testSecret)
+	rs256 := sign(t, "RS256", claims, rsaKey)
+	parts := strings.Split(hs256, ".")
+	errKey := errors.New("key unavailable")
+
+	tests := []struct {
+		name    string
+		token   string
+		keyFunc jws.KeyFunc
+		wantErr error // nil for any error
+		valid   bool
+	}{
+		{"HS256", hs256, keyFunc(testSecret), nil, true},
+		{"RS256", rs256, keyFunc(&rsaKey.PublicKey), nil, true},
+		{"fallback to a previous secret", hs256, keyFunc(jws.Keys{otherSecret, testSecret}), nil, true},
+		{"fallback past a key of another type", hs256, keyFunc(jws.Keys{&rsaKey.PublicKey, testSecret}), nil, true},
+		{"no key verifying", hs256, keyFunc(jws.Keys{otherSecret, &rsaKey.PublicKey}), nil, false},
+		{"no keys", hs256, keyFunc(jws.Keys{}), nil, false},
+		{"key error", hs256, func(jws.Header) (interface{}, error) { return nil, errKey }, errKey, false},
+		{"tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2], keyFunc(testSecret), nil, false},
+		{"RS256 with a secret", rs256, keyFunc(testSecret), nil, false},
+		// The public key is no secret: HMAC tokens signed with it must not
+		// verify against it.
+		{"HS256 signed with the public key", sign(t, "HS256", claims, pubPEM), keyFunc(&rsaKey.PublicKey), nil, false},
+		{"HS256 signed with the public key among keys", sign(t, "HS256", claims, pubPEM), keyFunc(jws.Keys{&rsaKey.PublicKey}), nil, false},
+		{"none", rawToken(t, `{"alg":"none","typ":"JWT"}`, `{"sub":"admin"}`, nil), keyFunc(jwt.UnsafeAllowNoneSignatureType), jws.ErrUnsupportedAlg, false},
+		{"unknown alg", rawToken(t, `{"alg":"XX256","typ":"JWT"}`, `{"sub":"admin"}`, testSecret), keyFunc(testSecret), jws.ErrUnsupportedAlg, false},
+		{"two segments", parts[0] + "." + parts[1], keyFunc(testSecret), jws.ErrMalformed, false},
+		{"four segments", hs256 + ".", keyFunc(testSecret), jws.ErrMalformed, false},
+		{"header not base64", "!" + hs256[1:], keyFunc(testSecret), jws.ErrMalformed, false},
+		{"header not JSON", rawToken(t, `alg=HS256`, `{"sub":"admin"}`, testSecret), keyFunc(testSecret), jws.ErrMalformed, false},
+		{"claims not JSON", rawToken(t, `{"alg":"HS256","typ":"JWT"}`, `sub=admin`, testSecret), keyFunc(testSecret), jws.ErrMalformed, false},
+		{"empty", "", keyFunc(testSecret), jws.ErrMalformed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]interface{})
+			err := jws.Parse(tt.token, &got, tt.keyFunc)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("Parse() = %v", err)
+				}
+				if got["sub"] != "jane@example.com" {
+					t.Errorf("Parse() claims = %v", got)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("Parse() succeeded")
+			}
+			if tt.wantErr != nil && err != tt.wantErr {
+				t.Errorf("Parse() = %v, want %v", err, tt.wantErr)
+			}
+			if len(got) != 0 {
+				t.Errorf("Parse() decoded the claims %v of an invalid token", got)
+			}
+		})
+	}
+}
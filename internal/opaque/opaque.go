@@ -0,0 +1,56 @@
+// Package opaque generates the opaque credentials handed out by server-side
+// session stores.
+//
+// Stores only keep the hashes of the tokens, so a leaked store cannot be used
+// to impersonate sessions.
+package opaque
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/go-toschool/palermo"
+)
+
+const tokenNumBytes = 32
+
+// NewCredentials returns new random credentials.
+func NewCredentials() (*palermo.SessionCredentials, error) {
+	auth, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &palermo.SessionCredentials{
+		ValidationToken: val,
+		AuthToken:       auth,
+	}, nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of the given token. Tokens carry
+// enough entropy for a plain hash to be safe.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Equal reports in constant time whether the given token hashes are equal.
+func Equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, tokenNumBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,87 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestAnonymousSession(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name            string
+		anonymousMaxAge time.Duration
+		session         *palermo.Session
+		wantErr         bool
+		wantMaxAge      time.Duration
+	}{
+		{"anonymous", 0, &palermo.Session{Anonymous: true}, false, time.Hour},
+		{"anonymous with own max age", 5 * time.Minute, &palermo.Session{Anonymous: true}, false, 5 * time.Minute},
+		{"anonymous with id", 0, &palermo.Session{Anonymous: true, ID: "guest-1"}, false, time.Hour},
+		{"user", 5 * time.Minute, &palermo.Session{UserID: "u1", Email: "u1@example.com"}, false, time.Hour},
+		{"user without email", 0, &palermo.Session{UserID: "u1"}, false, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, AnonymousMaxAge: tt.anonymousMaxAge}
+			c, err := js.CreateSession(ctx, tt.session)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateSession() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			s, err := js.Session(ctx, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Anonymous != tt.session.Anonymous || s.UserID != tt.session.UserID || s.ID != tt.session.ID {
+				t.Errorf("got session %+v, want %+v", s, tt.session)
+			}
+			if ttl := time.Until(s.ExpiresAt); ttl > tt.wantMaxAge || ttl < tt.wantMaxAge-time.Minute {
+				t.Errorf("credentials expire in %v, want %v", ttl, tt.wantMaxAge)
+			}
+		})
+	}
+}
+
+func TestAnonymousSessionUpgrade(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, AnonymousMaxAge: time.Minute}
+
+	guest, err := js.CreateSession(ctx, &palermo.Session{Anonymous: true, ID: "cart-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, err := js.Session(ctx, guest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Logging in creates new credentials for the same session id.
+	user, err := js.CreateSession(ctx, &palermo.Session{ID: gs.ID, UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := js.Session(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if us.Anonymous || us.UserID != "u1" || us.ID != "cart-1" {
+		t.Errorf("got upgraded session %+v", us)
+	}
+	if !us.ExpiresAt.After(gs.ExpiresAt) {
+		t.Errorf("upgraded session expires at %v, not after the guest one at %v", us.ExpiresAt, gs.ExpiresAt)
+	}
+
+	// The guest and user tokens cannot be mixed.
+	mixed := &palermo.SessionCredentials{AuthToken: user.AuthToken, ValidationToken: guest.ValidationToken}
+	if _, err := js.Session(ctx, mixed); err == nil {
+		t.Error("Session() accepted the user token with the guest validation token")
+	}
+}
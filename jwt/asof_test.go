@@ -0,0 +1,49 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestSessionAsOf(t *testing.T) {
+	ctx := context.Background()
+	issuer := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, TestMode: true}
+	c, err := issuer.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour}
+	if _, err := js.Session(ctx, c); err == nil {
+		t.Fatal("Session() accepted credentials expired since 2019")
+	}
+
+	iat := jwt.TestModeTime
+	tests := []struct {
+		name    string
+		at      time.Time
+		wantErr bool
+	}{
+		{"at issuance", iat, false},
+		{"within validity", iat.Add(30 * time.Minute), false},
+		{"at expiry", iat.Add(time.Hour), false},
+		{"before issuance", iat.Add(-time.Minute), true},
+		{"after expiry", iat.Add(time.Hour + time.Minute), true},
+		{"now", time.Now(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := js.SessionAsOf(ctx, c, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SessionAsOf() = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && s.UserID != "u1" {
+				t.Errorf("got session of %q", s.UserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	// Register the hash functions used by at_hash.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// ErrAccessTokenHashMismatch is returned when the at_hash claim of an
+// externally issued ID token does not match the supplied access token.
+var ErrAccessTokenHashMismatch = errors.New("jwt: at_hash does not match access token")
+
+// ErrMissingAccessTokenHash is returned when SessionService checks the at_hash
+// claim of an externally issued token that has none.
+var ErrMissingAccessTokenHash = errors.New("jwt: missing at_hash")
+
+// VerifyAccessTokenHash checks the OpenID Connect at_hash claim of an ID token
+// signed with alg against the given access token. The access token is hashed
+// with the hash function of alg and the left-most half of the digest,
+// base64url encoded, must equal atHash.
+//
+// It is meant for tokens issued by an external provider; palermo's own tokens
+// carry no at_hash.
+func VerifyAccessTokenHash(atHash, accessToken, alg string) error {
+	h, err := accessTokenHashFunc(alg)
+	if err != nil {
+		return err
+	}
+
+	d := h.New()
+	d.Write([]byte(accessToken))
+	sum := d.Sum(nil)
+	want := base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+
+	if subtle.ConstantTimeCompare([]byte(want), []byte(atHash)) != 1 {
+		return ErrAccessTokenHashMismatch
+	}
+	return nil
+}
+
+func accessTokenHashFunc(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "HS256", "RS256", "ES256", "PS256":
+		return crypto.SHA256, nil
+	case "HS384", "RS384", "ES384", "PS384":
+		return crypto.SHA384, nil
+	case "HS512", "RS512", "ES512", "PS512", "EdDSA":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("jwt: unsupported at_hash algorithm: %s", alg)
+}
@@ -0,0 +1,146 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/jws"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+// atHash returns the at_hash of accessToken with the given hash function.
+func atHash(h crypto.Hash, accessToken string) string {
+	d := h.New()
+	d.Write([]byte(accessToken))
+	sum := d.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+func TestVerifyAccessTokenHash(t *testing.T) {
+	const token = "ya29.access-token"
+
+	tests := []struct {
+		name    string
+		atHash  string
+		alg     string
+		wantErr error
+	}{
+		{"RS256", atHash(crypto.SHA256, token), "RS256", nil},
+		{"ES384", atHash(crypto.SHA384, token), "ES384", nil},
+		{"EdDSA", atHash(crypto.SHA512, token), "EdDSA", nil},
+		{"other token", atHash(crypto.SHA256, "other"), "RS256", jwt.ErrAccessTokenHashMismatch},
+		{"other hash function", atHash(crypto.SHA512, token), "RS256", jwt.ErrAccessTokenHashMismatch},
+		{"full digest", base64.RawURLEncoding.EncodeToString(sha256Sum(token)), "RS256", jwt.ErrAccessTokenHashMismatch},
+		{"empty", "", "RS256", jwt.ErrAccessTokenHashMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := jwt.VerifyAccessTokenHash(tt.atHash, token, tt.alg); err != tt.wantErr {
+				t.Errorf("VerifyAccessTokenHash() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := jwt.VerifyAccessTokenHash(atHash(crypto.SHA256, token), token, "none"); err == nil {
+		t.Error("VerifyAccessTokenHash() accepted an unsupported algorithm")
+	}
+}
+
+func sha256Sum(s string) []byte {
+	d := crypto.SHA256.New()
+	d.Write([]byte(s))
+	return d.Sum(nil)
+}
+
+func TestRemoteKeysAccessTokenHash(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &jwt.SessionService{
+		SigningMethod: jwt.SigningMethodES256,
+		Signer:        &jwt.LocalSigner{Method: "ES256", ID: "k1", Key: key},
+		MaxAge:        time.Minute,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := issuer.JWKS()
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	checking := &jwt.SessionService{RemoteKeys: &jwt.RemoteKeySet{URL: srv.URL}, MaxAge: time.Minute, CheckAccessTokenHash: true}
+	remote := &jwt.SessionService{RemoteKeys: &jwt.RemoteKeySet{URL: srv.URL}, MaxAge: time.Minute}
+
+	tests := []struct {
+		name    string
+		rs      *jwt.SessionService
+		atHash  func(valToken string) string
+		wantErr error
+	}{
+		{"missing at_hash", checking, nil, jwt.ErrMissingAccessTokenHash},
+		{"missing at_hash unchecked", remote, nil, nil},
+		{"matching", checking, func(v string) string { return atHash(crypto.SHA256, v) }, nil},
+		{"other token", checking, func(v string) string { return atHash(crypto.SHA256, v+"x") }, jwt.ErrAccessTokenHashMismatch},
+		{"other token unchecked", remote, func(v string) string { return atHash(crypto.SHA256, v+"x") }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := issuer.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.atHash != nil {
+				// Bind the authentication token to the validation
+				// token, as an external issuer would.
+				claims := make(map[string]interface{})
+				if _, err := jws.ParseUnverified(c.AuthToken, &claims); err != nil {
+					t.Fatal(err)
+				}
+				claims["at_hash"] = tt.atHash(c.ValidationToken)
+				c.AuthToken, err = jws.Sign("ES256", "k1", claims, func(input []byte) ([]byte, error) {
+					return jws.Signature("ES256", input, key)
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := tt.rs.Session(ctx, c); err != tt.wantErr {
+				t.Errorf("Session() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalKeysIgnoreAccessTokenHash(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute}
+	c, err := js.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens verified with the local keys are palermo's own, which carry no
+	// at_hash: one would not be checked against the validation token.
+	c.AuthToken = resign(t, c.AuthToken, func(claims map[string]interface{}) {
+		claims["at_hash"] = atHash(crypto.SHA256, "other")
+	})
+	if _, err := js.Session(ctx, c); err != nil {
+		t.Errorf("Session() = %v", err)
+	}
+}
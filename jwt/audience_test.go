@@ -0,0 +1,74 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/jws"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestAudienceRotation(t *testing.T) {
+	ctx := context.Background()
+	user := &palermo.Session{UserID: "u1", Email: "u1@example.com"}
+	mint := func(aud string) *palermo.SessionCredentials {
+		c, err := (&jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Audience: aud}).CreateSession(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	renamed := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Audience: "tokens.example.com", PreviousAudiences: []string{"auth.example.com"}}
+	migrated := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Audience: "tokens.example.com"}
+
+	tests := []struct {
+		name    string
+		creds   *palermo.SessionCredentials
+		wantErr error
+	}{
+		{"current audience", mint("tokens.example.com"), nil},
+		{"previous audience", mint("auth.example.com"), nil},
+		{"unknown audience", mint("other.example.com"), jwt.ErrInvalidAudience},
+		{"no audience", mint(""), jwt.ErrInvalidAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := renamed.Session(ctx, tt.creds); err != tt.wantErr {
+				t.Fatalf("Session() = %v, want %v", err, tt.wantErr)
+			}
+
+			nc, s, err := renamed.RefreshCredentials(ctx, tt.creds)
+			if err != tt.wantErr {
+				t.Fatalf("RefreshCredentials() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if s.UserID != "u1" {
+				t.Errorf("refreshed session of %q", s.UserID)
+			}
+			for _, tok := range []string{nc.AuthToken, nc.ValidationToken} {
+				var claims struct {
+					Audience string `json:"aud"`
+				}
+				if _, err := jws.ParseUnverified(tok, &claims); err != nil {
+					t.Fatal(err)
+				}
+				if claims.Audience != "tokens.example.com" {
+					t.Errorf("re-minted for audience %q", claims.Audience)
+				}
+			}
+
+			// Once the overlap is over, only re-minted credentials pass.
+			if _, err := migrated.Session(ctx, nc); err != nil {
+				t.Errorf("Session() of re-minted credentials = %v", err)
+			}
+		})
+	}
+
+	if _, err := migrated.Session(ctx, tests[1].creds); err != jwt.ErrInvalidAudience {
+		t.Errorf("Session() after the overlap = %v, want %v", err, jwt.ErrInvalidAudience)
+	}
+}
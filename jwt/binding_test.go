@@ -0,0 +1,51 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestSessionBinding(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour}
+	c, err := js.CreateSession(ctx, &palermo.Session{ID: "sa", UserID: "alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each case rewrites the validation token of alice's session, keeping its
+	// standard claims so that only the session binding differs.
+	tests := []struct {
+		name    string
+		edit    func(claims map[string]interface{})
+		wantErr error
+	}{
+		{"same session", func(claims map[string]interface{}) {}, nil},
+		{"other session id", func(claims map[string]interface{}) { claims["id"] = "sb" }, jwt.ErrSessionMismatch},
+		{"other user", func(claims map[string]interface{}) { claims["user_id"] = "mallory" }, jwt.ErrSessionMismatch},
+		{"other session of another user", func(claims map[string]interface{}) {
+			claims["id"] = "sb"
+			claims["user_id"] = "mallory"
+			claims["email"] = "mallory@example.com"
+		}, jwt.ErrSessionMismatch},
+		{"no session binding", func(claims map[string]interface{}) {
+			delete(claims, "id")
+			delete(claims, "user_id")
+		}, jwt.ErrSessionMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crossed := &palermo.SessionCredentials{
+				AuthToken:       c.AuthToken,
+				ValidationToken: resign(t, c.ValidationToken, tt.edit),
+			}
+			if _, err := js.Session(ctx, crossed); err != tt.wantErr {
+				t.Errorf("Session() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package jwt_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestClose(t *testing.T) {
+	ctx := context.Background()
+	user := &palermo.Session{UserID: "u1", Email: "u1@example.com"}
+
+	tests := []struct {
+		name string
+		js   func(secret, previous, keyring []byte) *jwt.SessionService
+	}{
+		{"secret key", func(secret, previous, keyring []byte) *jwt.SessionService {
+			return &jwt.SessionService{SecretKey: secret, PreviousSecretKeys: [][]byte{previous}, MaxAge: time.Hour}
+		}},
+		{"derived token keys", func(secret, previous, keyring []byte) *jwt.SessionService {
+			return &jwt.SessionService{SecretKey: secret, PreviousSecretKeys: [][]byte{previous}, DeriveTokenKeys: true, MaxAge: time.Hour}
+		}},
+		{"keyring", func(secret, previous, keyring []byte) *jwt.SessionService {
+			return &jwt.SessionService{SecretKey: secret, PreviousSecretKeys: [][]byte{previous}, Keyring: []jwt.Key{{ID: "k1", SecretKey: keyring}}, MaxAge: time.Hour}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := append([]byte(nil), testKey...)
+			previous := bytes.Repeat([]byte{'p'}, 32)
+			keyring := bytes.Repeat([]byte{'k'}, 32)
+			js := tt.js(secret, previous, keyring)
+
+			c, err := js.CreateSession(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := js.Close(); err != nil {
+				t.Fatalf("Close() = %v", err)
+			}
+			if err := js.Close(); err != nil {
+				t.Errorf("second Close() = %v", err)
+			}
+
+			zero := make([]byte, 32)
+			for name, key := range map[string][]byte{"SecretKey": secret, "PreviousSecretKeys": previous} {
+				if !bytes.Equal(key, zero) {
+					t.Errorf("%s not zeroed: %x", name, key)
+				}
+			}
+			if len(js.Keyring) > 0 && !bytes.Equal(keyring, zero) {
+				t.Errorf("keyring secret not zeroed: %x", keyring)
+			}
+
+			if _, err := js.Session(ctx, c); err != jwt.ErrClosed {
+				t.Errorf("Session() = %v, want %v", err, jwt.ErrClosed)
+			}
+			if _, err := js.RefreshSession(ctx, c); err != jwt.ErrClosed {
+				t.Errorf("RefreshSession() = %v, want %v", err, jwt.ErrClosed)
+			}
+			if _, err := js.CreateSession(ctx, user); err != jwt.ErrClosed {
+				t.Errorf("CreateSession() = %v, want %v", err, jwt.ErrClosed)
+			}
+			if _, err := js.UpdateSession(ctx, user); err != jwt.ErrClosed {
+				t.Errorf("UpdateSession() = %v, want %v", err, jwt.ErrClosed)
+			}
+			if len(js.Keyring) == 0 {
+				if err := js.RotateSecretKey(testKey); err != jwt.ErrClosed {
+					t.Errorf("RotateSecretKey() = %v, want %v", err, jwt.ErrClosed)
+				}
+			}
+			if err := js.Check(ctx); err != jwt.ErrClosed {
+				t.Errorf("Check() = %v, want %v", err, jwt.ErrClosed)
+			}
+		})
+	}
+}
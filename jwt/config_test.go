@@ -0,0 +1,74 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/memory"
+)
+
+func TestConfigError(t *testing.T) {
+	ctx := context.Background()
+	user := &palermo.Session{UserID: "u1", Email: "u1@example.com"}
+	valid, err := (&jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour}).CreateSession(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		js        *jwt.SessionService
+		wantField string
+	}{
+		{"no max age", &jwt.SessionService{SecretKey: testKey}, "MaxAge"},
+		{"negative max age", &jwt.SessionService{SecretKey: testKey, MaxAge: -time.Hour}, "MaxAge"},
+		{"unsupported signing method", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, SigningMethod: "HS512"}, "SigningMethod"},
+		{"negative leeway", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Leeway: -time.Second}, "Leeway"},
+		{"refresh window beyond max age", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, RefreshWindow: 2 * time.Hour}, "RefreshWindow"},
+		{"refresh max age below max age", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, RefreshMaxAge: time.Minute}, "RefreshMaxAge"},
+		{"replay guard without refresh tokens", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, ReplayGuard: &memory.ReplayGuard{}}, "ReplayGuard"},
+		{"empty previous secret", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, PreviousSecretKeys: [][]byte{{}}}, "PreviousSecretKeys"},
+		{"unsupported verify method", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, VerifyMethods: []string{"none"}}, "VerifyMethods"},
+		{"keyring key without id", &jwt.SessionService{Keyring: []jwt.Key{{SecretKey: testKey}}, MaxAge: time.Hour}, "Keyring"},
+		{"access token hash without remote keys", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, CheckAccessTokenHash: true}, "CheckAccessTokenHash"},
+		{"derived keys with asymmetric signing", &jwt.SessionService{SigningMethod: jwt.SigningMethodES256, PrivateKey: ecKey, DeriveTokenKeys: true, MaxAge: time.Hour}, "DeriveTokenKeys"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.js.CreateSession(ctx, user)
+			ce, ok := err.(*jwt.ConfigError)
+			if !ok || ce.Field != tt.wantField {
+				t.Fatalf("CreateSession() = %v, %v, want a ConfigError on %s", c, err, tt.wantField)
+			}
+			if !strings.Contains(err.Error(), tt.wantField) || ce.Reason == "" {
+				t.Errorf("unclear error %q", err)
+			}
+
+			// Every later operation fails the same way.
+			if _, err := tt.js.Session(ctx, valid); err != ce {
+				t.Errorf("Session() = %v, want %v", err, ce)
+			}
+			if _, err := tt.js.RefreshSession(ctx, valid); err != ce {
+				t.Errorf("RefreshSession() = %v, want %v", err, ce)
+			}
+			if err := tt.js.Check(ctx); err != ce {
+				t.Errorf("Check() = %v, want %v", err, ce)
+			}
+		})
+	}
+
+	if _, err := jwt.NewSessionService(testKey, 0); err == nil {
+		t.Error("NewSessionService() accepted a zero max age")
+	}
+}
@@ -0,0 +1,63 @@
+package jwt_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestFilterValid(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute}
+	past := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute, TestMode: true}
+
+	mint := func(js *jwt.SessionService, user string) *palermo.SessionCredentials {
+		c, err := js.CreateSession(ctx, &palermo.Session{UserID: user, Email: user + "@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	valid1, valid2 := mint(js, "u1"), mint(js, "u2")
+	expired := mint(past, "u3")
+	malformed := &palermo.SessionCredentials{AuthToken: "not-a-jwt", ValidationToken: valid1.ValidationToken}
+
+	tests := []struct {
+		name        string
+		creds       []*palermo.SessionCredentials
+		wantUsers   []string
+		wantInvalid []int
+	}{
+		{"none", nil, nil, nil},
+		{"all valid", []*palermo.SessionCredentials{valid1, valid2}, []string{"u1", "u2"}, nil},
+		{"all invalid", []*palermo.SessionCredentials{expired, malformed}, nil, []int{0, 1}},
+		{"mixed", []*palermo.SessionCredentials{expired, valid1, malformed, nil, valid2}, []string{"u1", "u2"}, []int{0, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions, invalid, err := js.FilterValid(ctx, tt.creds)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var users []string
+			for _, s := range sessions {
+				users = append(users, s.UserID)
+			}
+			if !reflect.DeepEqual(users, tt.wantUsers) {
+				t.Errorf("got sessions of %q, want %q", users, tt.wantUsers)
+			}
+			if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+				t.Errorf("got invalid indices %v, want %v", invalid, tt.wantInvalid)
+			}
+		})
+	}
+
+	if _, _, err := (&jwt.SessionService{MaxAge: time.Minute}).FilterValid(ctx, []*palermo.SessionCredentials{valid1}); err != jwt.ErrNoKeysConfigured {
+		t.Errorf("FilterValid() = %v, want %v", err, jwt.ErrNoKeysConfigured)
+	}
+}
@@ -0,0 +1,195 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrNoPublicKeys is returned when publishing the keys of a service signing
+// tokens with a shared secret.
+var ErrNoPublicKeys = errors.New("jwt: no public keys to publish")
+
+// JWK is a JSON Web Key (RFC 7517) holding a public verification key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Elliptic keys.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as published for relying parties to discover
+// verification keys.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys verifying the tokens of the service, so
+// relying parties can validate them locally. It fails with ErrNoPublicKeys
+// when tokens are signed with a shared secret.
+func (uss *SessionService) JWKS() (*JWKS, error) {
+	if err := uss.begin(); err != nil {
+		return nil, err
+	}
+	defer uss.end()
+
+	if !uss.asymmetric() {
+		return nil, ErrNoPublicKeys
+	}
+
+	set := &JWKS{Keys: []JWK{}}
+	if pub := uss.publicKey(); pub != nil {
+		k, err := NewJWK("", uss.SigningMethod, pub)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, k)
+	}
+
+	if uss.Signer != nil && uss.Signer.KeyID() != "" {
+		k, err := NewJWK(uss.Signer.KeyID(), uss.SigningMethod, uss.Signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, k)
+	}
+
+	for i := range uss.Keyring {
+		k, err := NewJWK(uss.Keyring[i].ID, uss.SigningMethod, uss.Keyring[i].publicKey())
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, k)
+	}
+	return set, nil
+}
+
+// NewJWK returns the JSON Web Key of the given RSA, P-256 ECDSA or Ed25519
+// public key.
+func NewJWK(kid, alg string, pub crypto.PublicKey) (JWK, error) {
+	k := JWK{Kid: kid, Use: "sig", Alg: alg}
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = encodeBigInt(p.N, 0)
+		k.E = encodeBigInt(big.NewInt(int64(p.E)), 0)
+	case *ecdsa.PublicKey:
+		size := (p.Curve.Params().BitSize + 7) / 8
+		k.Kty = "EC"
+		k.Crv = p.Curve.Params().Name
+		k.X = encodeBigInt(p.X, size)
+		k.Y = encodeBigInt(p.Y, size)
+	case ed25519.PublicKey:
+		k.Kty = "OKP"
+		k.Crv = "Ed25519"
+		k.X = base64.RawURLEncoding.EncodeToString(p)
+	default:
+		return JWK{}, fmt.Errorf("jwt: unsupported public key type %T", pub)
+	}
+	return k, nil
+}
+
+// encodeBigInt encodes n as unpadded base64url, left-padding its big-endian
+// bytes to size.
+func encodeBigInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// PublicKey returns the public key held by the JSON Web Key.
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("jwt: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jwt: unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("jwt: invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jwt: unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwt: invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("jwt: unsupported key type %q", k.Kty)
+}
+
+// compatible reports whether the key may verify tokens signed with alg.
+// Symmetric algorithms are never accepted, as published keys are public.
+func (k *JWK) compatible(alg string) bool {
+	if k.Alg != "" && k.Alg != alg {
+		return false
+	}
+
+	switch k.Kty {
+	case "RSA":
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case "EC":
+		return strings.HasPrefix(alg, "ES")
+	case "OKP":
+		return alg == SigningMethodEdDSA
+	}
+	return false
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -1,75 +1,635 @@
 // Package jwt implements palermo.SessionService using JWT tokens.
 //
 //  - Validation Token keys:
-//   * standard: jti, iat, sub, exp, iss
+//   * standard: jti, iat, sub, exp, iss, aud, nbf
+//   * custom: id, user_id
 //  - Authentication Token kys:
-//   * standard: jti, iat, sub, exp, iss
-//   * custom: id, email, host, created_at, updated_at
+//   * standard: jti, iat, sub, exp, iss, aud, nbf
+//   * custom: id, email, token, anon, src, scp, ver_api, allowed_methods,
+//     metadata, created_at, updated_at
+//  - Refresh Token keys, when issued:
+//   * standard: jti, iat, sub, exp, iss, aud, nbf
+//   * custom: the authentication token ones, use
 package jwt
 
 import (
+	"context"
+	"crypto"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/jws"
 )
 
 const tokenIDnumBytes = 32
 
+// tokenUseRefresh marks refresh tokens, which are only accepted by
+// RefreshSession.
+const tokenUseRefresh = "refresh"
+
+// tokenTypeService marks the tokens of service accounts.
+const tokenTypeService = "service"
+
+// Signing methods.
+const (
+	SigningMethodHS256 = "HS256"
+	SigningMethodRS256 = "RS256"
+	SigningMethodES256 = "ES256"
+	SigningMethodEdDSA = "EdDSA"
+)
+
+// ErrNoKeysConfigured is returned when the service has no key to sign or
+// verify tokens with.
+var ErrNoKeysConfigured = errors.New("jwt: no keys configured")
+
+// ErrNoSigningKey is returned when minting tokens with a service only holding
+// a public key.
+var ErrNoSigningKey = errors.New("jwt: no signing key configured")
+
+// ErrSessionMismatch is returned when the validation and authentication tokens
+// belong to different sessions.
+var ErrSessionMismatch = errors.New("jwt: validation and authentication token sessions mismatched")
+
+// ErrInvalidIssuer is returned when a token was not issued by the expected
+// issuer.
+var ErrInvalidIssuer = errors.New("jwt: invalid token issuer")
+
+// ErrInvalidAudience is returned when a token was not issued for any of the
+// accepted audiences.
+var ErrInvalidAudience = errors.New("jwt: invalid token audience")
+
+// ErrTokenTooOld is returned when a token is older than the maximum age
+// required by the caller.
+var ErrTokenTooOld = errors.New("jwt: token too old")
+
+// ErrInconsistentTimestamps is returned when the session timestamps of a token
+// contradict each other or its expiry.
+var ErrInconsistentTimestamps = errors.New("jwt: inconsistent token timestamps")
+
+// ErrLifetimeTooLong is returned when a token claims a longer lifetime than
+// the service ever issues.
+var ErrLifetimeTooLong = errors.New("jwt: token lifetime too long")
+
+// ErrRefreshTooEarly is returned when credentials are refreshed before their
+// refresh window opens.
+var ErrRefreshTooEarly = errors.New("jwt: too early to refresh")
+
+// ErrMissingRefreshToken is returned when refreshing credentials without
+// refresh token while the service issues them.
+var ErrMissingRefreshToken = errors.New("jwt: missing refresh token")
+
+// ErrTokenUse is returned when a token is presented where it is not usable,
+// e.g. a refresh token as authentication token.
+var ErrTokenUse = errors.New("jwt: token not usable for this operation")
+
+// ErrServiceAccountsDisabled is returned when creating credentials for a
+// service account without ServiceAccountMaxAge.
+var ErrServiceAccountsDisabled = errors.New("jwt: service accounts disabled")
+
+// ErrRevoked is returned when validating revoked credentials.
+var ErrRevoked = errors.New("jwt: credentials revoked")
+
+// ErrReplayed is returned when refreshing with a refresh token already used.
+var ErrReplayed = errors.New("jwt: refresh token already used")
+
+// ErrRevocationUnsupported is returned when revoking credentials without a
+// revocation store.
+var ErrRevocationUnsupported = errors.New("jwt: no revocation store configured")
+
+// ErrNegativeLeeway is returned when a validation is requested with a
+// negative leeway.
+var ErrNegativeLeeway = errors.New("jwt: negative leeway")
+
+// ErrNegativeMaxAge is returned when a validation is requested with a
+// negative maximum token age.
+var ErrNegativeMaxAge = errors.New("jwt: negative max age")
+
+// ErrClosed is returned by token operations once the service is closed.
+var ErrClosed = errors.New("jwt: session service closed")
+
+// ErrNoFallback is returned by EnsureSession when credentials must be minted
+// but no fallback session is given.
+var ErrNoFallback = errors.New("jwt: no fallback session")
+
+// SkewError is returned when a token is rejected because of its time claims
+// (exp, nbf or iat). It carries the server's notion of now and the leeway
+// tolerated alongside the token times to help debug clock skew between hosts.
+// Error only reports the underlying validation failure, so the timing details
+// are never leaked to clients that just print the error.
+type SkewError struct {
+	Err error
+
+	Now       time.Time
+	Leeway    time.Duration
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	NotBefore time.Time
+}
+
+func (e *SkewError) Error() string {
+	return e.Err.Error()
+}
+
+// ConfigError is returned by every operation of a service whose configuration
+// would make it mint forgeable or unusable tokens.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return "jwt: invalid " + e.Field + ": " + e.Reason
+}
+
+// Kinds of invalid time claims, which may be combined.
+const (
+	validationErrorExpired uint32 = 1 << iota
+	validationErrorIssuedAt
+	validationErrorNotValidYet
+)
+
+// validationError reports the time claims a token failed validation for.
+type validationError struct {
+	Inner  error
+	Errors uint32
+}
+
+func (e *validationError) Error() string {
+	return e.Inner.Error()
+}
+
 type sessionClaims struct {
-	jwt.StandardClaims
+	// Standard claims.
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	Id        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	Subject   string `json:"sub,omitempty"`
 
 	// Custom claims used to store user session.
-	ID        string `json:"id,omitempty"`
-	UserID    string `json:"user_id,omitempty"`
-	Token     string `json:"-"`
-	Email     string `json:"email,omitempty"`
-	CreatedAt int64  `json:"created_at,omitempty"`
-	UpdatedAt int64  `json:"updated_at,omitempty"`
+	ID             string            `json:"id,omitempty"`
+	UserID         string            `json:"user_id,omitempty"`
+	Token          string            `json:"token,omitempty"`
+	Email          string            `json:"email,omitempty"`
+	Anonymous      bool              `json:"anon,omitempty"`
+	Source         string            `json:"src,omitempty"`
+	Scopes         []string          `json:"scp,omitempty"`
+	APIVersion     string            `json:"ver_api,omitempty"`
+	AllowedMethods []string          `json:"allowed_methods,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	CreatedAt      int64             `json:"created_at,omitempty"`
+	UpdatedAt      int64             `json:"updated_at,omitempty"`
+
+	// TokenUse restricts the token to an operation, e.g. tokenUseRefresh.
+	// Empty for validation and authentication tokens.
+	TokenUse string `json:"use,omitempty"`
+
+	// TokenType is tokenTypeService for the tokens of service accounts,
+	// empty for the ones of users.
+	TokenType string `json:"token_type,omitempty"`
+
+	// AccessTokenHash binds an authentication token minted by an external
+	// issuer to its validation token. palermo never sets it.
+	AccessTokenHash string `json:"at_hash,omitempty"`
+
+	// alg is the signing method of the parsed token.
+	alg string
 }
 
 func (sc *sessionClaims) Session() *palermo.Session {
 	return &palermo.Session{
-		ID:        sc.ID,
-		Email:     sc.Email,
-		UserID:    sc.UserID,
-		Token:     sc.Token,
-		CreatedAt: time.Unix(sc.CreatedAt, 0),
-		UpdatedAt: time.Unix(sc.UpdatedAt, 0),
+		ID:             sc.ID,
+		Email:          sc.Email,
+		UserID:         sc.UserID,
+		Token:          sc.Token,
+		Anonymous:      sc.Anonymous,
+		ServiceAccount: sc.TokenType == tokenTypeService,
+		Source:         sc.Source,
+		Scopes:         sc.Scopes,
+		APIVersion:     sc.APIVersion,
+		AllowedMethods: sc.AllowedMethods,
+		Metadata:       sc.Metadata,
+		CreatedAt:      time.Unix(sc.CreatedAt, 0),
+		UpdatedAt:      time.Unix(sc.UpdatedAt, 0),
+		NotBefore:      unixTime(sc.NotBefore),
+		TokenID:        sc.Id,
+		ExpiresAt:      time.Unix(sc.ExpiresAt, 0),
 	}
 }
 
+// validAt validates the time claims against the given instant, tolerating
+// leeway of clock skew. Missing claims are not validated.
+func (sc *sessionClaims) validAt(now time.Time, leeway time.Duration) error {
+	t := now.Add(leeway).Unix()
+	vErr := new(validationError)
+
+	if sc.ExpiresAt != 0 && now.Add(-leeway).Unix() > sc.ExpiresAt {
+		vErr.Inner = errors.New("token is expired")
+		vErr.Errors |= validationErrorExpired
+	}
+
+	if sc.IssuedAt != 0 && t < sc.IssuedAt {
+		vErr.Inner = errors.New("token used before issued")
+		vErr.Errors |= validationErrorIssuedAt
+	}
+
+	if sc.NotBefore != 0 && t < sc.NotBefore {
+		vErr.Inner = errors.New("token is not valid yet")
+		vErr.Errors |= validationErrorNotValidYet
+	}
+
+	if vErr.Errors == 0 {
+		return nil
+	}
+	return vErr
+}
+
 // SessionService implements palermo.SessionService using JWT tokens.
 type SessionService struct {
+	// SigningMethod is the algorithm tokens are signed with, either
+	// SigningMethodHS256 (the default) with SecretKey, or one of the
+	// asymmetric SigningMethodRS256, SigningMethodES256 (P-256) and
+	// SigningMethodEdDSA (Ed25519) with PrivateKey. Elliptic keys produce much
+	// smaller tokens than RSA ones and are preferred for new deployments.
+	SigningMethod string
+
 	SecretKey []byte
 	MaxAge    time.Duration
+
+	// PreviousSecretKeys lists secrets SecretKey replaced, still accepted
+	// when verifying tokens without key id so that secrets can be rotated
+	// without logging everyone out. Tokens are only ever signed with
+	// SecretKey; drop a previous secret once the tokens it signed have
+	// expired.
+	PreviousSecretKeys [][]byte
+
+	// DeriveTokenKeys makes SecretKey, PreviousSecretKeys and the keyring
+	// secrets master secrets, from which validation, authentication and
+	// refresh tokens get separate signing keys with HKDF-SHA256. A token of
+	// one type then never verifies as another type. Toggling it invalidates
+	// outstanding tokens.
+	DeriveTokenKeys bool
+
+	// VerifyMethods lists the signing methods of the tokens accepted besides
+	// SigningMethod, e.g. SigningMethodHS256 while migrating to
+	// SigningMethodRS256: new tokens are signed with SigningMethod while the
+	// tokens signed with SecretKey keep verifying until they expire.
+	// SigningMethodHS256 requires SecretKey, and the asymmetric methods
+	// PublicKey or PrivateKey, so at most one of them may be used.
+	VerifyMethods []string
+
+	// PrivateKey signs tokens with asymmetric signing methods: an
+	// *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey matching
+	// SigningMethod. See LoadPrivateKey.
+	PrivateKey crypto.Signer
+
+	// Signer, when set, signs minted tokens instead of PrivateKey or the
+	// keyring, e.g. a KMSSigner keeping the private key out of the process.
+	// Its algorithm must match SigningMethod, and its public key verifies
+	// the tokens carrying its key id.
+	Signer Signer
+
+	// PublicKey verifies tokens with asymmetric signing methods. Defaults to
+	// the public part of PrivateKey. Services only holding a public key can
+	// validate tokens but not mint them, so downstream services can verify
+	// tokens locally without sharing any secret.
+	PublicKey crypto.PublicKey
+
+	// Keyring holds keys identified by their id (kid), all using
+	// SigningMethod. Tokens are signed with the first key and carry its id,
+	// and are verified with the key matching their id. Tokens without id are
+	// verified with SecretKey or PublicKey, so deployments can move to a
+	// keyring without invalidating outstanding sessions.
+	//
+	// To rotate keys, first add the new key at the end of the keyring of
+	// every instance, then move it first, and finally drop the old key once
+	// the tokens it signed have expired.
+	Keyring []Key
+
+	// RemoteKeys, when set, verifies tokens with the keys published by a
+	// remote JWKS endpoint instead of the local keys, e.g. to validate tokens
+	// issued by another palermo instance. Tokens must still carry the
+	// palermo claims. Local keys, if any, keep signing minted tokens.
+	RemoteKeys *RemoteKeySet
+
+	// CheckAccessTokenHash checks the at_hash claim binding the
+	// authentication token to the validation token, as an OpenID Connect ID
+	// token to its access token, with VerifyAccessTokenHash. Tokens without
+	// at_hash are rejected. It applies to tokens issued elsewhere, so it
+	// requires RemoteKeys; at_hash claims are ignored otherwise.
+	CheckAccessTokenHash bool
+
+	// AnonymousMaxAge overrides MaxAge for anonymous sessions. When zero,
+	// MaxAge is used.
+	AnonymousMaxAge time.Duration
+
+	// ServiceAccountMaxAge is the lifetime of the credentials of service
+	// accounts (see palermo.Session.ServiceAccount), e.g. API keys of other
+	// services, typically much longer than MaxAge. Their tokens carry a
+	// distinct token type and are never refreshed: new credentials must be
+	// created instead. When zero, no service account credentials are
+	// minted.
+	ServiceAccountMaxAge time.Duration
+
+	// Issuer is the issuer (iss) of minted tokens, e.g. the URL of the
+	// service. When set, validated tokens must carry it.
+	Issuer string
+
+	// Audience is the audience (aud) of issued tokens. When set, validated
+	// tokens must carry it or one of PreviousAudiences.
+	Audience string
+
+	// PreviousAudiences lists audiences still accepted on validation, e.g.
+	// while renaming the service. Tokens are only ever minted for Audience,
+	// so outstanding tokens migrate as they get refreshed (see
+	// RefreshCredentials).
+	PreviousAudiences []string
+
+	// CheckTimestamps enables the validation of the session timestamps
+	// against the token expiry: created_at <= updated_at <= exp.
+	CheckTimestamps bool
+
+	// CheckLifetime rejects tokens whose lifetime (exp - iat) exceeds the
+	// maximum age this service issues, as only a tampered token could claim
+	// more. Leave it disabled when validating tokens minted elsewhere with
+	// other lifetimes.
+	CheckLifetime bool
+
+	// RefreshWindow is the time before expiry from which credentials may be
+	// refreshed. Earlier refreshes fail with ErrRefreshTooEarly and validated
+	// sessions report when the window opens in RefreshableAt. When zero,
+	// credentials may be refreshed at any time.
+	RefreshWindow time.Duration
+
+	// RefreshMaxAge, when positive, makes CreateSession and UpdateSession
+	// also issue a refresh token valid that long, which RefreshSession then
+	// requires: expired authentication tokens are no longer refreshed on
+	// their own. It must not be shorter than MaxAge. Refresh tokens share the
+	// id (jti) of their credentials, so revoking the credentials revokes them
+	// as well.
+	RefreshMaxAge time.Duration
+
+	// Leeway tolerates clock skew between hosts when validating the exp, iat
+	// and nbf claims, so tokens minted by a host slightly ahead are not
+	// rejected right after issuance. A few seconds is usually enough. Zero
+	// by default.
+	Leeway time.Duration
+
+	// Transport, when set, encodes minted tokens (e.g. encrypts them into
+	// JWEs with a JWETransport, hiding their claims from bearers) and decodes
+	// them back before validation. Tokens are handed out as plain JWTs by
+	// default.
+	Transport Transport
+
+	// RevocationStore records revoked tokens, which are rejected until they
+	// expire. When nil, tokens cannot be revoked.
+	RevocationStore palermo.RevocationStore
+
+	// ReplayGuard, when set, makes refresh tokens single-use: refreshing
+	// consumes the refresh token, and later refreshes with it fail with
+	// ErrReplayed. Callers must then hand out the credentials minted on
+	// refresh, rotating refresh tokens, so a stolen refresh token is only
+	// good once.
+	ReplayGuard palermo.ReplayGuard
+
+	// Metrics records issued, validated and refreshed tokens. Defaults to
+	// palermo.NopMetrics.
+	Metrics palermo.Metrics
+
+	// Logger receives the security relevant events, e.g. replayed refresh
+	// tokens. Defaults to palermo.NopLogger.
+	Logger palermo.Logger
+
+	// TestMode freezes the clock at TestModeTime and replaces the random
+	// source with a deterministic one, so minted tokens are byte-for-byte
+	// reproducible, e.g. for golden files. Every operation fails with
+	// ErrTestModeOutsideTests when enabled outside of a test binary.
+	TestMode bool
+
+	mu       sync.RWMutex
+	closed   bool
+	testRand detReader
+
+	// rotated holds the keys replaced by RotateSecretKey and
+	// RotatePrivateKey, most recent last.
+	rotated []rotatedKey
+
+	validOnce sync.Once
+	validErr  error
+}
+
+// NewSessionService returns a service signing tokens with secretKey and
+// issuing them for maxAge. It fails when the configuration is unusable.
+// Other options may be set on the returned service before its first use.
+func NewSessionService(secretKey []byte, maxAge time.Duration) (*SessionService, error) {
+	uss := &SessionService{
+		SecretKey: secretKey,
+		MaxAge:    maxAge,
+	}
+	if err := uss.validate(); err != nil {
+		return nil, err
+	}
+	return uss, nil
 }
 
 // Session validates and returns the user session associated with the given
 // credentials.
-func (uss *SessionService) Session(c *palermo.SessionCredentials) (*palermo.Session, error) {
-	authClaims, valClaims, err := uss.parseTokens(c.AuthToken, c.ValidationToken)
+func (uss *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	if err := uss.begin(); err != nil {
+		return nil, err
+	}
+	defer uss.end()
+
+	s, err := uss.session(ctx, c, uss.now())
+	uss.metrics().IncCounter("palermo_tokens_validated_total", resultLabels(err))
+	return s, err
+}
+
+// SessionAsOf validates and returns the user session associated with the
+// given credentials as if the current time was at. It answers whether the
+// credentials were valid at a given instant, e.g. for forensic analysis, and
+// must never be fed a caller-controlled time on regular validation paths.
+func (uss *SessionService) SessionAsOf(ctx context.Context, c *palermo.SessionCredentials, at time.Time) (*palermo.Session, error) {
+	if err := uss.begin(); err != nil {
+		return nil, err
+	}
+	defer uss.end()
+
+	s, err := uss.session(ctx, c, at)
+	uss.metrics().IncCounter("palermo_tokens_validated_total", resultLabels(err))
+	return s, err
+}
+
+// SessionMaxAge validates and returns the user session associated with the
+// given credentials, additionally rejecting tokens issued more than maxAge
+// ago. It lets sensitive operations demand a recent authentication regardless
+// of the regular session lifetime.
+func (uss *SessionService) SessionMaxAge(ctx context.Context, c *palermo.SessionCredentials, maxAge time.Duration) (*palermo.Session, error) {
+	if maxAge < 0 {
+		return nil, ErrNegativeMaxAge
+	}
+
+	if err := uss.begin(); err != nil {
+		return nil, err
+	}
+	defer uss.end()
+
+	s, err := uss.sessionMaxAge(ctx, c, maxAge)
+	uss.metrics().IncCounter("palermo_tokens_validated_total", resultLabels(err))
+	return s, err
+}
+
+func (uss *SessionService) sessionMaxAge(ctx context.Context, c *palermo.SessionCredentials, maxAge time.Duration) (*palermo.Session, error) {
+	now := uss.now()
+	claims, err := uss.claims(ctx, c, now, uss.Leeway)
+	if err != nil {
+		return nil, err
+	}
+
+	if now.Sub(time.Unix(claims.IssuedAt, 0)) > maxAge {
+		return nil, ErrTokenTooOld
+	}
+	return uss.sessionFromClaims(claims), nil
+}
+
+// SessionWithLeeway validates and returns the user session associated with
+// the given credentials, tolerating leeway of clock skew on the token time
+// claims instead of the service default. It lets endpoints known to be
+// exposed to skewed clients be more lenient, or others be stricter.
+func (uss *SessionService) SessionWithLeeway(ctx context.Context, c *palermo.SessionCredentials, leeway time.Duration) (*palermo.Session, error) {
+	if leeway < 0 {
+		return nil, ErrNegativeLeeway
+	}
+
+	if err := uss.begin(); err != nil {
+		return nil, err
+	}
+	defer uss.end()
+
+	claims, err := uss.claims(ctx, c, uss.now(), leeway)
+	uss.metrics().IncCounter("palermo_tokens_validated_total", resultLabels(err))
 	if err != nil {
 		return nil, err
 	}
+	return uss.sessionFromClaims(claims), nil
+}
+
+func (uss *SessionService) session(ctx context.Context, c *palermo.SessionCredentials, now time.Time) (*palermo.Session, error) {
+	claims, err := uss.claims(ctx, c, now, uss.Leeway)
+	if err != nil {
+		return nil, err
+	}
+	return uss.sessionFromClaims(claims), nil
+}
+
+// sessionFromClaims returns the session held by the given claims, along with
+// the service policies applying to it.
+func (uss *SessionService) sessionFromClaims(sc *sessionClaims) *palermo.Session {
+	s := sc.Session()
+	if uss.RefreshWindow > 0 && !s.ServiceAccount {
+		s.RefreshableAt = s.ExpiresAt.Add(-uss.RefreshWindow)
+	}
+	return s
+}
+
+// claims validates the given credentials at now, tolerating leeway of clock
+// skew, and returns the claims of the authentication token.
+func (uss *SessionService) claims(ctx context.Context, c *palermo.SessionCredentials, now time.Time, leeway time.Duration) (*sessionClaims, error) {
+	authClaims, valClaims, err := uss.parseTokens(ctx, c.AuthToken, c.ValidationToken, now, leeway)
+	if err != nil {
+		if isTokenTimeInvalid(err) {
+			return nil, newSkewError(err, authClaims, now, leeway)
+		}
+		return nil, err
+	}
 
 	if err := uss.validateClaims(valClaims, authClaims); err != nil {
 		return nil, err
 	}
 
-	return authClaims.Session(), nil
+	if err := uss.validateIssuer(authClaims); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateAudience(authClaims); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateTimestamps(authClaims); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateLifetime(authClaims, leeway); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateRevocation(ctx, authClaims); err != nil {
+		return nil, err
+	}
+
+	return authClaims, nil
+}
+
+// FilterValid validates the given credentials in one pass and returns the
+// sessions of the valid ones along with the indices of the invalid ones.
+// An error is only returned when the service itself is unusable.
+func (uss *SessionService) FilterValid(ctx context.Context, creds []*palermo.SessionCredentials) ([]*palermo.Session, []int, error) {
+	if err := uss.begin(); err != nil {
+		return nil, nil, err
+	}
+	defer uss.end()
+
+	now := uss.now()
+	var sessions []*palermo.Session
+	var invalid []int
+	for i, c := range creds {
+		if c == nil {
+			invalid = append(invalid, i)
+			continue
+		}
+
+		s, err := uss.session(ctx, c, now)
+		uss.metrics().IncCounter("palermo_tokens_validated_total", resultLabels(err))
+		if err != nil {
+			invalid = append(invalid, i)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, invalid, nil
 }
 
 // RefreshSession validates and returns the user session associated with the
 // given credentials. This method skips the validation of the expiry of the
-// tokens.
+// tokens, unless refresh tokens are issued (see RefreshMaxAge): the refresh
+// token is validated instead.
 // Also the associated user session is returned updated.
-func (uss *SessionService) RefreshSession(c *palermo.SessionCredentials) (*palermo.Session, error) {
-	authClaims, valClaims, err := uss.parseTokens(c.AuthToken, c.ValidationToken)
+func (uss *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	if err := uss.begin(); err != nil {
+		return nil, err
+	}
+	defer uss.end()
+
+	s, err := uss.refreshSession(ctx, c)
+	uss.metrics().IncCounter("palermo_tokens_refreshed_total", resultLabels(err))
+	return s, err
+}
+
+func (uss *SessionService) refreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	if uss.RefreshMaxAge > 0 {
+		return uss.refreshSessionWithToken(ctx, c)
+	}
+
+	authClaims, valClaims, err := uss.parseTokens(ctx, c.AuthToken, c.ValidationToken, uss.now(), uss.Leeway)
 	if err != nil {
 		if !isTokenExpired(err) {
 			return nil, err
@@ -80,69 +640,534 @@ func (uss *SessionService) RefreshSession(c *palermo.SessionCredentials) (*paler
 		return nil, err
 	}
 
-	s := authClaims.Session()
-	s.UpdatedAt = time.Now()
+	if authClaims.TokenType == tokenTypeService {
+		return nil, ErrTokenUse
+	}
+
+	if err := uss.validateIssuer(authClaims); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateAudience(authClaims); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateTimestamps(authClaims); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateLifetime(authClaims, uss.Leeway); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateRevocation(ctx, authClaims); err != nil {
+		return nil, err
+	}
+
+	now := uss.now()
+	s := uss.sessionFromClaims(authClaims)
+	if now.Before(s.RefreshableAt) {
+		return nil, ErrRefreshTooEarly
+	}
+
+	s.UpdatedAt = now
 	return s, nil
 }
 
+// refreshSessionWithToken refreshes the session carried by the refresh token
+// of the given credentials. The other tokens are ignored, as they may have
+// expired long ago. The refresh window is enforced through the nbf claim of
+// the refresh token.
+func (uss *SessionService) refreshSessionWithToken(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	if c.RefreshToken == "" {
+		return nil, ErrMissingRefreshToken
+	}
+
+	now := uss.now()
+	rc, err := uss.tokenClaims(ctx, c.RefreshToken, tokenRefresh, now, uss.Leeway)
+	if err != nil {
+		if e, ok := err.(*validationError); ok && e.Errors == validationErrorNotValidYet {
+			return nil, ErrRefreshTooEarly
+		}
+		if isTokenTimeInvalid(err) {
+			return nil, newSkewError(err, rc, now, uss.Leeway)
+		}
+		return nil, err
+	}
+
+	if rc.TokenUse != tokenUseRefresh || rc.TokenType == tokenTypeService {
+		return nil, ErrTokenUse
+	}
+
+	if err := uss.validateIssuer(rc); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateAudience(rc); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateTimestamps(rc); err != nil {
+		return nil, err
+	}
+
+	if err := uss.validateRevocation(ctx, rc); err != nil {
+		return nil, err
+	}
+
+	if uss.ReplayGuard != nil {
+		fresh, err := uss.ReplayGuard.Consume(ctx, rc.Id, time.Unix(rc.ExpiresAt, 0))
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			uss.logger().Warn("jwt: refresh token replayed", palermo.Fields{
+				"jti":     rc.Id,
+				"user_id": rc.UserID,
+			})
+			return nil, ErrReplayed
+		}
+	}
+
+	s := rc.Session()
+	s.UpdatedAt = now
+	return s, nil
+}
+
+// RevokeSession revokes the given credentials, which are rejected from then
+// on. Expired credentials may be revoked as well, e.g. on logout, although
+// they were already unusable.
+func (uss *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	if err := uss.begin(); err != nil {
+		return err
+	}
+	defer uss.end()
+
+	if uss.RevocationStore == nil {
+		return ErrRevocationUnsupported
+	}
+
+	authClaims, valClaims, err := uss.parseTokens(ctx, c.AuthToken, c.ValidationToken, uss.now(), uss.Leeway)
+	if err != nil && !isTokenExpired(err) {
+		return err
+	}
+
+	if err := uss.validateClaims(valClaims, authClaims); err != nil {
+		return err
+	}
+
+	expiresAt := time.Unix(authClaims.ExpiresAt, 0)
+	if uss.RefreshMaxAge > 0 && authClaims.TokenType != tokenTypeService {
+		// The refresh token shares the id of the credentials and outlives
+		// them.
+		expiresAt = time.Unix(authClaims.IssuedAt, 0).Add(uss.RefreshMaxAge)
+	}
+
+	err = uss.RevocationStore.Revoke(ctx, authClaims.Id, expiresAt)
+	uss.metrics().IncCounter("palermo_tokens_revoked_total", resultLabels(err))
+	return err
+}
+
+// RefreshCredentials refreshes the session associated with the given
+// credentials and mints new credentials for it. New credentials always carry
+// the current Audience, which migrates tokens issued for a previous one.
+func (uss *SessionService) RefreshCredentials(ctx context.Context, c *palermo.SessionCredentials) (*palermo.SessionCredentials, *palermo.Session, error) {
+	s, err := uss.RefreshSession(ctx, c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nc, err := uss.UpdateSession(ctx, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nc, s, nil
+}
+
+// EnsureSession returns the given credentials and their session when they are
+// valid. When the credentials are absent or merely expired, new credentials
+// are minted for the fallback session instead, failing with ErrNoFallback
+// when it is nil. Any other invalid credentials, e.g. tampered or not valid
+// yet, are never replaced and their validation error is returned.
+func (uss *SessionService) EnsureSession(ctx context.Context, c *palermo.SessionCredentials, fallback *palermo.Session) (*palermo.SessionCredentials, *palermo.Session, error) {
+	if c != nil && (c.AuthToken != "" || c.ValidationToken != "") {
+		s, err := uss.Session(ctx, c)
+		if err == nil {
+			return c, s, nil
+		}
+		if se, ok := err.(*SkewError); !ok || !isTokenExpired(se.Err) {
+			return nil, nil, err
+		}
+	}
+	if fallback == nil {
+		return nil, nil, ErrNoFallback
+	}
+
+	nc, err := uss.CreateSession(ctx, fallback)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nc, fallback, nil
+}
+
 // CreateSession creates new credentials for the given session.
-func (uss *SessionService) CreateSession(us *palermo.Session) (*palermo.SessionCredentials, error) {
-	return uss.sessionCredentials(us)
+func (uss *SessionService) CreateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return uss.sessionCredentials(ctx, us)
 }
 
 // UpdateSession creates new credentials for the given session.
-func (uss *SessionService) UpdateSession(us *palermo.Session) (*palermo.SessionCredentials, error) {
-	return uss.sessionCredentials(us)
+func (uss *SessionService) UpdateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return uss.sessionCredentials(ctx, us)
 }
 
-func (uss *SessionService) sessionCredentials(us *palermo.Session) (*palermo.SessionCredentials, error) {
-	id, err := generateRandomToken(tokenIDnumBytes)
-	if err != nil {
+func (uss *SessionService) sessionCredentials(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if err := uss.begin(); err != nil {
 		return nil, err
 	}
+	defer uss.end()
 
-	iat := time.Now()
-	exp := iat.Add(uss.MaxAge)
+	var tokenType string
+	if us.ServiceAccount {
+		if uss.ServiceAccountMaxAge == 0 {
+			return nil, ErrServiceAccountsDisabled
+		}
+		if us.Anonymous || us.UserID == "" {
+			return nil, errors.New("jwt: service account sessions require a user id and cannot be anonymous")
+		}
+		tokenType = tokenTypeService
+	}
 
-	validationToken, err := uss.tokenString(&sessionClaims{
-		StandardClaims: jwt.StandardClaims{
-			Id:        id,
-			Issuer:    us.Token,
-			Subject:   us.Email,
-			IssuedAt:  iat.Unix(),
-			ExpiresAt: exp.Unix(),
-		},
-	})
+	id, err := generateRandomToken(uss.random(), tokenIDnumBytes)
 	if err != nil {
 		return nil, err
 	}
 
-	authToken, err := uss.tokenString(&sessionClaims{
-		StandardClaims: jwt.StandardClaims{
-			Id:        id,
-			Issuer:    us.Token,
-			Subject:   us.Email,
-			IssuedAt:  iat.Unix(),
-			ExpiresAt: exp.Unix(),
-		},
+	iat := uss.now()
+	exp := iat.Add(uss.maxAge(us))
+	var nbf int64
+	if !us.NotBefore.IsZero() {
+		nbf = us.NotBefore.Unix()
+	}
+
+	validationToken, err := uss.tokenString(ctx, tokenValidation, &sessionClaims{
+		Id:        id,
+		Issuer:    uss.Issuer,
+		Subject:   us.Email,
+		Audience:  uss.Audience,
+		IssuedAt:  iat.Unix(),
+		ExpiresAt: exp.Unix(),
+		NotBefore: nbf,
 		ID:        us.ID,
 		UserID:    us.UserID,
-		Email:     us.Email,
-		Token:     us.Token,
-		CreatedAt: us.CreatedAt.Unix(),
-		UpdatedAt: us.UpdatedAt.Unix(),
+		TokenType: tokenType,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &palermo.SessionCredentials{
+	authClaims := &sessionClaims{
+		Id:             id,
+		Issuer:         uss.Issuer,
+		Subject:        us.Email,
+		Audience:       uss.Audience,
+		IssuedAt:       iat.Unix(),
+		ExpiresAt:      exp.Unix(),
+		NotBefore:      nbf,
+		ID:             us.ID,
+		UserID:         us.UserID,
+		Email:          us.Email,
+		Token:          us.Token,
+		Anonymous:      us.Anonymous,
+		Source:         us.Source,
+		Scopes:         us.Scopes,
+		APIVersion:     us.APIVersion,
+		AllowedMethods: us.AllowedMethods,
+		Metadata:       us.Metadata,
+		CreatedAt:      us.CreatedAt.Unix(),
+		UpdatedAt:      us.UpdatedAt.Unix(),
+		TokenType:      tokenType,
+	}
+	authToken, err := uss.tokenString(ctx, tokenAuth, authClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &palermo.SessionCredentials{
 		ValidationToken: validationToken,
 		AuthToken:       authToken,
-	}, nil
+	}
+
+	// Service accounts are never refreshed.
+	if uss.RefreshMaxAge > 0 && !us.ServiceAccount {
+		rc := *authClaims
+		rc.TokenUse = tokenUseRefresh
+		rc.ExpiresAt = iat.Add(uss.RefreshMaxAge).Unix()
+		if uss.RefreshWindow > 0 && exp.Add(-uss.RefreshWindow).Unix() > rc.NotBefore {
+			rc.NotBefore = exp.Add(-uss.RefreshWindow).Unix()
+		}
+		if c.RefreshToken, err = uss.tokenString(ctx, tokenRefresh, &rc); err != nil {
+			return nil, err
+		}
+	}
+
+	uss.metrics().IncCounter("palermo_tokens_issued_total", nil)
+	return c, nil
+}
+
+// Close zeroes the key material held by the service and makes every later
+// token operation fail with ErrClosed. Zeroing is best effort: the Go runtime
+// may have copied the key elsewhere in memory (e.g. when the caller built it
+// from a string) and such copies are out of reach.
+func (uss *SessionService) Close() error {
+	uss.mu.Lock()
+	defer uss.mu.Unlock()
+
+	if uss.closed {
+		return nil
+	}
+	uss.closed = true
+
+	for i := range uss.SecretKey {
+		uss.SecretKey[i] = 0
+	}
+	for _, k := range uss.PreviousSecretKeys {
+		for i := range k {
+			k[i] = 0
+		}
+	}
+	uss.PreviousSecretKeys = nil
+	for _, rk := range uss.rotated {
+		zeroBytes(rk.key)
+	}
+	uss.rotated = nil
+	zeroPrivateKey(uss.PrivateKey)
+	uss.PrivateKey = nil
+	for i := range uss.Keyring {
+		uss.Keyring[i].zero()
+	}
+	return nil
+}
+
+// begin marks the start of a token operation, failing when the service is
+// not usable. end must be called once the operation is over.
+func (uss *SessionService) begin() error {
+	uss.mu.RLock()
+	if uss.closed {
+		uss.mu.RUnlock()
+		return ErrClosed
+	}
+	if err := uss.ensureValid(); err != nil {
+		uss.mu.RUnlock()
+		return err
+	}
+	if !uss.hasKeys() {
+		uss.mu.RUnlock()
+		return ErrNoKeysConfigured
+	}
+	return nil
+}
+
+// ensureValid validates the configuration of the service once, on first use,
+// as services built from struct literals skip NewSessionService.
+func (uss *SessionService) ensureValid() error {
+	uss.validOnce.Do(func() {
+		uss.validErr = uss.validate()
+	})
+	return uss.validErr
+}
+
+func (uss *SessionService) validate() error {
+	switch uss.SigningMethod {
+	case "", SigningMethodHS256, SigningMethodRS256, SigningMethodES256, SigningMethodEdDSA:
+	default:
+		return &ConfigError{Field: "SigningMethod", Reason: "unsupported " + uss.SigningMethod}
+	}
+	if !uss.hasKeys() {
+		return ErrNoKeysConfigured
+	}
+	if err := uss.validateKeyring(); err != nil {
+		return err
+	}
+	if err := uss.validateVerifyMethods(); err != nil {
+		return err
+	}
+	if len(uss.PreviousSecretKeys) > 0 && (!uss.verifies(SigningMethodHS256) || len(uss.SecretKey) == 0) {
+		return &ConfigError{Field: "PreviousSecretKeys", Reason: "requires SecretKey and SigningMethodHS256"}
+	}
+	for _, k := range uss.PreviousSecretKeys {
+		if len(k) == 0 {
+			return &ConfigError{Field: "PreviousSecretKeys", Reason: "empty secret"}
+		}
+	}
+	if uss.ReplayGuard != nil && uss.RefreshMaxAge == 0 {
+		return &ConfigError{Field: "ReplayGuard", Reason: "requires refresh tokens (RefreshMaxAge)"}
+	}
+	if uss.DeriveTokenKeys && uss.asymmetric() {
+		return &ConfigError{Field: "DeriveTokenKeys", Reason: "requires SigningMethodHS256"}
+	}
+	if uss.Signer != nil && (!uss.asymmetric() || uss.Signer.Algorithm() != uss.SigningMethod) {
+		return &ConfigError{Field: "Signer", Reason: "algorithm must match an asymmetric SigningMethod"}
+	}
+	if uss.RemoteKeys != nil && uss.RemoteKeys.URL == "" {
+		return &ConfigError{Field: "RemoteKeys", Reason: "missing URL"}
+	}
+	if uss.CheckAccessTokenHash && uss.RemoteKeys == nil {
+		return &ConfigError{Field: "CheckAccessTokenHash", Reason: "requires RemoteKeys"}
+	}
+	if uss.MaxAge <= 0 {
+		return &ConfigError{Field: "MaxAge", Reason: "must be positive, tokens would expire on issue"}
+	}
+	if uss.AnonymousMaxAge < 0 {
+		return &ConfigError{Field: "AnonymousMaxAge", Reason: "must not be negative"}
+	}
+	if uss.ServiceAccountMaxAge < 0 {
+		return &ConfigError{Field: "ServiceAccountMaxAge", Reason: "must not be negative"}
+	}
+	if uss.RefreshWindow < 0 || uss.RefreshWindow > uss.MaxAge {
+		return &ConfigError{Field: "RefreshWindow", Reason: "must be between zero and MaxAge"}
+	}
+	if uss.Leeway < 0 {
+		return &ConfigError{Field: "Leeway", Reason: "must not be negative"}
+	}
+	if uss.RefreshMaxAge < 0 || uss.RefreshMaxAge > 0 && (uss.RefreshMaxAge < uss.MaxAge || uss.RefreshMaxAge < uss.AnonymousMaxAge) {
+		return &ConfigError{Field: "RefreshMaxAge", Reason: "must be zero or outlive MaxAge"}
+	}
+	if uss.TestMode && !inTest() {
+		return ErrTestModeOutsideTests
+	}
+	return nil
+}
+
+// end marks the end of a token operation started by begin.
+func (uss *SessionService) end() {
+	uss.mu.RUnlock()
+}
+
+// Check reports whether the service has keys to verify tokens with: it is
+// valid and open, and its remote keys or its Signer, if any, are available.
+// It implements palermo.HealthChecker, so that the service only receives
+// traffic once it can serve it.
+func (uss *SessionService) Check(ctx context.Context) error {
+	if err := uss.begin(); err != nil {
+		return err
+	}
+	defer uss.end()
+
+	if uss.RemoteKeys != nil {
+		if err := uss.RemoteKeys.Check(ctx); err != nil {
+			return err
+		}
+	}
+	if hc, ok := uss.Signer.(palermo.HealthChecker); ok {
+		return hc.Check(ctx)
+	}
+	return nil
+}
+
+func (uss *SessionService) hasKeys() bool {
+	if uss.RemoteKeys != nil || uss.Signer != nil || len(uss.Keyring) > 0 {
+		return true
+	}
+	if uss.asymmetric() {
+		return uss.publicKey() != nil
+	}
+	return len(uss.SecretKey) > 0
+}
+
+func (uss *SessionService) validateVerifyMethods() error {
+	for _, m := range uss.VerifyMethods {
+		switch m {
+		case SigningMethodHS256:
+			if len(uss.SecretKey) == 0 {
+				return &ConfigError{Field: "VerifyMethods", Reason: "HS256 requires SecretKey"}
+			}
+		case SigningMethodRS256, SigningMethodES256, SigningMethodEdDSA:
+			if uss.asymmetric() && m != uss.SigningMethod {
+				return &ConfigError{Field: "VerifyMethods", Reason: "at most one asymmetric signing method"}
+			}
+			if uss.publicKey() == nil {
+				return &ConfigError{Field: "VerifyMethods", Reason: m + " requires PublicKey or PrivateKey"}
+			}
+		default:
+			return &ConfigError{Field: "VerifyMethods", Reason: "unsupported " + m}
+		}
+	}
+	return nil
+}
+
+// verifies reports whether tokens signed with alg are accepted.
+func (uss *SessionService) verifies(alg string) bool {
+	if alg == uss.signingMethod() {
+		return true
+	}
+	for _, m := range uss.VerifyMethods {
+		if alg == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (uss *SessionService) asymmetric() bool {
+	return uss.SigningMethod != "" && uss.SigningMethod != SigningMethodHS256
+}
+
+func (uss *SessionService) publicKey() crypto.PublicKey {
+	if uss.PublicKey != nil {
+		return uss.PublicKey
+	}
+	if uss.PrivateKey != nil {
+		return uss.PrivateKey.Public()
+	}
+	if uss.Signer != nil && uss.Signer.KeyID() == "" {
+		return uss.Signer.Public()
+	}
+	return nil
+}
+
+func (uss *SessionService) now() time.Time {
+	if uss.TestMode {
+		return TestModeTime
+	}
+	return time.Now()
+}
+
+func (uss *SessionService) random() io.Reader {
+	if uss.TestMode {
+		return &uss.testRand
+	}
+	return rand.Reader
+}
+
+func (uss *SessionService) logger() palermo.Logger {
+	if uss.Logger == nil {
+		return palermo.NopLogger{}
+	}
+	return uss.Logger
+}
+
+func (uss *SessionService) metrics() palermo.Metrics {
+	if uss.Metrics == nil {
+		return palermo.NopMetrics{}
+	}
+	return uss.Metrics
+}
+
+func (uss *SessionService) maxAge(us *palermo.Session) time.Duration {
+	if us.ServiceAccount {
+		return uss.ServiceAccountMaxAge
+	}
+	if us.Anonymous && uss.AnonymousMaxAge > 0 {
+		return uss.AnonymousMaxAge
+	}
+	return uss.MaxAge
 }
 
 func (uss *SessionService) validateClaims(lhs, rhs *sessionClaims) error {
+	if lhs.TokenUse != "" || rhs.TokenUse != "" {
+		return ErrTokenUse
+	}
+
 	if lhs.Id != rhs.Id {
 		return errors.New("jwt: validation and authentication token jti mismatched")
 	}
@@ -163,12 +1188,82 @@ func (uss *SessionService) validateClaims(lhs, rhs *sessionClaims) error {
 		return errors.New("jwt: validation and authentication token iss mismatched")
 	}
 
+	if lhs.Audience != rhs.Audience {
+		return errors.New("jwt: validation and authentication token aud mismatched")
+	}
+
+	if lhs.TokenType != rhs.TokenType {
+		return errors.New("jwt: validation and authentication token type mismatched")
+	}
+
+	if lhs.ID != rhs.ID || lhs.UserID != rhs.UserID {
+		return ErrSessionMismatch
+	}
+
+	return nil
+}
+
+func (uss *SessionService) validateIssuer(sc *sessionClaims) error {
+	if uss.Issuer != "" && sc.Issuer != uss.Issuer {
+		return ErrInvalidIssuer
+	}
+	return nil
+}
+
+func (uss *SessionService) validateAudience(sc *sessionClaims) error {
+	if uss.Audience == "" || sc.Audience == uss.Audience {
+		return nil
+	}
+
+	for _, aud := range uss.PreviousAudiences {
+		if sc.Audience == aud {
+			return nil
+		}
+	}
+	return ErrInvalidAudience
+}
+
+func (uss *SessionService) validateTimestamps(sc *sessionClaims) error {
+	if !uss.CheckTimestamps {
+		return nil
+	}
+
+	if sc.CreatedAt > sc.UpdatedAt || sc.UpdatedAt > sc.ExpiresAt {
+		return ErrInconsistentTimestamps
+	}
+	return nil
+}
+
+func (uss *SessionService) validateLifetime(sc *sessionClaims, leeway time.Duration) error {
+	if !uss.CheckLifetime {
+		return nil
+	}
+
+	lifetime := time.Duration(sc.ExpiresAt-sc.IssuedAt) * time.Second
+	if lifetime > uss.maxAge(sc.Session())+leeway {
+		return ErrLifetimeTooLong
+	}
+	return nil
+}
+
+func (uss *SessionService) validateRevocation(ctx context.Context, sc *sessionClaims) error {
+	if uss.RevocationStore == nil {
+		return nil
+	}
+
+	revoked, err := uss.RevocationStore.IsRevoked(ctx, sc.Id)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrRevoked
+	}
 	return nil
 }
 
-func (uss *SessionService) parseTokens(authToken, valToken string) (*sessionClaims, *sessionClaims, error) {
-	authClaims, authErr := uss.tokenClaims(authToken)
-	valClaims, valErr := uss.tokenClaims(valToken)
+func (uss *SessionService) parseTokens(ctx context.Context, authToken, valToken string, now time.Time, leeway time.Duration) (*sessionClaims, *sessionClaims, error) {
+	authClaims, authErr := uss.tokenClaims(ctx, authToken, tokenAuth, now, leeway)
+	valClaims, valErr := uss.tokenClaims(ctx, valToken, tokenValidation, now, leeway)
 
 	var err error
 	if authErr != nil {
@@ -177,45 +1272,141 @@ func (uss *SessionService) parseTokens(authToken, valToken string) (*sessionClai
 	if err == nil && valErr != nil {
 		err = valErr
 	}
+	if err == nil && uss.checksAccessTokenHash() {
+		if authClaims.AccessTokenHash == "" {
+			err = ErrMissingAccessTokenHash
+		} else {
+			err = VerifyAccessTokenHash(authClaims.AccessTokenHash, valToken, authClaims.alg)
+		}
+	}
 
 	return authClaims, valClaims, err
 }
 
-func (uss *SessionService) tokenClaims(tokenStr string) (*sessionClaims, error) {
+// checksAccessTokenHash reports whether the at_hash claim of tokens issued by
+// the remote keys is checked.
+func (uss *SessionService) checksAccessTokenHash() bool {
+	return uss.RemoteKeys != nil && uss.CheckAccessTokenHash
+}
+
+// tokenClaims parses and verifies the given token of the given kind,
+// validating its time claims against now with the given leeway.
+func (uss *SessionService) tokenClaims(ctx context.Context, tokenStr string, kind tokenKind, now time.Time, leeway time.Duration) (*sessionClaims, error) {
 	var claims = new(sessionClaims)
-	token, err := jwt.ParseWithClaims(tokenStr, claims, uss.verifySigningMethod)
+	if uss.Transport != nil {
+		var err error
+		if tokenStr, err = uss.Transport.Decode(tokenStr); err != nil {
+			return claims, err
+		}
+	}
 
-	if c, ok := token.Claims.(*sessionClaims); ok {
-		claims = c
+	keyFunc := uss.keyFunc(ctx, kind)
+	err := jws.Parse(tokenStr, claims, func(h jws.Header) (interface{}, error) {
+		claims.alg = h.Alg
+		return keyFunc(h)
+	})
+	if err != nil {
+		return claims, err
 	}
 
-	return claims, err
+	return claims, claims.validAt(now, leeway)
 }
 
-func (uss *SessionService) tokenString(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(uss.SecretKey)
+func (uss *SessionService) tokenString(ctx context.Context, kind tokenKind, claims *sessionClaims) (string, error) {
+	signer, err := uss.signer(kind)
+	if err != nil {
+		return "", err
+	}
+
+	s, err := jws.Sign(signer.Algorithm(), signer.KeyID(), claims, func(input []byte) ([]byte, error) {
+		return signer.Sign(ctx, input)
+	})
+	if err != nil || uss.Transport == nil {
+		return s, err
+	}
+	return uss.Transport.Encode(s)
 }
 
-func (uss *SessionService) verifySigningMethod(token *jwt.Token) (interface{}, error) {
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// keyFunc returns the function selecting the key verifying tokens of the
+// given kind.
+func (uss *SessionService) keyFunc(ctx context.Context, kind tokenKind) jws.KeyFunc {
+	return func(h jws.Header) (interface{}, error) {
+		if uss.RemoteKeys != nil {
+			return uss.RemoteKeys.Key(ctx, h.Kid, h.Alg)
+		}
+
+		if !uss.verifies(h.Alg) {
+			return nil, fmt.Errorf("unexpected signing method: %v", h.Alg)
+		}
+		return uss.verificationKey(h.Kid, h.Alg, kind)
 	}
-	return uss.SecretKey, nil
 }
 
-func generateRandomToken(n int) (string, error) {
+// TokenID returns the id (jti) of the given plain JWT token without verifying
+// it. It is meant to identify credentials just minted by the service, e.g. in
+// audit records, and must never be used to trust a token.
+func TokenID(tokenStr string) (string, error) {
+	claims := new(sessionClaims)
+	if _, err := jws.ParseUnverified(tokenStr, claims); err != nil {
+		return "", err
+	}
+	return claims.Id, nil
+}
+
+// unixTime returns the time of the given Unix seconds, or the zero time for 0,
+// i.e. a missing claim.
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+func generateRandomToken(r io.Reader, n int) (string, error) {
 	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
+	if _, err := io.ReadFull(r, b); err != nil {
 		return "", err
 	}
 	return base64.StdEncoding.EncodeToString(b), nil
 }
 
 func isTokenExpired(err error) bool {
-	e, ok := err.(*jwt.ValidationError)
+	e, ok := err.(*validationError)
+	if !ok {
+		return false
+	}
+	return (e.Errors & ^validationErrorExpired) == 0
+}
+
+func isTokenTimeInvalid(err error) bool {
+	e, ok := err.(*validationError)
 	if !ok {
 		return false
 	}
-	return (e.Errors & ^jwt.ValidationErrorExpired) == 0
+	return e.Errors&(validationErrorExpired|validationErrorNotValidYet|validationErrorIssuedAt) != 0
+}
+
+func newSkewError(err error, sc *sessionClaims, now time.Time, leeway time.Duration) *SkewError {
+	se := &SkewError{
+		Err:    err,
+		Now:    now,
+		Leeway: leeway,
+	}
+	if sc.IssuedAt != 0 {
+		se.IssuedAt = time.Unix(sc.IssuedAt, 0)
+	}
+	if sc.ExpiresAt != 0 {
+		se.ExpiresAt = time.Unix(sc.ExpiresAt, 0)
+	}
+	if sc.NotBefore != 0 {
+		se.NotBefore = time.Unix(sc.NotBefore, 0)
+	}
+	return se
+}
+
+func resultLabels(err error) map[string]string {
+	if err != nil {
+		return map[string]string{"result": "error"}
+	}
+	return map[string]string{"result": "ok"}
 }
@@ -0,0 +1,97 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/jws"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// resign returns token with its claims modified by edit, signed with testKey
+// as HS256, e.g. to craft tokens palermo would never mint.
+func resign(t *testing.T, token string, edit func(claims map[string]interface{})) string {
+	claims := make(map[string]interface{})
+	if _, err := jws.ParseUnverified(token, &claims); err != nil {
+		t.Fatal(err)
+	}
+	edit(claims)
+	token, err := jws.Sign("HS256", "", claims, func(input []byte) ([]byte, error) {
+		return jws.Signature("HS256", input, testKey)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestEnsureSession(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute}
+	// Credentials minted in TestMode are long expired for js.
+	past := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute, TestMode: true}
+
+	user := &palermo.Session{UserID: "u1", Email: "u1@example.com"}
+	guest := &palermo.Session{Anonymous: true}
+
+	valid, err := js.CreateSession(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := past.CreateSession(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notYet, err := js.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com", NotBefore: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := &palermo.SessionCredentials{AuthToken: valid.AuthToken + "x", ValidationToken: valid.ValidationToken}
+
+	tests := []struct {
+		name     string
+		creds    *palermo.SessionCredentials
+		fallback *palermo.Session
+		wantErr  bool
+		wantSame bool // the given credentials are returned
+		wantUser string
+	}{
+		{"no credentials", nil, guest, false, false, ""},
+		{"empty credentials", &palermo.SessionCredentials{}, guest, false, false, ""},
+		{"valid", valid, guest, false, true, "u1"},
+		{"valid without fallback", valid, nil, false, true, "u1"},
+		{"expired", expired, guest, false, false, ""},
+		{"expired without fallback", expired, nil, true, false, ""},
+		{"no credentials without fallback", nil, nil, true, false, ""},
+		{"not valid yet", notYet, guest, true, false, ""},
+		{"tampered", tampered, guest, true, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, s, err := js.EnsureSession(ctx, tt.creds, tt.fallback)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EnsureSession() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if same := c == tt.creds; same != tt.wantSame {
+				t.Errorf("credentials returned as is: %v, want %v", same, tt.wantSame)
+			}
+			if s.UserID != tt.wantUser {
+				t.Errorf("got session of %q, want %q", s.UserID, tt.wantUser)
+			}
+			if _, err := js.Session(ctx, c); err != nil {
+				t.Errorf("returned credentials invalid: %v", err)
+			}
+		})
+	}
+
+	if _, _, err := js.EnsureSession(ctx, expired, nil); err != jwt.ErrNoFallback {
+		t.Errorf("EnsureSession() = %v, want %v", err, jwt.ErrNoFallback)
+	}
+}
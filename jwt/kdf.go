@@ -0,0 +1,52 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt cost parameters recommended for interactive logins as of 2017.
+const (
+	kdfN      = 1 << 15
+	kdfR      = 8
+	kdfP      = 1
+	kdfKeyLen = 32
+)
+
+// tokenKind identifies a type of token. Its value is the HKDF label deriving
+// the key of the type when DeriveTokenKeys is set.
+type tokenKind string
+
+// Token types.
+const (
+	tokenValidation tokenKind = "palermo jwt validation token"
+	tokenAuth       tokenKind = "palermo jwt auth token"
+	tokenRefresh    tokenKind = "palermo jwt refresh token"
+)
+
+// DeriveKey stretches a human passphrase into a 32-byte signing key using
+// scrypt. The derivation is deterministic, so every instance sharing tokens
+// must be configured with the same passphrase and the same salt; a different
+// salt yields an unrelated key and tokens will not validate across instances.
+func DeriveKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, kdfN, kdfR, kdfP, kdfKeyLen)
+}
+
+// tokenKey returns the key signing tokens of the given kind with the given
+// secret: the secret itself, or a key derived from it with HKDF-SHA256 when
+// DeriveTokenKeys is set.
+func (uss *SessionService) tokenKey(secret []byte, kind tokenKind) []byte {
+	if !uss.DeriveTokenKeys {
+		return secret
+	}
+
+	key := make([]byte, kdfKeyLen)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(kind)), key); err != nil {
+		// HKDF-SHA256 produces up to 8160 bytes.
+		panic(err)
+	}
+	return key
+}
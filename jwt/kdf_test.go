@@ -0,0 +1,77 @@
+package jwt_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestDeriveKey(t *testing.T) {
+	ref, err := jwt.DeriveKey([]byte("correct horse battery staple"), []byte("palermo-salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ref) != 32 {
+		t.Fatalf("derived a %d-byte key, want 32", len(ref))
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		salt       string
+		wantSame   bool
+	}{
+		{"same passphrase and salt", "correct horse battery staple", "palermo-salt", true},
+		{"other salt", "correct horse battery staple", "other-salt", false},
+		{"other passphrase", "correct horse battery stable", "palermo-salt", false},
+		{"no salt", "correct horse battery staple", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := jwt.DeriveKey([]byte(tt.passphrase), []byte(tt.salt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := bytes.Equal(key, ref); same != tt.wantSame {
+				t.Errorf("same key: %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestDerivedKeyInteroperates(t *testing.T) {
+	ctx := context.Background()
+	newService := func(salt string) *jwt.SessionService {
+		key, err := jwt.DeriveKey([]byte("correct horse battery staple"), []byte(salt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &jwt.SessionService{SecretKey: key, MaxAge: time.Minute}
+	}
+
+	issuer := newService("palermo-salt")
+	c, err := issuer.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		salt    string
+		wantErr bool
+	}{
+		{"instance with the same salt", "palermo-salt", false},
+		{"instance with another salt", "other-salt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newService(tt.salt).Session(ctx, c); (err != nil) != tt.wantErr {
+				t.Errorf("Session() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
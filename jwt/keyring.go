@@ -0,0 +1,146 @@
+package jwt
+
+import (
+	"crypto"
+	"errors"
+
+	"github.com/go-toschool/palermo/internal/jws"
+)
+
+// ErrUnknownKey is returned when a token was signed with a key the service
+// does not hold, e.g. one rotated out of the keyring.
+var ErrUnknownKey = errors.New("jwt: unknown signing key")
+
+// Key is a key of a keyring. It holds a SecretKey for HS256, or a PrivateKey
+// and/or PublicKey for asymmetric signing methods.
+type Key struct {
+	// ID identifies the key in the kid header of the tokens it signs.
+	ID string
+
+	SecretKey  []byte
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+func (k *Key) publicKey() crypto.PublicKey {
+	if k.PublicKey != nil {
+		return k.PublicKey
+	}
+	if k.PrivateKey != nil {
+		return k.PrivateKey.Public()
+	}
+	return nil
+}
+
+func (k *Key) zero() {
+	for i := range k.SecretKey {
+		k.SecretKey[i] = 0
+	}
+	zeroPrivateKey(k.PrivateKey)
+	k.PrivateKey = nil
+}
+
+func (uss *SessionService) validateKeyring() error {
+	ids := make(map[string]bool, len(uss.Keyring))
+	for i := range uss.Keyring {
+		k := &uss.Keyring[i]
+		if k.ID == "" {
+			return &ConfigError{Field: "Keyring", Reason: "key without id"}
+		}
+		if ids[k.ID] {
+			return &ConfigError{Field: "Keyring", Reason: "duplicate key id " + k.ID}
+		}
+		ids[k.ID] = true
+
+		if uss.asymmetric() && k.publicKey() == nil || !uss.asymmetric() && len(k.SecretKey) == 0 {
+			return &ConfigError{Field: "Keyring", Reason: "no key material for key " + k.ID}
+		}
+	}
+	return nil
+}
+
+func (uss *SessionService) signingMethod() string {
+	if uss.asymmetric() {
+		return uss.SigningMethod
+	}
+	return SigningMethodHS256
+}
+
+// signer returns the signer of new tokens: Signer when set, or else the
+// first key of the keyring, or else the keys configured outside of it.
+func (uss *SessionService) signer(kind tokenKind) (Signer, error) {
+	if uss.Signer != nil {
+		return uss.Signer, nil
+	}
+
+	if len(uss.Keyring) > 0 {
+		k := &uss.Keyring[0]
+		if !uss.asymmetric() {
+			return &LocalSigner{Method: uss.signingMethod(), ID: k.ID, Key: uss.tokenKey(k.SecretKey, kind)}, nil
+		}
+		if k.PrivateKey == nil {
+			return nil, ErrNoSigningKey
+		}
+		return &LocalSigner{Method: uss.signingMethod(), ID: k.ID, Key: k.PrivateKey}, nil
+	}
+
+	if !uss.asymmetric() {
+		return &LocalSigner{Method: uss.signingMethod(), Key: uss.tokenKey(uss.SecretKey, kind)}, nil
+	}
+	if uss.PrivateKey == nil {
+		return nil, ErrNoSigningKey
+	}
+	return &LocalSigner{Method: uss.signingMethod(), Key: uss.PrivateKey}, nil
+}
+
+// verificationKey returns the key verifying tokens of the given kind signed
+// with alg and the given key id. Symmetric algorithms are only ever verified
+// with secrets, and asymmetric ones with public keys.
+func (uss *SessionService) verificationKey(kid, alg string, kind tokenKind) (interface{}, error) {
+	symmetric := jws.Symmetric(alg)
+	if uss.Signer != nil && !symmetric && kid != "" && kid == uss.Signer.KeyID() {
+		return uss.Signer.Public(), nil
+	}
+
+	if kid == "" {
+		if symmetric && len(uss.SecretKey) > 0 {
+			previous := append(uss.rotatedKeys(), uss.PreviousSecretKeys...)
+			if len(previous) == 0 {
+				return uss.tokenKey(uss.SecretKey, kind), nil
+			}
+			keys := jws.Keys{uss.tokenKey(uss.SecretKey, kind)}
+			for _, k := range previous {
+				keys = append(keys, uss.tokenKey(k, kind))
+			}
+			return keys, nil
+		}
+		if pub := uss.publicKey(); !symmetric && pub != nil {
+			previous := uss.rotatedPublicKeys()
+			if len(previous) == 0 {
+				return pub, nil
+			}
+			keys := jws.Keys{pub}
+			for _, k := range previous {
+				keys = append(keys, k)
+			}
+			return keys, nil
+		}
+		return nil, ErrUnknownKey
+	}
+
+	for i := range uss.Keyring {
+		k := &uss.Keyring[i]
+		if k.ID != kid {
+			continue
+		}
+		if !symmetric {
+			if pub := k.publicKey(); pub != nil {
+				return pub, nil
+			}
+		} else if len(k.SecretKey) > 0 {
+			return uss.tokenKey(k.SecretKey, kind), nil
+		}
+		return nil, ErrUnknownKey
+	}
+	return nil, ErrUnknownKey
+}
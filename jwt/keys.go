@@ -0,0 +1,99 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-toschool/palermo/internal/jws"
+)
+
+// ErrEdDSAVerification is returned when an EdDSA token signature is invalid.
+var ErrEdDSAVerification = jws.ErrEdDSAVerification
+
+// LoadPrivateKey reads a PEM encoded RSA, ECDSA or Ed25519 private key from
+// the file at path.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(b)
+}
+
+// LoadPublicKey reads a PEM encoded RSA, ECDSA or Ed25519 public key from the
+// file at path.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKeyPEM(b)
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded private key, either PKCS #8
+// ("PRIVATE KEY"), PKCS #1 ("RSA PRIVATE KEY") or SEC 1 ("EC PRIVATE KEY").
+func ParsePrivateKeyPEM(b []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("jwt: no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("jwt: unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("jwt: unsupported PEM block %q", block.Type)
+}
+
+// ParsePublicKeyPEM parses a PEM encoded public key, either PKIX ("PUBLIC
+// KEY") or PKCS #1 ("RSA PUBLIC KEY").
+func ParsePublicKeyPEM(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("jwt: no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("jwt: unsupported PEM block %q", block.Type)
+}
+
+// zeroPrivateKey overwrites the secret parts of the given key, best effort.
+func zeroPrivateKey(key crypto.Signer) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		k.D.SetInt64(0)
+		for _, p := range k.Primes {
+			p.SetInt64(0)
+		}
+	case *ecdsa.PrivateKey:
+		k.D.SetInt64(0)
+	case ed25519.PrivateKey:
+		for i := range k {
+			k[i] = 0
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestSessionWithLeeway(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Leeway: 5 * time.Second}
+	c, err := js.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expire the credentials 30 seconds ago.
+	exp := float64(time.Now().Add(-30 * time.Second).Unix())
+	edit := func(claims map[string]interface{}) { claims["exp"] = exp }
+	expired := &palermo.SessionCredentials{
+		AuthToken:       resign(t, c.AuthToken, edit),
+		ValidationToken: resign(t, c.ValidationToken, edit),
+	}
+	if _, err := js.Session(ctx, expired); err == nil {
+		t.Fatal("Session() accepted credentials expired beyond the default leeway")
+	}
+
+	tests := []struct {
+		name    string
+		creds   *palermo.SessionCredentials
+		leeway  time.Duration
+		wantErr bool
+	}{
+		{"valid with zero leeway", c, 0, false},
+		{"slightly expired with generous leeway", expired, 2 * time.Minute, false},
+		{"slightly expired with zero leeway", expired, 0, true},
+		{"slightly expired with short leeway", expired, 10 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := js.SessionWithLeeway(ctx, tt.creds, tt.leeway)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SessionWithLeeway() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if _, ok := err.(*jwt.SkewError); !ok {
+					t.Errorf("got %T, want *jwt.SkewError", err)
+				}
+				return
+			}
+			if s.UserID != "u1" {
+				t.Errorf("got session of %q", s.UserID)
+			}
+		})
+	}
+
+	if _, err := js.SessionWithLeeway(ctx, c, -time.Second); err != jwt.ErrNegativeLeeway {
+		t.Errorf("SessionWithLeeway() = %v, want %v", err, jwt.ErrNegativeLeeway)
+	}
+}
@@ -0,0 +1,55 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestCheckLifetime(t *testing.T) {
+	ctx := context.Background()
+	issuer := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour}
+	c, err := issuer.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lifetime returns c with its expiry moved to d after its issuance.
+	lifetime := func(d time.Duration) *palermo.SessionCredentials {
+		edit := func(claims map[string]interface{}) {
+			claims["exp"] = claims["iat"].(float64) + d.Seconds()
+		}
+		return &palermo.SessionCredentials{
+			AuthToken:       resign(t, c.AuthToken, edit),
+			ValidationToken: resign(t, c.ValidationToken, edit),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		creds   *palermo.SessionCredentials
+		check   bool
+		wantErr error
+	}{
+		{"normally minted", c, true, nil},
+		{"shorter lifetime", lifetime(time.Minute), true, nil},
+		{"lifetime within leeway", lifetime(time.Hour + 30*time.Second), true, nil},
+		{"oversized lifetime", lifetime(30 * 24 * time.Hour), true, jwt.ErrLifetimeTooLong},
+		{"lifetime beyond leeway", lifetime(time.Hour + 2*time.Minute), true, jwt.ErrLifetimeTooLong},
+		{"oversized lifetime unchecked", lifetime(30 * 24 * time.Hour), false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Leeway: time.Minute, CheckLifetime: tt.check}
+			if _, err := js.Session(ctx, tt.creds); err != tt.wantErr {
+				t.Errorf("Session() = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := js.RefreshSession(ctx, tt.creds); err != tt.wantErr {
+				t.Errorf("RefreshSession() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
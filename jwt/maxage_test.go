@@ -0,0 +1,69 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestSessionMaxAge(t *testing.T) {
+	ctx := context.Background()
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour}
+	c, err := js.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// issuedAgo returns c as if issued d ago, still valid for the hour.
+	issuedAgo := func(d time.Duration) *palermo.SessionCredentials {
+		iat := float64(time.Now().Add(-d).Unix())
+		edit := func(claims map[string]interface{}) { claims["iat"] = iat }
+		return &palermo.SessionCredentials{
+			AuthToken:       resign(t, c.AuthToken, edit),
+			ValidationToken: resign(t, c.ValidationToken, edit),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		creds   *palermo.SessionCredentials
+		maxAge  time.Duration
+		wantErr error
+	}{
+		{"fresh token", c, 2 * time.Minute, nil},
+		{"recent token", issuedAgo(time.Minute), 2 * time.Minute, nil},
+		{"older than max age", issuedAgo(10 * time.Minute), 2 * time.Minute, jwt.ErrTokenTooOld},
+		{"older with a looser max age", issuedAgo(10 * time.Minute), 15 * time.Minute, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The credentials are valid regardless of their age.
+			if _, err := js.Session(ctx, tt.creds); err != nil {
+				t.Fatalf("Session() = %v", err)
+			}
+
+			s, err := js.SessionMaxAge(ctx, tt.creds, tt.maxAge)
+			if err != tt.wantErr {
+				t.Fatalf("SessionMaxAge() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && s.UserID != "u1" {
+				t.Errorf("got session of %q", s.UserID)
+			}
+		})
+	}
+
+	expired, err := (&jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, TestMode: true}).CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.SessionMaxAge(ctx, expired, 24*time.Hour*365*100); err == nil {
+		t.Error("SessionMaxAge() accepted expired credentials")
+	}
+
+	if _, err := js.SessionMaxAge(ctx, c, -time.Minute); err != jwt.ErrNegativeMaxAge {
+		t.Errorf("SessionMaxAge() = %v, want %v", err, jwt.ErrNegativeMaxAge)
+	}
+}
@@ -0,0 +1,102 @@
+package jwt_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+func TestSessionServiceMetrics(t *testing.T) {
+	ctx := context.Background()
+	user := &palermo.Session{UserID: "u1", Email: "u1@example.com"}
+
+	tests := []struct {
+		name      string
+		call      func(js *jwt.SessionService) error
+		wantCalls []palermotest.Metric
+	}{
+		{"create", func(js *jwt.SessionService) error {
+			_, err := js.CreateSession(ctx, user)
+			return err
+		}, []palermotest.Metric{
+			{Kind: "counter", Name: "palermo_tokens_issued_total", Value: 1},
+		}},
+		{"failed validate", func(js *jwt.SessionService) error {
+			_, err := js.Session(ctx, &palermo.SessionCredentials{AuthToken: "forged", ValidationToken: "forged"})
+			if err == nil {
+				t.Error("Session() accepted forged credentials")
+			}
+			return nil
+		}, []palermotest.Metric{
+			{Kind: "counter", Name: "palermo_tokens_validated_total", Value: 1, Labels: map[string]string{"result": "error"}},
+		}},
+		{"create and validate", func(js *jwt.SessionService) error {
+			c, err := js.CreateSession(ctx, user)
+			if err != nil {
+				return err
+			}
+			_, err = js.Session(ctx, c)
+			return err
+		}, []palermotest.Metric{
+			{Kind: "counter", Name: "palermo_tokens_issued_total", Value: 1},
+			{Kind: "counter", Name: "palermo_tokens_validated_total", Value: 1, Labels: map[string]string{"result": "ok"}},
+		}},
+		{"create and validate with max age", func(js *jwt.SessionService) error {
+			c, err := js.CreateSession(ctx, user)
+			if err != nil {
+				return err
+			}
+			_, err = js.SessionMaxAge(ctx, c, time.Minute)
+			return err
+		}, []palermotest.Metric{
+			{Kind: "counter", Name: "palermo_tokens_issued_total", Value: 1},
+			{Kind: "counter", Name: "palermo_tokens_validated_total", Value: 1, Labels: map[string]string{"result": "ok"}},
+		}},
+		{"create and validate as of now", func(js *jwt.SessionService) error {
+			c, err := js.CreateSession(ctx, user)
+			if err != nil {
+				return err
+			}
+			_, err = js.SessionAsOf(ctx, c, time.Now())
+			return err
+		}, []palermotest.Metric{
+			{Kind: "counter", Name: "palermo_tokens_issued_total", Value: 1},
+			{Kind: "counter", Name: "palermo_tokens_validated_total", Value: 1, Labels: map[string]string{"result": "ok"}},
+		}},
+		{"failed validate as of an instant", func(js *jwt.SessionService) error {
+			_, err := js.SessionAsOf(ctx, &palermo.SessionCredentials{AuthToken: "forged", ValidationToken: "forged"}, time.Now().Add(-time.Hour))
+			if err == nil {
+				t.Error("SessionAsOf() accepted forged credentials")
+			}
+			return nil
+		}, []palermotest.Metric{
+			{Kind: "counter", Name: "palermo_tokens_validated_total", Value: 1, Labels: map[string]string{"result": "error"}},
+		}},
+		{"failed validate with max age", func(js *jwt.SessionService) error {
+			_, err := js.SessionMaxAge(ctx, &palermo.SessionCredentials{AuthToken: "forged", ValidationToken: "forged"}, time.Minute)
+			if err == nil {
+				t.Error("SessionMaxAge() accepted forged credentials")
+			}
+			return nil
+		}, []palermotest.Metric{
+			{Kind: "counter", Name: "palermo_tokens_validated_total", Value: 1, Labels: map[string]string{"result": "error"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &palermotest.Metrics{}
+			js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute, Metrics: metrics}
+			if err := tt.call(js); err != nil {
+				t.Fatal(err)
+			}
+			if got := metrics.Calls(); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("got metrics %+v, want %+v", got, tt.wantCalls)
+			}
+		})
+	}
+}
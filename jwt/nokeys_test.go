@@ -0,0 +1,47 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestNoKeysConfigured(t *testing.T) {
+	ctx := context.Background()
+	user := &palermo.Session{UserID: "u1", Email: "u1@example.com"}
+
+	minted, err := (&jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute}).CreateSession(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		js   *jwt.SessionService
+	}{
+		{"no secret", &jwt.SessionService{MaxAge: time.Minute}},
+		{"empty secret", &jwt.SessionService{SecretKey: []byte{}, MaxAge: time.Minute}},
+		{"asymmetric without keys", &jwt.SessionService{SigningMethod: jwt.SigningMethodES256, MaxAge: time.Minute}},
+		{"previous secrets only", &jwt.SessionService{PreviousSecretKeys: [][]byte{testKey}, MaxAge: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.js.Session(ctx, minted); err != jwt.ErrNoKeysConfigured {
+				t.Errorf("Session() = %v, want %v", err, jwt.ErrNoKeysConfigured)
+			}
+			if _, err := tt.js.RefreshSession(ctx, minted); err != jwt.ErrNoKeysConfigured {
+				t.Errorf("RefreshSession() = %v, want %v", err, jwt.ErrNoKeysConfigured)
+			}
+			if _, err := tt.js.CreateSession(ctx, user); err != jwt.ErrNoKeysConfigured {
+				t.Errorf("CreateSession() = %v, want %v", err, jwt.ErrNoKeysConfigured)
+			}
+		})
+	}
+
+	if _, err := jwt.NewSessionService(nil, time.Minute); err != jwt.ErrNoKeysConfigured {
+		t.Errorf("NewSessionService() = %v, want %v", err, jwt.ErrNoKeysConfigured)
+	}
+}
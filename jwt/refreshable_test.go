@@ -0,0 +1,69 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestRefreshableAt(t *testing.T) {
+	ctx := context.Background()
+	issuer := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour}
+	c, err := issuer.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// issuedAgo returns c as if issued d ago.
+	issuedAgo := func(d time.Duration) *palermo.SessionCredentials {
+		iat := time.Now().Add(-d).Unix()
+		edit := func(claims map[string]interface{}) {
+			claims["iat"] = float64(iat)
+			claims["exp"] = float64(iat + int64(time.Hour/time.Second))
+		}
+		return &palermo.SessionCredentials{
+			AuthToken:       resign(t, c.AuthToken, edit),
+			ValidationToken: resign(t, c.ValidationToken, edit),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		creds   *palermo.SessionCredentials
+		window  time.Duration
+		wantErr error
+	}{
+		{"before the window", c, 10 * time.Minute, jwt.ErrRefreshTooEarly},
+		{"just before the window", issuedAgo(49 * time.Minute), 10 * time.Minute, jwt.ErrRefreshTooEarly},
+		{"within the window", issuedAgo(55 * time.Minute), 10 * time.Minute, nil},
+		{"window of the whole lifetime", c, time.Hour, nil},
+		{"without window", c, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, RefreshWindow: tt.window}
+			s, err := js.Session(ctx, tt.creds)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want time.Time
+			if tt.window > 0 {
+				want = s.ExpiresAt.Add(-tt.window)
+			}
+			if !s.RefreshableAt.Equal(want) {
+				t.Errorf("RefreshableAt = %v, want %v", s.RefreshableAt, want)
+			}
+			if now := time.Now(); (tt.wantErr != nil) != now.Before(s.RefreshableAt) {
+				t.Errorf("RefreshableAt %v inconsistent with refreshing at %v", s.RefreshableAt, now)
+			}
+
+			if _, err := js.RefreshSession(ctx, tt.creds); err != tt.wantErr {
+				t.Errorf("RefreshSession() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultRemoteKeysRefreshInterval is how often remote keys are fetched again
+// when no RefreshInterval is set.
+const DefaultRemoteKeysRefreshInterval = 10 * time.Minute
+
+// remoteKeysMinRefetch bounds how often unknown key ids trigger a fetch, so
+// tokens forged with random key ids cannot hammer the remote endpoint. It also
+// caps the delay between retries of a failing endpoint.
+const remoteKeysMinRefetch = time.Minute
+
+// remoteKeysRetryDelay is how long fetches wait after a failed fetch, doubled
+// after each further failure up to remoteKeysMinRefetch.
+const remoteKeysRetryDelay = time.Second
+
+// ErrRemoteKeysUnavailable is returned when the remote keys could not be
+// fetched and none were cached.
+var ErrRemoteKeysUnavailable = errors.New("jwt: remote keys unavailable")
+
+// RemoteKeySet fetches verification keys from a remote JWKS URL, e.g. the one
+// published by another palermo instance or by an identity provider, and
+// caches them.
+//
+// Concurrent fetches are shared, and run without blocking the validations
+// served from the cached keys. Each caller stops waiting for a shared fetch
+// when its own context is done.
+type RemoteKeySet struct {
+	// URL is the address of the JSON Web Key Set.
+	URL string
+
+	// RefreshInterval is how long fetched keys are cached. Defaults to
+	// DefaultRemoteKeysRefreshInterval.
+	RefreshInterval time.Duration
+
+	// Client fetches the keys. Defaults to a client with a 10 seconds
+	// timeout.
+	Client *http.Client
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// Logger receives the fetch failures. Defaults to palermo.NopLogger.
+	Logger palermo.Logger
+
+	group singleflight.Group
+
+	mu          sync.Mutex
+	keys        []JWK
+	fetchedAt   time.Time // last successful fetch
+	attemptedAt time.Time // last fetch, successful or not
+	failures    int       // consecutive failed fetches
+}
+
+// Key returns the public key with the given id able to verify tokens signed
+// with alg. Keys are fetched again once stale, or when the id is unknown. A
+// failed fetch keeps the cached keys in use, and is retried with an
+// exponential backoff.
+func (rks *RemoteKeySet) Key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	now := rks.now()
+	if rks.due(now, false) {
+		rks.fetch(ctx, now, false)
+	}
+
+	k, cached := rks.find(kid, alg)
+	if k == nil && rks.due(now, true) {
+		rks.fetch(ctx, now, true)
+		k, cached = rks.find(kid, alg)
+	}
+
+	if k == nil {
+		if !cached {
+			return nil, ErrRemoteKeysUnavailable
+		}
+		return nil, ErrUnknownKey
+	}
+	return k.PublicKey()
+}
+
+// Check fetches the keys when stale, and returns ErrRemoteKeysUnavailable
+// when none could ever be fetched. It implements palermo.HealthChecker.
+func (rks *RemoteKeySet) Check(ctx context.Context) error {
+	now := rks.now()
+	if rks.due(now, false) {
+		rks.fetch(ctx, now, false)
+	}
+
+	rks.mu.Lock()
+	defer rks.mu.Unlock()
+	if rks.keys == nil {
+		return ErrRemoteKeysUnavailable
+	}
+	return nil
+}
+
+// due reports whether the keys should be fetched at now: once stale, or at
+// most every remoteKeysMinRefetch for an unknown key id, but never before the
+// backoff of the last failed fetch is over.
+func (rks *RemoteKeySet) due(now time.Time, unknownKey bool) bool {
+	rks.mu.Lock()
+	defer rks.mu.Unlock()
+
+	if rks.failures > 0 && now.Sub(rks.attemptedAt) < rks.backoff() {
+		return false
+	}
+	if unknownKey {
+		return rks.attemptedAt.IsZero() || now.Sub(rks.attemptedAt) > remoteKeysMinRefetch
+	}
+	return rks.fetchedAt.IsZero() || now.Sub(rks.fetchedAt) > rks.refreshInterval()
+}
+
+// backoff returns how long to wait after the last failed fetch.
+func (rks *RemoteKeySet) backoff() time.Duration {
+	d := remoteKeysRetryDelay
+	for i := 1; i < rks.failures && d < remoteKeysMinRefetch; i++ {
+		d *= 2
+	}
+	if d > remoteKeysMinRefetch {
+		d = remoteKeysMinRefetch
+	}
+	return d
+}
+
+// find returns the key with the given id compatible with alg, and whether any
+// keys were cached. Tokens without key id match a key set holding a single
+// compatible key.
+func (rks *RemoteKeySet) find(kid, alg string) (*JWK, bool) {
+	rks.mu.Lock()
+	defer rks.mu.Unlock()
+
+	var match *JWK
+	for i := range rks.keys {
+		k := &rks.keys[i]
+		if !k.compatible(alg) || k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if kid != "" && k.Kid == kid {
+			return k, true
+		}
+		if kid == "" {
+			if match != nil {
+				return nil, true
+			}
+			match = k
+		}
+	}
+	return match, rks.keys != nil
+}
+
+// fetch fetches the keys when still due, joining the fetch in flight if any,
+// until done or ctx is done. The fetch itself runs with the context of the
+// caller that started it; one aborted by that context is not counted as a
+// failure.
+func (rks *RemoteKeySet) fetch(ctx context.Context, now time.Time, unknownKey bool) {
+	ch := rks.group.DoChan("", func() (interface{}, error) {
+		// Another fetch may have completed since due was checked.
+		if !rks.due(now, unknownKey) {
+			return nil, nil
+		}
+		set, err := rks.get(ctx)
+
+		rks.mu.Lock()
+		defer rks.mu.Unlock()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			rks.logger().Warn("jwt: failed to fetch remote keys", palermo.Fields{
+				"url":   rks.URL,
+				"error": err.Error(),
+			})
+			// Keep the cached keys in use until a fetch succeeds.
+			rks.attemptedAt = now
+			rks.failures++
+			return nil, err
+		}
+
+		rks.keys = set.Keys
+		rks.fetchedAt = now
+		rks.attemptedAt = now
+		rks.failures = 0
+		return nil, nil
+	})
+
+	select {
+	case <-ch:
+	case <-ctx.Done():
+	}
+}
+
+func (rks *RemoteKeySet) get(ctx context.Context) (*JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rks.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rks.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwt: fetching remote keys: %s", resp.Status)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	if set.Keys == nil {
+		set.Keys = []JWK{}
+	}
+	return &set, nil
+}
+
+func (rks *RemoteKeySet) refreshInterval() time.Duration {
+	if rks.RefreshInterval > 0 {
+		return rks.RefreshInterval
+	}
+	return DefaultRemoteKeysRefreshInterval
+}
+
+func (rks *RemoteKeySet) client() *http.Client {
+	if rks.Client != nil {
+		return rks.Client
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+func (rks *RemoteKeySet) now() time.Time {
+	if rks.Now != nil {
+		return rks.Now()
+	}
+	return time.Now()
+}
+
+func (rks *RemoteKeySet) logger() palermo.Logger {
+	if rks.Logger == nil {
+		return palermo.NopLogger{}
+	}
+	return rks.Logger
+}
@@ -0,0 +1,119 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo/jwt"
+)
+
+// jwksTransport serves an empty key set, or fails while down, counting the
+// fetches. When hold is set, fetches wait on it.
+type jwksTransport struct {
+	fetches int32
+	down    int32
+	hold    chan struct{}
+}
+
+func (jt *jwksTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&jt.fetches, 1)
+	if jt.hold != nil {
+		<-jt.hold
+	}
+	if atomic.LoadInt32(&jt.down) != 0 {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       ioutil.NopCloser(strings.NewReader(`{"keys":[]}`)),
+		Request:    r,
+	}, nil
+}
+
+func TestRemoteKeySetUnreachable(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := &jwksTransport{down: 1}
+	rks := &jwt.RemoteKeySet{
+		URL:    "https://idp.example.com/jwks.json",
+		Client: &http.Client{Transport: tr},
+		Now:    func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	// key calls Key at the given offset from the start of the test and
+	// checks the number of fetches made so far.
+	start := now
+	key := func(offset time.Duration, wantErr error, wantFetches int32) {
+		t.Helper()
+		now = start.Add(offset)
+		if _, err := rks.Key(ctx, "k1", "ES256"); err != wantErr {
+			t.Errorf("Key() at %v = %v, want %v", offset, err, wantErr)
+		}
+		if got := atomic.LoadInt32(&tr.fetches); got != wantFetches {
+			t.Errorf("%d fetches at %v, want %d", got, offset, wantFetches)
+		}
+	}
+
+	// Failed fetches are retried after 1s, 2s, 4s...
+	key(0, jwt.ErrRemoteKeysUnavailable, 1)
+	key(0, jwt.ErrRemoteKeysUnavailable, 1)
+	key(500*time.Millisecond, jwt.ErrRemoteKeysUnavailable, 1)
+	key(time.Second, jwt.ErrRemoteKeysUnavailable, 2)
+	key(2*time.Second, jwt.ErrRemoteKeysUnavailable, 2)
+	key(3*time.Second, jwt.ErrRemoteKeysUnavailable, 3)
+	for i := 0; i < 1000; i++ {
+		now = start.Add(3*time.Second + time.Duration(i)*100*time.Millisecond)
+		rks.Key(ctx, "k1", "ES256")
+	}
+	// Then at 7s, 15s, 31s and 63s, the backoff being capped to a minute.
+	if got := atomic.LoadInt32(&tr.fetches); got != 7 {
+		t.Errorf("%d fetches in 103s, want 7", got)
+	}
+
+	// Once the endpoint is back, the keys are fetched after the backoff.
+	atomic.StoreInt32(&tr.down, 0)
+	n := atomic.LoadInt32(&tr.fetches)
+	key(10*time.Minute, jwt.ErrUnknownKey, n+1)
+	key(10*time.Minute, jwt.ErrUnknownKey, n+1)
+}
+
+func TestRemoteKeySetSharedFetch(t *testing.T) {
+	tr := &jwksTransport{down: 1, hold: make(chan struct{})}
+	rks := &jwt.RemoteKeySet{URL: "https://idp.example.com/jwks.json", Client: &http.Client{Transport: tr}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rks.Key(context.Background(), "k1", "ES256"); err != jwt.ErrRemoteKeysUnavailable {
+				t.Errorf("Key() = %v, want %v", err, jwt.ErrRemoteKeysUnavailable)
+			}
+		}()
+	}
+
+	for atomic.LoadInt32(&tr.fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A caller gives up on the fetch in flight when its context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := rks.Key(ctx, "k1", "ES256"); err != jwt.ErrRemoteKeysUnavailable {
+		t.Errorf("Key() = %v, want %v", err, jwt.ErrRemoteKeysUnavailable)
+	}
+
+	close(tr.hold)
+	wg.Wait()
+	if got := atomic.LoadInt32(&tr.fetches); got != 1 {
+		t.Errorf("%d fetches, want 1", got)
+	}
+}
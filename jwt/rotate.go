@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"time"
+)
+
+// rotatedKey is a secret replaced by RotateSecretKey, or the public part of a
+// private key replaced by RotatePrivateKey, still verifying the tokens it
+// signed until they expire.
+type rotatedKey struct {
+	key    []byte
+	public crypto.PublicKey
+	until  time.Time
+}
+
+// RotateSecretKey replaces SecretKey with key, e.g. when a new secret is
+// fetched from a secret store. Tokens signed with the replaced secret stay
+// valid until they expire, after which the secret is dropped. It only
+// applies to HS256 tokens signed with SecretKey, not with a keyring or a
+// Signer.
+func (uss *SessionService) RotateSecretKey(key []byte) error {
+	if uss.asymmetric() || len(uss.Keyring) > 0 || uss.Signer != nil {
+		return &ConfigError{Field: "SecretKey", Reason: "rotation requires SigningMethodHS256 without keyring nor Signer"}
+	}
+	if len(key) == 0 {
+		return &ConfigError{Field: "SecretKey", Reason: "empty secret"}
+	}
+
+	uss.mu.Lock()
+	defer uss.mu.Unlock()
+
+	if uss.closed {
+		return ErrClosed
+	}
+	if subtle.ConstantTimeCompare(key, uss.SecretKey) == 1 {
+		return nil
+	}
+
+	uss.retire(rotatedKey{key: uss.SecretKey})
+	uss.SecretKey = append([]byte(nil), key...)
+	return nil
+}
+
+// RotatePrivateKey replaces PrivateKey with key, e.g. when a new key file is
+// deployed. Tokens signed with the replaced key stay valid until they
+// expire, after which its public part is dropped. It only applies to
+// asymmetric signing methods with PrivateKey, not with an explicit
+// PublicKey, a keyring or a Signer. Published JWKS only hold the new key.
+func (uss *SessionService) RotatePrivateKey(key crypto.Signer) error {
+	if !uss.asymmetric() || uss.PublicKey != nil || len(uss.Keyring) > 0 || uss.Signer != nil {
+		return &ConfigError{Field: "PrivateKey", Reason: "rotation requires an asymmetric SigningMethod without PublicKey, keyring nor Signer"}
+	}
+	if key == nil {
+		return &ConfigError{Field: "PrivateKey", Reason: "missing key"}
+	}
+
+	uss.mu.Lock()
+	defer uss.mu.Unlock()
+
+	if uss.closed {
+		return ErrClosed
+	}
+	if uss.PrivateKey != nil {
+		type equaler interface {
+			Equal(crypto.PublicKey) bool
+		}
+		if pub, ok := uss.PrivateKey.Public().(equaler); ok && pub.Equal(key.Public()) {
+			return nil
+		}
+		uss.retire(rotatedKey{public: uss.PrivateKey.Public()})
+		zeroPrivateKey(uss.PrivateKey)
+	}
+	uss.PrivateKey = key
+	return nil
+}
+
+// retire keeps rk verifying tokens for as long as the tokens it signed may
+// live, and drops the rotated keys that expired. uss.mu must be held.
+func (uss *SessionService) retire(rk rotatedKey) {
+	now := uss.now()
+	var kept []rotatedKey
+	for _, k := range uss.rotated {
+		if now.Before(k.until) {
+			kept = append(kept, k)
+			continue
+		}
+		zeroBytes(k.key)
+	}
+	rk.until = now.Add(uss.longestMaxAge() + uss.Leeway)
+	uss.rotated = append(kept, rk)
+}
+
+// rotatedKeys returns the rotated secrets still verifying tokens, most
+// recent first.
+func (uss *SessionService) rotatedKeys() [][]byte {
+	now := uss.now()
+	var keys [][]byte
+	for i := len(uss.rotated) - 1; i >= 0; i-- {
+		if rk := uss.rotated[i]; rk.key != nil && now.Before(rk.until) {
+			keys = append(keys, rk.key)
+		}
+	}
+	return keys
+}
+
+// rotatedPublicKeys returns the public parts of the rotated private keys
+// still verifying tokens, most recent first.
+func (uss *SessionService) rotatedPublicKeys() []crypto.PublicKey {
+	now := uss.now()
+	var keys []crypto.PublicKey
+	for i := len(uss.rotated) - 1; i >= 0; i-- {
+		if rk := uss.rotated[i]; rk.public != nil && now.Before(rk.until) {
+			keys = append(keys, rk.public)
+		}
+	}
+	return keys
+}
+
+// longestMaxAge returns the lifetime of the longest lived tokens.
+func (uss *SessionService) longestMaxAge() time.Duration {
+	d := uss.MaxAge
+	if uss.AnonymousMaxAge > d {
+		d = uss.AnonymousMaxAge
+	}
+	if uss.ServiceAccountMaxAge > d {
+		d = uss.ServiceAccountMaxAge
+	}
+	if uss.RefreshMaxAge > d {
+		d = uss.RefreshMaxAge
+	}
+	return d
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,180 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/go-toschool/palermo/internal/jws"
+)
+
+// ErrUnsupportedSigner is returned when a Signer cannot produce signatures
+// for the requested signing method.
+var ErrUnsupportedSigner = errors.New("jwt: signing method unsupported by signer")
+
+// Signer signs tokens. It lets the signing key live outside of the process,
+// e.g. in a KMS, so that it never sits in memory.
+type Signer interface {
+	// Algorithm returns the signing method of the signatures, e.g.
+	// SigningMethodES256.
+	Algorithm() string
+
+	// KeyID returns the id of the signing key, set in the kid header of the
+	// tokens it signs unless empty.
+	KeyID() string
+
+	// Public returns the public key verifying the signatures.
+	Public() crypto.PublicKey
+
+	// Sign returns the JWS signature of the given signing input.
+	Sign(ctx context.Context, signingInput []byte) ([]byte, error)
+}
+
+// LocalSigner implements Signer with a key held in memory.
+type LocalSigner struct {
+	// Method is the signing method of Key.
+	Method string
+
+	// ID is the id of Key, if any.
+	ID string
+
+	// Key is a []byte secret for SigningMethodHS256, or an *rsa.PrivateKey,
+	// *ecdsa.PrivateKey or ed25519.PrivateKey matching Method.
+	Key interface{}
+}
+
+// Algorithm returns the signing method of the signer.
+func (ls *LocalSigner) Algorithm() string {
+	return ls.Method
+}
+
+// KeyID returns the id of the signing key.
+func (ls *LocalSigner) KeyID() string {
+	return ls.ID
+}
+
+// Public returns the public key of asymmetric keys, and nil for secrets.
+func (ls *LocalSigner) Public() crypto.PublicKey {
+	if k, ok := ls.Key.(crypto.Signer); ok {
+		return k.Public()
+	}
+	return nil
+}
+
+// Sign returns the JWS signature of the given signing input.
+func (ls *LocalSigner) Sign(ctx context.Context, signingInput []byte) ([]byte, error) {
+	return jws.Signature(ls.Method, signingInput, ls.Key)
+}
+
+// KMSClient signs digests with asymmetric keys held by a key management
+// service, e.g. the Sign API of AWS KMS (with the DIGEST message type) or
+// the AsymmetricSign API of GCP Cloud KMS. Implementations are thin adapters
+// over the SDK of the provider.
+type KMSClient interface {
+	// Sign returns the signature of the given SHA-256 digest by the key
+	// named keyName: PKCS #1 v1.5 for RSA keys, ASN.1 DER encoded for ECDSA
+	// keys, as KMS APIs return them.
+	Sign(ctx context.Context, keyName string, digest []byte) ([]byte, error)
+
+	// PublicKey returns the public key of the key named keyName.
+	PublicKey(ctx context.Context, keyName string) (crypto.PublicKey, error)
+}
+
+// KMSSigner implements Signer with a key held by a key management service.
+// It supports SigningMethodRS256 and SigningMethodES256 keys.
+type KMSSigner struct {
+	client  KMSClient
+	keyName string
+	method  string
+	id      string
+	pub     crypto.PublicKey
+}
+
+// NewKMSSigner returns a signer using the KMS key named keyName, e.g. an AWS
+// key ARN or a GCP key version resource name, with the given signing method
+// and key id. The public key is fetched once, up front.
+func NewKMSSigner(ctx context.Context, client KMSClient, keyName, method, kid string) (*KMSSigner, error) {
+	if method != SigningMethodRS256 && method != SigningMethodES256 {
+		return nil, ErrUnsupportedSigner
+	}
+
+	pub, err := client.PublicKey(ctx, keyName)
+	if err != nil {
+		return nil, err
+	}
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		if method != SigningMethodRS256 {
+			return nil, ErrUnsupportedSigner
+		}
+	case *ecdsa.PublicKey:
+		if method != SigningMethodES256 || p.Curve != elliptic.P256() {
+			return nil, ErrUnsupportedSigner
+		}
+	default:
+		return nil, ErrUnsupportedSigner
+	}
+
+	return &KMSSigner{
+		client:  client,
+		keyName: keyName,
+		method:  method,
+		id:      kid,
+		pub:     pub,
+	}, nil
+}
+
+// Algorithm returns the signing method of the signer.
+func (ks *KMSSigner) Algorithm() string {
+	return ks.method
+}
+
+// KeyID returns the id of the signing key.
+func (ks *KMSSigner) KeyID() string {
+	return ks.id
+}
+
+// Public returns the public key of the KMS key.
+func (ks *KMSSigner) Public() crypto.PublicKey {
+	return ks.pub
+}
+
+// Sign returns the JWS signature of the given signing input, signed by the
+// KMS.
+func (ks *KMSSigner) Sign(ctx context.Context, signingInput []byte) ([]byte, error) {
+	digest := sha256.Sum256(signingInput)
+	sig, err := ks.client.Sign(ctx, ks.keyName, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := ks.pub.(*ecdsa.PublicKey)
+	if !ok {
+		return sig, nil
+	}
+
+	// JWS ECDSA signatures are the concatenation of r and s (RFC 7518,
+	// section 3.4) rather than their DER encoding.
+	var rs struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(sig, &rs); err != nil || len(rest) > 0 {
+		return nil, errors.New("jwt: malformed KMS ECDSA signature")
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	if rs.R.Sign() <= 0 || rs.S.Sign() <= 0 || rs.R.BitLen() > size*8 || rs.S.BitLen() > size*8 {
+		return nil, errors.New("jwt: malformed KMS ECDSA signature")
+	}
+
+	raw := make([]byte, 2*size)
+	r, s := rs.R.Bytes(), rs.S.Bytes()
+	copy(raw[size-len(r):size], r)
+	copy(raw[2*size-len(s):], s)
+	return raw, nil
+}
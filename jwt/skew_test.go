@@ -0,0 +1,71 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestSkewError(t *testing.T) {
+	ctx := context.Background()
+	issuer := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute, TestMode: true}
+	iat := jwt.TestModeTime
+	exp := iat.Add(time.Minute)
+	nbf := iat.Add(30 * time.Second)
+
+	c, err := issuer.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delayed, err := issuer.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com", NotBefore: nbf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Minute, Leeway: 5 * time.Second}
+
+	tests := []struct {
+		name          string
+		creds         *palermo.SessionCredentials
+		at            time.Time
+		wantSkew      bool
+		wantNotBefore time.Time
+	}{
+		{"valid", c, iat.Add(30 * time.Second), false, time.Time{}},
+		{"expired within leeway", c, exp.Add(4 * time.Second), false, time.Time{}},
+		{"expired", c, exp.Add(10 * time.Second), true, time.Time{}},
+		{"issued ahead within leeway", c, iat.Add(-4 * time.Second), false, time.Time{}},
+		{"issued ahead", c, iat.Add(-10 * time.Second), true, time.Time{}},
+		{"not valid yet within leeway", delayed, nbf.Add(-4 * time.Second), false, time.Time{}},
+		{"not valid yet", delayed, nbf.Add(-10 * time.Second), true, nbf},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := js.SessionAsOf(ctx, tt.creds, tt.at)
+			if !tt.wantSkew {
+				if err != nil {
+					t.Fatalf("SessionAsOf() = %v", err)
+				}
+				return
+			}
+
+			se, ok := err.(*jwt.SkewError)
+			if !ok {
+				t.Fatalf("SessionAsOf() = %#v, want a *jwt.SkewError", err)
+			}
+			if !se.Now.Equal(tt.at) || se.Leeway != js.Leeway {
+				t.Errorf("got now %v and leeway %v, want %v and %v", se.Now, se.Leeway, tt.at, js.Leeway)
+			}
+			if !se.IssuedAt.Equal(iat) || !se.ExpiresAt.Equal(exp) || !se.NotBefore.Equal(tt.wantNotBefore) {
+				t.Errorf("got iat %v, exp %v and nbf %v, want %v, %v and %v", se.IssuedAt, se.ExpiresAt, se.NotBefore, iat, exp, tt.wantNotBefore)
+			}
+			// The error message never carries the timing details.
+			if se.Error() != se.Err.Error() {
+				t.Errorf("Error() = %q, want %q", se.Error(), se.Err.Error())
+			}
+		})
+	}
+}
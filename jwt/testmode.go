@@ -0,0 +1,49 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"sync"
+	"time"
+)
+
+// ErrTestModeOutsideTests is returned by every operation of a service with
+// TestMode enabled outside of a test binary.
+var ErrTestModeOutsideTests = errors.New("jwt: TestMode enabled outside of tests, refusing to mint predictable tokens")
+
+// TestModeTime is the fixed time seen by services in TestMode.
+var TestModeTime = time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// inTest reports whether the running binary is a test binary, which registers
+// the test.v flag.
+func inTest() bool {
+	return flag.Lookup("test.v") != nil
+}
+
+// detReader is a deterministic random source: it yields the SHA-256 digests
+// of an increasing counter. It only exists to make tokens reproducible in
+// TestMode and must never back real tokens.
+type detReader struct {
+	mu  sync.Mutex
+	n   uint64
+	buf []byte
+}
+
+func (r *detReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for len(r.buf) < len(p) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], r.n)
+		r.n++
+		sum := sha256.Sum256(b[:])
+		r.buf = append(r.buf, sum[:]...)
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,90 @@
+package jwt_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestTestModeGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		js      func() *jwt.SessionService
+		session *palermo.Session
+	}{
+		{"user", func() *jwt.SessionService {
+			return &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, TestMode: true}
+		}, &palermo.Session{UserID: "u1", Email: "u1@example.com", Scopes: []string{"read"}}},
+		{"anonymous", func() *jwt.SessionService {
+			return &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, TestMode: true}
+		}, &palermo.Session{Anonymous: true}},
+		{"issuer and audience", func() *jwt.SessionService {
+			return &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Issuer: "https://auth.example.com", Audience: "api.example.com", TestMode: true}
+		}, &palermo.Session{UserID: "u1", Email: "u1@example.com"}},
+		{"derived keys with refresh token", func() *jwt.SessionService {
+			return &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, RefreshMaxAge: 24 * time.Hour, DeriveTokenKeys: true, TestMode: true}
+		}, &palermo.Session{UserID: "u1", Email: "u1@example.com"}},
+	}
+
+	golden := filepath.Join("testdata", "testmode.golden.json")
+	var want map[string][]*palermo.SessionCredentials
+	if !*update {
+		b, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &want); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := make(map[string][]*palermo.SessionCredentials)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every fresh service mints the same sequence of credentials.
+			for i := 0; i < 2; i++ {
+				js := tt.js()
+				var creds []*palermo.SessionCredentials
+				for j := 0; j < 2; j++ {
+					c, err := js.CreateSession(context.Background(), tt.session)
+					if err != nil {
+						t.Fatal(err)
+					}
+					creds = append(creds, c)
+				}
+				if *creds[0] == *creds[1] {
+					t.Error("consecutive sessions got the same credentials")
+				}
+				if i == 0 {
+					got[tt.name] = creds
+				} else if !reflect.DeepEqual(creds, got[tt.name]) {
+					t.Errorf("credentials not reproducible: %+v, then %+v", got[tt.name], creds)
+				}
+			}
+
+			if !*update && !reflect.DeepEqual(got[tt.name], want[tt.name]) {
+				t.Errorf("credentials changed:\n got %+v\nwant %+v", got[tt.name], want[tt.name])
+			}
+		})
+	}
+
+	if *update {
+		b, err := json.MarshalIndent(got, "", "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(golden, append(b, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
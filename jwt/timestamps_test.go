@@ -0,0 +1,55 @@
+package jwt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+func TestCheckTimestamps(t *testing.T) {
+	ctx := context.Background()
+	issuer := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour}
+	checked := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, CheckTimestamps: true}
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		updatedAt time.Time
+		wantErr   error
+	}{
+		{"created then updated", now.Add(-time.Hour), now, nil},
+		{"never updated", now, now, nil},
+		{"updated at expiry", now, now.Add(time.Hour), nil},
+		{"updated before created", now, now.Add(-time.Minute), jwt.ErrInconsistentTimestamps},
+		{"updated after expiry", now, now.Add(2 * time.Hour), jwt.ErrInconsistentTimestamps},
+		{"created after expiry", now.Add(2 * time.Hour), now.Add(2 * time.Hour), jwt.ErrInconsistentTimestamps},
+		{"created after expiry, updated before", now.Add(2 * time.Hour), now, jwt.ErrInconsistentTimestamps},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := issuer.CreateSession(ctx, &palermo.Session{
+				UserID:    "u1",
+				Email:     "u1@example.com",
+				CreatedAt: tt.createdAt,
+				UpdatedAt: tt.updatedAt,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := issuer.Session(ctx, c); err != nil {
+				t.Errorf("Session() without check = %v", err)
+			}
+			if _, err := checked.Session(ctx, c); err != tt.wantErr {
+				t.Errorf("Session() = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := checked.RefreshSession(ctx, c); err != tt.wantErr {
+				t.Errorf("RefreshSession() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrInvalidTransport is returned when a token cannot be decoded from its
+// transport encoding, e.g. because it was tampered with.
+var ErrInvalidTransport = errors.New("jwt: invalid token transport encoding")
+
+// Transport is a reversible encoding applied to signed tokens before they are
+// handed out, and reversed before they are validated. It keeps bearer strings
+// from being readable JWTs, e.g. when they leak into logs or referrers.
+type Transport interface {
+	Encode(token string) (string, error)
+	Decode(blob string) (string, error)
+}
+
+// AESGCMTransport encrypts tokens with AES-GCM into opaque URL-safe blobs
+// made of the nonce followed by the sealed token.
+type AESGCMTransport struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMTransport returns a transport encrypting tokens with the given
+// 16, 24 or 32-byte key.
+func NewAESGCMTransport(key []byte) (*AESGCMTransport, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCMTransport{aead: aead}, nil
+}
+
+// Encode encrypts the given token.
+func (t *AESGCMTransport) Encode(token string) (string, error) {
+	nonce := make([]byte, t.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	b := t.aead.Seal(nonce, nonce, []byte(token), nil)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Decode decrypts the given blob, failing with ErrInvalidTransport when it
+// was not produced by Encode with the same key.
+func (t *AESGCMTransport) Decode(blob string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(blob)
+	if err != nil || len(b) < t.aead.NonceSize() {
+		return "", ErrInvalidTransport
+	}
+
+	n := t.aead.NonceSize()
+	token, err := t.aead.Open(nil, b[:n], b[n:], nil)
+	if err != nil {
+		return "", ErrInvalidTransport
+	}
+	return string(token), nil
+}
+
+// jweHeader is the protected header of the JWEs produced by JWETransport.
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty"`
+}
+
+// JWETransport encrypts signed tokens into nested JWTs: compact JSON Web
+// Encryptions (RFC 7516) of the token using direct encryption with a shared
+// key ("alg": "dir") and AES-256-GCM ("enc": "A256GCM"). Unlike
+// AESGCMTransport, the tokens can be decrypted by any JOSE library holding the
+// key, so downstream services can read the claims while they stay hidden from
+// token bearers.
+type JWETransport struct {
+	aead cipher.AEAD
+}
+
+// NewJWETransport returns a transport encrypting tokens with the given 32-byte
+// key.
+func NewJWETransport(key []byte) (*JWETransport, error) {
+	if len(key) != 32 {
+		return nil, errors.New("jwt: JWE transport requires a 32-byte key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &JWETransport{aead: aead}, nil
+}
+
+// Encode encrypts the given token into a compact JWE.
+func (t *JWETransport) Encode(token string) (string, error) {
+	h, err := json.Marshal(&jweHeader{Alg: "dir", Enc: "A256GCM", Cty: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(h)
+
+	iv := make([]byte, t.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+
+	sealed := t.aead.Seal(nil, iv, []byte(token), []byte(protected))
+	n := len(sealed) - t.aead.Overhead()
+	return strings.Join([]string{
+		protected,
+		"",
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(sealed[:n]),
+		base64.RawURLEncoding.EncodeToString(sealed[n:]),
+	}, "."), nil
+}
+
+// Decode decrypts the given compact JWE, failing with ErrInvalidTransport when
+// it does not use direct AES-256-GCM encryption with the transport key.
+func (t *JWETransport) Decode(blob string) (string, error) {
+	parts := strings.Split(blob, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		return "", ErrInvalidTransport
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidTransport
+	}
+	var h jweHeader
+	if err := json.Unmarshal(b, &h); err != nil || h.Alg != "dir" || h.Enc != "A256GCM" {
+		return "", ErrInvalidTransport
+	}
+
+	iv, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(iv) != t.aead.NonceSize() {
+		return "", ErrInvalidTransport
+	}
+	c, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", ErrInvalidTransport
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil || len(tag) != t.aead.Overhead() {
+		return "", ErrInvalidTransport
+	}
+
+	token, err := t.aead.Open(nil, iv, append(c, tag...), []byte(parts[0]))
+	if err != nil {
+		return "", ErrInvalidTransport
+	}
+	return string(token), nil
+}
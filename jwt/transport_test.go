@@ -0,0 +1,119 @@
+package jwt_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/jws"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+// tamper returns s with a character in its middle replaced.
+func tamper(s string) string {
+	i := len(s) / 2
+	if s[i] == '.' {
+		i++
+	}
+	c := byte('A')
+	if s[i] == c {
+		c = 'B'
+	}
+	return s[:i] + string(c) + s[i+1:]
+}
+
+func TestTransport(t *testing.T) {
+	key := bytes.Repeat([]byte{'t'}, 32)
+	otherKey := bytes.Repeat([]byte{'o'}, 32)
+	aesgcm := func(key []byte) jwt.Transport {
+		tr, err := jwt.NewAESGCMTransport(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr
+	}
+	jwe := func(key []byte) jwt.Transport {
+		tr, err := jwt.NewJWETransport(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr
+	}
+
+	tests := []struct {
+		name      string
+		transport func(key []byte) jwt.Transport
+	}{
+		{"AES-GCM", aesgcm},
+		{"JWE", jwe},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			js := &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Transport: tt.transport(key)}
+			c, err := js.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, blob := range []string{c.AuthToken, c.ValidationToken} {
+				var claims map[string]interface{}
+				if _, err := jws.ParseUnverified(blob, &claims); err == nil {
+					t.Errorf("token readable as a JWT: %v", claims)
+				}
+				tok, err := js.Transport.Decode(blob)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if payload := strings.Split(tok, ".")[1]; strings.Contains(blob, payload) {
+					t.Errorf("token leaks its claims: %s", blob)
+				}
+			}
+
+			s, err := js.Session(ctx, c)
+			if err != nil {
+				t.Fatalf("Session() = %v", err)
+			}
+			if s.UserID != "u1" {
+				t.Errorf("got session of %q", s.UserID)
+			}
+
+			invalid := []struct {
+				name  string
+				js    *jwt.SessionService
+				creds *palermo.SessionCredentials
+			}{
+				{"tampered auth token", js, &palermo.SessionCredentials{AuthToken: tamper(c.AuthToken), ValidationToken: c.ValidationToken}},
+				{"tampered validation token", js, &palermo.SessionCredentials{AuthToken: c.AuthToken, ValidationToken: tamper(c.ValidationToken)}},
+				{"other transport key", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour, Transport: tt.transport(otherKey)}, c},
+				{"plain service", &jwt.SessionService{SecretKey: testKey, MaxAge: time.Hour}, c},
+			}
+			for _, iv := range invalid {
+				if _, err := iv.js.Session(ctx, iv.creds); err == nil {
+					t.Errorf("%s: Session() accepted the credentials", iv.name)
+				}
+			}
+
+			tr := tt.transport(key)
+			blob, err := tr.Encode("header.payload.signature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tok, err := tr.Decode(blob); err != nil || tok != "header.payload.signature" {
+				t.Errorf("Decode() = %q, %v", tok, err)
+			}
+			for _, bad := range []string{tamper(blob), "", "not-a-blob", blob + "."} {
+				if _, err := tr.Decode(bad); err != jwt.ErrInvalidTransport {
+					t.Errorf("Decode(%q) = %v, want %v", bad, err, jwt.ErrInvalidTransport)
+				}
+			}
+		})
+	}
+
+	if _, err := jwt.NewJWETransport(key[:16]); err == nil {
+		t.Error("NewJWETransport() accepted a 16-byte key")
+	}
+}
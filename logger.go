@@ -0,0 +1,37 @@
+package palermo
+
+// Fields annotates log entries.
+type Fields map[string]interface{}
+
+// Logger receives the log entries of palermo components. Like Metrics and
+// Tracer, it keeps the core packages independent from the logging library,
+// so that embedders can route the entries into their own pipeline.
+type Logger interface {
+	Debug(msg string, fields Fields)
+	Info(msg string, fields Fields)
+	Warn(msg string, fields Fields)
+	Error(msg string, fields Fields)
+
+	// With returns a logger adding fields to every entry.
+	With(fields Fields) Logger
+}
+
+// NopLogger is a Logger implementation discarding every entry.
+type NopLogger struct{}
+
+// Debug does nothing.
+func (NopLogger) Debug(msg string, fields Fields) {}
+
+// Info does nothing.
+func (NopLogger) Info(msg string, fields Fields) {}
+
+// Warn does nothing.
+func (NopLogger) Warn(msg string, fields Fields) {}
+
+// Error does nothing.
+func (NopLogger) Error(msg string, fields Fields) {}
+
+// With returns the NopLogger.
+func (l NopLogger) With(fields Fields) Logger {
+	return l
+}
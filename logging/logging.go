@@ -0,0 +1,87 @@
+// Package logging implements a palermo.SessionService decorator logging the
+// outcome of session validations.
+package logging
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/logrus"
+)
+
+// SessionService decorates a palermo.SessionService with outcome logging.
+// Failed validations are always logged while successful ones are sampled, so
+// high traffic does not flood the logs.
+type SessionService struct {
+	// successes counts successful validations. Kept first for 64-bit atomic
+	// alignment.
+	successes uint64
+
+	palermo.SessionService
+
+	// SuccessSampleRate is the fraction of successful validations logged,
+	// between 0 (none) and 1 (all).
+	SuccessSampleRate float64
+
+	// Logger receives the log entries. Defaults to the logrus standard
+	// logger.
+	Logger palermo.Logger
+}
+
+// Session validates the given credentials and logs the outcome.
+func (s *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	us, err := s.SessionService.Session(ctx, c)
+	s.log("Session", us, err)
+	return us, err
+}
+
+// RefreshSession refreshes the given credentials and logs the outcome.
+func (s *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	us, err := s.SessionService.RefreshSession(ctx, c)
+	s.log("RefreshSession", us, err)
+	return us, err
+}
+
+func (s *SessionService) log(method string, us *palermo.Session, err error) {
+	if err != nil {
+		s.logger().Warn("SessionService: validation failed", palermo.Fields{
+			"method": method,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	if !s.sample() {
+		return
+	}
+
+	s.logger().Info("SessionService: validation succeeded", palermo.Fields{
+		"method":     method,
+		"session_id": us.ID,
+		"user_id":    us.UserID,
+	})
+}
+
+// sample reports whether the current success must be logged. It spreads the
+// logged successes evenly: the n-th success is logged whenever n*rate crosses
+// an integer, which is cheap and deterministic.
+func (s *SessionService) sample() bool {
+	rate := s.SuccessSampleRate
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+
+	n := atomic.AddUint64(&s.successes, 1)
+	return uint64(float64(n)*rate) != uint64(float64(n-1)*rate)
+}
+
+func (s *SessionService) logger() palermo.Logger {
+	if s.Logger == nil {
+		return logrus.NewLogger(nil)
+	}
+	return s.Logger
+}
@@ -0,0 +1,101 @@
+package logging_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/logging"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+func TestSampling(t *testing.T) {
+	const calls = 1000
+	ok := &palermo.SessionCredentials{AuthToken: "ok"}
+	failed := &palermo.SessionCredentials{AuthToken: "failed"}
+
+	tests := []struct {
+		name string
+		rate float64
+	}{
+		{"none", 0},
+		{"one percent", 0.01},
+		{"a third", 1.0 / 3},
+		{"half", 0.5},
+		{"all", 1},
+		{"above one", 2},
+		{"negative", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &palermotest.Logger{}
+			s := &logging.SessionService{
+				SessionService: &palermotest.SessionService{
+					SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+						if c == failed {
+							return nil, errors.New("invalid token")
+						}
+						return &palermo.Session{ID: "s1", UserID: "u1"}, nil
+					},
+				},
+				SuccessSampleRate: tt.rate,
+				Logger:            log,
+			}
+
+			for i := 0; i < calls; i++ {
+				s.Session(context.Background(), ok)
+				s.Session(context.Background(), failed)
+			}
+
+			if got := len(log.Messages("warn")); got != calls {
+				t.Errorf("logged %d failures, want %d", got, calls)
+			}
+			want := calls * math.Max(0, math.Min(1, tt.rate))
+			if got := float64(len(log.Messages("info"))); math.Abs(got-want) > 1 {
+				t.Errorf("logged %v successes, want about %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantLevel  string
+		wantFields palermo.Fields
+	}{
+		{"success", nil, "info", palermo.Fields{"method": "RefreshSession", "session_id": "s1", "user_id": "u1"}},
+		{"failure", errors.New("expired"), "warn", palermo.Fields{"method": "RefreshSession", "error": "expired"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &palermotest.Logger{}
+			s := &logging.SessionService{
+				SessionService: &palermotest.SessionService{
+					RefreshSessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+						if tt.err != nil {
+							return nil, tt.err
+						}
+						return &palermo.Session{ID: "s1", UserID: "u1"}, nil
+					},
+				},
+				SuccessSampleRate: 1,
+				Logger:            log,
+			}
+			s.RefreshSession(context.Background(), &palermo.SessionCredentials{})
+
+			entries := log.Entries()
+			if len(entries) != 1 || entries[0].Level != tt.wantLevel {
+				t.Fatalf("got entries %+v, want one %s entry", entries, tt.wantLevel)
+			}
+			for k, v := range tt.wantFields {
+				if entries[0].Fields[k] != v {
+					t.Errorf("field %s = %v, want %v", k, entries[0].Fields[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Package logrus implements palermo.Logger using logrus.
+package logrus
+
+import (
+	"github.com/go-toschool/palermo"
+	lr "github.com/sirupsen/logrus"
+)
+
+// Logger implements palermo.Logger on top of a logrus logger.
+type Logger struct {
+	Logger lr.FieldLogger
+}
+
+// NewLogger returns a logger writing to l. When l is nil the logrus standard
+// logger is used.
+func NewLogger(l lr.FieldLogger) *Logger {
+	if l == nil {
+		l = lr.StandardLogger()
+	}
+	return &Logger{Logger: l}
+}
+
+// Debug logs msg at the debug level.
+func (l *Logger) Debug(msg string, fields palermo.Fields) {
+	l.Logger.WithFields(lr.Fields(fields)).Debug(msg)
+}
+
+// Info logs msg at the info level.
+func (l *Logger) Info(msg string, fields palermo.Fields) {
+	l.Logger.WithFields(lr.Fields(fields)).Info(msg)
+}
+
+// Warn logs msg at the warning level.
+func (l *Logger) Warn(msg string, fields palermo.Fields) {
+	l.Logger.WithFields(lr.Fields(fields)).Warn(msg)
+}
+
+// Error logs msg at the error level.
+func (l *Logger) Error(msg string, fields palermo.Fields) {
+	l.Logger.WithFields(lr.Fields(fields)).Error(msg)
+}
+
+// With returns a logger adding fields to every entry.
+func (l *Logger) With(fields palermo.Fields) palermo.Logger {
+	return &Logger{Logger: l.Logger.WithFields(lr.Fields(fields))}
+}
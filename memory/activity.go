@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ActivityStore implements idle.Store in memory. Activity is forgotten on
+// restart and not shared between instances.
+type ActivityStore struct {
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	activity  map[string]activity
+	lastSweep time.Time
+}
+
+type activity struct {
+	usedAt    time.Time
+	expiresAt time.Time
+}
+
+// LastUsed returns the last time the given session was used, or the zero time
+// if unknown.
+func (as *ActivityStore) LastUsed(ctx context.Context, sessionID string) (time.Time, error) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	a, ok := as.activity[sessionID]
+	if !ok || !as.now().Before(a.expiresAt) {
+		return time.Time{}, nil
+	}
+	return a.usedAt, nil
+}
+
+// Touch records the given session as used at usedAt until expiresAt.
+func (as *ActivityStore) Touch(ctx context.Context, sessionID string, usedAt, expiresAt time.Time) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if as.activity == nil {
+		as.activity = make(map[string]activity)
+	}
+	if a, ok := as.activity[sessionID]; ok && a.usedAt.After(usedAt) {
+		usedAt = a.usedAt
+	}
+	as.activity[sessionID] = activity{usedAt: usedAt, expiresAt: expiresAt}
+
+	now := as.now()
+	if now.Sub(as.lastSweep) > time.Minute {
+		for id, a := range as.activity {
+			if !now.Before(a.expiresAt) {
+				delete(as.activity, id)
+			}
+		}
+		as.lastSweep = now
+	}
+	return nil
+}
+
+func (as *ActivityStore) now() time.Time {
+	if as.Now != nil {
+		return as.Now()
+	}
+	return time.Now()
+}
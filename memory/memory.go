@@ -0,0 +1,334 @@
+// Package memory implements palermo.SessionService storing sessions in
+// memory, for development and tests.
+//
+// Sessions are lost on restart and not shared between instances. Expired
+// sessions are rejected on read and evicted by a background janitor.
+// Credentials are opaque random tokens.
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/opaque"
+)
+
+// ErrSessionNotFound is returned when the credentials match no stored
+// session, e.g. because it expired.
+var ErrSessionNotFound = errors.New("memory: session not found")
+
+// ErrSessionNotValidYet is returned when the credentials match a session whose
+// NotBefore time has not come yet.
+var ErrSessionNotValidYet = errors.New("memory: session not valid yet")
+
+// ErrInvalidMaxAge is returned when sessions would expire on creation.
+var ErrInvalidMaxAge = errors.New("memory: MaxAge must be positive")
+
+// exportBatchSize is the number of sessions ExportSessions copies at once.
+const exportBatchSize = 100
+
+type entry struct {
+	session        palermo.Session
+	validationHash string
+}
+
+// sessionCopy returns a copy of the stored session identified by the given
+// token id.
+func (e *entry) sessionCopy(tokenID string) *palermo.Session {
+	s := e.session.Clone()
+	s.TokenID = tokenID
+	return s
+}
+
+// SessionService implements palermo.SessionService in memory.
+type SessionService struct {
+	// MaxAge is the lifetime of sessions.
+	MaxAge time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.RWMutex
+	sessions map[string]*entry
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSessionService returns a service keeping sessions for maxAge, with a
+// janitor evicting expired sessions every interval until Close is called.
+func NewSessionService(maxAge, interval time.Duration) *SessionService {
+	ss := &SessionService{
+		MaxAge: maxAge,
+		stop:   make(chan struct{}),
+	}
+	go ss.janitor(interval)
+	return ss
+}
+
+// Session validates and returns the user session associated with the given
+// credentials.
+func (ss *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	key := opaque.Hash(c.AuthToken)
+
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	e, ok := ss.sessions[key]
+	if !ok || !opaque.Equal(e.validationHash, opaque.Hash(c.ValidationToken)) {
+		return nil, ErrSessionNotFound
+	}
+	now := ss.now()
+	if !now.Before(e.session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+	if now.Before(e.session.NotBefore) {
+		return nil, ErrSessionNotValidYet
+	}
+
+	return e.sessionCopy(key), nil
+}
+
+// RefreshSession validates and returns the user session associated with the
+// given credentials, updated. Expired sessions cannot be refreshed.
+func (ss *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	key := opaque.Hash(c.AuthToken)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	e, ok := ss.sessions[key]
+	if !ok || !opaque.Equal(e.validationHash, opaque.Hash(c.ValidationToken)) {
+		return nil, ErrSessionNotFound
+	}
+
+	now := ss.now()
+	if !now.Before(e.session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+	if now.Before(e.session.NotBefore) {
+		return nil, ErrSessionNotValidYet
+	}
+
+	e.session.UpdatedAt = now
+	return e.sessionCopy(key), nil
+}
+
+// CreateSession stores the given session and returns new credentials for it.
+func (ss *SessionService) CreateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return ss.storeSession(us)
+}
+
+// UpdateSession stores the given session and returns new credentials for it.
+// Previous credentials stay valid until they expire.
+func (ss *SessionService) UpdateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return ss.storeSession(us)
+}
+
+// RevokeSession deletes the session associated with the given credentials.
+func (ss *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	key := opaque.Hash(c.AuthToken)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	e, ok := ss.sessions[key]
+	if !ok || !opaque.Equal(e.validationHash, opaque.Hash(c.ValidationToken)) {
+		return ErrSessionNotFound
+	}
+
+	delete(ss.sessions, key)
+	return nil
+}
+
+// UserSessions returns the live sessions of the given user.
+func (ss *SessionService) UserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	now := ss.now()
+	var sessions []*palermo.Session
+	for k, e := range ss.sessions {
+		if e.session.UserID == userID && now.Before(e.session.ExpiresAt) {
+			sessions = append(sessions, e.sessionCopy(k))
+		}
+	}
+	return sessions, nil
+}
+
+// RevokeSessionByTokenID deletes the session identified by tokenID.
+func (ss *SessionService) RevokeSessionByTokenID(ctx context.Context, tokenID string) (*palermo.Session, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	e, ok := ss.sessions[tokenID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	delete(ss.sessions, tokenID)
+	return e.sessionCopy(tokenID), nil
+}
+
+// RevokeUserSessions deletes every session of the given user.
+func (ss *SessionService) RevokeUserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var sessions []*palermo.Session
+	for k, e := range ss.sessions {
+		if e.session.UserID == userID {
+			sessions = append(sessions, e.sessionCopy(k))
+			delete(ss.sessions, k)
+		}
+	}
+	return sessions, nil
+}
+
+// ExportSessions calls fn for every live session, in token id order. Sessions
+// are copied in batches, resuming after the last key of the previous one, so
+// only a batch is held in memory and fn runs without holding the store
+// locked. Iteration stops when ctx is done.
+func (ss *SessionService) ExportSessions(ctx context.Context, fn func(*palermo.Session) error) error {
+	var after string
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch, next := ss.exportBatch(after)
+		for _, s := range batch {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		after = next
+	}
+}
+
+// exportBatch returns copies of the live sessions among the exportBatchSize
+// first keys following after, along with the key to resume after, empty once
+// no keys are left.
+func (ss *SessionService) exportBatch(after string) ([]*palermo.Session, string) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	// Keep the smallest keys following after, sorted.
+	keys := make([]string, 0, exportBatchSize+1)
+	for k := range ss.sessions {
+		if k <= after {
+			continue
+		}
+		i := sort.SearchStrings(keys, k)
+		if i == exportBatchSize {
+			continue
+		}
+		keys = append(keys, "")
+		copy(keys[i+1:], keys[i:])
+		keys[i] = k
+		if len(keys) > exportBatchSize {
+			keys = keys[:exportBatchSize]
+		}
+	}
+
+	now := ss.now()
+	var batch []*palermo.Session
+	for _, k := range keys {
+		if e := ss.sessions[k]; now.Before(e.session.ExpiresAt) {
+			batch = append(batch, e.sessionCopy(k))
+		}
+	}
+
+	if len(keys) < exportBatchSize {
+		return batch, ""
+	}
+	return batch, keys[len(keys)-1]
+}
+
+// Close stops the janitor.
+func (ss *SessionService) Close() error {
+	ss.stopOnce.Do(func() {
+		if ss.stop != nil {
+			close(ss.stop)
+		}
+	})
+	return nil
+}
+
+// Len returns the number of stored sessions, including expired sessions not
+// evicted yet.
+func (ss *SessionService) Len() int {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return len(ss.sessions)
+}
+
+// Evict removes expired sessions.
+func (ss *SessionService) Evict() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	now := ss.now()
+	for k, e := range ss.sessions {
+		if !now.Before(e.session.ExpiresAt) {
+			delete(ss.sessions, k)
+		}
+	}
+}
+
+func (ss *SessionService) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			ss.Evict()
+		case <-ss.stop:
+			return
+		}
+	}
+}
+
+func (ss *SessionService) storeSession(us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if ss.MaxAge <= 0 {
+		return nil, ErrInvalidMaxAge
+	}
+
+	if us.ServiceAccount {
+		return nil, errors.New("memory: service account sessions are not supported")
+	}
+
+	c, err := opaque.NewCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{
+		session:        *us.Clone(),
+		validationHash: opaque.Hash(c.ValidationToken),
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	e.session.ExpiresAt = ss.now().Add(ss.MaxAge)
+	if ss.sessions == nil {
+		ss.sessions = make(map[string]*entry)
+	}
+	ss.sessions[opaque.Hash(c.AuthToken)] = e
+	return c, nil
+}
+
+func (ss *SessionService) now() time.Time {
+	if ss.Now != nil {
+		return ss.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,403 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/memory"
+)
+
+var (
+	_ palermo.SessionService  = (*memory.SessionService)(nil)
+	_ palermo.SessionAdmin    = (*memory.SessionService)(nil)
+	_ palermo.SessionExporter = (*memory.SessionService)(nil)
+)
+
+// clock is a settable time source.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestSessionService(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	user := &palermo.Session{UserID: "u1", Email: "u1@example.com", Scopes: []string{"read"}}
+
+	tests := []struct {
+		name string
+		// use returns the credentials to validate, given the ones of user
+		// created at start.
+		use        func(ss *memory.SessionService, clk *clock, c *palermo.SessionCredentials) *palermo.SessionCredentials
+		wantErr    error
+		wantUpdate bool // refreshing updates UpdatedAt
+	}{
+		{"valid", func(ss *memory.SessionService, clk *clock, c *palermo.SessionCredentials) *palermo.SessionCredentials {
+			clk.Add(time.Minute)
+			return c
+		}, nil, true},
+		{"other validation token", func(ss *memory.SessionService, clk *clock, c *palermo.SessionCredentials) *palermo.SessionCredentials {
+			return &palermo.SessionCredentials{AuthToken: c.AuthToken, ValidationToken: c.AuthToken}
+		}, memory.ErrSessionNotFound, false},
+		{"unknown", func(ss *memory.SessionService, clk *clock, c *palermo.SessionCredentials) *palermo.SessionCredentials {
+			return &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"}
+		}, memory.ErrSessionNotFound, false},
+		{"revoked", func(ss *memory.SessionService, clk *clock, c *palermo.SessionCredentials) *palermo.SessionCredentials {
+			if err := ss.RevokeSession(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+			return c
+		}, memory.ErrSessionNotFound, false},
+		{"expired", func(ss *memory.SessionService, clk *clock, c *palermo.SessionCredentials) *palermo.SessionCredentials {
+			clk.Add(time.Hour)
+			return c
+		}, memory.ErrSessionNotFound, false},
+		{"not valid yet", func(ss *memory.SessionService, clk *clock, c *palermo.SessionCredentials) *palermo.SessionCredentials {
+			c, err := ss.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com", NotBefore: start.Add(time.Minute)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		}, memory.ErrSessionNotValidYet, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := &clock{now: start}
+			ss := &memory.SessionService{MaxAge: time.Hour, Now: clk.Now}
+			c, err := ss.CreateSession(ctx, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c = tt.use(ss, clk, c)
+
+			s, err := ss.Session(ctx, c)
+			if err != tt.wantErr {
+				t.Fatalf("Session() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if s.UserID != "u1" || s.TokenID == "" || !s.ExpiresAt.Equal(start.Add(time.Hour)) || !reflect.DeepEqual(s.Scopes, user.Scopes) {
+					t.Errorf("Session() = %+v", s)
+				}
+			}
+
+			s, err = ss.RefreshSession(ctx, c)
+			if err != tt.wantErr {
+				t.Fatalf("RefreshSession() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantUpdate && !s.UpdatedAt.Equal(clk.Now()) {
+				t.Errorf("refreshed session updated at %v, want %v", s.UpdatedAt, clk.Now())
+			}
+		})
+	}
+}
+
+func TestCreateSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxAge  time.Duration
+		session *palermo.Session
+		wantErr bool
+	}{
+		{"user", time.Hour, &palermo.Session{UserID: "u1", Email: "u1@example.com"}, false},
+		{"anonymous", time.Hour, &palermo.Session{Anonymous: true}, false},
+		{"no email", time.Hour, &palermo.Session{UserID: "u1"}, false},
+		{"service account", time.Hour, &palermo.Session{UserID: "svc", Email: "svc@example.com", ServiceAccount: true}, true},
+		{"zero max age", 0, &palermo.Session{UserID: "u1", Email: "u1@example.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := &memory.SessionService{MaxAge: tt.maxAge}
+			c, err := ss.CreateSession(context.Background(), tt.session)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateSession() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.maxAge == 0 && err != memory.ErrInvalidMaxAge {
+				t.Errorf("CreateSession() = %v, want %v", err, memory.ErrInvalidMaxAge)
+			}
+			if err == nil && (c.AuthToken == "" || c.ValidationToken == "" || c.AuthToken == c.ValidationToken) {
+				t.Errorf("CreateSession() = %+v", c)
+			}
+		})
+	}
+}
+
+func TestSessionIsolation(t *testing.T) {
+	ctx := context.Background()
+	ss := &memory.SessionService{MaxAge: time.Hour}
+	us := &palermo.Session{UserID: "u1", Email: "u1@example.com", Scopes: []string{"read"}, Metadata: map[string]string{"plan": "free"}}
+	c, err := ss.CreateSession(ctx, us)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the created session nor the returned ones alias the stored one.
+	us.Scopes[0] = "admin"
+	us.Metadata["plan"] = "pro"
+	s, err := ss.Session(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Scopes[0] = "admin"
+	s.Metadata["plan"] = "pro"
+
+	s, err = ss.Session(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Scopes[0] != "read" || s.Metadata["plan"] != "free" {
+		t.Errorf("stored session modified: %+v", s)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	ctx := context.Background()
+	clk := &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ss := &memory.SessionService{MaxAge: time.Hour, Now: clk.Now}
+
+	var creds []*palermo.SessionCredentials
+	for i := 0; i < 3; i++ {
+		c, err := ss.CreateSession(ctx, &palermo.Session{UserID: "u1", Email: "u1@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds = append(creds, c)
+		clk.Add(20 * time.Minute)
+	}
+
+	tests := []struct {
+		after   time.Duration
+		wantLen int
+	}{
+		{-time.Second, 3},
+		{time.Second, 2},
+		{19 * time.Minute, 2},
+		{time.Minute, 1},
+		{20 * time.Minute, 0},
+	}
+	for _, tt := range tests {
+		clk.Add(tt.after)
+		ss.Evict()
+		if got := ss.Len(); got != tt.wantLen {
+			t.Errorf("at %v: Len() = %d, want %d", clk.Now(), got, tt.wantLen)
+		}
+		for i, c := range creds {
+			_, err := ss.Session(ctx, c)
+			if live := i >= len(creds)-tt.wantLen; live != (err == nil) {
+				t.Errorf("at %v: Session(%d) = %v", clk.Now(), i, err)
+			}
+		}
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	ss := memory.NewSessionService(20*time.Millisecond, 5*time.Millisecond)
+	defer ss.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := ss.CreateSession(context.Background(), &palermo.Session{UserID: "u1", Email: "u1@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ss.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor left %d expired sessions", ss.Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := ss.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+}
+
+func TestSessionAdmin(t *testing.T) {
+	ctx := context.Background()
+	ss := &memory.SessionService{MaxAge: time.Hour}
+	create := func(user string) *palermo.SessionCredentials {
+		c, err := ss.CreateSession(ctx, &palermo.Session{UserID: user, Email: user + "@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	a1, a2, b1 := create("alice"), create("alice"), create("bob")
+
+	sessions, err := ss.UserSessions(ctx, "alice")
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("UserSessions() = %v, %v", sessions, err)
+	}
+
+	revoked, err := ss.RevokeSessionByTokenID(ctx, sessions[0].TokenID)
+	if err != nil || revoked.UserID != "alice" {
+		t.Fatalf("RevokeSessionByTokenID() = %v, %v", revoked, err)
+	}
+	if _, err := ss.RevokeSessionByTokenID(ctx, sessions[0].TokenID); err != memory.ErrSessionNotFound {
+		t.Errorf("second RevokeSessionByTokenID() = %v, want %v", err, memory.ErrSessionNotFound)
+	}
+
+	revokedAll, err := ss.RevokeUserSessions(ctx, "alice")
+	if err != nil || len(revokedAll) != 1 {
+		t.Fatalf("RevokeUserSessions() = %v, %v", revokedAll, err)
+	}
+	for _, c := range []*palermo.SessionCredentials{a1, a2} {
+		if _, err := ss.Session(ctx, c); err != memory.ErrSessionNotFound {
+			t.Errorf("Session() of a revoked session = %v", err)
+		}
+	}
+	if _, err := ss.Session(ctx, b1); err != nil {
+		t.Errorf("Session() of another user = %v", err)
+	}
+
+	var exported []string
+	if err := ss.ExportSessions(ctx, func(s *palermo.Session) error {
+		exported = append(exported, s.UserID)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exported, []string{"bob"}) {
+		t.Errorf("exported sessions of %q", exported)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	ctx := context.Background()
+	ss := memory.NewSessionService(time.Hour, time.Millisecond)
+	defer ss.Close()
+
+	const workers, rounds = 8, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			user := fmt.Sprintf("u%d", w)
+			for i := 0; i < rounds; i++ {
+				c, err := ss.CreateSession(ctx, &palermo.Session{UserID: user, Email: user + "@example.com"})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, err := ss.Session(ctx, c); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := ss.RefreshSession(ctx, c); err != nil {
+					errs <- err
+					return
+				}
+				if i%2 == 0 {
+					if err := ss.RevokeSession(ctx, c); err != nil {
+						errs <- err
+						return
+					}
+				}
+				if _, err := ss.UserSessions(ctx, user); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var users []string
+	ss.ExportSessions(ctx, func(s *palermo.Session) error {
+		users = append(users, s.UserID)
+		return nil
+	})
+	if len(users) != workers*rounds/2 || ss.Len() != workers*rounds/2 {
+		t.Errorf("kept %d sessions (%d exported), want %d", ss.Len(), len(users), workers*rounds/2)
+	}
+}
+
+func TestExportSessions(t *testing.T) {
+	// exportBatchSize is the batch size of memory.SessionService.
+	const exportBatchSize = 100
+	const live, expired = 10000, 500
+
+	ctx := context.Background()
+	clk := &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ss := &memory.SessionService{MaxAge: time.Hour, Now: clk.Now}
+	create := func(user string) {
+		if _, err := ss.CreateSession(ctx, &palermo.Session{UserID: user, Email: user + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < expired; i++ {
+		create("expired")
+	}
+	clk.Add(30 * time.Minute)
+	for i := 0; i < live; i++ {
+		create("u1")
+	}
+	clk.Add(45 * time.Minute)
+
+	t.Run("complete", func(t *testing.T) {
+		// Sessions are exported in token id order, so each once.
+		exported := 0
+		last := ""
+		if err := ss.ExportSessions(ctx, func(s *palermo.Session) error {
+			if s.TokenID <= last {
+				t.Fatalf("session %q exported after %q", s.TokenID, last)
+			}
+			if s.UserID != "u1" {
+				t.Fatalf("exported an expired session of %s", s.UserID)
+			}
+			last = s.TokenID
+			exported++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if exported != live {
+			t.Errorf("exported %d sessions, want %d", exported, live)
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		// Sessions revoked once the export started are left out, but for
+		// the ones already copied: at most the rest of the first batch.
+		exported := 0
+		if err := ss.ExportSessions(ctx, func(s *palermo.Session) error {
+			if exported == 0 {
+				if _, err := ss.RevokeUserSessions(ctx, "u1"); err != nil {
+					return err
+				}
+			}
+			exported++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if exported > exportBatchSize {
+			t.Errorf("exported %d revoked sessions, want at most a batch of %d", exported, exportBatchSize)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ReplayGuard implements palermo.ReplayGuard in memory. Consumed credentials
+// are forgotten on restart and not shared between instances.
+type ReplayGuard struct {
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	consumed  map[string]time.Time
+	lastSweep time.Time
+}
+
+// Consume marks the given token id as used until expiresAt, and reports
+// whether it was unused.
+func (rg *ReplayGuard) Consume(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	now := rg.now()
+	if exp, ok := rg.consumed[tokenID]; ok && now.Before(exp) {
+		return false, nil
+	}
+
+	if rg.consumed == nil {
+		rg.consumed = make(map[string]time.Time)
+	}
+	rg.consumed[tokenID] = expiresAt
+
+	// Expired tokens are rejected anyway, so their records can be dropped
+	// to keep memory bounded.
+	if now.Sub(rg.lastSweep) > time.Minute {
+		for id, exp := range rg.consumed {
+			if !now.Before(exp) {
+				delete(rg.consumed, id)
+			}
+		}
+		rg.lastSweep = now
+	}
+	return true, nil
+}
+
+func (rg *ReplayGuard) now() time.Time {
+	if rg.Now != nil {
+		return rg.Now()
+	}
+	return time.Now()
+}
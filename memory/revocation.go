@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+)
+
+// RevocationStore implements palermo.RevocationStore in memory. Revocations
+// are lost on restart and not shared between instances.
+type RevocationStore struct {
+	// MaxEntries bounds the number of revocations kept, so that spamming
+	// logouts cannot exhaust memory. Past it, the revocations expiring first
+	// are evicted, with a warning when their token has not expired yet, as
+	// it becomes usable again. Zero means unbounded.
+	MaxEntries int
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// Metrics receives the size of the store. Defaults to
+	// palermo.NopMetrics.
+	Metrics palermo.Metrics
+
+	// Logger receives the early evictions. Defaults to palermo.NopLogger.
+	Logger palermo.Logger
+
+	mu       sync.Mutex
+	revoked  map[string]*revocation
+	byExpiry revocationHeap
+}
+
+type revocation struct {
+	tokenID   string
+	expiresAt time.Time
+	index     int
+}
+
+// Revoke records the given token id as revoked until expiresAt.
+func (rs *RevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.revoked == nil {
+		rs.revoked = make(map[string]*revocation)
+	}
+	if r, ok := rs.revoked[tokenID]; ok {
+		if expiresAt.After(r.expiresAt) {
+			r.expiresAt = expiresAt
+			heap.Fix(&rs.byExpiry, r.index)
+		}
+	} else {
+		r := &revocation{tokenID: tokenID, expiresAt: expiresAt}
+		rs.revoked[tokenID] = r
+		heap.Push(&rs.byExpiry, r)
+	}
+
+	// Expired tokens are rejected anyway, so their revocations can be
+	// dropped to keep memory bounded.
+	now := rs.now()
+	for len(rs.byExpiry) > 0 && now.After(rs.byExpiry[0].expiresAt) {
+		rs.evict()
+	}
+	for rs.MaxEntries > 0 && len(rs.byExpiry) > rs.MaxEntries {
+		r := rs.evict()
+		rs.logger().Warn("memory: revocation evicted before its token expired", palermo.Fields{
+			"token_id":    r.tokenID,
+			"expires_at":  r.expiresAt,
+			"max_entries": rs.MaxEntries,
+		})
+	}
+
+	rs.metrics().SetGauge("palermo_revocation_store_entries", float64(len(rs.revoked)), nil)
+	return nil
+}
+
+// IsRevoked reports whether the given token id was revoked.
+func (rs *RevocationStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	_, ok := rs.revoked[tokenID]
+	return ok, nil
+}
+
+// Len returns the number of revocations kept.
+func (rs *RevocationStore) Len() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return len(rs.revoked)
+}
+
+// evict drops the revocation expiring first.
+func (rs *RevocationStore) evict() *revocation {
+	r := heap.Pop(&rs.byExpiry).(*revocation)
+	delete(rs.revoked, r.tokenID)
+	return r
+}
+
+func (rs *RevocationStore) now() time.Time {
+	if rs.Now != nil {
+		return rs.Now()
+	}
+	return time.Now()
+}
+
+func (rs *RevocationStore) metrics() palermo.Metrics {
+	if rs.Metrics == nil {
+		return palermo.NopMetrics{}
+	}
+	return rs.Metrics
+}
+
+func (rs *RevocationStore) logger() palermo.Logger {
+	if rs.Logger == nil {
+		return palermo.NopLogger{}
+	}
+	return rs.Logger
+}
+
+// revocationHeap orders revocations by expiry, implementing heap.Interface.
+type revocationHeap []*revocation
+
+func (h revocationHeap) Len() int           { return len(h) }
+func (h revocationHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h revocationHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *revocationHeap) Push(x interface{}) {
+	r := x.(*revocation)
+	r.index = len(*h)
+	*h = append(*h, r)
+}
+
+func (h *revocationHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return r
+}
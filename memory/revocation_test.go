@@ -0,0 +1,102 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo/memory"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+func TestRevocationStoreMaxEntries(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		revoked    int
+		wantLen    int
+		wantWarns  int
+	}{
+		{"unbounded", 0, 50, 50, 0},
+		{"below ceiling", 100, 50, 50, 0},
+		{"at ceiling", 50, 50, 50, 0},
+		{"past ceiling", 10, 50, 10, 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &palermotest.Logger{}
+			metrics := &palermotest.Metrics{}
+			rs := &memory.RevocationStore{
+				MaxEntries: tt.maxEntries,
+				Now:        func() time.Time { return now },
+				Logger:     logger,
+				Metrics:    metrics,
+			}
+
+			ctx := context.Background()
+			for i := 0; i < tt.revoked; i++ {
+				// Later token ids expire later.
+				exp := now.Add(time.Hour + time.Duration(i)*time.Minute)
+				if err := rs.Revoke(ctx, fmt.Sprint("tok", i), exp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := rs.Len(); got != tt.wantLen {
+				t.Errorf("Len() = %d, want %d", got, tt.wantLen)
+			}
+			if got := len(logger.Messages("warn")); got != tt.wantWarns {
+				t.Errorf("got %d warnings, want %d", got, tt.wantWarns)
+			}
+			m, ok := metrics.Last("palermo_revocation_store_entries")
+			if !ok || m.Value != float64(tt.wantLen) {
+				t.Errorf("size gauge = %v, want %d", m.Value, tt.wantLen)
+			}
+
+			// The revocations expiring last are kept.
+			for i := tt.revoked - tt.wantLen; i < tt.revoked; i++ {
+				revoked, _ := rs.IsRevoked(ctx, fmt.Sprint("tok", i))
+				if !revoked {
+					t.Errorf("tok%d was evicted", i)
+				}
+			}
+			for i := 0; i < tt.revoked-tt.wantLen; i++ {
+				revoked, _ := rs.IsRevoked(ctx, fmt.Sprint("tok", i))
+				if revoked {
+					t.Errorf("tok%d was kept", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRevocationStoreDropsExpiredBeforeEvicting(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	logger := &palermotest.Logger{}
+	rs := &memory.RevocationStore{
+		MaxEntries: 2,
+		Now:        func() time.Time { return now },
+		Logger:     logger,
+	}
+
+	ctx := context.Background()
+	rs.Revoke(ctx, "expiring", now.Add(time.Minute))
+	rs.Revoke(ctx, "live", now.Add(time.Hour))
+	now = now.Add(2 * time.Minute)
+	rs.Revoke(ctx, "new", now.Add(time.Hour))
+
+	if got := rs.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+	if warns := logger.Messages("warn"); len(warns) != 0 {
+		t.Errorf("expired revocation dropped with warnings %q", warns)
+	}
+	for _, id := range []string{"live", "new"} {
+		if revoked, _ := rs.IsRevoked(ctx, id); !revoked {
+			t.Errorf("%s was evicted", id)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package palermo
+
+// Metrics records service metrics. It keeps the core packages independent
+// from the metrics backend (Prometheus, StatsD, OpenTelemetry...).
+// A given metric name must always be used with the same set of label names.
+type Metrics interface {
+	// IncCounter increments the named counter by one.
+	IncCounter(name string, labels map[string]string)
+
+	// ObserveHistogram records a value in the named histogram.
+	ObserveHistogram(name string, value float64, labels map[string]string)
+
+	// SetGauge sets the value of the named gauge.
+	SetGauge(name string, value float64, labels map[string]string)
+}
+
+// NopMetrics is a Metrics implementation that discards every metric.
+type NopMetrics struct{}
+
+// IncCounter does nothing.
+func (NopMetrics) IncCounter(name string, labels map[string]string) {}
+
+// ObserveHistogram does nothing.
+func (NopMetrics) ObserveHistogram(name string, value float64, labels map[string]string) {}
+
+// SetGauge does nothing.
+func (NopMetrics) SetGauge(name string, value float64, labels map[string]string) {}
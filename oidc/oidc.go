@@ -0,0 +1,373 @@
+// Package oidc verifies the ID tokens of an external OpenID Connect provider,
+// e.g. Google, Auth0 or Keycloak, so that palermo sessions can be created
+// from third-party logins.
+//
+// The signing keys of the provider are read from its JWKS, found through its
+// discovery document unless given:
+//
+//	v := &oidc.Verifier{
+//		Issuer:    "https://accounts.google.com",
+//		ClientIDs: []string{"1234.apps.googleusercontent.com"},
+//	}
+//
+//	claims, err := v.Verify(ctx, idToken)
+//	if err != nil {
+//		return err
+//	}
+//	creds, err := sessions.CreateSession(ctx, claims.Session())
+//
+// ID tokens received along with an access token are verified with
+// VerifyWithAccessToken instead, which checks their at_hash claim.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/jws"
+	"github.com/go-toschool/palermo/jwt"
+)
+
+// DefaultMethods are the signing methods accepted when Verifier.Methods is
+// nil. Symmetric methods are never accepted, as the client secret shared
+// with the provider must not be able to mint sessions.
+var DefaultMethods = []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}
+
+var (
+	// ErrInvalidIssuer is returned for ID tokens of another issuer.
+	ErrInvalidIssuer = errors.New("oidc: invalid issuer")
+
+	// ErrInvalidAudience is returned for ID tokens issued to another client.
+	ErrInvalidAudience = errors.New("oidc: invalid audience")
+
+	// ErrExpired is returned for expired ID tokens.
+	ErrExpired = errors.New("oidc: ID token is expired")
+
+	// ErrIssuedInFuture is returned for ID tokens issued after now, beyond
+	// the leeway.
+	ErrIssuedInFuture = errors.New("oidc: ID token used before issued")
+
+	// ErrMissingSubject is returned for ID tokens without subject.
+	ErrMissingSubject = errors.New("oidc: missing subject")
+
+	// ErrMissingEmail is returned for ID tokens without email, e.g. when the
+	// email scope was not requested from the provider.
+	ErrMissingEmail = errors.New("oidc: missing email")
+
+	// ErrEmailNotVerified is returned for ID tokens whose email the provider
+	// did not verify, unless allowed.
+	ErrEmailNotVerified = errors.New("oidc: email not verified")
+
+	// ErrUnexpectedMethod is returned for ID tokens signed with a method
+	// not listed in Verifier.Methods.
+	ErrUnexpectedMethod = errors.New("oidc: unexpected signing method")
+
+	// ErrProviderUnavailable is returned when the discovery document of the
+	// provider could not be fetched, the details going to the logger.
+	ErrProviderUnavailable = errors.New("oidc: provider unavailable")
+)
+
+// Claims are the claims of a verified ID token.
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce,omitempty"`
+	Email           string   `json:"email,omitempty"`
+	EmailVerified   bool     `json:"email_verified,omitempty"`
+	Name            string   `json:"name,omitempty"`
+
+	// AccessTokenHash is the at_hash claim, binding the ID token to the
+	// access token issued along with it.
+	AccessTokenHash string `json:"at_hash,omitempty"`
+}
+
+// Session returns the session of the user the ID token was issued to,
+// identified by its subject.
+func (c *Claims) Session() *palermo.Session {
+	now := time.Now()
+	return &palermo.Session{
+		UserID:    c.Subject,
+		Email:     c.Email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// audience decodes the aud claim, either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	*a = ss
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier verifies the ID tokens of a provider. Its fields must be set
+// before its first call.
+type Verifier struct {
+	// Issuer is the issuer URL of the provider, e.g.
+	// https://accounts.google.com, matched against the iss claim.
+	Issuer string
+
+	// ClientIDs are the client ids of the application at the provider. ID
+	// tokens must be issued to one of them.
+	ClientIDs []string
+
+	// Keys fetches the signing keys of the provider. Defaults to a
+	// jwt.RemoteKeySet on the jwks_uri of the discovery document of the
+	// issuer.
+	Keys *jwt.RemoteKeySet
+
+	// Methods lists the accepted signing methods. Defaults to
+	// DefaultMethods.
+	Methods []string
+
+	// Leeway tolerates clock skew with the provider on the exp and iat
+	// claims.
+	Leeway time.Duration
+
+	// AllowUnverifiedEmail accepts ID tokens whose email the provider did
+	// not verify. Only enable it when sessions are never matched to
+	// accounts by email, or anyone could claim the account of another.
+	AllowUnverifiedEmail bool
+
+	// Client fetches the discovery document. Defaults to a client with a 10
+	// seconds timeout.
+	Client *http.Client
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// Logger receives the discovery and key fetch failures. Defaults to
+	// palermo.NopLogger.
+	Logger palermo.Logger
+
+	mu   sync.Mutex
+	keys *jwt.RemoteKeySet
+}
+
+// Verify verifies the signature and the claims of the given ID token and
+// returns its claims. jwt.ErrRemoteKeysUnavailable and
+// ErrProviderUnavailable report a provider that could not be reached, other
+// errors an invalid token.
+func (v *Verifier) Verify(ctx context.Context, idToken string) (*Claims, error) {
+	claims, _, err := v.verify(ctx, idToken)
+	return claims, err
+}
+
+// VerifyWithAccessToken verifies the given ID token as Verify does, and that
+// it was issued along with accessToken: its at_hash claim, when set, must
+// match accessToken, as required by OpenID Connect Core 1.0, section
+// 3.2.2.9. Providers may omit at_hash in the authorization code flow, where
+// both tokens come straight from the provider.
+func (v *Verifier) VerifyWithAccessToken(ctx context.Context, idToken, accessToken string) (*Claims, error) {
+	claims, alg, err := v.verify(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.AccessTokenHash != "" {
+		if err := jwt.VerifyAccessTokenHash(claims.AccessTokenHash, accessToken, alg); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// verify verifies the given ID token and returns its claims along with its
+// signing method.
+func (v *Verifier) verify(ctx context.Context, idToken string) (*Claims, string, error) {
+	keys, err := v.remoteKeys(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var alg string
+	claims := &Claims{}
+	err = jws.Parse(idToken, claims, func(h jws.Header) (interface{}, error) {
+		if !v.accepts(h.Alg) {
+			return nil, ErrUnexpectedMethod
+		}
+		alg = h.Alg
+		return keys.Key(ctx, h.Kid, h.Alg)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := v.validate(claims); err != nil {
+		return nil, "", err
+	}
+	return claims, alg, nil
+}
+
+// validate checks the claims of a verified ID token, as required by OpenID
+// Connect Core 1.0, section 3.1.3.7.
+func (v *Verifier) validate(c *Claims) error {
+	if c.Issuer != v.Issuer {
+		return ErrInvalidIssuer
+	}
+	if !v.issuedTo(c) {
+		return ErrInvalidAudience
+	}
+
+	now := v.now()
+	if c.ExpiresAt == 0 || !now.Before(time.Unix(c.ExpiresAt, 0).Add(v.Leeway)) {
+		return ErrExpired
+	}
+	if c.IssuedAt != 0 && now.Add(v.Leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return ErrIssuedInFuture
+	}
+
+	if c.Subject == "" {
+		return ErrMissingSubject
+	}
+	if c.Email == "" {
+		return ErrMissingEmail
+	}
+	if !c.EmailVerified && !v.AllowUnverifiedEmail {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// issuedTo reports whether c was issued to one of the client ids: its
+// audience must hold one of them, and its authorized party, when set, must
+// be one of them.
+func (v *Verifier) issuedTo(c *Claims) bool {
+	trusted := false
+	for _, id := range v.ClientIDs {
+		if c.Audience.contains(id) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted || c.AuthorizedParty == "" {
+		return trusted
+	}
+	for _, id := range v.ClientIDs {
+		if c.AuthorizedParty == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Verifier) accepts(alg string) bool {
+	methods := v.Methods
+	if methods == nil {
+		methods = DefaultMethods
+	}
+	for _, m := range methods {
+		if m == alg && !jws.Symmetric(alg) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteKeys returns Keys, else the key set of the jwks_uri of the discovery
+// document, fetched once. A failed discovery is retried on next use.
+func (v *Verifier) remoteKeys(ctx context.Context) (*jwt.RemoteKeySet, error) {
+	if v.Keys != nil {
+		return v.Keys, nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.keys != nil {
+		return v.keys, nil
+	}
+
+	uri, err := v.discover(ctx)
+	if err != nil {
+		v.logger().Warn("oidc: failed to discover provider", palermo.Fields{
+			"issuer": v.Issuer,
+			"error":  err.Error(),
+		})
+		return nil, ErrProviderUnavailable
+	}
+	v.keys = &jwt.RemoteKeySet{URL: uri, Client: v.Client, Now: v.Now, Logger: v.Logger}
+	return v.keys, nil
+}
+
+// discover returns the jwks_uri of the discovery document of the issuer.
+func (v *Verifier) discover(ctx context.Context) (string, error) {
+	url := strings.TrimSuffix(v.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := v.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching discovery document: %s", resp.Status)
+	}
+
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", err
+	}
+	// The document must describe the issuer it was fetched from, or an
+	// attacker serving it could substitute its own keys.
+	if doc.Issuer != v.Issuer || doc.JWKSURI == "" {
+		return "", fmt.Errorf("discovery document describes issuer %q", doc.Issuer)
+	}
+	return doc.JWKSURI, nil
+}
+
+func (v *Verifier) client() *http.Client {
+	if v.Client != nil {
+		return v.Client
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+func (v *Verifier) logger() palermo.Logger {
+	if v.Logger == nil {
+		return palermo.NopLogger{}
+	}
+	return v.Logger
+}
+
+func (v *Verifier) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,97 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo/internal/jws"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/oidc"
+)
+
+const (
+	testIssuer   = "https://accounts.example.com"
+	testClientID = "1234.apps.example.com"
+)
+
+func TestVerifyWithAccessToken(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := jwt.NewJWK("k1", "ES256", key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&jwt.JWKS{Keys: []jwt.JWK{jwk}})
+	}))
+	defer srv.Close()
+
+	v := &oidc.Verifier{
+		Issuer:    testIssuer,
+		ClientIDs: []string{testClientID},
+		Keys:      &jwt.RemoteKeySet{URL: srv.URL},
+	}
+
+	const accessToken = "ya29.access-token"
+	sum := sha256.Sum256([]byte(accessToken))
+	goodHash := base64.RawURLEncoding.EncodeToString(sum[:16])
+
+	tests := []struct {
+		name        string
+		atHash      string
+		accessToken string
+		wantErr     error
+	}{
+		{"matching", goodHash, accessToken, nil},
+		{"no at_hash", "", accessToken, nil},
+		{"other access token", goodHash, "stolen", jwt.ErrAccessTokenHashMismatch},
+		{"other at_hash", base64.RawURLEncoding.EncodeToString(sum[16:]), accessToken, jwt.ErrAccessTokenHashMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			claims := map[string]interface{}{
+				"iss":            testIssuer,
+				"aud":            testClientID,
+				"sub":            "108",
+				"email":          "jane@example.com",
+				"email_verified": true,
+				"iat":            now.Unix(),
+				"exp":            now.Add(time.Hour).Unix(),
+			}
+			if tt.atHash != "" {
+				claims["at_hash"] = tt.atHash
+			}
+			idToken, err := jws.Sign("ES256", "k1", claims, func(input []byte) ([]byte, error) {
+				return jws.Signature("ES256", input, key)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := v.VerifyWithAccessToken(context.Background(), idToken, tt.accessToken)
+			if err != tt.wantErr {
+				t.Fatalf("VerifyWithAccessToken() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && c.Subject != "108" {
+				t.Errorf("got subject %q, want 108", c.Subject)
+			}
+
+			// Verify alone does not check the access token.
+			if _, err := v.Verify(context.Background(), idToken); err != nil {
+				t.Errorf("Verify() = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+// Package otlp implements palermo.Tracer, exporting spans to an
+// OpenTelemetry collector with the OTLP/HTTP protocol (JSON encoding).
+//
+// Spans are batched in memory and sent in the background. Spans ended while
+// the queue is full are dropped rather than slowing requests down. Trace
+// context is propagated with W3C traceparent values (see Extract).
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+)
+
+// Defaults of the Tracer settings.
+const (
+	DefaultFlushInterval = 5 * time.Second
+	DefaultBatchSize     = 512
+	DefaultQueueSize     = 4096
+)
+
+// ErrClosed is returned when closing a tracer twice.
+var ErrClosed = errors.New("otlp: tracer closed")
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+
+	statusCodeOK    = 1
+	statusCodeError = 2
+)
+
+// Tracer implements palermo.Tracer exporting spans to an OTLP/HTTP endpoint.
+type Tracer struct {
+	// Logger receives the failed exports. Defaults to palermo.NopLogger.
+	// It must be set before the first span is started.
+	Logger palermo.Logger
+
+	endpoint      string
+	serviceName   string
+	client        *http.Client
+	batchSize     int
+	flushInterval time.Duration
+
+	queue     chan *span
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTracer returns a tracer exporting the spans of the service named
+// serviceName to the collector at endpoint, e.g. http://localhost:4318, until
+// Close is called.
+func NewTracer(endpoint, serviceName string) *Tracer {
+	t := &Tracer{
+		endpoint:      strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		serviceName:   serviceName,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		queue:         make(chan *span, DefaultQueueSize),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start starts a span named name, child of the span or remote parent carried
+// by ctx.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, palermo.Span) {
+	s := &span{
+		tracer: t,
+		name:   name,
+		kind:   spanKindInternal,
+		start:  time.Now(),
+		spanID: randomHex(8),
+	}
+
+	if parent, ok := ctx.Value(spanKey{}).(spanContext); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+		if parent.remote {
+			s.kind = spanKindServer
+		}
+	} else {
+		s.traceID = randomHex(16)
+		s.kind = spanKindServer
+	}
+
+	return context.WithValue(ctx, spanKey{}, spanContext{traceID: s.traceID, spanID: s.spanID}), s
+}
+
+// Close exports the pending spans and stops the tracer.
+func (t *Tracer) Close() error {
+	err := ErrClosed
+	t.closeOnce.Do(func() {
+		close(t.done)
+		<-t.stopped
+		err = nil
+	})
+	return err
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+
+	tick := time.NewTicker(t.flushInterval)
+	defer tick.Stop()
+
+	var batch []*span
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.batchSize {
+				t.export(batch)
+				batch = nil
+			}
+		case <-tick.C:
+			t.export(batch)
+			batch = nil
+		case <-t.done:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					t.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) enqueue(s *span) {
+	select {
+	case t.queue <- s:
+	default:
+	}
+}
+
+func (t *Tracer) export(batch []*span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := t.send(batch); err != nil {
+		// Tracing must never fail requests: the batch is dropped.
+		t.logger().Warn("otlp: failed to export spans", palermo.Fields{
+			"error": err.Error(),
+			"spans": len(batch),
+		})
+	}
+}
+
+func (t *Tracer) logger() palermo.Logger {
+	if t.Logger == nil {
+		return palermo.NopLogger{}
+	}
+	return t.Logger
+}
+
+func (t *Tracer) send(batch []*span) error {
+	spans := make([]jsonSpan, len(batch))
+	for i, s := range batch {
+		spans[i] = s.json()
+	}
+
+	b, err := json.Marshal(&exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{Attributes: []keyValue{stringAttribute("service.name", t.serviceName)}},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: "github.com/go-toschool/palermo"},
+				Spans: spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp: collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+type spanKey struct{}
+
+// spanContext identifies the current span of a context.
+type spanContext struct {
+	traceID string
+	spanID  string
+	remote  bool
+}
+
+// Extract returns a copy of ctx whose spans continue the trace of the given
+// W3C traceparent value, e.g. read from the metadata of an incoming request.
+// Invalid values are ignored and a new trace is started instead.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHex(parts[1], 16) || !isHex(parts[2], 8) {
+		return ctx
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, spanContext{traceID: parts[1], spanID: parts[2], remote: true})
+}
+
+type span struct {
+	tracer   *Tracer
+	name     string
+	kind     int
+	traceID  string
+	spanID   string
+	parentID string
+	start    time.Time
+
+	mu    sync.Mutex
+	attrs []keyValue
+	end   time.Time
+	err   error
+	ended bool
+}
+
+func (s *span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, stringAttribute(key, value))
+}
+
+func (s *span) End(err error) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+
+	s.tracer.enqueue(s)
+}
+
+func (s *span) json() jsonSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	js := jsonSpan{
+		TraceID:           s.traceID,
+		SpanID:            s.spanID,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        s.attrs,
+		Status:            status{Code: statusCodeOK},
+	}
+	if s.err != nil {
+		js.Status = status{Code: statusCodeError, Message: s.err.Error()}
+	}
+	return js
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string, n int) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == n && s == strings.ToLower(s)
+}
@@ -1,6 +1,7 @@
 package palermo
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"time"
@@ -15,35 +16,176 @@ type Session struct {
 	Email  string `json:"email,omitempty"`
 	Token  string `json:"token,omitempty"`
 
+	// Anonymous marks a guest session, which carries neither user id nor
+	// email.
+	Anonymous bool `json:"anonymous,omitempty"`
+
+	// ServiceAccount marks the session of a machine, e.g. another service
+	// holding an API key, rather than of a person. It carries a user id
+	// identifying the service account, but no email is required.
+	ServiceAccount bool `json:"service_account,omitempty"`
+
+	// Source identifies where the session was created from, either a client
+	// device id or its network address.
+	Source string `json:"source,omitempty"`
+
+	// Scopes lists the permissions granted to the session.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// APIVersion restricts the session to a single API version (e.g. "v1").
+	// An empty version allows every API version.
+	APIVersion string `json:"api_version,omitempty"`
+
+	// AllowedMethods restricts the session to the listed full gRPC method
+	// names, e.g. for one-shot operations. An empty list allows every
+	// method.
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+
+	// Metadata carries application-specific data attached to the session,
+	// e.g. plan, locale or organization. It travels with the session, so it
+	// must stay small and never hold secrets.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
+
+	// NotBefore is the time from which the session is valid, e.g. for
+	// sessions scheduled ahead of time. A zero time means valid on creation.
+	NotBefore time.Time `json:"not_before,omitempty"`
+
+	// TokenID is the id (jti) of the credentials the session was read from.
+	TokenID string `json:"jti,omitempty"`
+
+	// ExpiresAt is the expiry of the credentials the session was read from.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	// RefreshableAt is the earliest time the credentials the session was read
+	// from may be refreshed. A zero time means no refresh window applies.
+	RefreshableAt time.Time `json:"refreshable_at,omitempty"`
+}
+
+// IsAnonymous reports whether the session belongs to a guest.
+func (s *Session) IsAnonymous() bool {
+	return s.Anonymous
+}
+
+// IsServiceAccount reports whether the session belongs to a machine rather
+// than to a person.
+func (s *Session) IsServiceAccount() bool {
+	return s.ServiceAccount
+}
+
+// Clone returns a copy of s sharing nothing with it, e.g. for stores and
+// caches handing out sessions callers may alter.
+func (s *Session) Clone() *Session {
+	cs := *s
+	cs.Scopes = append([]string(nil), s.Scopes...)
+	cs.AllowedMethods = append([]string(nil), s.AllowedMethods...)
+	if s.Metadata != nil {
+		cs.Metadata = make(map[string]string, len(s.Metadata))
+		for k, v := range s.Metadata {
+			cs.Metadata[k] = v
+		}
+	}
+	return &cs
 }
 
 // SessionCredentials represents credentials of an user session.
 type SessionCredentials struct {
 	ValidationToken string
 	AuthToken       string
+
+	// RefreshToken is a long-lived token only accepted to refresh the
+	// session once the other tokens expired. Empty when the SessionService
+	// issues no refresh tokens.
+	RefreshToken string
 }
 
 // SessionService manages user session and credentials. It provides methods
 // to validate and refresh credentials.
 // This interface allow the implementation of sessions using a data-store or in
-// a stateless manner.
+// a stateless manner. Every method takes a context carrying the deadline and
+// cancellation of the request, which data-store implementations must honor.
 type SessionService interface {
 	// UserSession validates and returns the associated session with the given
 	// credentials.
-	Session(s *SessionCredentials) (*Session, error)
+	Session(ctx context.Context, s *SessionCredentials) (*Session, error)
 
 	// RefreshSession validates and returns the associated session with the
 	// given credentials. This method must  contain the logic to refresh a
 	// session, which are implementation details.
-	RefreshSession(s *SessionCredentials) (*Session, error)
+	RefreshSession(ctx context.Context, s *SessionCredentials) (*Session, error)
 
 	// Session creates credentials for the given session.
-	CreateSession(s *Session) (*SessionCredentials, error)
+	CreateSession(ctx context.Context, s *Session) (*SessionCredentials, error)
 
 	// Session creates credentials for the given session.
-	UpdateSession(s *Session) (*SessionCredentials, error)
+	UpdateSession(ctx context.Context, s *Session) (*SessionCredentials, error)
+
+	// RevokeSession invalidates the given credentials before they expire,
+	// e.g. on logout.
+	RevokeSession(ctx context.Context, s *SessionCredentials) error
+}
+
+// RevocationStore keeps track of revoked credentials, for SessionService
+// implementations whose credentials cannot be deleted, e.g. stateless tokens.
+type RevocationStore interface {
+	// Revoke marks the credentials identified by tokenID as revoked. The
+	// record may be dropped once the credentials expire, at expiresAt.
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+
+	// IsRevoked reports whether the credentials identified by tokenID were
+	// revoked.
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// ReplayGuard records consumed one-time credentials, e.g. refresh tokens, so
+// that they cannot be used twice.
+type ReplayGuard interface {
+	// Consume marks the credentials identified by tokenID as used, and
+	// reports whether they were used for the first time. The record may be
+	// dropped once the credentials expire, at expiresAt.
+	Consume(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+}
+
+// HealthChecker is implemented by components relying on a remote backend,
+// e.g. a database, so that probes can tell whether it is reachable.
+type HealthChecker interface {
+	// Check returns an error when the backend cannot be used.
+	Check(ctx context.Context) error
+}
+
+// SecretProvider supplies a secret kept outside of the service, e.g. the
+// signing key stored in a secret manager, so that it can be rotated without
+// redeploying.
+type SecretProvider interface {
+	// Secret returns the current value of the secret.
+	Secret(ctx context.Context) ([]byte, error)
+}
+
+// SessionExporter is implemented by SessionService backends that store
+// sessions server-side and can stream them out.
+type SessionExporter interface {
+	// ExportSessions calls fn for every stored session. Implementations must
+	// scan the store in bounded batches instead of loading every session in
+	// memory. Iteration stops at the first error returned by fn.
+	ExportSessions(ctx context.Context, fn func(*Session) error) error
+}
+
+// SessionAdmin is implemented by SessionService backends that store
+// sessions server-side, so that operators can manage the sessions of a user
+// without their credentials. Sessions are identified by their TokenID.
+type SessionAdmin interface {
+	// UserSessions returns the live sessions of the given user.
+	UserSessions(ctx context.Context, userID string) ([]*Session, error)
+
+	// RevokeSessionByTokenID deletes the session identified by tokenID and
+	// returns it.
+	RevokeSessionByTokenID(ctx context.Context, tokenID string) (*Session, error)
+
+	// RevokeUserSessions deletes every session of the given user and
+	// returns them.
+	RevokeUserSessions(ctx context.Context, userID string) ([]*Session, error)
 }
 
 // NewSession creates a new user session.
@@ -0,0 +1,36 @@
+package palermo_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+)
+
+func TestSessionClone(t *testing.T) {
+	s := &palermo.Session{
+		UserID:         "42",
+		Email:          "jane@example.com",
+		Scopes:         []string{"read"},
+		AllowedMethods: []string{"/auth.AuthService/Get"},
+		Metadata:       map[string]string{"plan": "pro"},
+		ExpiresAt:      time.Now(),
+	}
+
+	c := s.Clone()
+	if !reflect.DeepEqual(c, s) {
+		t.Fatalf("Clone() = %+v, want %+v", c, s)
+	}
+
+	c.Scopes[0] = "write"
+	c.AllowedMethods[0] = "/auth.AuthService/Revoke"
+	c.Metadata["plan"] = "free"
+	if s.Scopes[0] != "read" || s.AllowedMethods[0] != "/auth.AuthService/Get" || s.Metadata["plan"] != "pro" {
+		t.Errorf("altering the clone altered the session: %+v", s)
+	}
+
+	if c := (&palermo.Session{}).Clone(); c.Scopes != nil || c.AllowedMethods != nil || c.Metadata != nil {
+		t.Errorf("Clone() of an empty session = %+v", c)
+	}
+}
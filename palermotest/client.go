@@ -0,0 +1,357 @@
+package palermotest
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/client"
+	"github.com/go-toschool/palermo/oidc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NewClient returns a client.Client served in memory by the given sessions,
+// a new SessionService when nil.
+func NewClient(sessions palermo.SessionService) *client.Client {
+	return client.NewFromStub(NewAuthServiceClient(sessions))
+}
+
+// AuthServiceClient is an in-memory auth.AuthServiceClient serving its calls
+// with a palermo.SessionService the way the AuthService of a palermo server
+// does, without source policy nor audit. Errors are returned as gRPC
+// statuses, errors of the SessionService with codes.Unknown as by a server.
+// DeleteAll requires Sessions to implement palermo.SessionAdmin, as the
+// default SessionService does. Watch is unimplemented.
+type AuthServiceClient struct {
+	Sessions palermo.SessionService
+
+	// VerifyIDToken verifies the ID tokens exchanged on Create, e.g.
+	// returning fixed claims. The exchange fails with
+	// codes.FailedPrecondition when nil, as on a server without OIDC
+	// provider, and errors are returned with codes.Unauthenticated.
+	VerifyIDToken func(ctx context.Context, idToken string) (*oidc.Claims, error)
+}
+
+// NewAuthServiceClient returns a client served by the given sessions, a new
+// SessionService when nil.
+func NewAuthServiceClient(sessions palermo.SessionService) *AuthServiceClient {
+	if sessions == nil {
+		sessions = &SessionService{}
+	}
+	return &AuthServiceClient{Sessions: sessions}
+}
+
+// Get validates the given credentials and returns their session.
+func (ac *AuthServiceClient) Get(ctx context.Context, in *auth.GetRequest, opts ...grpc.CallOption) (*auth.GetResponse, error) {
+	if in.Data == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+	s, err := ac.Sessions.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: in.Data.ValidationToken,
+		AuthToken:       in.Data.AuthToken,
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &auth.GetResponse{Data: sessionToProto(s)}, nil
+}
+
+// Create creates credentials for the given session. As by a server, service
+// account sessions are rejected: create them with SessionService.MustCreate.
+func (ac *AuthServiceClient) Create(ctx context.Context, in *auth.CreateRequest, opts ...grpc.CallOption) (*auth.CreateResponse, error) {
+	data := in.Data
+	if data == nil {
+		if in.IdToken == "" {
+			return nil, status.Error(codes.InvalidArgument, "missing session")
+		}
+		data = &auth.Session{}
+	}
+	if data.ServiceAccount {
+		return nil, status.Error(codes.PermissionDenied, "service account credentials are only created by the AdminService")
+	}
+	now := time.Now()
+	s := &palermo.Session{
+		ID:             data.Id,
+		UserID:         data.UserId,
+		Email:          data.Email,
+		Token:          data.Token,
+		Anonymous:      data.Anonymous,
+		Source:         data.Source,
+		Scopes:         data.Scopes,
+		APIVersion:     data.ApiVersion,
+		AllowedMethods: data.AllowedMethods,
+		Metadata:       data.Metadata,
+		NotBefore:      fromUnix(data.NotBefore),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if in.IdToken != "" {
+		if ac.VerifyIDToken == nil {
+			return nil, status.Error(codes.FailedPrecondition, "OIDC token exchange is not enabled")
+		}
+		claims, err := ac.VerifyIDToken(ctx, in.IdToken)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid ID token")
+		}
+		s.UserID, s.Email, s.Anonymous = claims.Subject, claims.Email, false
+	}
+
+	c, err := ac.Sessions.CreateSession(ctx, s)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &auth.CreateResponse{Data: credentialsToProto(c)}, nil
+}
+
+// Update refreshes the given credentials, handing out new ones when
+// refreshed with a refresh token.
+func (ac *AuthServiceClient) Update(ctx context.Context, in *auth.UpdateRequest, opts ...grpc.CallOption) (*auth.UpdateResponse, error) {
+	if in.Data == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+	s, nc, err := ac.refresh(ctx, credentialsFromProto(in.Data))
+	if err != nil {
+		return nil, err
+	}
+	return &auth.UpdateResponse{Data: sessionToProto(s), Credentials: credentialsToProto(nc)}, nil
+}
+
+// GetOrRefresh validates the given credentials, refreshing them once their
+// refresh window is open or, when they carry a refresh token, once invalid.
+func (ac *AuthServiceClient) GetOrRefresh(ctx context.Context, in *auth.GetOrRefreshRequest, opts ...grpc.CallOption) (*auth.GetOrRefreshResponse, error) {
+	if in.Data == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+	c := credentialsFromProto(in.Data)
+
+	s, err := ac.Sessions.Session(ctx, c)
+	if err != nil && c.RefreshToken == "" {
+		return nil, toStatus(err)
+	}
+	if err == nil && (s.RefreshableAt.IsZero() || time.Now().Before(s.RefreshableAt)) {
+		return &auth.GetOrRefreshResponse{Data: sessionToProto(s)}, nil
+	}
+
+	s, err = ac.Sessions.RefreshSession(ctx, c)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	nc, err := ac.Sessions.UpdateSession(ctx, s)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &auth.GetOrRefreshResponse{Data: sessionToProto(s), Credentials: credentialsToProto(nc)}, nil
+}
+
+// Delete revokes the given credentials of a user.
+func (ac *AuthServiceClient) Delete(ctx context.Context, in *auth.DeleteRequest, opts ...grpc.CallOption) (*auth.DeleteResponse, error) {
+	if in.Credentials == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+	c := &palermo.SessionCredentials{
+		ValidationToken: in.Credentials.ValidationToken,
+		AuthToken:       in.Credentials.AuthToken,
+	}
+
+	s, err := ac.Sessions.Session(ctx, c)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if s.UserID != in.UserId {
+		return nil, status.Error(codes.PermissionDenied, "credentials do not belong to user")
+	}
+	if err := ac.Sessions.RevokeSession(ctx, c); err != nil {
+		return nil, toStatus(err)
+	}
+	return &auth.DeleteResponse{Data: &auth.User{UserId: s.UserID, Email: s.Email}}, nil
+}
+
+// DeleteAll revokes every session of a user given the credentials of one of
+// them.
+func (ac *AuthServiceClient) DeleteAll(ctx context.Context, in *auth.DeleteAllRequest, opts ...grpc.CallOption) (*auth.DeleteAllResponse, error) {
+	admin, ok := ac.Sessions.(palermo.SessionAdmin)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "session backend does not support revoking every session of a user")
+	}
+	if in.Credentials == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+
+	s, err := ac.Sessions.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: in.Credentials.ValidationToken,
+		AuthToken:       in.Credentials.AuthToken,
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if s.UserID != in.UserId {
+		return nil, status.Error(codes.PermissionDenied, "credentials do not belong to user")
+	}
+	sessions, err := admin.RevokeUserSessions(ctx, s.UserID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &auth.DeleteAllResponse{
+		Data:    &auth.User{UserId: s.UserID, Email: s.Email},
+		Revoked: int32(len(sessions)),
+	}, nil
+}
+
+// Introspect reports whether the given credentials are active along with a
+// few of their claims.
+func (ac *AuthServiceClient) Introspect(ctx context.Context, in *auth.IntrospectRequest, opts ...grpc.CallOption) (*auth.IntrospectResponse, error) {
+	if in.Credentials == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+	s, err := ac.Sessions.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: in.Credentials.ValidationToken,
+		AuthToken:       in.Credentials.AuthToken,
+	})
+	if err != nil {
+		return &auth.IntrospectResponse{}, nil
+	}
+	return &auth.IntrospectResponse{
+		Active:         true,
+		Scope:          strings.Join(s.Scopes, " "),
+		Sub:            s.UserID,
+		Exp:            unixTime(s.ExpiresAt),
+		Nbf:            unixTime(s.NotBefore),
+		Jti:            s.TokenID,
+		Anonymous:      s.Anonymous,
+		ServiceAccount: s.ServiceAccount,
+	}, nil
+}
+
+// Watch is unimplemented.
+func (ac *AuthServiceClient) Watch(ctx context.Context, in *auth.WatchRequest, opts ...grpc.CallOption) (auth.AuthService_WatchClient, error) {
+	return nil, status.Error(codes.Unimplemented, "palermotest: Watch is not implemented")
+}
+
+// ValidateBatch validates each of the given credentials.
+func (ac *AuthServiceClient) ValidateBatch(ctx context.Context, in *auth.ValidateBatchRequest, opts ...grpc.CallOption) (*auth.ValidateBatchResponse, error) {
+	results := make([]*auth.ValidateBatchResponse_Result, len(in.Credentials))
+	for i, c := range in.Credentials {
+		if c == nil {
+			results[i] = &auth.ValidateBatchResponse_Result{Error: "missing credentials"}
+			continue
+		}
+		s, err := ac.Sessions.Session(ctx, &palermo.SessionCredentials{
+			ValidationToken: c.ValidationToken,
+			AuthToken:       c.AuthToken,
+		})
+		if err != nil {
+			results[i] = &auth.ValidateBatchResponse_Result{Error: status.Convert(err).Message()}
+			continue
+		}
+		results[i] = &auth.ValidateBatchResponse_Result{Data: sessionToProto(s)}
+	}
+	return &auth.ValidateBatchResponse{Results: results}, nil
+}
+
+// Validate reports whether the given credentials are valid along with their
+// expiry. Invalid credentials are not an error.
+func (ac *AuthServiceClient) Validate(ctx context.Context, in *auth.ValidateRequest, opts ...grpc.CallOption) (*auth.ValidateResponse, error) {
+	if in.Credentials == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing credentials")
+	}
+	s, err := ac.Sessions.Session(ctx, &palermo.SessionCredentials{
+		ValidationToken: in.Credentials.ValidationToken,
+		AuthToken:       in.Credentials.AuthToken,
+	})
+	if err != nil {
+		return &auth.ValidateResponse{}, nil
+	}
+	return &auth.ValidateResponse{Valid: true, ExpiresAt: unixTime(s.ExpiresAt)}, nil
+}
+
+// refresh refreshes c and, when it carries a refresh token, returns the
+// credentials replacing it.
+func (ac *AuthServiceClient) refresh(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, *palermo.SessionCredentials, error) {
+	s, err := ac.Sessions.RefreshSession(ctx, c)
+	if err != nil {
+		return nil, nil, toStatus(err)
+	}
+	if c.RefreshToken == "" {
+		return s, nil, nil
+	}
+	nc, err := ac.Sessions.UpdateSession(ctx, s)
+	if err != nil {
+		return nil, nil, toStatus(err)
+	}
+	return s, nc, nil
+}
+
+// toStatus converts err as a gRPC server would: statuses are kept, context
+// errors get their code and other errors codes.Unknown.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch err {
+	case context.Canceled, context.DeadlineExceeded:
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+func credentialsToProto(c *palermo.SessionCredentials) *auth.SessionCredentials {
+	if c == nil {
+		return nil
+	}
+	return &auth.SessionCredentials{
+		ValidationToken: c.ValidationToken,
+		AuthToken:       c.AuthToken,
+		RefreshToken:    c.RefreshToken,
+	}
+}
+
+func credentialsFromProto(c *auth.SessionCredentials) *palermo.SessionCredentials {
+	return &palermo.SessionCredentials{
+		ValidationToken: c.ValidationToken,
+		AuthToken:       c.AuthToken,
+		RefreshToken:    c.RefreshToken,
+	}
+}
+
+func sessionToProto(s *palermo.Session) *auth.Session {
+	return &auth.Session{
+		Id:             s.ID,
+		UserId:         s.UserID,
+		Email:          s.Email,
+		Token:          s.Token,
+		Anonymous:      s.Anonymous,
+		ServiceAccount: s.ServiceAccount,
+		Source:         s.Source,
+		Scopes:         s.Scopes,
+		ApiVersion:     s.APIVersion,
+		AllowedMethods: s.AllowedMethods,
+		Metadata:       s.Metadata,
+		CreatedAt:      unixTime(s.CreatedAt),
+		UpdatedAt:      unixTime(s.UpdatedAt),
+		ExpiresAt:      unixTime(s.ExpiresAt),
+		RefreshableAt:  unixTime(s.RefreshableAt),
+		NotBefore:      unixTime(s.NotBefore),
+		TokenId:        s.TokenID,
+	}
+}
+
+// unixTime returns t in Unix seconds, or 0 when t is the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// fromUnix returns the time of the given Unix seconds, or the zero time for
+// 0.
+func fromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,188 @@
+package palermotest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/auth"
+	"github.com/go-toschool/palermo/oidc"
+	"github.com/go-toschool/palermo/palermotest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ auth.AuthServiceClient = (*palermotest.AuthServiceClient)(nil)
+
+func TestAuthServiceClient(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		call     func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error
+		wantCode codes.Code
+	}{
+		{"Get", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			resp, err := ac.Get(ctx, &auth.GetRequest{Data: c})
+			if err == nil && (resp.Data.UserId != "42" || resp.Data.TokenId == "") {
+				return errors.New("unexpected session")
+			}
+			return err
+		}, codes.OK},
+		{"Get without credentials", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			_, err := ac.Get(ctx, &auth.GetRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"Get with invalid credentials", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			_, err := ac.Get(ctx, &auth.GetRequest{Data: &auth.SessionCredentials{AuthToken: "a", ValidationToken: "v"}})
+			return err
+		}, codes.Unknown},
+		{"Create service account", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			_, err := ac.Create(ctx, &auth.CreateRequest{Data: &auth.Session{UserId: "svc", Email: "svc@example.com", ServiceAccount: true}})
+			return err
+		}, codes.PermissionDenied},
+		{"Create from ID token without verifier", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			_, err := ac.Create(ctx, &auth.CreateRequest{IdToken: "id"})
+			return err
+		}, codes.FailedPrecondition},
+		{"Create from ID token", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			ac.VerifyIDToken = func(ctx context.Context, idToken string) (*oidc.Claims, error) {
+				return &oidc.Claims{Subject: "43", Email: "joe@example.com"}, nil
+			}
+			resp, err := ac.Create(ctx, &auth.CreateRequest{IdToken: "id"})
+			if err != nil {
+				return err
+			}
+			s, err := ac.Get(ctx, &auth.GetRequest{Data: resp.Data})
+			if err == nil && s.Data.UserId != "43" {
+				return errors.New("session not created for the ID token subject")
+			}
+			return err
+		}, codes.OK},
+		{"Create from invalid ID token", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			ac.VerifyIDToken = func(ctx context.Context, idToken string) (*oidc.Claims, error) {
+				return nil, errors.New("expired")
+			}
+			_, err := ac.Create(ctx, &auth.CreateRequest{IdToken: "id"})
+			return err
+		}, codes.Unauthenticated},
+		{"Update", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			resp, err := ac.Update(ctx, &auth.UpdateRequest{Data: c})
+			if err == nil && resp.Credentials != nil {
+				return errors.New("new credentials without refresh token")
+			}
+			return err
+		}, codes.OK},
+		{"GetOrRefresh without refresh window", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			resp, err := ac.GetOrRefresh(ctx, &auth.GetOrRefreshRequest{Data: c})
+			if err == nil && resp.Credentials != nil {
+				return errors.New("refreshed outside the refresh window")
+			}
+			return err
+		}, codes.OK},
+		{"Delete", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			if _, err := ac.Delete(ctx, &auth.DeleteRequest{UserId: "42", Credentials: c}); err != nil {
+				return err
+			}
+			_, err := ac.Get(ctx, &auth.GetRequest{Data: c})
+			return err
+		}, codes.Unknown},
+		{"Delete credentials of another user", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			_, err := ac.Delete(ctx, &auth.DeleteRequest{UserId: "43", Credentials: c})
+			return err
+		}, codes.PermissionDenied},
+		{"DeleteAll", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			resp, err := ac.DeleteAll(ctx, &auth.DeleteAllRequest{UserId: "42", Credentials: c})
+			if err == nil && resp.Revoked != 2 {
+				return errors.New("not every session revoked")
+			}
+			return err
+		}, codes.OK},
+		{"Introspect", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			resp, err := ac.Introspect(ctx, &auth.IntrospectRequest{Credentials: c})
+			if err == nil && (!resp.Active || resp.Sub != "42" || resp.Scope != "read write") {
+				return errors.New("unexpected introspection")
+			}
+			return err
+		}, codes.OK},
+		{"Introspect invalid credentials", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			resp, err := ac.Introspect(ctx, &auth.IntrospectRequest{Credentials: &auth.SessionCredentials{AuthToken: "a"}})
+			if err == nil && resp.Active {
+				return errors.New("invalid credentials active")
+			}
+			return err
+		}, codes.OK},
+		{"Validate", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			resp, err := ac.Validate(ctx, &auth.ValidateRequest{Credentials: c})
+			if err == nil && (!resp.Valid || resp.ExpiresAt == 0) {
+				return errors.New("valid credentials reported invalid")
+			}
+			return err
+		}, codes.OK},
+		{"ValidateBatch", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			resp, err := ac.ValidateBatch(ctx, &auth.ValidateBatchRequest{Credentials: []*auth.SessionCredentials{c, nil, {AuthToken: "a"}}})
+			if err != nil {
+				return err
+			}
+			r := resp.Results
+			if len(r) != 3 || r[0].Data == nil || r[1].Error == "" || r[2].Error == "" {
+				return errors.New("unexpected batch results")
+			}
+			return nil
+		}, codes.OK},
+		{"Watch", func(ac *palermotest.AuthServiceClient, c *auth.SessionCredentials) error {
+			_, err := ac.Watch(ctx, &auth.WatchRequest{})
+			return err
+		}, codes.Unimplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &palermotest.SessionService{}
+			sessions.MustCreate(&palermo.Session{UserID: "42", Email: "jane@example.com"})
+			c := sessions.MustCreate(&palermo.Session{UserID: "42", Email: "jane@example.com", Scopes: []string{"read", "write"}})
+			ac := palermotest.NewAuthServiceClient(sessions)
+
+			err := tt.call(ac, &auth.SessionCredentials{ValidationToken: c.ValidationToken, AuthToken: c.AuthToken})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("%s = %v, want %v", tt.name, err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	ctx := context.Background()
+	errDown := status.Error(codes.Unavailable, "palermo is down")
+	tests := []struct {
+		name        string
+		sessionFunc func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error)
+		wantCode    codes.Code
+	}{
+		{"backend", nil, codes.OK},
+		{"injected failure", func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+			return nil, errDown
+		}, codes.Unavailable},
+		{"canceled", func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+			return nil, context.Canceled
+		}, codes.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &palermotest.SessionService{SessionFunc: tt.sessionFunc}
+			c := palermotest.NewClient(sessions)
+			creds, err := c.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := c.Session(ctx, creds)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Session() = %v, want %v", err, tt.wantCode)
+			}
+			if err == nil && s.UserID != "42" {
+				t.Errorf("got session of %q", s.UserID)
+			}
+		})
+	}
+}
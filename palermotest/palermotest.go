@@ -0,0 +1,190 @@
+// Package palermotest provides test doubles of palermo services, so that
+// downstream services can unit-test their auth integration without running a
+// palermo server:
+//
+//	sessions := &palermotest.SessionService{}
+//	creds := sessions.MustCreate(&palermo.Session{UserID: "42", Email: "jane@example.com"})
+//
+//	c := palermotest.NewClient(sessions)
+//	s, err := c.Session(ctx, creds)
+//
+// Failures are injected by overriding the methods of the fake:
+//
+//	sessions.SessionFunc = func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+//		return nil, status.Error(codes.Unavailable, "palermo is down")
+//	}
+package palermotest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/memory"
+)
+
+// DefaultMaxAge is the lifetime of the sessions of a SessionService without
+// Backend.
+const DefaultMaxAge = time.Hour
+
+// ErrNotAdmin is returned by the palermo.SessionAdmin methods of a
+// SessionService whose Backend does not implement them.
+var ErrNotAdmin = errors.New("palermotest: backend does not implement palermo.SessionAdmin")
+
+// SessionService is a configurable fake palermo.SessionService, and
+// palermo.SessionAdmin. Each method calls its override when set, else the
+// Backend. The zero value keeps sessions in memory. Its fields must be set
+// before its first call.
+type SessionService struct {
+	// Backend serves the methods without override. Defaults to a
+	// memory.SessionService keeping sessions for DefaultMaxAge.
+	Backend palermo.SessionService
+
+	SessionFunc        func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error)
+	RefreshSessionFunc func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error)
+	CreateSessionFunc  func(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error)
+	UpdateSessionFunc  func(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error)
+	RevokeSessionFunc  func(ctx context.Context, c *palermo.SessionCredentials) error
+
+	UserSessionsFunc           func(ctx context.Context, userID string) ([]*palermo.Session, error)
+	RevokeSessionByTokenIDFunc func(ctx context.Context, tokenID string) (*palermo.Session, error)
+	RevokeUserSessionsFunc     func(ctx context.Context, userID string) ([]*palermo.Session, error)
+
+	mu      sync.Mutex
+	calls   []string
+	backend palermo.SessionService
+}
+
+// Session calls SessionFunc, else the backend.
+func (ss *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	b := ss.record("Session")
+	if ss.SessionFunc != nil {
+		return ss.SessionFunc(ctx, c)
+	}
+	return b.Session(ctx, c)
+}
+
+// RefreshSession calls RefreshSessionFunc, else the backend.
+func (ss *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	b := ss.record("RefreshSession")
+	if ss.RefreshSessionFunc != nil {
+		return ss.RefreshSessionFunc(ctx, c)
+	}
+	return b.RefreshSession(ctx, c)
+}
+
+// CreateSession calls CreateSessionFunc, else the backend.
+func (ss *SessionService) CreateSession(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error) {
+	b := ss.record("CreateSession")
+	if ss.CreateSessionFunc != nil {
+		return ss.CreateSessionFunc(ctx, s)
+	}
+	return b.CreateSession(ctx, s)
+}
+
+// UpdateSession calls UpdateSessionFunc, else the backend.
+func (ss *SessionService) UpdateSession(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error) {
+	b := ss.record("UpdateSession")
+	if ss.UpdateSessionFunc != nil {
+		return ss.UpdateSessionFunc(ctx, s)
+	}
+	return b.UpdateSession(ctx, s)
+}
+
+// RevokeSession calls RevokeSessionFunc, else the backend.
+func (ss *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	b := ss.record("RevokeSession")
+	if ss.RevokeSessionFunc != nil {
+		return ss.RevokeSessionFunc(ctx, c)
+	}
+	return b.RevokeSession(ctx, c)
+}
+
+// UserSessions calls UserSessionsFunc, else the backend.
+func (ss *SessionService) UserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	b := ss.record("UserSessions")
+	if ss.UserSessionsFunc != nil {
+		return ss.UserSessionsFunc(ctx, userID)
+	}
+	admin, ok := b.(palermo.SessionAdmin)
+	if !ok {
+		return nil, ErrNotAdmin
+	}
+	return admin.UserSessions(ctx, userID)
+}
+
+// RevokeSessionByTokenID calls RevokeSessionByTokenIDFunc, else the backend.
+func (ss *SessionService) RevokeSessionByTokenID(ctx context.Context, tokenID string) (*palermo.Session, error) {
+	b := ss.record("RevokeSessionByTokenID")
+	if ss.RevokeSessionByTokenIDFunc != nil {
+		return ss.RevokeSessionByTokenIDFunc(ctx, tokenID)
+	}
+	admin, ok := b.(palermo.SessionAdmin)
+	if !ok {
+		return nil, ErrNotAdmin
+	}
+	return admin.RevokeSessionByTokenID(ctx, tokenID)
+}
+
+// RevokeUserSessions calls RevokeUserSessionsFunc, else the backend.
+func (ss *SessionService) RevokeUserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	b := ss.record("RevokeUserSessions")
+	if ss.RevokeUserSessionsFunc != nil {
+		return ss.RevokeUserSessionsFunc(ctx, userID)
+	}
+	admin, ok := b.(palermo.SessionAdmin)
+	if !ok {
+		return nil, ErrNotAdmin
+	}
+	return admin.RevokeUserSessions(ctx, userID)
+}
+
+// MustCreate creates credentials for the given session with the backend,
+// bypassing CreateSessionFunc, and panics on failure. It seeds the fake with
+// the sessions of a test.
+func (ss *SessionService) MustCreate(s *palermo.Session) *palermo.SessionCredentials {
+	ss.mu.Lock()
+	b := ss.backendLocked()
+	ss.mu.Unlock()
+
+	c, err := b.CreateSession(context.Background(), s)
+	if err != nil {
+		panic("palermotest: " + err.Error())
+	}
+	return c
+}
+
+// Calls returns the names of the methods called so far, in order, e.g.
+// "Session", seeding with MustCreate excluded.
+func (ss *SessionService) Calls() []string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return append([]string(nil), ss.calls...)
+}
+
+// Reset forgets the calls recorded so far.
+func (ss *SessionService) Reset() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.calls = nil
+}
+
+// record records a call of the named method and returns the backend.
+func (ss *SessionService) record(method string) palermo.SessionService {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.calls = append(ss.calls, method)
+	return ss.backendLocked()
+}
+
+func (ss *SessionService) backendLocked() palermo.SessionService {
+	if ss.Backend != nil {
+		return ss.Backend
+	}
+	if ss.backend == nil {
+		ss.backend = &memory.SessionService{MaxAge: DefaultMaxAge}
+	}
+	return ss.backend
+}
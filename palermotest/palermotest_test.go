@@ -0,0 +1,136 @@
+package palermotest_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/jwt"
+	"github.com/go-toschool/palermo/memory"
+	"github.com/go-toschool/palermo/palermotest"
+)
+
+var (
+	_ palermo.SessionService = (*palermotest.SessionService)(nil)
+	_ palermo.SessionAdmin   = (*palermotest.SessionService)(nil)
+)
+
+func TestSessionService(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("palermo is down")
+
+	tests := []struct {
+		name     string
+		sessions *palermotest.SessionService
+		call     func(ss *palermotest.SessionService, c *palermo.SessionCredentials) error
+		wantCall string
+		wantErr  error
+	}{
+		{"Session", &palermotest.SessionService{}, func(ss *palermotest.SessionService, c *palermo.SessionCredentials) error {
+			s, err := ss.Session(ctx, c)
+			if err == nil && s.UserID != "42" {
+				return errors.New("session of " + s.UserID)
+			}
+			return err
+		}, "Session", nil},
+		{"Session override", &palermotest.SessionService{
+			SessionFunc: func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+				return nil, errDown
+			},
+		}, func(ss *palermotest.SessionService, c *palermo.SessionCredentials) error {
+			_, err := ss.Session(ctx, c)
+			return err
+		}, "Session", errDown},
+		{"RefreshSession", &palermotest.SessionService{}, func(ss *palermotest.SessionService, c *palermo.SessionCredentials) error {
+			_, err := ss.RefreshSession(ctx, c)
+			return err
+		}, "RefreshSession", nil},
+		{"CreateSession override", &palermotest.SessionService{
+			CreateSessionFunc: func(ctx context.Context, s *palermo.Session) (*palermo.SessionCredentials, error) {
+				return nil, errDown
+			},
+		}, func(ss *palermotest.SessionService, c *palermo.SessionCredentials) error {
+			_, err := ss.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+			return err
+		}, "CreateSession", errDown},
+		{"RevokeSession", &palermotest.SessionService{}, func(ss *palermotest.SessionService, c *palermo.SessionCredentials) error {
+			if err := ss.RevokeSession(ctx, c); err != nil {
+				return err
+			}
+			if _, err := ss.Backend.Session(ctx, c); err == nil {
+				return errors.New("session not revoked")
+			}
+			return nil
+		}, "RevokeSession", nil},
+		{"UserSessions", &palermotest.SessionService{}, func(ss *palermotest.SessionService, c *palermo.SessionCredentials) error {
+			sessions, err := ss.UserSessions(ctx, "42")
+			if err == nil && len(sessions) != 1 {
+				return errors.New("sessions of another user")
+			}
+			return err
+		}, "UserSessions", nil},
+		{"RevokeUserSessions of a backend without admin", &palermotest.SessionService{
+			Backend: &jwt.SessionService{SecretKey: []byte("0123456789abcdef0123456789abcdef"), MaxAge: time.Hour},
+		}, func(ss *palermotest.SessionService, c *palermo.SessionCredentials) error {
+			_, err := ss.RevokeUserSessions(ctx, "42")
+			return err
+		}, "RevokeUserSessions", palermotest.ErrNotAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.sessions.Backend == nil {
+				tt.sessions.Backend = &memory.SessionService{MaxAge: time.Hour}
+			}
+			c := tt.sessions.MustCreate(&palermo.Session{UserID: "42", Email: "jane@example.com"})
+			if calls := tt.sessions.Calls(); len(calls) != 0 {
+				t.Errorf("MustCreate() recorded %q", calls)
+			}
+
+			if err := tt.call(tt.sessions, c); err != tt.wantErr {
+				t.Errorf("%s = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if calls := tt.sessions.Calls(); !reflect.DeepEqual(calls, []string{tt.wantCall}) {
+				t.Errorf("Calls() = %q, want %q", calls, tt.wantCall)
+			}
+			tt.sessions.Reset()
+			if calls := tt.sessions.Calls(); len(calls) != 0 {
+				t.Errorf("Calls() after Reset() = %q", calls)
+			}
+		})
+	}
+}
+
+func TestSessionServiceDefaultBackend(t *testing.T) {
+	ctx := context.Background()
+	ss := &palermotest.SessionService{}
+	c, err := ss.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ss.Session(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(s.ExpiresAt); d <= palermotest.DefaultMaxAge-time.Minute || d > palermotest.DefaultMaxAge {
+		t.Errorf("session expires in %v, want %v", d, palermotest.DefaultMaxAge)
+	}
+	if _, err := ss.RevokeSessionByTokenID(ctx, s.TokenID); err != nil {
+		t.Errorf("RevokeSessionByTokenID() = %v", err)
+	}
+	if _, err := ss.Session(ctx, c); err == nil {
+		t.Error("Session() accepted revoked credentials")
+	}
+}
+
+func TestMustCreatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustCreate() of an invalid session did not panic")
+		}
+	}()
+	(&palermotest.SessionService{}).MustCreate(&palermo.Session{UserID: "42", ServiceAccount: true})
+}
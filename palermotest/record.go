@@ -0,0 +1,136 @@
+package palermotest
+
+import (
+	"sync"
+
+	"github.com/go-toschool/palermo"
+)
+
+// LogEntry is an entry received by a Logger.
+type LogEntry struct {
+	Level   string
+	Message string
+	Fields  palermo.Fields
+}
+
+// Logger is a palermo.Logger recording its entries.
+type Logger struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	parent  *Logger
+	fields  palermo.Fields
+}
+
+// Debug records a debug entry.
+func (l *Logger) Debug(msg string, fields palermo.Fields) { l.log("debug", msg, fields) }
+
+// Info records an info entry.
+func (l *Logger) Info(msg string, fields palermo.Fields) { l.log("info", msg, fields) }
+
+// Warn records a warning entry.
+func (l *Logger) Warn(msg string, fields palermo.Fields) { l.log("warn", msg, fields) }
+
+// Error records an error entry.
+func (l *Logger) Error(msg string, fields palermo.Fields) { l.log("error", msg, fields) }
+
+// With returns a logger adding fields to the entries it records into l.
+func (l *Logger) With(fields palermo.Fields) palermo.Logger {
+	return &Logger{parent: l.root(), fields: merge(l.fields, fields)}
+}
+
+// Entries returns the recorded entries, oldest first.
+func (l *Logger) Entries() []LogEntry {
+	r := l.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]LogEntry(nil), r.entries...)
+}
+
+// Messages returns the messages of the entries of the given level.
+func (l *Logger) Messages(level string) []string {
+	var msgs []string
+	for _, e := range l.Entries() {
+		if e.Level == level {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	return msgs
+}
+
+func (l *Logger) log(level, msg string, fields palermo.Fields) {
+	r := l.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, LogEntry{Level: level, Message: msg, Fields: merge(l.fields, fields)})
+}
+
+func (l *Logger) root() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
+}
+
+func merge(a, b palermo.Fields) palermo.Fields {
+	f := make(palermo.Fields, len(a)+len(b))
+	for k, v := range a {
+		f[k] = v
+	}
+	for k, v := range b {
+		f[k] = v
+	}
+	return f
+}
+
+// Metric is a metric call received by a Metrics.
+type Metric struct {
+	Kind   string
+	Name   string
+	Value  float64
+	Labels map[string]string
+}
+
+// Metrics is a palermo.Metrics recording its calls.
+type Metrics struct {
+	mu    sync.Mutex
+	calls []Metric
+}
+
+// IncCounter records a counter increment.
+func (m *Metrics) IncCounter(name string, labels map[string]string) {
+	m.record(Metric{Kind: "counter", Name: name, Value: 1, Labels: labels})
+}
+
+// ObserveHistogram records a histogram observation.
+func (m *Metrics) ObserveHistogram(name string, value float64, labels map[string]string) {
+	m.record(Metric{Kind: "histogram", Name: name, Value: value, Labels: labels})
+}
+
+// SetGauge records a gauge update.
+func (m *Metrics) SetGauge(name string, value float64, labels map[string]string) {
+	m.record(Metric{Kind: "gauge", Name: name, Value: value, Labels: labels})
+}
+
+// Calls returns the recorded calls, oldest first.
+func (m *Metrics) Calls() []Metric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Metric(nil), m.calls...)
+}
+
+// Last returns the last call of the named metric, if any.
+func (m *Metrics) Last(name string) (Metric, bool) {
+	calls := m.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].Name == name {
+			return calls[i], true
+		}
+	}
+	return Metric{}, false
+}
+
+func (m *Metrics) record(c Metric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, c)
+}
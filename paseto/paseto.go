@@ -0,0 +1,410 @@
+// Package paseto implements palermo.SessionService using PASETO tokens.
+//
+// PASETO is a misuse-resistant alternative to JWT: each protocol version pins
+// its algorithms, so tokens cannot downgrade them. Local tokens are encrypted
+// with a shared key and public tokens are signed with Ed25519. Credentials
+// are made of a validation and an authentication token as with the jwt
+// package, so both packages serve the same gRPC surface:
+//
+//  - Validation Token claims: jti, iat, sub, exp, nbf, iss, aud, id, user_id
+//  - Authentication Token claims: the validation token ones, email, token,
+//    anon, src, scp, ver_api, allowed_methods, metadata, created_at,
+//    updated_at
+package paseto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-toschool/palermo"
+)
+
+// Protocols, made of a PASETO version and purpose.
+const (
+	V2Local  = "v2.local"
+	V2Public = "v2.public"
+	V4Local  = "v4.local"
+	V4Public = "v4.public"
+)
+
+// KeySize is the size of the shared keys of local protocols.
+const KeySize = 32
+
+const tokenIDnumBytes = 32
+
+// ErrUnsupportedProtocol is returned when the service is configured with an
+// unknown protocol.
+var ErrUnsupportedProtocol = errors.New("paseto: unsupported protocol")
+
+// ErrInvalidKey is returned when the service lacks the key its protocol
+// requires, or holds one of the wrong size.
+var ErrInvalidKey = errors.New("paseto: invalid key")
+
+// ErrNoSigningKey is returned when minting public tokens with a service only
+// holding a public key.
+var ErrNoSigningKey = errors.New("paseto: no signing key configured")
+
+// ErrInvalidMaxAge is returned when sessions would expire on creation.
+var ErrInvalidMaxAge = errors.New("paseto: MaxAge must be positive")
+
+// ErrExpired is returned when validating expired credentials.
+var ErrExpired = errors.New("paseto: token expired")
+
+// ErrNotValidYet is returned when validating credentials issued in the
+// future, e.g. because of clock skew.
+var ErrNotValidYet = errors.New("paseto: token not valid yet")
+
+// ErrSessionMismatch is returned when the validation and authentication tokens
+// belong to different sessions.
+var ErrSessionMismatch = errors.New("paseto: validation and authentication token sessions mismatched")
+
+// ErrRevoked is returned when validating revoked credentials.
+var ErrRevoked = errors.New("paseto: credentials revoked")
+
+// ErrRevocationUnsupported is returned when revoking credentials without a
+// revocation store.
+var ErrRevocationUnsupported = errors.New("paseto: no revocation store configured")
+
+type sessionClaims struct {
+	// Standard claims.
+	Audience  string     `json:"aud,omitempty"`
+	ExpiresAt time.Time  `json:"exp"`
+	ID        string     `json:"jti"`
+	IssuedAt  time.Time  `json:"iat"`
+	Issuer    string     `json:"iss,omitempty"`
+	NotBefore *time.Time `json:"nbf,omitempty"`
+	Subject   string     `json:"sub,omitempty"`
+
+	// Custom claims used to store user session.
+	SessionID      string            `json:"id,omitempty"`
+	UserID         string            `json:"user_id,omitempty"`
+	Email          string            `json:"email,omitempty"`
+	Token          string            `json:"token,omitempty"`
+	Anonymous      bool              `json:"anon,omitempty"`
+	Source         string            `json:"src,omitempty"`
+	Scopes         []string          `json:"scp,omitempty"`
+	APIVersion     string            `json:"ver_api,omitempty"`
+	AllowedMethods []string          `json:"allowed_methods,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	CreatedAt      int64             `json:"created_at,omitempty"`
+	UpdatedAt      int64             `json:"updated_at,omitempty"`
+}
+
+func (sc *sessionClaims) Session() *palermo.Session {
+	s := &palermo.Session{
+		ID:             sc.SessionID,
+		UserID:         sc.UserID,
+		Email:          sc.Email,
+		Token:          sc.Token,
+		Anonymous:      sc.Anonymous,
+		Source:         sc.Source,
+		Scopes:         sc.Scopes,
+		APIVersion:     sc.APIVersion,
+		AllowedMethods: sc.AllowedMethods,
+		Metadata:       sc.Metadata,
+		CreatedAt:      time.Unix(sc.CreatedAt, 0),
+		UpdatedAt:      time.Unix(sc.UpdatedAt, 0),
+		TokenID:        sc.ID,
+		ExpiresAt:      sc.ExpiresAt,
+	}
+	if sc.NotBefore != nil {
+		s.NotBefore = *sc.NotBefore
+	}
+	return s
+}
+
+// SessionService implements palermo.SessionService using PASETO tokens.
+type SessionService struct {
+	// Protocol is the version and purpose of tokens, V4Local by default.
+	// Version 4 is preferred for new deployments, version 2 being kept for
+	// interoperability.
+	Protocol string
+
+	// SecretKey encrypts local tokens. It must be KeySize bytes long.
+	SecretKey []byte
+
+	// PrivateKey signs public tokens.
+	PrivateKey ed25519.PrivateKey
+
+	// PublicKey verifies public tokens. Defaults to the public part of
+	// PrivateKey, so services only holding a public key can validate tokens
+	// but not mint them.
+	PublicKey ed25519.PublicKey
+
+	// MaxAge is the lifetime of credentials.
+	MaxAge time.Duration
+
+	// Issuer is the issuer (iss) of minted tokens. When set, validated
+	// tokens must carry it.
+	Issuer string
+
+	// Audience is the audience (aud) of issued tokens. When set, validated
+	// tokens must carry it.
+	Audience string
+
+	// RevocationStore records revoked tokens, which are rejected until they
+	// expire. When nil, tokens cannot be revoked.
+	RevocationStore palermo.RevocationStore
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Session validates and returns the user session associated with the given
+// credentials.
+func (ss *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	sc, err := ss.claims(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ss.now().Before(sc.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return sc.Session(), nil
+}
+
+// RefreshSession validates and returns the user session associated with the
+// given credentials, updated. Like JWT sessions, expired sessions may still
+// be refreshed.
+func (ss *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	sc, err := ss.claims(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	s := sc.Session()
+	s.UpdatedAt = ss.now()
+	return s, nil
+}
+
+// CreateSession creates new credentials for the given session.
+func (ss *SessionService) CreateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return ss.sessionCredentials(us)
+}
+
+// UpdateSession creates new credentials for the given session.
+func (ss *SessionService) UpdateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return ss.sessionCredentials(us)
+}
+
+// RevokeSession revokes the given credentials, which are rejected from then
+// on.
+func (ss *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	if ss.RevocationStore == nil {
+		return ErrRevocationUnsupported
+	}
+
+	sc, err := ss.claims(ctx, c)
+	if err != nil {
+		return err
+	}
+	return ss.RevocationStore.Revoke(ctx, sc.ID, sc.ExpiresAt)
+}
+
+// claims decrypts or verifies the tokens of the given credentials and returns
+// the claims of the authentication token. Their expiry is left to callers.
+func (ss *SessionService) claims(ctx context.Context, c *palermo.SessionCredentials) (*sessionClaims, error) {
+	authClaims, err := ss.tokenClaims(c.AuthToken)
+	if err != nil {
+		return nil, err
+	}
+
+	valClaims, err := ss.tokenClaims(c.ValidationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if authClaims.ID != valClaims.ID ||
+		!authClaims.IssuedAt.Equal(valClaims.IssuedAt) ||
+		!authClaims.ExpiresAt.Equal(valClaims.ExpiresAt) ||
+		authClaims.Subject != valClaims.Subject ||
+		authClaims.Issuer != valClaims.Issuer ||
+		authClaims.Audience != valClaims.Audience ||
+		authClaims.SessionID != valClaims.SessionID ||
+		authClaims.UserID != valClaims.UserID {
+		return nil, ErrSessionMismatch
+	}
+
+	if ss.Issuer != "" && authClaims.Issuer != ss.Issuer {
+		return nil, ErrInvalidToken
+	}
+
+	if ss.Audience != "" && authClaims.Audience != ss.Audience {
+		return nil, ErrInvalidToken
+	}
+
+	now := ss.now()
+	if authClaims.IssuedAt.After(now) || authClaims.NotBefore != nil && now.Before(*authClaims.NotBefore) {
+		return nil, ErrNotValidYet
+	}
+
+	if ss.RevocationStore != nil {
+		revoked, err := ss.RevocationStore.IsRevoked(ctx, authClaims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrRevoked
+		}
+	}
+	return authClaims, nil
+}
+
+func (ss *SessionService) sessionCredentials(us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if ss.MaxAge <= 0 {
+		return nil, ErrInvalidMaxAge
+	}
+
+	if us.ServiceAccount {
+		return nil, errors.New("paseto: service account sessions are not supported")
+	}
+
+	b := make([]byte, tokenIDnumBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	iat := ss.now().Truncate(time.Second)
+	val := &sessionClaims{
+		Audience:  ss.Audience,
+		ExpiresAt: iat.Add(ss.MaxAge),
+		ID:        base64.StdEncoding.EncodeToString(b),
+		IssuedAt:  iat,
+		Issuer:    ss.Issuer,
+		Subject:   us.Email,
+		SessionID: us.ID,
+		UserID:    us.UserID,
+	}
+	if !us.NotBefore.IsZero() {
+		nbf := us.NotBefore.Truncate(time.Second)
+		val.NotBefore = &nbf
+	}
+
+	auth := *val
+	auth.Email = us.Email
+	auth.Token = us.Token
+	auth.Anonymous = us.Anonymous
+	auth.Source = us.Source
+	auth.Scopes = us.Scopes
+	auth.APIVersion = us.APIVersion
+	auth.AllowedMethods = us.AllowedMethods
+	auth.Metadata = us.Metadata
+	auth.CreatedAt = us.CreatedAt.Unix()
+	auth.UpdatedAt = us.UpdatedAt.Unix()
+
+	validationToken, err := ss.tokenString(val)
+	if err != nil {
+		return nil, err
+	}
+
+	authToken, err := ss.tokenString(&auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &palermo.SessionCredentials{
+		ValidationToken: validationToken,
+		AuthToken:       authToken,
+	}, nil
+}
+
+func (ss *SessionService) tokenString(sc *sessionClaims) (string, error) {
+	msg, err := json.Marshal(sc)
+	if err != nil {
+		return "", err
+	}
+
+	switch ss.protocol() {
+	case V2Local:
+		if len(ss.SecretKey) != KeySize {
+			return "", ErrInvalidKey
+		}
+		return encryptV2(ss.SecretKey, msg, nil)
+	case V4Local:
+		if len(ss.SecretKey) != KeySize {
+			return "", ErrInvalidKey
+		}
+		return encryptV4(ss.SecretKey, msg, nil, nil)
+	case V2Public, V4Public:
+		if ss.PrivateKey == nil {
+			return "", ErrNoSigningKey
+		}
+		if len(ss.PrivateKey) != ed25519.PrivateKeySize {
+			return "", ErrInvalidKey
+		}
+		if ss.protocol() == V2Public {
+			return sign(v2PublicHeader, ss.PrivateKey, msg, nil), nil
+		}
+		// Version 4 binds an implicit assertion, left empty.
+		return sign(v4PublicHeader, ss.PrivateKey, msg, nil, nil), nil
+	}
+	return "", ErrUnsupportedProtocol
+}
+
+func (ss *SessionService) tokenClaims(token string) (*sessionClaims, error) {
+	var msg []byte
+	var err error
+	switch ss.protocol() {
+	case V2Local:
+		if len(ss.SecretKey) != KeySize {
+			return nil, ErrInvalidKey
+		}
+		msg, err = decryptV2(ss.SecretKey, token)
+	case V4Local:
+		if len(ss.SecretKey) != KeySize {
+			return nil, ErrInvalidKey
+		}
+		msg, err = decryptV4(ss.SecretKey, token, nil)
+	case V2Public:
+		if len(ss.publicKey()) != ed25519.PublicKeySize {
+			return nil, ErrInvalidKey
+		}
+		msg, err = verify(v2PublicHeader, ss.publicKey(), token)
+	case V4Public:
+		if len(ss.publicKey()) != ed25519.PublicKeySize {
+			return nil, ErrInvalidKey
+		}
+		msg, err = verify(v4PublicHeader, ss.publicKey(), token, nil)
+	default:
+		return nil, ErrUnsupportedProtocol
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sc sessionClaims
+	if err := json.Unmarshal(msg, &sc); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &sc, nil
+}
+
+func (ss *SessionService) protocol() string {
+	if ss.Protocol == "" {
+		return V4Local
+	}
+	return ss.Protocol
+}
+
+func (ss *SessionService) publicKey() ed25519.PublicKey {
+	if ss.PublicKey != nil {
+		return ss.PublicKey
+	}
+	if ss.PrivateKey != nil {
+		return ss.PrivateKey.Public().(ed25519.PublicKey)
+	}
+	return nil
+}
+
+func (ss *SessionService) now() time.Time {
+	if ss.Now != nil {
+		return ss.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,228 @@
+package paseto_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/memory"
+	"github.com/go-toschool/palermo/paseto"
+)
+
+var (
+	testKey        = []byte("0123456789abcdef0123456789abcdef")
+	testPrivateKey = ed25519.NewKeyFromSeed([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func newSessionService(protocol string) *paseto.SessionService {
+	return &paseto.SessionService{
+		Protocol:   protocol,
+		SecretKey:  testKey,
+		PrivateKey: testPrivateKey,
+		MaxAge:     time.Minute,
+	}
+}
+
+var protocols = []string{paseto.V2Local, paseto.V2Public, paseto.V4Local, paseto.V4Public}
+
+func TestSessionService(t *testing.T) {
+	ctx := context.Background()
+	us := &palermo.Session{
+		UserID:   "42",
+		Email:    "jane@example.com",
+		Scopes:   []string{"read"},
+		Metadata: map[string]string{"plan": "pro"},
+	}
+
+	for _, protocol := range protocols {
+		t.Run(protocol, func(t *testing.T) {
+			ss := newSessionService(protocol)
+			c, err := ss.CreateSession(ctx, us)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, token := range []string{c.AuthToken, c.ValidationToken} {
+				if !strings.HasPrefix(token, protocol+".") {
+					t.Errorf("minted %s, want a %s token", token, protocol)
+				}
+				if strings.Count(token, ".") != 2 {
+					t.Errorf("minted %s with a footer", token)
+				}
+			}
+
+			s, err := ss.Session(ctx, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.UserID != us.UserID || s.Email != us.Email || s.Scopes[0] != "read" || s.Metadata["plan"] != "pro" {
+				t.Errorf("Session() = %+v", s)
+			}
+
+			// Tokens of another protocol are rejected.
+			for _, other := range protocols {
+				if other == protocol {
+					continue
+				}
+				if _, err := newSessionService(other).Session(ctx, c); err != paseto.ErrInvalidToken {
+					t.Errorf("Session() with %s = %v, want %v", other, err, paseto.ErrInvalidToken)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionServicePublicKeyOnly(t *testing.T) {
+	ctx := context.Background()
+	verifier := &paseto.SessionService{
+		Protocol:  paseto.V4Public,
+		PublicKey: testPrivateKey.Public().(ed25519.PublicKey),
+		MaxAge:    time.Minute,
+	}
+
+	c, err := newSessionService(paseto.V4Public).CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Session(ctx, c); err != nil {
+		t.Errorf("Session() = %v", err)
+	}
+	if _, err := verifier.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"}); err != paseto.ErrNoSigningKey {
+		t.Errorf("CreateSession() = %v, want %v", err, paseto.ErrNoSigningKey)
+	}
+
+	other := &paseto.SessionService{
+		Protocol:  paseto.V4Public,
+		PublicKey: ed25519.NewKeyFromSeed(testKey).Public().(ed25519.PublicKey),
+		MaxAge:    time.Minute,
+	}
+	if _, err := other.Session(ctx, c); err != paseto.ErrInvalidToken {
+		t.Errorf("Session() with another key = %v, want %v", err, paseto.ErrInvalidToken)
+	}
+}
+
+func TestSessionServiceRejectsTamperedCredentials(t *testing.T) {
+	ctx := context.Background()
+	us := &palermo.Session{UserID: "42", Email: "jane@example.com"}
+
+	for _, protocol := range protocols {
+		t.Run(protocol, func(t *testing.T) {
+			ss := newSessionService(protocol)
+			c, err := ss.CreateSession(ctx, us)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := ss.CreateSession(ctx, us)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Flip a character in the middle of the payload.
+			i := len(protocol) + 1 + (len(c.AuthToken)-len(protocol)-1)/2
+			flipped := []byte(c.AuthToken)
+			if flipped[i] == 'A' {
+				flipped[i] = 'B'
+			} else {
+				flipped[i] = 'A'
+			}
+
+			tests := []struct {
+				name    string
+				creds   *palermo.SessionCredentials
+				wantErr error
+			}{
+				{"payload", &palermo.SessionCredentials{AuthToken: string(flipped), ValidationToken: c.ValidationToken}, paseto.ErrInvalidToken},
+				{"footer added", &palermo.SessionCredentials{AuthToken: c.AuthToken + ".Zm9vdGVy", ValidationToken: c.ValidationToken}, paseto.ErrInvalidToken},
+				{"empty footer", &palermo.SessionCredentials{AuthToken: c.AuthToken + ".", ValidationToken: c.ValidationToken}, paseto.ErrInvalidToken},
+				{"truncated", &palermo.SessionCredentials{AuthToken: c.AuthToken[:len(c.AuthToken)-4], ValidationToken: c.ValidationToken}, paseto.ErrInvalidToken},
+				{"empty", &palermo.SessionCredentials{}, paseto.ErrInvalidToken},
+				{"mismatched tokens", &palermo.SessionCredentials{AuthToken: c.AuthToken, ValidationToken: other.ValidationToken}, paseto.ErrSessionMismatch},
+			}
+			for _, tt := range tests {
+				if _, err := ss.Session(ctx, tt.creds); err != tt.wantErr {
+					t.Errorf("%s: Session() = %v, want %v", tt.name, err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionServiceExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	ss := newSessionService(paseto.V4Local)
+	ss.Now = func() time.Time { return now }
+
+	c, err := ss.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delayed, err := ss.CreateSession(ctx, &palermo.Session{UserID: "42", Email: "jane@example.com", NotBefore: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		creds   *palermo.SessionCredentials
+		at      time.Time
+		wantErr error
+	}{
+		{"valid", c, now.Add(30 * time.Second), nil},
+		{"expired", c, now.Add(time.Minute), paseto.ErrExpired},
+		{"issued in the future", c, now.Add(-time.Second), paseto.ErrNotValidYet},
+		{"not valid yet", delayed, now.Add(30 * time.Second), paseto.ErrNotValidYet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss.Now = func() time.Time { return tt.at }
+			if _, err := ss.Session(ctx, tt.creds); err != tt.wantErr {
+				t.Errorf("Session() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Expired sessions may still be refreshed.
+	ss.Now = func() time.Time { return now.Add(time.Hour) }
+	s, err := ss.RefreshSession(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.UpdatedAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("refreshed session updated at %v", s.UpdatedAt)
+	}
+}
+
+func TestSessionServiceRevocation(t *testing.T) {
+	ctx := context.Background()
+	us := &palermo.Session{UserID: "42", Email: "jane@example.com"}
+
+	ss := newSessionService(paseto.V4Local)
+	c, err := ss.CreateSession(ctx, us)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.RevokeSession(ctx, c); err != paseto.ErrRevocationUnsupported {
+		t.Errorf("RevokeSession() without a store = %v, want %v", err, paseto.ErrRevocationUnsupported)
+	}
+
+	ss.RevocationStore = &memory.RevocationStore{}
+	other, err := ss.CreateSession(ctx, us)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.RevokeSession(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.Session(ctx, c); err != paseto.ErrRevoked {
+		t.Errorf("Session() of revoked credentials = %v, want %v", err, paseto.ErrRevoked)
+	}
+	if _, err := ss.RefreshSession(ctx, c); err != paseto.ErrRevoked {
+		t.Errorf("RefreshSession() of revoked credentials = %v, want %v", err, paseto.ErrRevoked)
+	}
+	if _, err := ss.Session(ctx, other); err != nil {
+		t.Errorf("Session() of other credentials = %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package paseto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ErrInvalidToken is returned when a token is malformed, was not issued with
+// the expected protocol or fails authentication.
+var ErrInvalidToken = errors.New("paseto: invalid token")
+
+var b64 = base64.RawURLEncoding
+
+// pae returns the pre-authentication encoding of the given pieces, which
+// binds them together unambiguously before encryption or signing.
+func pae(pieces ...[]byte) []byte {
+	n := 8
+	for _, p := range pieces {
+		n += 8 + len(p)
+	}
+
+	b := make([]byte, 8, n)
+	binary.LittleEndian.PutUint64(b, uint64(len(pieces)))
+	for _, p := range pieces {
+		var l [8]byte
+		binary.LittleEndian.PutUint64(l[:], uint64(len(p)))
+		b = append(b, l[:]...)
+		b = append(b, p...)
+	}
+	return b
+}
+
+// split checks the header of the given token and returns its decoded payload
+// and footer.
+func split(token, header string) ([]byte, []byte, error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	parts := strings.Split(token[len(header):], ".")
+	if len(parts) > 2 {
+		return nil, nil, ErrInvalidToken
+	}
+
+	payload, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+
+	var footer []byte
+	if len(parts) == 2 {
+		// Empty footers are left out along with their dot, so tokens have
+		// a single encoding.
+		if parts[1] == "" {
+			return nil, nil, ErrInvalidToken
+		}
+		if footer, err = b64.DecodeString(parts[1]); err != nil {
+			return nil, nil, ErrInvalidToken
+		}
+	}
+	return payload, footer, nil
+}
+
+func join(header string, payload, footer []byte) string {
+	token := header + b64.EncodeToString(payload)
+	if len(footer) > 0 {
+		token += "." + b64.EncodeToString(footer)
+	}
+	return token
+}
+
+const (
+	v2LocalHeader  = "v2.local."
+	v2PublicHeader = "v2.public."
+	v4LocalHeader  = "v4.local."
+	v4PublicHeader = "v4.public."
+)
+
+// encryptV2 returns a v2.local token holding msg, encrypted with
+// XChaCha20-Poly1305.
+func encryptV2(key, msg, footer []byte) (string, error) {
+	b := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return sealV2(key, b, msg, footer)
+}
+
+// sealV2 encrypts msg into a v2.local token, deriving its nonce from msg and
+// the random bytes b.
+func sealV2(key, b, msg, footer []byte) (string, error) {
+	h, err := blake2b.New(chacha20poly1305.NonceSizeX, b)
+	if err != nil {
+		return "", err
+	}
+	h.Write(msg)
+	nonce := h.Sum(nil)
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+
+	payload := append([]byte(nil), nonce...)
+	payload = aead.Seal(payload, nonce, msg, pae([]byte(v2LocalHeader), nonce, footer))
+	return join(v2LocalHeader, payload, footer), nil
+}
+
+func decryptV2(key []byte, token string) ([]byte, error) {
+	payload, footer, err := split(token, v2LocalHeader)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < chacha20poly1305.NonceSizeX+aead.Overhead() {
+		return nil, ErrInvalidToken
+	}
+
+	nonce, c := payload[:chacha20poly1305.NonceSizeX], payload[chacha20poly1305.NonceSizeX:]
+	msg, err := aead.Open(nil, nonce, c, pae([]byte(v2LocalHeader), nonce, footer))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return msg, nil
+}
+
+// v4Keys derives the encryption key, counter nonce and authentication key of
+// a v4.local token from the shared key and the token nonce.
+func v4Keys(key, nonce []byte) (ek, n2, ak []byte, err error) {
+	h, err := blake2b.New(56, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	h.Write([]byte("paseto-encryption-key"))
+	h.Write(nonce)
+	tmp := h.Sum(nil)
+
+	h, err = blake2b.New256(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	h.Write([]byte("paseto-auth-key-for-aead"))
+	h.Write(nonce)
+	return tmp[:32], tmp[32:], h.Sum(nil), nil
+}
+
+// encryptV4 returns a v4.local token holding msg, encrypted with XChaCha20
+// and authenticated with keyed BLAKE2b.
+func encryptV4(key, msg, footer, implicit []byte) (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return sealV4(key, nonce, msg, footer, implicit)
+}
+
+// sealV4 encrypts msg into a v4.local token with the given nonce.
+func sealV4(key, nonce, msg, footer, implicit []byte) (string, error) {
+	ek, n2, ak, err := v4Keys(key, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	s, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return "", err
+	}
+	c := make([]byte, len(msg))
+	s.XORKeyStream(c, msg)
+
+	h, err := blake2b.New256(ak)
+	if err != nil {
+		return "", err
+	}
+	h.Write(pae([]byte(v4LocalHeader), nonce, c, footer, implicit))
+
+	payload := append(append(append([]byte(nil), nonce...), c...), h.Sum(nil)...)
+	return join(v4LocalHeader, payload, footer), nil
+}
+
+func decryptV4(key []byte, token string, implicit []byte) ([]byte, error) {
+	payload, footer, err := split(token, v4LocalHeader)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < 64 {
+		return nil, ErrInvalidToken
+	}
+
+	nonce, c, t := payload[:32], payload[32:len(payload)-32], payload[len(payload)-32:]
+	ek, n2, ak, err := v4Keys(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := blake2b.New256(ak)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(pae([]byte(v4LocalHeader), nonce, c, footer, implicit))
+	if subtle.ConstantTimeCompare(h.Sum(nil), t) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	s, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, len(c))
+	s.XORKeyStream(msg, c)
+	return msg, nil
+}
+
+// sign returns a public token of the given header holding msg, signed with
+// Ed25519. v2 tokens take no implicit assertion.
+func sign(header string, priv ed25519.PrivateKey, msg, footer []byte, implicit ...[]byte) string {
+	m2 := pae(append([][]byte{[]byte(header), msg, footer}, implicit...)...)
+	payload := append(append([]byte(nil), msg...), ed25519.Sign(priv, m2)...)
+	return join(header, payload, footer)
+}
+
+func verify(header string, pub ed25519.PublicKey, token string, implicit ...[]byte) ([]byte, error) {
+	payload, footer, err := split(token, header)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < ed25519.SignatureSize {
+		return nil, ErrInvalidToken
+	}
+
+	msg, sig := payload[:len(payload)-ed25519.SignatureSize], payload[len(payload)-ed25519.SignatureSize:]
+	m2 := pae(append([][]byte{[]byte(header), msg, footer}, implicit...)...)
+	if !ed25519.Verify(pub, m2, sig) {
+		return nil, ErrInvalidToken
+	}
+	return msg, nil
+}
@@ -0,0 +1,192 @@
+package paseto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+)
+
+// Official PASETO test vectors.
+var (
+	vectorKey   = mustHex("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	vectorSeed  = mustHex("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774")
+	vectorNonce = mustHex("45742c976d684ff84ebdc0de59809a97cda2f64c84fda19b")
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestV2LocalVectors(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    []byte
+		nonce  []byte
+		msg    string
+		footer string
+		token  string
+	}{
+		{
+			"empty message, null key", make([]byte, 32), make([]byte, 24), "", "",
+			"v2.local.driRNhM20GQPvlWfJCepzh6HdijAq-yNUtKpdy5KXjKfpSKrOlqQvQ",
+		},
+		{
+			"empty message with footer, full key", bytes.Repeat([]byte{0xff}, 32), make([]byte, 24), "", "Cuon Alpinus",
+			"v2.local.driRNhM20GQPvlWfJCepzh6HdijAq-yNJbTJxAGtEg4ZMXY9g2LSoQ.Q3VvbiBBbHBpbnVz",
+		},
+		{
+			"message", vectorKey, make([]byte, 24), "Love is stronger than hate or fear", "",
+			"v2.local.BEsKs5AolRYDb_O-bO-lwHWUextpShFSXlvv8MsrNZs3vTSnGQG4qRM9ezDl880jFwknSA6JARj2qKhDHnlSHx1GSCizfcF019U",
+		},
+		{
+			"message with footer and nonce", vectorKey, vectorNonce, "Love is stronger than hate or fear", "Cuon Alpinus",
+			"v2.local.FGVEQLywggpvH0AzKtLXz0QRmGYuC6yvl05z9GIX0cnol6UK94cfV77AXnShlUcNgpDR12FrQiurS8jxBRmvoIKmeMWC5wY9Y6w.Q3VvbiBBbHBpbnVz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := sealV2(tt.key, tt.nonce, []byte(tt.msg), []byte(tt.footer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != tt.token {
+				t.Errorf("sealV2() = %s, want %s", token, tt.token)
+			}
+
+			msg, err := decryptV2(tt.key, tt.token)
+			if err != nil || string(msg) != tt.msg {
+				t.Errorf("decryptV2() = %q, %v, want %q", msg, err, tt.msg)
+			}
+		})
+	}
+}
+
+func TestV4LocalVectors(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   string
+		token string
+	}{
+		{
+			"4-E-1", `{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`,
+			"v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg",
+		},
+		{
+			"4-E-2", `{"data":"this is a hidden message","exp":"2022-01-01T00:00:00+00:00"}`,
+			"v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvS2csCgglvpk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XIemu9chy3WVKvRBfg6t8wwYHK0ArLxxfZP73W_vfwt5A",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := sealV4(vectorKey, make([]byte, 32), []byte(tt.msg), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != tt.token {
+				t.Errorf("sealV4() = %s, want %s", token, tt.token)
+			}
+
+			msg, err := decryptV4(vectorKey, tt.token, nil)
+			if err != nil || string(msg) != tt.msg {
+				t.Errorf("decryptV4() = %q, %v, want %q", msg, err, tt.msg)
+			}
+		})
+	}
+}
+
+func TestPublicVectors(t *testing.T) {
+	priv := ed25519.NewKeyFromSeed(vectorSeed)
+	pub := priv.Public().(ed25519.PublicKey)
+
+	tests := []struct {
+		name   string
+		header string
+		msg    string
+		footer string
+		token  string
+	}{
+		{
+			"v2 empty message", v2PublicHeader, "", "",
+			"v2.public.xnHHprS7sEyjP5vWpOvHjAP2f0HER7SWfPuehZ8QIctJRPTrlZLtRCk9_iNdugsrqJoGaO4k9cDBq3TOXu24AA",
+		},
+		{
+			"v2 empty message with footer", v2PublicHeader, "", "Cuon Alpinus",
+			"v2.public.Qf-w0RdU2SDGW_awMwbfC0Alf_nd3ibUdY3HigzU7tn_4MPMYIKAJk_J_yKYltxrGlxEdrWIqyfjW81njtRyDw.Q3VvbiBBbHBpbnVz",
+		},
+		{
+			"v2 message", v2PublicHeader, "Frank Denis rocks", "",
+			"v2.public.RnJhbmsgRGVuaXMgcm9ja3NBeHgns4TLYAoyD1OPHww0qfxHdTdzkKcyaE4_fBF2WuY1JNRW_yI8qRhZmNTaO19zRhki6YWRaKKlCZNCNrQM",
+		},
+		{
+			"v2 message with footer", v2PublicHeader, "Frank Denis rocks", "Cuon Alpinus",
+			"v2.public.RnJhbmsgRGVuaXMgcm9ja3O7MPuu90WKNyvBUUhAGFmi4PiPOr2bN2ytUSU-QWlj8eNefki2MubssfN1b8figynnY0WusRPwIQ-o0HSZOS0F.Q3VvbiBBbHBpbnVz",
+		},
+		{
+			"4-S-1", v4PublicHeader, `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`, "",
+			"v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var implicit [][]byte
+			if tt.header == v4PublicHeader {
+				implicit = [][]byte{nil}
+			}
+
+			if token := sign(tt.header, priv, []byte(tt.msg), []byte(tt.footer), implicit...); token != tt.token {
+				t.Errorf("sign() = %s, want %s", token, tt.token)
+			}
+			msg, err := verify(tt.header, pub, tt.token, implicit...)
+			if err != nil || string(msg) != tt.msg {
+				t.Errorf("verify() = %q, %v, want %q", msg, err, tt.msg)
+			}
+		})
+	}
+}
+
+func TestTamperedTokens(t *testing.T) {
+	priv := ed25519.NewKeyFromSeed(vectorSeed)
+	pub := priv.Public().(ed25519.PublicKey)
+	v4Local, err := sealV4(vectorKey, make([]byte, 32), []byte("message"), []byte("footer"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v4Public := sign(v4PublicHeader, priv, []byte("message"), []byte("footer"), nil)
+
+	open := map[string]func(token string) ([]byte, error){
+		v4LocalHeader:  func(token string) ([]byte, error) { return decryptV4(vectorKey, token, nil) },
+		v4PublicHeader: func(token string) ([]byte, error) { return verify(v4PublicHeader, pub, token, nil) },
+	}
+	for header, token := range map[string]string{v4LocalHeader: v4Local, v4PublicHeader: v4Public} {
+		dot := len(token) - len(b64.EncodeToString([]byte("footer"))) - 1
+		body, footer := token[:dot], token[dot:]
+		flipped := []byte(body)
+		flipped[len(header)+10] ^= 1
+
+		tests := map[string]string{
+			"payload bit flipped": string(flipped) + footer,
+			"footer removed":      body,
+			"footer replaced":     body + "." + b64.EncodeToString([]byte("other")),
+			"wrong header":        "v2" + token[2:],
+			"truncated":           token[:len(header)+8],
+			"malformed":           token + ".extra",
+		}
+		for name, tampered := range tests {
+			if _, err := open[header](tampered); err != ErrInvalidToken {
+				t.Errorf("%s%s: got %v, want %v", header, name, err, ErrInvalidToken)
+			}
+		}
+	}
+
+	if _, err := decryptV4(vectorKey, v4Local, []byte("implicit")); err != ErrInvalidToken {
+		t.Errorf("v4.local with another implicit assertion: got %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := verify(v4PublicHeader, pub, v4Public, []byte("implicit")); err != ErrInvalidToken {
+		t.Errorf("v4.public with another implicit assertion: got %v, want %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ActivityStore implements idle.Store using the session_activity table of
+// Schema, so the last use of sessions is shared between instances.
+type ActivityStore struct {
+	DB *sql.DB
+}
+
+// LastUsed returns the last time the given session was used, or the zero time
+// if unknown.
+func (as *ActivityStore) LastUsed(ctx context.Context, sessionID string) (time.Time, error) {
+	var usedAt time.Time
+	err := as.DB.QueryRowContext(ctx,
+		`SELECT last_used_at FROM session_activity WHERE id = $1 AND expires_at > now()`,
+		sessionID,
+	).Scan(&usedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return usedAt, nil
+}
+
+// Touch records the given session as used at usedAt until expiresAt. Touches
+// racing between instances keep the latest use.
+func (as *ActivityStore) Touch(ctx context.Context, sessionID string, usedAt, expiresAt time.Time) error {
+	_, err := as.DB.ExecContext(ctx, `
+INSERT INTO session_activity (id, last_used_at, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE SET
+	last_used_at = GREATEST(session_activity.last_used_at, EXCLUDED.last_used_at),
+	expires_at = GREATEST(session_activity.expires_at, EXCLUDED.expires_at)`,
+		sessionID, usedAt, expiresAt,
+	)
+	return err
+}
+
+// PurgeExpired deletes the expired activity records and returns how many were
+// deleted. It should be called periodically, as SessionService.PurgeExpired.
+func (as *ActivityStore) PurgeExpired(ctx context.Context) (int64, error) {
+	res, err := as.DB.ExecContext(ctx, `DELETE FROM session_activity WHERE expires_at < now()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
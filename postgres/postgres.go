@@ -0,0 +1,362 @@
+// Package postgres implements palermo.SessionService storing sessions in
+// PostgreSQL.
+//
+// Sessions are durable and queryable: they are kept in the sessions table
+// under the hash of their authentication token, along with the hash of their
+// validation token. Credentials are opaque random tokens.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/opaque"
+	"github.com/lib/pq"
+)
+
+const exportBatchSize = 100
+
+// Schema creates the sessions and session_activity tables and their indices,
+// if missing.
+const Schema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	auth_hash       TEXT PRIMARY KEY,
+	validation_hash TEXT NOT NULL,
+	id              TEXT NOT NULL,
+	user_id         TEXT NOT NULL,
+	email           TEXT NOT NULL,
+	token           TEXT NOT NULL,
+	anonymous       BOOLEAN NOT NULL,
+	source          TEXT NOT NULL,
+	scopes          TEXT[] NOT NULL,
+	api_version     TEXT NOT NULL,
+	allowed_methods TEXT[] NOT NULL,
+	metadata        JSONB NOT NULL DEFAULT '{}',
+	not_before      TIMESTAMPTZ,
+	created_at      TIMESTAMPTZ NOT NULL,
+	updated_at      TIMESTAMPTZ NOT NULL,
+	expires_at      TIMESTAMPTZ NOT NULL
+);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS not_before TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
+CREATE TABLE IF NOT EXISTS session_activity (
+	id           TEXT PRIMARY KEY,
+	last_used_at TIMESTAMPTZ NOT NULL,
+	expires_at   TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS session_activity_expires_at_idx ON session_activity (expires_at);
+`
+
+const sessionColumns = `auth_hash, validation_hash, id, user_id, email, token, anonymous, source,
+	scopes, api_version, allowed_methods, metadata, not_before, created_at, updated_at, expires_at`
+
+// ErrSessionNotFound is returned when the credentials match no stored
+// session.
+var ErrSessionNotFound = errors.New("postgres: session not found")
+
+// ErrSessionExpired is returned when the credentials match an expired
+// session.
+var ErrSessionExpired = errors.New("postgres: session expired")
+
+// ErrSessionNotValidYet is returned when the credentials match a session whose
+// NotBefore time has not come yet.
+var ErrSessionNotValidYet = errors.New("postgres: session not valid yet")
+
+// ErrInvalidMaxAge is returned when sessions would expire on creation.
+var ErrInvalidMaxAge = errors.New("postgres: MaxAge must be positive")
+
+// SessionService implements palermo.SessionService using PostgreSQL.
+type SessionService struct {
+	DB *sql.DB
+
+	// MaxAge is the lifetime of sessions.
+	MaxAge time.Duration
+}
+
+// CreateSchema creates the sessions table if it does not exist yet.
+func (ss *SessionService) CreateSchema() error {
+	_, err := ss.DB.Exec(Schema)
+	return err
+}
+
+// Session validates and returns the user session associated with the given
+// credentials.
+func (ss *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	s, err := ss.session(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !now.Before(s.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+	if now.Before(s.NotBefore) {
+		return nil, ErrSessionNotValidYet
+	}
+	return s, nil
+}
+
+// RefreshSession validates and returns the user session associated with the
+// given credentials, updated. Like JWT sessions, expired sessions may still
+// be refreshed.
+func (ss *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	s, err := ss.session(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.UpdatedAt = time.Now()
+	if _, err := ss.DB.ExecContext(ctx, `UPDATE sessions SET updated_at = $1 WHERE auth_hash = $2`, s.UpdatedAt, s.TokenID); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CreateSession stores the given session and returns new credentials for it.
+func (ss *SessionService) CreateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return ss.storeSession(ctx, us)
+}
+
+// UpdateSession stores the given session and returns new credentials for it.
+// Previous credentials stay valid until they expire.
+func (ss *SessionService) UpdateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return ss.storeSession(ctx, us)
+}
+
+// RevokeSession deletes the session associated with the given credentials.
+func (ss *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	s, err := ss.session(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.DB.ExecContext(ctx, `DELETE FROM sessions WHERE auth_hash = $1`, s.TokenID)
+	return err
+}
+
+// ExportSessions calls fn for every live session, reading them in batches.
+func (ss *SessionService) ExportSessions(ctx context.Context, fn func(*palermo.Session) error) error {
+	var after string
+	for {
+		rows, err := ss.DB.QueryContext(ctx, `SELECT `+sessionColumns+` FROM sessions
+			WHERE auth_hash > $1 AND expires_at > $2 ORDER BY auth_hash LIMIT $3`, after, time.Now(), exportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		var batch []*palermo.Session
+		for rows.Next() {
+			s, _, err := scanSession(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, s)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return err
+		}
+		rows.Close()
+
+		for _, s := range batch {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		after = batch[len(batch)-1].TokenID
+	}
+}
+
+// UserSessions returns the live sessions of the given user.
+func (ss *SessionService) UserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	return ss.querySessions(ctx, `SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = $1 AND expires_at > $2 ORDER BY created_at`, userID, time.Now())
+}
+
+// RevokeSessionByTokenID deletes the session identified by tokenID.
+func (ss *SessionService) RevokeSessionByTokenID(ctx context.Context, tokenID string) (*palermo.Session, error) {
+	row := ss.DB.QueryRowContext(ctx, `DELETE FROM sessions WHERE auth_hash = $1 RETURNING `+sessionColumns, tokenID)
+	s, _, err := scanSession(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// RevokeUserSessions deletes every session of the given user.
+func (ss *SessionService) RevokeUserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	return ss.querySessions(ctx, `DELETE FROM sessions WHERE user_id = $1 RETURNING `+sessionColumns, userID)
+}
+
+// PurgeExpired deletes the expired sessions and returns how many were
+// deleted. Expired sessions are rejected anyway, but are only deleted by
+// PurgeExpired, which should therefore be called periodically to keep the
+// sessions table small.
+func (ss *SessionService) PurgeExpired(ctx context.Context) (int64, error) {
+	res, err := ss.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < now()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Check pings the database.
+func (ss *SessionService) Check(ctx context.Context) error {
+	return ss.DB.PingContext(ctx)
+}
+
+// Close closes the underlying database.
+func (ss *SessionService) Close() error {
+	return ss.DB.Close()
+}
+
+func (ss *SessionService) session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	row := ss.DB.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE auth_hash = $1`, opaque.Hash(c.AuthToken))
+	s, valHash, err := scanSession(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !opaque.Equal(valHash, opaque.Hash(c.ValidationToken)) {
+		return nil, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+func (ss *SessionService) storeSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if ss.MaxAge <= 0 {
+		return nil, ErrInvalidMaxAge
+	}
+
+	if us.ServiceAccount {
+		return nil, errors.New("postgres: service account sessions are not supported")
+	}
+
+	metadata, err := json.Marshal(us.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if us.Metadata == nil {
+		metadata = []byte("{}")
+	}
+
+	c, err := opaque.NewCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ss.DB.ExecContext(ctx, `INSERT INTO sessions (`+sessionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		opaque.Hash(c.AuthToken),
+		opaque.Hash(c.ValidationToken),
+		us.ID,
+		us.UserID,
+		us.Email,
+		us.Token,
+		us.Anonymous,
+		us.Source,
+		pq.Array(nonNil(us.Scopes)),
+		us.APIVersion,
+		pq.Array(nonNil(us.AllowedMethods)),
+		metadata,
+		pq.NullTime{Time: us.NotBefore, Valid: !us.NotBefore.IsZero()},
+		us.CreatedAt,
+		us.UpdatedAt,
+		time.Now().Add(ss.MaxAge),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// querySessions returns the sessions selected, or deleted, by the given
+// query returning sessionColumns.
+func (ss *SessionService) querySessions(ctx context.Context, query string, args ...interface{}) ([]*palermo.Session, error) {
+	rows, err := ss.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*palermo.Session
+	for rows.Next() {
+		s, _, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSession reads a session selected with sessionColumns, along with its
+// validation token hash. The session is identified by its authentication
+// token hash.
+func scanSession(row scanner) (*palermo.Session, string, error) {
+	var s palermo.Session
+	var valHash string
+	var metadata []byte
+	var notBefore pq.NullTime
+	err := row.Scan(
+		&s.TokenID,
+		&valHash,
+		&s.ID,
+		&s.UserID,
+		&s.Email,
+		&s.Token,
+		&s.Anonymous,
+		&s.Source,
+		pq.Array(&s.Scopes),
+		&s.APIVersion,
+		pq.Array(&s.AllowedMethods),
+		&metadata,
+		&notBefore,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+		&s.ExpiresAt,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := json.Unmarshal(metadata, &s.Metadata); err != nil {
+		return nil, "", err
+	}
+	if len(s.Metadata) == 0 {
+		s.Metadata = nil
+	}
+	s.NotBefore = notBefore.Time
+	return &s, valHash, nil
+}
+
+// nonNil returns an empty slice for nil ones, as the array columns are not
+// nullable.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
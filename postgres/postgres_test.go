@@ -0,0 +1,209 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/postgres"
+)
+
+// recordingDriver is a database/sql driver recording the statements executed
+// and deleting rowsAffected rows each.
+type recordingDriver struct {
+	mu           sync.Mutex
+	stmts        []string
+	rowsAffected int64
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) { return &recordingConn{d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c *recordingConn) Close() error { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.stmts = append(c.d.stmts, query)
+	return driver.RowsAffected(c.d.rowsAffected), nil
+}
+
+var drivers int
+
+func openRecording(t *testing.T, rowsAffected int64) (*sql.DB, *recordingDriver) {
+	d := &recordingDriver{rowsAffected: rowsAffected}
+	drivers++
+	name := fmt.Sprint("recording-", drivers)
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, d
+}
+
+func TestPurgeExpired(t *testing.T) {
+	tests := []struct {
+		name      string
+		purge     func(*sql.DB) (int64, error)
+		wantTable string
+	}{
+		{"sessions", func(db *sql.DB) (int64, error) {
+			return (&postgres.SessionService{DB: db}).PurgeExpired(context.Background())
+		}, "sessions"},
+		{"activity", func(db *sql.DB) (int64, error) {
+			return (&postgres.ActivityStore{DB: db}).PurgeExpired(context.Background())
+		}, "session_activity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, d := openRecording(t, 3)
+			defer db.Close()
+
+			n, err := tt.purge(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 3 {
+				t.Errorf("purged %d rows, want 3", n)
+			}
+			want := "DELETE FROM " + tt.wantTable + " WHERE expires_at < now()"
+			if len(d.stmts) != 1 || d.stmts[0] != want {
+				t.Errorf("executed %q, want %q", d.stmts, want)
+			}
+		})
+	}
+}
+
+// sessionsDriver is a database/sql driver answering the export query from a
+// synthetic sessions table, counting the rows read.
+type sessionsDriver struct {
+	hashes  []string // sorted
+	expires map[string]time.Time
+	read    int
+}
+
+func (d *sessionsDriver) Open(name string) (driver.Conn, error) { return &sessionsConn{d}, nil }
+
+type sessionsConn struct{ d *sessionsDriver }
+
+func (c *sessionsConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c *sessionsConn) Close() error { return nil }
+func (c *sessionsConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+// QueryContext answers WHERE auth_hash > $1 AND expires_at > $2 ORDER BY
+// auth_hash LIMIT $3.
+func (c *sessionsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.Contains(query, "WHERE auth_hash > $1 AND expires_at > $2 ORDER BY auth_hash LIMIT $3") || len(args) != 3 {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	after, now, limit := args[0].Value.(string), args[1].Value.(time.Time), int(args[2].Value.(int64))
+
+	rows := &sessionsRows{d: c.d}
+	i := sort.SearchStrings(c.d.hashes, after)
+	for ; i < len(c.d.hashes) && len(rows.hashes) < limit; i++ {
+		h := c.d.hashes[i]
+		if h > after && c.d.expires[h].After(now) {
+			rows.hashes = append(rows.hashes, h)
+		}
+	}
+	return rows, nil
+}
+
+type sessionsRows struct {
+	d      *sessionsDriver
+	hashes []string
+}
+
+func (r *sessionsRows) Columns() []string {
+	return []string{"auth_hash", "validation_hash", "id", "user_id", "email", "token", "anonymous", "source",
+		"scopes", "api_version", "allowed_methods", "metadata", "not_before", "created_at", "updated_at", "expires_at"}
+}
+
+func (r *sessionsRows) Close() error { return nil }
+
+func (r *sessionsRows) Next(dest []driver.Value) error {
+	if len(r.hashes) == 0 {
+		return io.EOF
+	}
+	h := r.hashes[0]
+	r.hashes = r.hashes[1:]
+	r.d.read++
+
+	created := r.d.expires[h].Add(-time.Hour)
+	copy(dest, []driver.Value{
+		h, "validation-" + h, "id-" + h, "u1", "u1@example.com", "", false, "",
+		[]byte("{read}"), "", []byte("{}"), []byte("{}"), nil, created, created, r.d.expires[h],
+	})
+	return nil
+}
+
+func TestExportSessions(t *testing.T) {
+	// exportBatchSize is the batch size of postgres.SessionService.
+	const exportBatchSize = 100
+	const live, expired = 10000, 500
+
+	d := &sessionsDriver{expires: make(map[string]time.Time)}
+	now := time.Now()
+	for i := 0; i < live+expired; i++ {
+		h := fmt.Sprintf("%064x", i*7919)
+		d.hashes = append(d.hashes, h)
+		d.expires[h] = now.Add(time.Hour)
+		if i < expired {
+			d.expires[h] = now.Add(-time.Minute)
+		}
+	}
+	sort.Strings(d.hashes)
+	drivers++
+	name := fmt.Sprint("sessions-", drivers)
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Every session is exported once, expired ones left out, and the
+	// export never reads more than a batch ahead of fn.
+	seen := make(map[string]bool)
+	ss := &postgres.SessionService{DB: db, MaxAge: time.Hour}
+	if err := ss.ExportSessions(context.Background(), func(s *palermo.Session) error {
+		if seen[s.TokenID] {
+			t.Fatalf("session %s exported twice", s.TokenID)
+		}
+		seen[s.TokenID] = true
+		if !s.ExpiresAt.After(now) {
+			t.Fatalf("expired session %s exported", s.TokenID)
+		}
+		if ahead := d.read - len(seen); ahead >= exportBatchSize {
+			t.Fatalf("read %d sessions ahead of the export", ahead)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != live {
+		t.Errorf("exported %d sessions, want %d", len(seen), live)
+	}
+}
@@ -0,0 +1,99 @@
+// Package prometheus implements palermo.Metrics using Prometheus.
+package prometheus
+
+import (
+	"sort"
+	"sync"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics implements palermo.Metrics on top of a Prometheus registerer.
+// Collectors are created and registered on first use of each metric name,
+// with the label names of that first use.
+type Metrics struct {
+	Registerer prom.Registerer
+
+	mu         sync.Mutex
+	counters   map[string]*prom.CounterVec
+	histograms map[string]*prom.HistogramVec
+	gauges     map[string]*prom.GaugeVec
+}
+
+// NewMetrics returns metrics registered against r. When r is nil the default
+// Prometheus registerer is used.
+func NewMetrics(r prom.Registerer) *Metrics {
+	if r == nil {
+		r = prom.DefaultRegisterer
+	}
+	return &Metrics{
+		Registerer: r,
+		counters:   make(map[string]*prom.CounterVec),
+		histograms: make(map[string]*prom.HistogramVec),
+		gauges:     make(map[string]*prom.GaugeVec),
+	}
+}
+
+// IncCounter increments the named counter by one.
+func (m *Metrics) IncCounter(name string, labels map[string]string) {
+	m.mu.Lock()
+	c, ok := m.counters[name]
+	if !ok {
+		c = prom.NewCounterVec(prom.CounterOpts{Name: name, Help: name}, labelNames(labels))
+		c = m.register(c).(*prom.CounterVec)
+		m.counters[name] = c
+	}
+	m.mu.Unlock()
+
+	c.With(labels).Inc()
+}
+
+// ObserveHistogram records a value in the named histogram.
+func (m *Metrics) ObserveHistogram(name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	h, ok := m.histograms[name]
+	if !ok {
+		h = prom.NewHistogramVec(prom.HistogramOpts{Name: name, Help: name}, labelNames(labels))
+		h = m.register(h).(*prom.HistogramVec)
+		m.histograms[name] = h
+	}
+	m.mu.Unlock()
+
+	h.With(labels).Observe(value)
+}
+
+// SetGauge sets the value of the named gauge.
+func (m *Metrics) SetGauge(name string, value float64, labels map[string]string) {
+	m.mu.Lock()
+	g, ok := m.gauges[name]
+	if !ok {
+		g = prom.NewGaugeVec(prom.GaugeOpts{Name: name, Help: name}, labelNames(labels))
+		g = m.register(g).(*prom.GaugeVec)
+		m.gauges[name] = g
+	}
+	m.mu.Unlock()
+
+	g.With(labels).Set(value)
+}
+
+// register registers c, returning the already registered collector when
+// another Metrics shares the registerer.
+func (m *Metrics) register(c prom.Collector) prom.Collector {
+	if err := m.Registerer.Register(c); err != nil {
+		are, ok := err.(prom.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		return are.ExistingCollector
+	}
+	return c
+}
+
+func labelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
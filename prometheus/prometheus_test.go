@@ -0,0 +1,60 @@
+package prometheus_test
+
+import (
+	"testing"
+
+	"github.com/go-toschool/palermo/prometheus"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prom.NewRegistry()
+	// Metrics sharing a registerer share their collectors.
+	m1, m2 := prometheus.NewMetrics(reg), prometheus.NewMetrics(reg)
+
+	m1.IncCounter("palermo_test_total", map[string]string{"result": "ok"})
+	m2.IncCounter("palermo_test_total", map[string]string{"result": "ok"})
+	m1.IncCounter("palermo_test_total", map[string]string{"result": "error"})
+	m1.ObserveHistogram("palermo_test_seconds", 0.5, nil)
+	m2.SetGauge("palermo_test_entries", 42, map[string]string{"store": "memory"})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			name := mf.GetName()
+			for _, l := range m.GetLabel() {
+				name += "," + l.GetName() + "=" + l.GetValue()
+			}
+			switch {
+			case m.GetCounter() != nil:
+				got[name] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				got[name] = m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				got[name] = m.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		want float64
+	}{
+		{"palermo_test_total,result=ok", 2},
+		{"palermo_test_total,result=error", 1},
+		{"palermo_test_seconds", 0.5},
+		{"palermo_test_entries,store=memory", 42},
+	}
+	for _, tt := range tests {
+		if v, ok := got[tt.name]; !ok || v != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, v, tt.want)
+		}
+	}
+	if len(got) != len(tests) {
+		t.Errorf("got metrics %v", got)
+	}
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+)
+
+// DefaultActivityKeyPrefix prefixes the activity keys when no KeyPrefix is
+// set.
+const DefaultActivityKeyPrefix = "palermo:last-used:"
+
+// ActivityStore implements idle.Store using Redis, so the last use of
+// sessions is shared between instances. Activity keys expire along with the
+// sessions. Touches only move the last use forward, even when concurrent.
+type ActivityStore struct {
+	Client goredis.Cmdable
+
+	// KeyPrefix prefixes the activity keys. Defaults to
+	// DefaultActivityKeyPrefix.
+	KeyPrefix string
+}
+
+// LastUsed returns the last time the given session was used, or the zero time
+// if unknown.
+func (as *ActivityStore) LastUsed(ctx context.Context, sessionID string) (time.Time, error) {
+	n, err := as.client(ctx).Get(as.key(sessionID)).Int64()
+	if err == goredis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, n), nil
+}
+
+// touchScript keeps the latest use and expiry of KEYS[1] given the use
+// ARGV[1], in nanoseconds, and time to live ARGV[2], in milliseconds.
+var touchScript = goredis.NewScript(`
+local used, ttl = ARGV[1], tonumber(ARGV[2])
+local cur = redis.call('GET', KEYS[1])
+if cur and tonumber(cur) > tonumber(used) then
+	used = cur
+end
+local pttl = redis.call('PTTL', KEYS[1])
+if pttl > ttl then
+	ttl = pttl
+end
+return redis.call('SET', KEYS[1], used, 'PX', ttl)
+`)
+
+// Touch records the given session as used at usedAt until expiresAt, unless
+// it was recorded as used later.
+func (as *ActivityStore) Touch(ctx context.Context, sessionID string, usedAt, expiresAt time.Time) error {
+	ttl := int64(expiresAt.Sub(usedAt) / time.Millisecond)
+	if ttl <= 0 {
+		return nil
+	}
+	return touchScript.Run(as.client(ctx), []string{as.key(sessionID)}, usedAt.UnixNano(), ttl).Err()
+}
+
+func (as *ActivityStore) client(ctx context.Context) goredis.Cmdable {
+	return withContext(ctx, as.Client)
+}
+
+func (as *ActivityStore) key(sessionID string) string {
+	if as.KeyPrefix == "" {
+		return DefaultActivityKeyPrefix + sessionID
+	}
+	return as.KeyPrefix + sessionID
+}
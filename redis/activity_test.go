@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+)
+
+// evalClient is a goredis.Cmdable recording the scripts run. Other commands
+// are not implemented.
+type evalClient struct {
+	goredis.Cmdable
+	keys [][]string
+	args [][]interface{}
+}
+
+func (ec *evalClient) EvalSha(sha1 string, keys []string, args ...interface{}) *goredis.Cmd {
+	ec.keys = append(ec.keys, keys)
+	ec.args = append(ec.args, args)
+	return goredis.NewCmdResult("OK", nil)
+}
+
+func TestActivityStoreTouch(t *testing.T) {
+	// Times are far in the past: the time to live only depends on them.
+	usedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		wantArgs  []interface{} // nil when not recorded
+	}{
+		{"recorded", usedAt.Add(15 * time.Minute), []interface{}{usedAt.UnixNano(), int64(15 * 60 * 1000)}},
+		{"expired", usedAt, nil},
+		{"expiring within a millisecond", usedAt.Add(time.Microsecond), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &evalClient{}
+			as := &ActivityStore{Client: ec}
+			if err := as.Touch(context.Background(), "s1", usedAt, tt.expiresAt); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantArgs == nil {
+				if len(ec.args) != 0 {
+					t.Errorf("ran the touch script with %v", ec.args)
+				}
+				return
+			}
+			if len(ec.args) != 1 {
+				t.Fatalf("ran the touch script %d times, want once", len(ec.args))
+			}
+			if want := []string{DefaultActivityKeyPrefix + "s1"}; !reflect.DeepEqual(ec.keys[0], want) {
+				t.Errorf("touched %q, want %q", ec.keys[0], want)
+			}
+			if !reflect.DeepEqual(ec.args[0], tt.wantArgs) {
+				t.Errorf("touch script args = %v, want %v", ec.args[0], tt.wantArgs)
+			}
+		})
+	}
+}
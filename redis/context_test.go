@@ -0,0 +1,46 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	goredis "github.com/go-redis/redis"
+)
+
+type ctxKey struct{}
+
+func TestWithContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+
+	tests := []struct {
+		name   string
+		client goredis.Cmdable
+		bound  func(goredis.Cmdable) context.Context
+	}{
+		{"client", goredis.NewClient(&goredis.Options{}), func(c goredis.Cmdable) context.Context {
+			return c.(*goredis.Client).Context()
+		}},
+		{"cluster", goredis.NewClusterClient(&goredis.ClusterOptions{}), func(c goredis.Cmdable) context.Context {
+			return c.(*goredis.ClusterClient).Context()
+		}},
+		{"ring", goredis.NewRing(&goredis.RingOptions{}), func(c goredis.Cmdable) context.Context {
+			return c.(*goredis.Ring).Context()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := map[string]goredis.Cmdable{
+				"SessionService":  (&SessionService{Client: tt.client}).client(ctx),
+				"RevocationStore": (&RevocationStore{Client: tt.client}).client(ctx),
+				"ReplayGuard":     (&ReplayGuard{Client: tt.client}).client(ctx),
+				"HandleStore":     (&HandleStore{Client: tt.client}).client(ctx),
+				"ActivityStore":   (&ActivityStore{Client: tt.client}).client(ctx),
+			}
+			for name, c := range stores {
+				if got := tt.bound(c).Value(ctxKey{}); got != "request" {
+					t.Errorf("%s commands not bound to the request context", name)
+				}
+			}
+		})
+	}
+}
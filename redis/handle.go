@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/go-toschool/palermo/handle"
+)
+
+// DefaultHandleKeyPrefix prefixes the handle keys when no KeyPrefix is set.
+const DefaultHandleKeyPrefix = "palermo:handle:"
+
+// HandleStore implements handle.Store using Redis, so handles survive
+// restarts and are shared between instances. Handle keys expire along with
+// the handles.
+type HandleStore struct {
+	Client goredis.Cmdable
+
+	// KeyPrefix prefixes the handle keys. Defaults to
+	// DefaultHandleKeyPrefix.
+	KeyPrefix string
+}
+
+// Put stores r under key until expiresAt.
+func (hs *HandleStore) Put(ctx context.Context, key string, r *handle.Record, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return hs.client(ctx).Set(hs.key(key), b, ttl).Err()
+}
+
+// Get returns the record stored under key, or handle.ErrHandleNotFound.
+func (hs *HandleStore) Get(ctx context.Context, key string) (*handle.Record, error) {
+	b, err := hs.client(ctx).Get(hs.key(key)).Bytes()
+	if err == goredis.Nil {
+		return nil, handle.ErrHandleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r handle.Record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Delete removes the record stored under key, if any.
+func (hs *HandleStore) Delete(ctx context.Context, key string) error {
+	return hs.client(ctx).Del(hs.key(key)).Err()
+}
+
+// Check pings Redis.
+func (hs *HandleStore) Check(ctx context.Context) error {
+	return hs.client(ctx).Ping().Err()
+}
+
+func (hs *HandleStore) client(ctx context.Context) goredis.Cmdable {
+	return withContext(ctx, hs.Client)
+}
+
+func (hs *HandleStore) key(key string) string {
+	if hs.KeyPrefix == "" {
+		return DefaultHandleKeyPrefix + key
+	}
+	return hs.KeyPrefix + key
+}
@@ -0,0 +1,342 @@
+// Package redis implements palermo.SessionService storing sessions in Redis.
+//
+// Sessions are stored server-side under the hash of their authentication
+// token and expire along with their credentials, so deleting a key revokes a
+// session immediately instead of waiting for a token to expire. Credentials
+// are opaque random tokens. The sessions of each user are indexed in a set,
+// so that they can be listed and revoked together.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/internal/opaque"
+)
+
+// DefaultKeyPrefix prefixes the session keys when no KeyPrefix is set.
+const DefaultKeyPrefix = "palermo:session:"
+
+// DefaultUserKeyPrefix prefixes the user index keys when no UserKeyPrefix is
+// set.
+const DefaultUserKeyPrefix = "palermo:user-sessions:"
+
+const scanCount = 100
+
+// ErrSessionNotFound is returned when the credentials match no stored
+// session, e.g. because it expired or was revoked.
+var ErrSessionNotFound = errors.New("redis: session not found")
+
+// ErrSessionNotValidYet is returned when the credentials match a session whose
+// NotBefore time has not come yet.
+var ErrSessionNotValidYet = errors.New("redis: session not valid yet")
+
+// ErrInvalidMaxAge is returned when sessions would expire on creation.
+var ErrInvalidMaxAge = errors.New("redis: MaxAge must be positive")
+
+type record struct {
+	Session        *palermo.Session `json:"session"`
+	ValidationHash string           `json:"validation_hash"`
+}
+
+// SessionService implements palermo.SessionService using Redis.
+type SessionService struct {
+	Client goredis.Cmdable
+
+	// MaxAge is the lifetime of sessions, after which Redis evicts them.
+	MaxAge time.Duration
+
+	// KeyPrefix prefixes the session keys. Defaults to DefaultKeyPrefix.
+	KeyPrefix string
+
+	// UserKeyPrefix prefixes the keys indexing the sessions of each user.
+	// Defaults to DefaultUserKeyPrefix.
+	UserKeyPrefix string
+}
+
+// Session validates and returns the user session associated with the given
+// credentials.
+func (ss *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	key := opaque.Hash(c.AuthToken)
+	b, err := ss.client(ctx).Get(ss.key(key)).Bytes()
+	if err == goredis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+
+	if rec.Session == nil || !opaque.Equal(rec.ValidationHash, opaque.Hash(c.ValidationToken)) {
+		return nil, ErrSessionNotFound
+	}
+	if time.Now().Before(rec.Session.NotBefore) {
+		return nil, ErrSessionNotValidYet
+	}
+
+	rec.Session.TokenID = key
+	return rec.Session, nil
+}
+
+// RefreshSession validates and returns the user session associated with the
+// given credentials, updated. Expired sessions are evicted by Redis and thus
+// cannot be refreshed.
+func (ss *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	s, err := ss.Session(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.UpdatedAt = time.Now()
+	return s, nil
+}
+
+// CreateSession stores the given session and returns new credentials for it.
+func (ss *SessionService) CreateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return ss.storeSession(ctx, us)
+}
+
+// UpdateSession stores the given session and returns new credentials for it.
+// Previous credentials stay valid until they expire.
+func (ss *SessionService) UpdateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	return ss.storeSession(ctx, us)
+}
+
+// RevokeSession deletes the session associated with the given credentials.
+func (ss *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	s, err := ss.Session(ctx, c)
+	if err != nil {
+		return err
+	}
+	return ss.deleteSessions(ctx, s)
+}
+
+// UserSessions returns the live sessions of the given user. Sessions created
+// before the user index was introduced are not listed.
+func (ss *SessionService) UserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	hashes, err := ss.client(ctx).SMembers(ss.userKey(userID)).Result()
+	if err != nil || len(hashes) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(hashes))
+	for i, h := range hashes {
+		keys[i] = ss.key(h)
+	}
+	values, err := ss.client(ctx).MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*palermo.Session
+	var expired []interface{}
+	for i, v := range values {
+		b, ok := v.(string)
+		if !ok {
+			expired = append(expired, hashes[i])
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal([]byte(b), &rec); err != nil {
+			return nil, err
+		}
+		if rec.Session == nil {
+			continue
+		}
+		rec.Session.TokenID = hashes[i]
+		sessions = append(sessions, rec.Session)
+	}
+
+	// Sessions are evicted by Redis, not from the index.
+	if len(expired) > 0 {
+		if err := ss.client(ctx).SRem(ss.userKey(userID), expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// RevokeSessionByTokenID deletes the session identified by tokenID.
+func (ss *SessionService) RevokeSessionByTokenID(ctx context.Context, tokenID string) (*palermo.Session, error) {
+	b, err := ss.client(ctx).Get(ss.key(tokenID)).Bytes()
+	if err == goredis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+	if rec.Session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	rec.Session.TokenID = tokenID
+	if err := ss.deleteSessions(ctx, rec.Session); err != nil {
+		return nil, err
+	}
+	return rec.Session, nil
+}
+
+// RevokeUserSessions deletes every session of the given user.
+func (ss *SessionService) RevokeUserSessions(ctx context.Context, userID string) ([]*palermo.Session, error) {
+	sessions, err := ss.UserSessions(ctx, userID)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	if err := ss.deleteSessions(ctx, sessions...); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// ExportSessions calls fn for every stored session, scanning the keys in
+// batches. Iteration stops when ctx is done.
+func (ss *SessionService) ExportSessions(ctx context.Context, fn func(*palermo.Session) error) error {
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		keys, next, err := ss.client(ctx).Scan(cursor, ss.key("*"), scanCount).Result()
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			b, err := ss.client(ctx).Get(k).Bytes()
+			if err == goredis.Nil {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			var rec record
+			if err := json.Unmarshal(b, &rec); err != nil {
+				return err
+			}
+			if rec.Session == nil {
+				continue
+			}
+
+			rec.Session.TokenID = k[len(ss.key("")):]
+			if err := fn(rec.Session); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Check pings Redis.
+func (ss *SessionService) Check(ctx context.Context) error {
+	return ss.client(ctx).Ping().Err()
+}
+
+func (ss *SessionService) storeSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	if ss.MaxAge <= 0 {
+		return nil, ErrInvalidMaxAge
+	}
+
+	if us.ServiceAccount {
+		return nil, errors.New("redis: service account sessions are not supported")
+	}
+
+	c, err := opaque.NewCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	s := *us
+	s.TokenID = ""
+	s.ExpiresAt = time.Now().Add(ss.MaxAge)
+	b, err := json.Marshal(&record{
+		Session:        &s,
+		ValidationHash: opaque.Hash(c.ValidationToken),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hash := opaque.Hash(c.AuthToken)
+	_, err = ss.client(ctx).TxPipelined(func(pipe goredis.Pipeliner) error {
+		pipe.Set(ss.key(hash), b, ss.MaxAge)
+		if s.UserID != "" {
+			// The index outlives the sessions it lists, all of them
+			// living for MaxAge.
+			pipe.SAdd(ss.userKey(s.UserID), hash)
+			pipe.Expire(ss.userKey(s.UserID), ss.MaxAge)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// deleteSessions deletes the given sessions, identified by their TokenID,
+// along with their user index entries.
+func (ss *SessionService) deleteSessions(ctx context.Context, sessions ...*palermo.Session) error {
+	_, err := ss.client(ctx).TxPipelined(func(pipe goredis.Pipeliner) error {
+		for _, s := range sessions {
+			pipe.Del(ss.key(s.TokenID))
+			if s.UserID != "" {
+				pipe.SRem(ss.userKey(s.UserID), s.TokenID)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (ss *SessionService) client(ctx context.Context) goredis.Cmdable {
+	return withContext(ctx, ss.Client)
+}
+
+func (ss *SessionService) userKey(userID string) string {
+	if ss.UserKeyPrefix == "" {
+		return DefaultUserKeyPrefix + userID
+	}
+	return ss.UserKeyPrefix + userID
+}
+
+func (ss *SessionService) key(hash string) string {
+	if ss.KeyPrefix == "" {
+		return DefaultKeyPrefix + hash
+	}
+	return ss.KeyPrefix + hash
+}
+
+// withContext returns c bound to ctx, so that its commands are abandoned
+// along with the requests they serve. Clients other than those of go-redis
+// are returned as is.
+func withContext(ctx context.Context, c goredis.Cmdable) goredis.Cmdable {
+	switch c := c.(type) {
+	case *goredis.Client:
+		return c.WithContext(ctx)
+	case *goredis.ClusterClient:
+		return c.WithContext(ctx)
+	case *goredis.Ring:
+		return c.WithContext(ctx)
+	}
+	return c
+}
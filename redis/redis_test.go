@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/go-toschool/palermo"
+)
+
+// scanClient is a goredis.Cmdable serving SCAN and GET from a map of values,
+// counting the keys scanned. Other commands are not implemented.
+type scanClient struct {
+	goredis.Cmdable
+	keys    []string // sorted
+	values  map[string]string
+	scanned int
+}
+
+func (sc *scanClient) Scan(cursor uint64, match string, count int64) *goredis.ScanCmd {
+	prefix := strings.TrimSuffix(match, "*")
+	var page []string
+	i := int(cursor)
+	for ; i < len(sc.keys) && len(page) < int(count); i++ {
+		if strings.HasPrefix(sc.keys[i], prefix) {
+			page = append(page, sc.keys[i])
+		}
+	}
+	sc.scanned += len(page)
+	if i == len(sc.keys) {
+		i = 0
+	}
+	return goredis.NewScanCmdResult(page, uint64(i), nil)
+}
+
+func (sc *scanClient) Get(key string) *goredis.StringCmd {
+	v, ok := sc.values[key]
+	if !ok {
+		return goredis.NewStringResult("", goredis.Nil)
+	}
+	return goredis.NewStringResult(v, nil)
+}
+
+func TestExportSessions(t *testing.T) {
+	const sessions = 10000
+
+	ss := &SessionService{MaxAge: time.Hour}
+	sc := &scanClient{values: make(map[string]string)}
+	for i := 0; i < sessions; i++ {
+		b, err := json.Marshal(record{Session: &palermo.Session{UserID: fmt.Sprint("u", i), Email: "u@example.com"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		k := ss.key(fmt.Sprintf("%064x", i))
+		sc.keys = append(sc.keys, k)
+		sc.values[k] = string(b)
+	}
+	// Keys of other stores sharing the database are skipped.
+	sc.keys = append(sc.keys, DefaultUserKeyPrefix+"u1")
+	sort.Strings(sc.keys)
+	ss.Client = sc
+
+	// Every session is exported once, and the export never scans more than
+	// a batch ahead of fn.
+	seen := make(map[string]bool)
+	if err := ss.ExportSessions(context.Background(), func(s *palermo.Session) error {
+		if seen[s.TokenID] {
+			t.Fatalf("session %s exported twice", s.TokenID)
+		}
+		seen[s.TokenID] = true
+		if ahead := sc.scanned - len(seen); ahead >= scanCount {
+			t.Fatalf("scanned %d sessions ahead of the export", ahead)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != sessions {
+		t.Errorf("exported %d sessions, want %d", len(seen), sessions)
+	}
+}
@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+)
+
+// DefaultReplayKeyPrefix prefixes the consumed token keys when no KeyPrefix
+// is set.
+const DefaultReplayKeyPrefix = "palermo:consumed:"
+
+// ReplayGuard implements palermo.ReplayGuard using Redis, so consumed
+// credentials are shared between instances and rejected by all of them.
+// Keys expire along with the consumed tokens.
+type ReplayGuard struct {
+	Client goredis.Cmdable
+
+	// KeyPrefix prefixes the consumed token keys. Defaults to
+	// DefaultReplayKeyPrefix.
+	KeyPrefix string
+}
+
+// Consume marks the given token id as used until expiresAt, and reports
+// whether it was unused. Tokens already expired are rejected anyway and are
+// not recorded.
+func (rg *ReplayGuard) Consume(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return true, nil
+	}
+	return rg.client(ctx).SetNX(rg.key(tokenID), 1, ttl).Result()
+}
+
+// Check pings Redis.
+func (rg *ReplayGuard) Check(ctx context.Context) error {
+	return rg.client(ctx).Ping().Err()
+}
+
+func (rg *ReplayGuard) client(ctx context.Context) goredis.Cmdable {
+	return withContext(ctx, rg.Client)
+}
+
+func (rg *ReplayGuard) key(tokenID string) string {
+	if rg.KeyPrefix == "" {
+		return DefaultReplayKeyPrefix + tokenID
+	}
+	return rg.KeyPrefix + tokenID
+}
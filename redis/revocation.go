@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+)
+
+// DefaultRevocationKeyPrefix prefixes the revocation keys when no KeyPrefix is
+// set.
+const DefaultRevocationKeyPrefix = "palermo:revoked:"
+
+// RevocationStore implements palermo.RevocationStore using Redis, so
+// revocations survive restarts and are shared between instances. Revocation
+// keys expire along with the revoked tokens.
+type RevocationStore struct {
+	Client goredis.Cmdable
+
+	// KeyPrefix prefixes the revocation keys. Defaults to
+	// DefaultRevocationKeyPrefix.
+	KeyPrefix string
+}
+
+// Revoke records the given token id as revoked until expiresAt. Tokens
+// already expired are rejected anyway and are not recorded.
+func (rs *RevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return rs.client(ctx).Set(rs.key(tokenID), 1, ttl).Err()
+}
+
+// IsRevoked reports whether the given token id was revoked.
+func (rs *RevocationStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	n, err := rs.client(ctx).Exists(rs.key(tokenID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Check pings Redis.
+func (rs *RevocationStore) Check(ctx context.Context) error {
+	return rs.client(ctx).Ping().Err()
+}
+
+func (rs *RevocationStore) client(ctx context.Context) goredis.Cmdable {
+	return withContext(ctx, rs.Client)
+}
+
+func (rs *RevocationStore) key(tokenID string) string {
+	if rs.KeyPrefix == "" {
+		return DefaultRevocationKeyPrefix + tokenID
+	}
+	return rs.KeyPrefix + tokenID
+}
@@ -0,0 +1,69 @@
+// Package scope implements a palermo.SessionService decorator that rejects
+// sessions carrying mutually exclusive scopes.
+package scope
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-toschool/palermo"
+)
+
+// ErrConflictingScopes is returned when a session carries scopes that must
+// not be granted together.
+var ErrConflictingScopes = errors.New("scope: conflicting scopes")
+
+// SessionService decorates a palermo.SessionService so validated sessions
+// carrying a forbidden combination of scopes are rejected. Such sessions can
+// only come from misconfigured token minting, so they are refused rather than
+// having some of their scopes dropped.
+type SessionService struct {
+	palermo.SessionService
+
+	// Conflicts lists groups of mutually exclusive scopes: a session may
+	// carry at most one scope of each group, e.g. {"readonly", "admin"}.
+	Conflicts [][]string
+}
+
+// Session validates the given credentials and the scopes of their session.
+func (s *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	us, err := s.SessionService.Session(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return s.check(us)
+}
+
+// RefreshSession refreshes the given credentials and validates the scopes of
+// their session.
+func (s *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	us, err := s.SessionService.RefreshSession(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return s.check(us)
+}
+
+func (s *SessionService) check(us *palermo.Session) (*palermo.Session, error) {
+	if len(us.Scopes) < 2 {
+		return us, nil
+	}
+
+	granted := make(map[string]bool, len(us.Scopes))
+	for _, sc := range us.Scopes {
+		granted[sc] = true
+	}
+
+	for _, group := range s.Conflicts {
+		n := 0
+		for _, sc := range group {
+			if granted[sc] {
+				n++
+			}
+		}
+		if n > 1 {
+			return nil, ErrConflictingScopes
+		}
+	}
+	return us, nil
+}
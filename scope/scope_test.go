@@ -0,0 +1,59 @@
+package scope_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-toschool/palermo"
+	"github.com/go-toschool/palermo/palermotest"
+	"github.com/go-toschool/palermo/scope"
+)
+
+func TestConflictingScopes(t *testing.T) {
+	conflicts := [][]string{{"readonly", "admin"}, {"sandbox", "live", "staging"}}
+
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr error
+	}{
+		{"empty", nil, nil},
+		{"single scope", []string{"admin"}, nil},
+		{"legal set", []string{"readonly", "sandbox", "billing"}, nil},
+		{"repeated scope", []string{"admin", "admin"}, nil},
+		{"illegal pair", []string{"readonly", "admin"}, scope.ErrConflictingScopes},
+		{"illegal pair among others", []string{"billing", "admin", "sandbox", "readonly"}, scope.ErrConflictingScopes},
+		{"two of a larger group", []string{"live", "staging"}, scope.ErrConflictingScopes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validated := func(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+				return &palermo.Session{UserID: "42", Scopes: tt.scopes}, nil
+			}
+			s := &scope.SessionService{
+				SessionService: &palermotest.SessionService{SessionFunc: validated, RefreshSessionFunc: validated},
+				Conflicts:      conflicts,
+			}
+
+			for name, call := range map[string]func(context.Context, *palermo.SessionCredentials) (*palermo.Session, error){
+				"Session":        s.Session,
+				"RefreshSession": s.RefreshSession,
+			} {
+				us, err := call(context.Background(), &palermo.SessionCredentials{})
+				if err != tt.wantErr {
+					t.Errorf("%s() = %v, want %v", name, err, tt.wantErr)
+				}
+				if (us == nil) != (tt.wantErr != nil) {
+					t.Errorf("%s() returned session %v", name, us)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	s := &scope.SessionService{SessionService: &palermotest.SessionService{}, Conflicts: [][]string{{"readonly", "admin"}}}
+	if _, err := s.Session(context.Background(), &palermo.SessionCredentials{AuthToken: "a", ValidationToken: "v"}); err == nil || err == scope.ErrConflictingScopes {
+		t.Errorf("Session() = %v, want the validation error", err)
+	}
+}
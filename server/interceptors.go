@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-toschool/palermo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errPanic is returned to callers whose request made a handler panic. The
+// panic details only go to the server logs.
+var errPanic = status.Error(codes.Internal, "internal error")
+
+// Logging returns the interceptor logging every RPC with its status code
+// and duration, at the debug level.
+func Logging(l palermo.Logger) Interceptor {
+	return Interceptor{
+		Name: LoggingInterceptor,
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			start := time.Now()
+			resp, err := handler(ctx, req)
+			logRPC(contextLogger(ctx, l), info.FullMethod, start, err)
+			return resp, err
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, ss)
+			logRPC(contextLogger(ss.Context(), l), info.FullMethod, start, err)
+			return err
+		},
+	}
+}
+
+func logRPC(l palermo.Logger, method string, start time.Time, err error) {
+	l.Debug("server: handled RPC", palermo.Fields{
+		"method":   method,
+		"code":     status.Code(err).String(),
+		"duration": time.Since(start).String(),
+	})
+}
+
+// Metrics returns the interceptor counting the RPCs by method and status
+// code and recording their latency. Stream latency covers the whole stream.
+func Metrics(m palermo.Metrics) Interceptor {
+	return Interceptor{
+		Name: MetricsInterceptor,
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			start := time.Now()
+			resp, err := handler(ctx, req)
+			observeRPC(m, info.FullMethod, start, err)
+			return resp, err
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, ss)
+			observeRPC(m, info.FullMethod, start, err)
+			return err
+		},
+	}
+}
+
+func observeRPC(m palermo.Metrics, method string, start time.Time, err error) {
+	m.IncCounter("palermo_grpc_requests_total", map[string]string{
+		"method": method,
+		"code":   status.Code(err).String(),
+	})
+	m.ObserveHistogram("palermo_grpc_request_duration_seconds", time.Since(start).Seconds(), map[string]string{
+		"method": method,
+	})
+}
+
+// Recovery returns the interceptor turning handler panics into INTERNAL
+// errors, so a single faulty request does not crash the server along with
+// every request in flight.
+func Recovery(l palermo.Logger) Interceptor {
+	return Interceptor{
+		Name: RecoveryInterceptor,
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logPanic(contextLogger(ctx, l), info.FullMethod, r)
+					resp, err = nil, errPanic
+				}
+			}()
+			return handler(ctx, req)
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logPanic(contextLogger(ss.Context(), l), info.FullMethod, r)
+					err = errPanic
+				}
+			}()
+			return handler(srv, ss)
+		},
+	}
+}
+
+func logPanic(l palermo.Logger, method string, r interface{}) {
+	l.Error("server: handler panicked", palermo.Fields{
+		"method": method,
+		"panic":  r,
+		"stack":  string(debug.Stack()),
+	})
+}
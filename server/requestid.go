@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/go-toschool/palermo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// RequestIDMetadataKey is the metadata key carrying the request id, in
+	// the requests and the response headers alike.
+	RequestIDMetadataKey = "x-request-id"
+
+	// maxRequestIDLen bounds the request ids accepted from callers, as they
+	// end up in every log entry.
+	maxRequestIDLen = 128
+)
+
+type requestIDKey struct{}
+
+// RequestID returns the interceptor tagging every RPC with the request id
+// sent by the caller, or a new one, and echoing it back in the response
+// headers.
+func RequestID() Interceptor {
+	return Interceptor{
+		Name: RequestIDInterceptor,
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return handler(withRequestID(ctx), req)
+		},
+		Stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx := withRequestID(ss.Context())
+			return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		},
+	}
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDMetadataKey); len(ids) > 0 && ValidRequestID(ids[0]) {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id = NewRequestID()
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, id))
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request id of the RPC, empty outside of
+// one.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ValidRequestID reports whether id may be accepted from a caller: it is
+// printable ASCII of bounded length.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID returns a random request id.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// contextLogger returns l tagging entries with the request id of the RPC, if
+// any.
+func contextLogger(ctx context.Context, l palermo.Logger) palermo.Logger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return l.With(palermo.Fields{"request_id": id})
+	}
+	return l
+}
+
+// contextStream overrides the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,176 @@
+// Package server builds gRPC servers serving palermo services, with the
+// interceptors of the palermo server.
+//
+// Embedders pick the built-in interceptors (request ids, logging, metrics,
+// panic recovery), register their own and choose the order in which they
+// wrap the RPCs through Options, instead of hard-wiring grpc.NewServer:
+//
+//	srv, err := server.NewServer(&server.Options{
+//		Logger:       logger,
+//		Interceptors: []server.Interceptor{authz},
+//		Order:        []string{server.RequestIDInterceptor, server.RecoveryInterceptor, "authz"},
+//	})
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-toschool/palermo"
+	"google.golang.org/grpc"
+)
+
+// Names of the built-in interceptors.
+const (
+	RequestIDInterceptor = "request-id"
+	LoggingInterceptor   = "logging"
+	MetricsInterceptor   = "metrics"
+	RecoveryInterceptor  = "recovery"
+)
+
+// DefaultOrder is the order of the built-in interceptors when Options.Order
+// is nil, the first being the outermost. Metrics sit above the recovery so
+// that panics are counted as INTERNAL errors.
+var DefaultOrder = []string{
+	RequestIDInterceptor,
+	LoggingInterceptor,
+	MetricsInterceptor,
+	RecoveryInterceptor,
+}
+
+// Interceptor intercepts the unary and streaming RPCs of a server. Either
+// may be nil when it only applies to one kind of RPCs.
+type Interceptor struct {
+	// Name identifies the interceptor in Options.Order.
+	Name string
+
+	Unary  grpc.UnaryServerInterceptor
+	Stream grpc.StreamServerInterceptor
+}
+
+// Options configures the server and its interceptors.
+type Options struct {
+	// Logger receives the logs of the built-in interceptors. Defaults to
+	// palermo.NopLogger.
+	Logger palermo.Logger
+
+	// Metrics records the RPCs intercepted by the metrics interceptor.
+	// Defaults to palermo.NopMetrics.
+	Metrics palermo.Metrics
+
+	// Interceptors are registered along the built-in ones. They run inside
+	// the built-in ones, in order, unless Order says otherwise.
+	Interceptors []Interceptor
+
+	// Order names the enabled interceptors, built-in and registered alike,
+	// the first being the outermost. Interceptors it does not name are
+	// disabled. Defaults to DefaultOrder followed by Interceptors.
+	Order []string
+
+	// ServerOptions are given to grpc.NewServer, e.g. the transport
+	// credentials. Interceptor options are set by NewServer and must not be
+	// given.
+	ServerOptions []grpc.ServerOption
+}
+
+// NewServer returns a gRPC server running the interceptors of o.
+func NewServer(o *Options) (*grpc.Server, error) {
+	unary, stream, err := o.Chain()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := append([]grpc.ServerOption{
+		grpc.UnaryInterceptor(unary),
+		grpc.StreamInterceptor(stream),
+	}, o.ServerOptions...)
+	return grpc.NewServer(opts...), nil
+}
+
+// Chain returns the interceptors of o chained in order, e.g. to run the
+// unary ones in front of an HTTP gateway as well. It fails when Order names
+// an unknown interceptor or names one twice.
+func (o *Options) Chain() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor, error) {
+	available := map[string]Interceptor{
+		RequestIDInterceptor: RequestID(),
+		LoggingInterceptor:   Logging(o.logger()),
+		MetricsInterceptor:   Metrics(o.metrics()),
+		RecoveryInterceptor:  Recovery(o.logger()),
+	}
+	for _, i := range o.Interceptors {
+		if _, ok := available[i.Name]; ok || i.Name == "" {
+			return nil, nil, fmt.Errorf("server: invalid or duplicate interceptor name %q", i.Name)
+		}
+		available[i.Name] = i
+	}
+
+	order := o.Order
+	if order == nil {
+		order = append([]string(nil), DefaultOrder...)
+		for _, i := range o.Interceptors {
+			order = append(order, i.Name)
+		}
+	}
+
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	for _, name := range order {
+		i, ok := available[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("server: unknown or duplicate interceptor %q in order", name)
+		}
+		delete(available, name)
+
+		if i.Unary != nil {
+			unary = append(unary, i.Unary)
+		}
+		if i.Stream != nil {
+			stream = append(stream, i.Stream)
+		}
+	}
+	return ChainUnary(unary...), ChainStream(stream...), nil
+}
+
+func (o *Options) logger() palermo.Logger {
+	if o.Logger == nil {
+		return palermo.NopLogger{}
+	}
+	return o.Logger
+}
+
+func (o *Options) metrics() palermo.Metrics {
+	if o.Metrics == nil {
+		return palermo.NopMetrics{}
+	}
+	return o.Metrics
+}
+
+// ChainUnary returns an interceptor running the given ones in order, the
+// first being the outermost, as the gRPC server takes a single unary
+// interceptor.
+func ChainUnary(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// ChainStream is the streaming counterpart of ChainUnary.
+func ChainStream(interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, h)
+			}
+		}
+		return next(srv, ss)
+	}
+}
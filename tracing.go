@@ -0,0 +1,34 @@
+package palermo
+
+import "context"
+
+// Tracer starts trace spans. Like Metrics, it keeps the core packages
+// independent from the tracing backend (OpenTelemetry, Zipkin...).
+type Tracer interface {
+	// Start starts a span named name, child of the span carried by ctx if
+	// any, and returns a context carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	// SetAttribute annotates the span.
+	SetAttribute(key, value string)
+
+	// End ends the span, marking it failed when err is not nil.
+	End(err error)
+}
+
+// NopTracer is a Tracer implementation that records nothing.
+type NopTracer struct{}
+
+// Start returns ctx and a span recording nothing.
+func (NopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key, value string) {}
+
+func (nopSpan) End(err error) {}
@@ -0,0 +1,68 @@
+// Package tracing implements a palermo.SessionService decorator tracing every
+// call to the decorated service, whatever its implementation.
+package tracing
+
+import (
+	"context"
+
+	"github.com/go-toschool/palermo"
+)
+
+// SessionService decorates a palermo.SessionService with a span per call.
+type SessionService struct {
+	palermo.SessionService
+
+	// Tracer starts the spans.
+	Tracer palermo.Tracer
+
+	// Backend names the decorated implementation in the spans, e.g. "jwt".
+	Backend string
+}
+
+// Session validates the given credentials through the backend.
+func (s *SessionService) Session(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	ctx, span := s.start(ctx, "Session")
+	us, err := s.SessionService.Session(ctx, c)
+	span.End(err)
+	return us, err
+}
+
+// RefreshSession refreshes the given credentials through the backend.
+func (s *SessionService) RefreshSession(ctx context.Context, c *palermo.SessionCredentials) (*palermo.Session, error) {
+	ctx, span := s.start(ctx, "RefreshSession")
+	us, err := s.SessionService.RefreshSession(ctx, c)
+	span.End(err)
+	return us, err
+}
+
+// CreateSession creates credentials through the backend.
+func (s *SessionService) CreateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	ctx, span := s.start(ctx, "CreateSession")
+	c, err := s.SessionService.CreateSession(ctx, us)
+	span.End(err)
+	return c, err
+}
+
+// UpdateSession creates credentials through the backend.
+func (s *SessionService) UpdateSession(ctx context.Context, us *palermo.Session) (*palermo.SessionCredentials, error) {
+	ctx, span := s.start(ctx, "UpdateSession")
+	c, err := s.SessionService.UpdateSession(ctx, us)
+	span.End(err)
+	return c, err
+}
+
+// RevokeSession revokes the given credentials through the backend.
+func (s *SessionService) RevokeSession(ctx context.Context, c *palermo.SessionCredentials) error {
+	ctx, span := s.start(ctx, "RevokeSession")
+	err := s.SessionService.RevokeSession(ctx, c)
+	span.End(err)
+	return err
+}
+
+func (s *SessionService) start(ctx context.Context, method string) (context.Context, palermo.Span) {
+	ctx, span := s.Tracer.Start(ctx, "palermo.SessionService/"+method)
+	if s.Backend != "" {
+		span.SetAttribute("palermo.backend", s.Backend)
+	}
+	return ctx, span
+}
@@ -0,0 +1,109 @@
+// Package vault implements palermo.SecretProvider reading secrets from the
+// KV secrets engine of HashiCorp Vault, version 1 or 2.
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultField is the field of the secret holding its value when no Field is
+// set.
+const DefaultField = "secret"
+
+// ErrSecretNotFound is returned when the path or the field of the secret does
+// not exist.
+var ErrSecretNotFound = errors.New("vault: secret not found")
+
+// SecretProvider reads a secret from Vault.
+type SecretProvider struct {
+	// Address is the URL of the Vault server, e.g. https://vault:8200.
+	Address string
+
+	// Token authenticates the requests.
+	Token string
+
+	// Path is the path of the secret, including the mount, e.g.
+	// secret/data/palermo for a KV version 2 engine mounted at secret/.
+	Path string
+
+	// Field is the field of the secret holding its value. Defaults to
+	// DefaultField.
+	Field string
+
+	// Client reads the secret. Defaults to a client with a 10 seconds
+	// timeout.
+	Client *http.Client
+}
+
+type response struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// kvV2Data is the data of a KV version 2 secret, holding its fields along
+// with their metadata.
+type kvV2Data struct {
+	Data     map[string]interface{} `json:"data"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// Secret fetches the value of the secret.
+func (sp *SecretProvider) Secret(ctx context.Context) ([]byte, error) {
+	url := strings.TrimSuffix(sp.Address, "/") + "/v1/" + strings.TrimPrefix(sp.Path, "/")
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", sp.Token)
+
+	resp, err := sp.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault: reading %s: %s", sp.Path, resp.Status)
+	}
+
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	var v2 kvV2Data
+	if err := json.Unmarshal(r.Data, &v2); err == nil && v2.Data != nil && v2.Metadata != nil {
+		fields = v2.Data
+	} else if err := json.Unmarshal(r.Data, &fields); err != nil {
+		return nil, err
+	}
+
+	v, ok := fields[sp.field()].(string)
+	if !ok || v == "" {
+		return nil, ErrSecretNotFound
+	}
+	return []byte(v), nil
+}
+
+func (sp *SecretProvider) field() string {
+	if sp.Field == "" {
+		return DefaultField
+	}
+	return sp.Field
+}
+
+func (sp *SecretProvider) client() *http.Client {
+	if sp.Client == nil {
+		return &http.Client{Timeout: 10 * time.Second}
+	}
+	return sp.Client
+}
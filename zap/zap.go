@@ -0,0 +1,63 @@
+// Package zap implements palermo.Logger using zap.
+package zap
+
+import (
+	"sort"
+
+	"github.com/go-toschool/palermo"
+	uzap "go.uber.org/zap"
+)
+
+// Logger implements palermo.Logger on top of a zap logger.
+type Logger struct {
+	Logger *uzap.Logger
+}
+
+// NewLogger returns a logger writing to l. When l is nil the zap global
+// logger is used.
+func NewLogger(l *uzap.Logger) *Logger {
+	if l == nil {
+		l = uzap.L()
+	}
+	return &Logger{Logger: l}
+}
+
+// Debug logs msg at the debug level.
+func (l *Logger) Debug(msg string, fields palermo.Fields) {
+	l.Logger.Debug(msg, zapFields(fields)...)
+}
+
+// Info logs msg at the info level.
+func (l *Logger) Info(msg string, fields palermo.Fields) {
+	l.Logger.Info(msg, zapFields(fields)...)
+}
+
+// Warn logs msg at the warning level.
+func (l *Logger) Warn(msg string, fields palermo.Fields) {
+	l.Logger.Warn(msg, zapFields(fields)...)
+}
+
+// Error logs msg at the error level.
+func (l *Logger) Error(msg string, fields palermo.Fields) {
+	l.Logger.Error(msg, zapFields(fields)...)
+}
+
+// With returns a logger adding fields to every entry.
+func (l *Logger) With(fields palermo.Fields) palermo.Logger {
+	return &Logger{Logger: l.Logger.With(zapFields(fields)...)}
+}
+
+// zapFields converts fields, sorted by key so entries are stable.
+func zapFields(fields palermo.Fields) []uzap.Field {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	zf := make([]uzap.Field, len(keys))
+	for i, k := range keys {
+		zf[i] = uzap.Any(k, fields[k])
+	}
+	return zf
+}
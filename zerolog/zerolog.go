@@ -0,0 +1,42 @@
+// Package zerolog implements palermo.Logger using zerolog.
+package zerolog
+
+import (
+	"github.com/go-toschool/palermo"
+	zl "github.com/rs/zerolog"
+)
+
+// Logger implements palermo.Logger on top of a zerolog logger.
+type Logger struct {
+	Logger zl.Logger
+}
+
+// NewLogger returns a logger writing to l.
+func NewLogger(l zl.Logger) *Logger {
+	return &Logger{Logger: l}
+}
+
+// Debug logs msg at the debug level.
+func (l *Logger) Debug(msg string, fields palermo.Fields) {
+	l.Logger.Debug().Fields(fields).Msg(msg)
+}
+
+// Info logs msg at the info level.
+func (l *Logger) Info(msg string, fields palermo.Fields) {
+	l.Logger.Info().Fields(fields).Msg(msg)
+}
+
+// Warn logs msg at the warning level.
+func (l *Logger) Warn(msg string, fields palermo.Fields) {
+	l.Logger.Warn().Fields(fields).Msg(msg)
+}
+
+// Error logs msg at the error level.
+func (l *Logger) Error(msg string, fields palermo.Fields) {
+	l.Logger.Error().Fields(fields).Msg(msg)
+}
+
+// With returns a logger adding fields to every entry.
+func (l *Logger) With(fields palermo.Fields) palermo.Logger {
+	return &Logger{Logger: l.Logger.With().Fields(fields).Logger()}
+}